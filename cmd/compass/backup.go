@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// runBackupCommand handles `compass backup [--project id] [--output path]
+// [--reason text] [--json]` and `compass backup list [--json]`
+func runBackupCommand(args []string) int {
+	if len(args) > 0 && args[0] == "list" {
+		return runBackupList(args[1:])
+	}
+
+	flags := flag.NewFlagSet("compass backup", flag.ContinueOnError)
+	projectID := flags.String("project", "", "only back up this project (JSON storage only)")
+	output := flags.String("output", "", "write the archive here instead of .compass/backups")
+	reason := flags.String("reason", "", "note stored with the snapshot")
+	asJSON := flags.Bool("json", false, "print the snapshot as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	snapshot, err := storage.CreateSnapshot(cwd, storage.SnapshotOptions{ProjectID: *projectID, Reason: *reason, Output: *output})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(snapshot, "", "  ")
+		fmt.Println(string(output))
+		return 0
+	}
+	fmt.Printf("Saved %d files (%s) to %s\n", snapshot.Files, formatSize(snapshot.Size), snapshot.Path)
+	return 0
+}
+
+func runBackupList(args []string) int {
+	flags := flag.NewFlagSet("compass backup list", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the snapshots as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	snapshots, err := storage.ListSnapshots(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(snapshots, "", "  ")
+		fmt.Println(string(output))
+		return 0
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots in .compass/backups.")
+		return 0
+	}
+	for _, snapshot := range snapshots {
+		fmt.Printf("%-60s %8s  %s\n", snapshot.Name, formatSize(snapshot.Size), describeSnapshot(snapshot))
+	}
+	return 0
+}
+
+// runRestoreCommand handles `compass restore <snapshot>`, where snapshot is
+// a name from `compass backup list` or a path to an archive
+func runRestoreCommand(args []string) int {
+	flags := flag.NewFlagSet("compass restore", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: compass restore [--json] <snapshot>")
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	result, err := storage.RestoreSnapshot(cwd, storage.ResolveSnapshot(cwd, flags.Arg(0)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(output))
+		return 0
+	}
+	fmt.Printf("Restored %d files from %s (%s).\n", result.Files, result.Restored.Name, describeSnapshot(result.Restored))
+	fmt.Printf("The previous state was saved to %s; restore it to undo.\n", result.Safety.Name)
+	if result.Restored.Backend == storage.BackendSQLite {
+		fmt.Println("Restart any running compass servers so they reopen the restored database.")
+	}
+	return 0
+}
+
+func describeSnapshot(snapshot *domain.Snapshot) string {
+	text := snapshot.CreatedAt.Local().Format("2006-01-02 15:04:05")
+	if snapshot.ProjectID != "" {
+		text += ", project " + snapshot.ProjectID
+	}
+	if snapshot.Automatic {
+		text += ", automatic"
+	}
+	if snapshot.Reason != "" {
+		text += ", " + snapshot.Reason
+	}
+	return text
+}
+
+func formatSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", bytes)
+	}
+}
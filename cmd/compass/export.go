@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rcliao/compass/internal/importer"
+	"github.com/rcliao/compass/internal/service"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// runExportCommand handles `compass export [--project id] [--format f]
+// [--output path]`. Without --output the export is written to stdout.
+func runExportCommand(args []string) int {
+	flags := flag.NewFlagSet("compass export", flag.ContinueOnError)
+	projectID := flags.String("project", "", "project to export (defaults to the current project)")
+	format := flags.String("format", service.ExportFormatJSON, "json, csv or markdown")
+	output := flags.String("output", "", "write the export to this file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	store, err := storage.Open(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer closeStore(store)
+
+	if *projectID == "" {
+		current, err := store.GetCurrentProject()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: no current project set; pass --project")
+			return 2
+		}
+		*projectID = current.ID
+	}
+
+	exportService := service.NewExportService(store)
+	bundle, err := exportService.Export(*projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	data, err := exportService.Encode(bundle, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Exported %s (%d tasks) to %s\n", bundle.Project.Name, len(bundle.Tasks), *output)
+	return 0
+}
+
+// runImportCommand handles `compass import [--name n] [--json] <bundle.json>`
+// and `compass import github|jira ...`
+func runImportCommand(args []string) int {
+	if len(args) > 0 && (args[0] == importer.SourceGitHub || args[0] == importer.SourceJira) {
+		return runImportIssues(args[0], args[1:])
+	}
+
+	flags := flag.NewFlagSet("compass import", flag.ContinueOnError)
+	name := flags.String("name", "", "name for the imported project (defaults to the exported name)")
+	asJSON := flags.Bool("json", false, "print the result, including the ID map, as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: compass import [--name name] [--json] <bundle.json>")
+		return 2
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	bundle, err := service.DecodeProjectBundle(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	store, err := storage.Open(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer closeStore(store)
+
+	result, err := service.NewExportService(store).Import(bundle, *name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(output))
+		return 0
+	}
+	fmt.Printf("Imported %s as project %s: %d tasks, %d decisions, %d discoveries, %d planning sessions, %d processes.\n",
+		result.Project.Name, result.Project.ID, result.Tasks, result.Decisions, result.Discoveries, result.PlanningSessions, result.Processes)
+	if result.Dropped > 0 {
+		fmt.Printf("Dropped %d references to entities outside the exported project.\n", result.Dropped)
+	}
+	return 0
+}
+
+// runImportIssues handles `compass import github|jira [--project id]
+// [--repo owner/name] [--dry-run] [--json] <export>`
+func runImportIssues(source string, args []string) int {
+	flags := flag.NewFlagSet("compass import "+source, flag.ContinueOnError)
+	projectID := flags.String("project", "", "project to import into (defaults to the current project)")
+	repo := flags.String("repo", "", "owner/name for GitHub exports without issue URLs")
+	dryRun := flags.Bool("dry-run", false, "show what would be created or updated without writing")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: compass import %s [--project id] [--repo owner/name] [--dry-run] [--json] <export>\n", source)
+		return 2
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	issues, err := importer.Parse(source, data, importer.Options{Repo: *repo})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	store, err := storage.Open(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer closeStore(store)
+
+	if *projectID == "" {
+		current, err := store.GetCurrentProject()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: no current project set; pass --project")
+			return 2
+		}
+		*projectID = current.ID
+	}
+
+	result, err := service.NewIssueImportService(store).Import(*projectID, source, issues, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(output))
+		return 0
+	}
+	for _, item := range result.Items {
+		if item.Action != "unchanged" {
+			fmt.Printf("%-9s %-20s %s\n", item.Action, item.Ref.Key, item.Title)
+		}
+	}
+	verb := "Imported"
+	if result.DryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d issues: %d created, %d updated, %d unchanged.\n", verb, len(result.Items), result.Created, result.Updated, result.Unchanged)
+	return 0
+}
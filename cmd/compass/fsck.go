@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// runFsckCommand handles `compass fsck [--repair] [--json]`. It exits
+// non-zero while any issue remains unrepaired.
+func runFsckCommand(args []string) int {
+	flags := flag.NewFlagSet("compass fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "back up .compass and fix the issues that have a safe repair")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	store, err := storage.Open(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer closeStore(store)
+
+	report, err := store.Check(*repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+	} else {
+		printCheckReport(report)
+	}
+	if report.Outstanding() > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printCheckReport(report *domain.CheckReport) {
+	for _, issue := range report.Issues {
+		where := issue.Path
+		if where == "" && issue.ID != "" {
+			where = issue.Entity + " " + issue.ID
+		}
+		state := ""
+		switch {
+		case issue.Repaired:
+			state = " (repaired)"
+		case issue.Repairable:
+			state = " (repairable)"
+		}
+		if where != "" {
+			where += ": "
+		}
+		fmt.Printf("%-7s %-24s %s%s%s\n", issue.Severity, issue.Code, where, issue.Message, state)
+	}
+
+	if len(report.Issues) == 0 {
+		fmt.Printf("No issues found in the %s storage.\n", report.Backend)
+		return
+	}
+	fmt.Printf("%d errors, %d warnings", report.Count(domain.SeverityError), report.Count(domain.SeverityWarning))
+	if report.Repaired > 0 {
+		fmt.Printf("; repaired %d, backup in %s", report.Repaired, report.Backup)
+	} else if repairable := countRepairable(report); repairable > 0 {
+		fmt.Printf("; run `compass fsck --repair` to fix %d", repairable)
+	}
+	fmt.Println(".")
+}
+
+func countRepairable(report *domain.CheckReport) int {
+	count := 0
+	for _, issue := range report.Issues {
+		if issue.Repairable && !issue.Repaired {
+			count++
+		}
+	}
+	return count
+}
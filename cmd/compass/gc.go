@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/service"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// runGCCommand handles `compass gc [--dry-run] [--json]`, which applies the
+// retention policy from .compass/config.json
+func runGCCommand(args []string) int {
+	flags := flag.NewFlagSet("compass gc", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "show what would be archived and deleted without changing anything")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: compass gc [--dry-run] [--json]")
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	config, err := storage.ReadConfig(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var policy domain.RetentionPolicy
+	if config.Retention != nil {
+		policy = *config.Retention
+	}
+
+	store, err := storage.Open(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer closeStore(store)
+
+	adminService := service.NewAdminService(store, storage.NewSnapshotter(cwd))
+	report, err := service.NewRetentionService(store, adminService).Collect(policy, time.Now(), *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+		return 0
+	}
+	switch {
+	case report.Empty():
+		fmt.Println("Nothing to collect.")
+	case report.DryRun:
+		fmt.Printf("Would archive %d tasks and %d planning sessions and delete %d process log entries.\n",
+			len(report.ArchivedTasks), len(report.ArchivedSessions), report.PrunedLogs)
+	default:
+		fmt.Printf("Archived %d tasks and %d planning sessions; deleted %d process log entries.\n",
+			len(report.ArchivedTasks), len(report.ArchivedSessions), report.PrunedLogs)
+		if report.Safety != nil {
+			fmt.Printf("The previous state is in %s.\n", report.Safety.Path)
+		}
+	}
+	return 0
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -16,10 +17,34 @@ import (
 )
 
 func main() {
-	// Check for CLI mode flag
-	if len(os.Args) > 1 && os.Args[1] == "--cli" {
-		runCLI()
-		return
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "--cli":
+			runCLI()
+			return
+		case "storage":
+			os.Exit(runStorageCommand(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrateCommand(os.Args[2:]))
+		case "merge-driver":
+			os.Exit(runMergeDriverCommand(os.Args[2:]))
+		case "fsck":
+			os.Exit(runFsckCommand(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackupCommand(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestoreCommand(os.Args[2:]))
+		case "export":
+			os.Exit(runExportCommand(os.Args[2:]))
+		case "import":
+			os.Exit(runImportCommand(os.Args[2:]))
+		case "sync":
+			os.Exit(runSyncCommand(os.Args[2:]))
+		case "gc":
+			os.Exit(runGCCommand(os.Args[2:]))
+		case "secret":
+			os.Exit(runSecretCommand(os.Args[2:]))
+		}
 	}
 
 	// Default to MCP transport mode
@@ -33,31 +58,40 @@ func runMCPTransport() {
 		log.Fatal("Failed to get current directory:", err)
 	}
 
-	// Initialize storage
-	fileStorage, err := storage.NewFileStorage(cwd)
+	// Initialize the storage backend selected in .compass/config.json
+	store, err := storage.Open(cwd)
 	if err != nil {
-		log.Fatal("Failed to initialize file storage:", err)
+		log.Fatal("Failed to initialize storage:", err)
 	}
 
 	// Initialize services
-	taskService := service.NewTaskService(fileStorage)
-	projectService := service.NewProjectService(fileStorage)
-	contextRetriever := service.NewContextRetriever(fileStorage, fileStorage)
-	planningService := service.NewPlanningService(fileStorage, taskService, projectService)
+	taskService := service.NewTaskService(store)
+	projectService := service.NewProjectService(store)
+	contextRetriever := service.NewContextRetriever(store, store)
+	planningService := service.NewPlanningService(store, taskService, projectService)
 	summaryService := service.NewProjectSummaryService(taskService, projectService, planningService)
 	
 	// Initialize new process orchestrator
 	orchestratorConfig := service.DefaultProcessOrchestratorConfig()
 	orchestratorConfig.DefaultWorkingDir = cwd
-	processOrchestrator := service.NewProcessOrchestrator(fileStorage, orchestratorConfig)
+	orchestratorConfig.Secrets = storage.NewSecretStore(cwd, "")
+	processOrchestrator := service.NewProcessOrchestrator(store, orchestratorConfig)
 	
 	// Start the orchestrator
 	if err := processOrchestrator.Initialize(); err != nil {
 		log.Fatal("Failed to start process orchestrator:", err)
 	}
 
+	boardService := service.NewBoardService(taskService, projectService)
+	leaseService := service.NewLeaseService(taskService)
+	adminService := service.NewAdminService(store, storage.NewSnapshotter(cwd))
+	exportService := service.NewExportService(store)
+	issueImportService := service.NewIssueImportService(store)
+	batchService := service.NewBatchService(store)
+
 	// Initialize MCP server
-	mcpServer := mcp.NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService, processOrchestrator)
+	mcpServer := mcp.NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService, processOrchestrator, boardService, leaseService, adminService, exportService, issueImportService, batchService)
+	mcpServer.SetAgentLabel(os.Getenv("COMPASS_AGENT_LABEL"))
 
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -68,15 +102,41 @@ func runMCPTransport() {
 		log.Println("Main: Received shutdown signal, cleaning up...")
 		log.Println("Main: Calling mcpServer.Shutdown()...")
 		mcpServer.Shutdown()
+		closeStore(store)
 		log.Println("Main: Shutdown complete, exiting...")
 		os.Exit(0)
 	}()
 
 	// Start MCP transport
 	transport := mcp.NewMCPTransport(mcpServer)
+
+	// Follow changes made to .compass by other instances and by hand, so
+	// caches do not go stale and subscribed clients hear about them
+	if watcher, err := storage.Watch(cwd, storage.DefaultWatchInterval); err != nil {
+		log.Println("Change detection disabled:", err)
+	} else {
+		defer watcher.Close()
+		go func() {
+			for changes := range watcher.Changes {
+				transport.NotifyResourcesUpdated(mcpServer.ApplyStorageChanges(changes))
+			}
+		}()
+	}
+
 	if err := transport.Start(); err != nil {
 		log.Fatal("MCP transport error:", err)
 	}
+	closeStore(store)
+}
+
+// closeStore flushes backends that buffer writes, such as the task journal
+// of the JSON backend
+func closeStore(store storage.Store) {
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Println("Failed to close storage:", err)
+		}
+	}
 }
 
 func runCLI() {
@@ -86,31 +146,41 @@ func runCLI() {
 		log.Fatal("Failed to get current directory:", err)
 	}
 
-	// Initialize storage
-	fileStorage, err := storage.NewFileStorage(cwd)
+	// Initialize the storage backend selected in .compass/config.json
+	store, err := storage.Open(cwd)
 	if err != nil {
-		log.Fatal("Failed to initialize file storage:", err)
+		log.Fatal("Failed to initialize storage:", err)
 	}
 
 	// Initialize services
-	taskService := service.NewTaskService(fileStorage)
-	projectService := service.NewProjectService(fileStorage)
-	contextRetriever := service.NewContextRetriever(fileStorage, fileStorage)
-	planningService := service.NewPlanningService(fileStorage, taskService, projectService)
+	taskService := service.NewTaskService(store)
+	projectService := service.NewProjectService(store)
+	contextRetriever := service.NewContextRetriever(store, store)
+	planningService := service.NewPlanningService(store, taskService, projectService)
 	summaryService := service.NewProjectSummaryService(taskService, projectService, planningService)
 	
 	// Initialize new process orchestrator
 	orchestratorConfig := service.DefaultProcessOrchestratorConfig()
 	orchestratorConfig.DefaultWorkingDir = cwd
-	processOrchestrator := service.NewProcessOrchestrator(fileStorage, orchestratorConfig)
+	orchestratorConfig.Secrets = storage.NewSecretStore(cwd, "")
+	processOrchestrator := service.NewProcessOrchestrator(store, orchestratorConfig)
 	
 	// Start the orchestrator
 	if err := processOrchestrator.Initialize(); err != nil {
 		log.Fatal("Failed to start process orchestrator:", err)
 	}
 
+	boardService := service.NewBoardService(taskService, projectService)
+	leaseService := service.NewLeaseService(taskService)
+	adminService := service.NewAdminService(store, storage.NewSnapshotter(cwd))
+	exportService := service.NewExportService(store)
+	issueImportService := service.NewIssueImportService(store)
+	batchService := service.NewBatchService(store)
+
 	// Initialize MCP server
-	mcpServer := mcp.NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService, processOrchestrator)
+	mcpServer := mcp.NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService, processOrchestrator, boardService, leaseService, adminService, exportService, issueImportService, batchService)
+	mcpServer.SetClientInfo("compass-cli", "")
+	mcpServer.SetAgentLabel(os.Getenv("COMPASS_AGENT_LABEL"))
 
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -120,6 +190,7 @@ func runCLI() {
 		<-sigChan
 		fmt.Println("\nReceived shutdown signal, cleaning up...")
 		mcpServer.Shutdown()
+		closeStore(store)
 		fmt.Println("Goodbye!")
 		os.Exit(0)
 	}()
@@ -152,6 +223,7 @@ func runCLI() {
 
 		handleCommand(mcpServer, input)
 	}
+	closeStore(store)
 }
 
 func printHelp() {
@@ -165,6 +237,18 @@ func printHelp() {
 	fmt.Println("    compass.project.list         - List all projects")
 	fmt.Println("    compass.project.current      - Get current project")
 	fmt.Println("    compass.project.set_current  - Set current project")
+	fmt.Println("    compass.project.export       - Export a project as JSON, CSV or Markdown")
+	fmt.Println("    compass.project.import       - Import a project bundle as a new project")
+	fmt.Println("    compass.import.issues        - Import GitHub or Jira issue exports as tasks")
+	fmt.Println()
+	fmt.Println("  Agent commands:")
+	fmt.Println("    compass.agent.whoami         - Show the identity stamped onto changes")
+	fmt.Println("    compass.agent.set_label      - Name this session's agent")
+	fmt.Println()
+	fmt.Println("  Focus commands:")
+	fmt.Println("    compass.focus.set            - Declare the task you are working on")
+	fmt.Println("    compass.focus.get            - Show the current focus task")
+	fmt.Println("    compass.focus.clear          - Clear the focus task")
 	fmt.Println()
 	fmt.Println("  Task commands:")
 	fmt.Println("    compass.task.create          - Create a new task")
@@ -172,6 +256,9 @@ func printHelp() {
 	fmt.Println("    compass.task.get             - Get a specific task")
 	fmt.Println("    compass.task.update          - Update a task")
 	fmt.Println("    compass.task.delete          - Delete a task")
+	fmt.Println("    compass.task.claim           - Lease a task to an agent")
+	fmt.Println("    compass.task.heartbeat       - Renew a task lease")
+	fmt.Println("    compass.task.release         - Release a task lease")
 	fmt.Println()
 	fmt.Println("  Context commands:")
 	fmt.Println("    compass.context.get          - Get full context for a task")
@@ -182,6 +269,10 @@ func printHelp() {
 	fmt.Println("    compass.next                 - Get next recommended task")
 	fmt.Println("    compass.blockers             - Get all blocked tasks")
 	fmt.Println()
+	fmt.Println("  Board commands:")
+	fmt.Println("    compass.board                - Show tasks grouped into status columns")
+	fmt.Println("    compass.board.limits         - Set per-status WIP limits and policy")
+	fmt.Println()
 	fmt.Println("  Planning commands:")
 	fmt.Println("    compass.planning.start       - Start a new planning session")
 	fmt.Println("    compass.planning.list        - List planning sessions")
@@ -198,6 +289,13 @@ func printHelp() {
 	fmt.Println("  Summary commands:")
 	fmt.Println("    compass.project.summary      - Generate intelligent project summary and insights")
 	fmt.Println()
+	fmt.Println("  Admin commands:")
+	fmt.Println("    compass.admin.check          - Check storage integrity and optionally repair it")
+	fmt.Println("    compass.admin.snapshot       - Take a snapshot of the workspace")
+	fmt.Println()
+	fmt.Println("  Batch commands:")
+	fmt.Println("    compass.batch                - Apply several commands all or nothing")
+	fmt.Println()
 	fmt.Println("  Process commands:")
 	fmt.Println("    compass.process.create       - Create a new process")
 	fmt.Println("    compass.process.start        - Start a process")
@@ -227,6 +325,7 @@ func printHelp() {
 	fmt.Println("  compass.task.create {\"projectId\":\"<project-id>\",\"title\":\"Setup\",\"description\":\"Initial setup\"}")
 	fmt.Println("  compass.context.search {\"query\":\"authentication\",\"limit\":5}")
 	fmt.Println("  compass.next {}")
+	fmt.Println("  compass.board.limits {\"limits\":{\"in-progress\":3},\"policy\":\"reject\"}")
 	fmt.Println("  compass.context.get {\"taskId\":\"<task-id>\"}")
 	fmt.Println("  compass.planning.start {\"name\":\"Sprint Planning\"}")
 	fmt.Println("  compass.discovery.add {\"insight\":\"Users prefer OAuth\",\"impact\":\"high\",\"source\":\"research\"}")
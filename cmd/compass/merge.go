@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rcliao/compass/internal/merge"
+)
+
+// gitAttributes routes the .compass data files through the compass driver.
+// Of the JSON Lines files only task history is merged line by line; task
+// journals must be compacted before committing and process logs are not
+// shared.
+var gitAttributes = []string{
+	".compass/**/*.json merge=compass",
+	".compass/**/history/*.jsonl merge=compass",
+}
+
+// staleGitAttributes are entries earlier versions wrote that would route
+// task journals through the driver; install removes them
+var staleGitAttributes = map[string]bool{
+	".compass/**/*.jsonl merge=compass": true,
+}
+
+func mergeDriverUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  compass merge-driver <base> <ours> <theirs> [path]   Merge .compass files (run by git)")
+	fmt.Fprintln(os.Stderr, "  compass merge-driver install [--command compass]    Register the driver and write .gitattributes")
+}
+
+// runMergeDriverCommand handles `compass merge-driver ...` and returns the
+// exit code. As a git merge driver it writes the result over <ours> and
+// exits non-zero when conflicts remain, as git expects.
+func runMergeDriverCommand(args []string) int {
+	if len(args) > 0 && args[0] == "install" {
+		return runMergeDriverInstall(args[1:])
+	}
+	if len(args) < 3 || len(args) > 4 {
+		mergeDriverUsage()
+		return 2
+	}
+
+	basePath, oursPath, theirsPath := args[0], args[1], args[2]
+	path := oursPath
+	if len(args) == 4 {
+		path = args[3]
+	}
+
+	var files [3][]byte
+	for i, name := range []string{basePath, oursPath, theirsPath} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "compass merge-driver: %v\n", err)
+			return 2
+		}
+		files[i] = data
+	}
+
+	result, err := merge.Files(path, files[0], files[1], files[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compass merge-driver: %s: %v\n", path, err)
+		return 2
+	}
+	if err := os.WriteFile(oursPath, result.Data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "compass merge-driver: %v\n", err)
+		return 2
+	}
+
+	if len(result.Conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "compass merge-driver: %s: conflicting changes to %s\n", path, strings.Join(result.Conflicts, ", "))
+		return 1
+	}
+	return 0
+}
+
+// runMergeDriverInstall registers the driver in the repository's git config
+// and adds the .gitattributes entries that are not there yet
+func runMergeDriverInstall(args []string) int {
+	flags := flag.NewFlagSet("compass merge-driver install", flag.ContinueOnError)
+	command := flags.String("command", "compass", "how git should invoke compass")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not inside a git repository: %v\n", err)
+		return 1
+	}
+
+	driver := *command + " merge-driver %O %A %B %P"
+	for _, setting := range [][2]string{
+		{"merge.compass.name", "Compass field-level merge for .compass files"},
+		{"merge.compass.driver", driver},
+	} {
+		if _, err := gitOutput("config", setting[0], setting[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: git config %s: %v\n", setting[0], err)
+			return 1
+		}
+	}
+
+	added, err := appendGitAttributes(filepath.Join(root, ".gitattributes"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Registered merge driver: %s\n", driver)
+	if added == 0 {
+		fmt.Println(".gitattributes already routes .compass files to the driver.")
+	} else {
+		fmt.Printf("Added %d entries to .gitattributes; commit it so the whole team uses the driver.\n", added)
+	}
+	return 0
+}
+
+func appendGitAttributes(path string) (int, error) {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	present := make(map[string]bool)
+	var kept []string
+	removed := 0
+	content := strings.TrimSuffix(string(existing), "\n")
+	if content != "" {
+		for _, line := range strings.Split(content, "\n") {
+			normalized := strings.Join(strings.Fields(line), " ")
+			if staleGitAttributes[normalized] {
+				removed++
+				continue
+			}
+			present[normalized] = true
+			kept = append(kept, line)
+		}
+	}
+
+	var missing []string
+	for _, line := range gitAttributes {
+		if !present[line] {
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) == 0 && removed == 0 {
+		return 0, nil
+	}
+
+	lines := append(kept, missing...)
+	return len(missing), os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func gitOutput(args ...string) (string, error) {
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func secretUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  compass secret set <name> [--key-file path] < value")
+	fmt.Fprintln(os.Stderr, "  compass secret list [--json]")
+	fmt.Fprintln(os.Stderr, "  compass secret rm <name>")
+}
+
+// runSecretCommand handles `compass secret <action> ...`. Values are read
+// from stdin so they stay out of shell history, and are never printed.
+func runSecretCommand(args []string) int {
+	if len(args) == 0 {
+		secretUsage()
+		return 2
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("compass secret "+action, flag.ContinueOnError)
+	keyFile := flags.String("key-file", "", "key file to encrypt with (default $"+storage.SecretKeyEnv+" or the user config directory)")
+	asJSON := flags.Bool("json", false, "list only: print the names as JSON")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	// The flag package stops at the first positional argument, so flags
+	// after the name are parsed once it has been taken off
+	var name string
+	if (action == "set" || action == "rm") && flags.NArg() > 0 {
+		name = flags.Arg(0)
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return 2
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	secrets := storage.NewSecretStore(cwd, *keyFile)
+
+	switch {
+	case action == "set" && name != "" && flags.NArg() == 0:
+		value, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if err := secrets.Set(name, strings.TrimRight(string(value), "\r\n")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Stored secret %s; reference it as secret://%s.\n", name, name)
+	case action == "list" && flags.NArg() == 0:
+		names, err := secrets.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			output, _ := json.MarshalIndent(names, "", "  ")
+			fmt.Println(string(output))
+			return 0
+		}
+		if len(names) == 0 {
+			fmt.Println("No secrets stored.")
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case action == "rm" && name != "" && flags.NArg() == 0:
+		if err := secrets.Delete(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Removed secret %s.\n", name)
+	default:
+		secretUsage()
+		return 2
+	}
+	return 0
+}
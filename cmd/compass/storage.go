@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func storageUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  compass storage migrate --to sqlite   Copy the JSON layout into .compass/compass.db and switch to it")
+	fmt.Fprintln(os.Stderr, "  compass storage layout <layout>       Rewrite the JSON files as single-file or per-entity")
+	fmt.Fprintln(os.Stderr, "  compass storage compact               Fold the task journals into tasks.json")
+	fmt.Fprintln(os.Stderr, "  compass migrate [--dry-run]           Upgrade the JSON layout to the current schema version")
+}
+
+// runStorageCommand handles `compass storage ...` and returns the exit code
+func runStorageCommand(args []string) int {
+	if len(args) == 0 {
+		storageUsage()
+		return 2
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runStorageMigrate(args[1:])
+	case "layout":
+		return runStorageLayout(args[1:])
+	case "compact":
+		return runStorageCompact()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown storage command: %s\n", args[0])
+		storageUsage()
+		return 2
+	}
+}
+
+func runStorageMigrate(args []string) int {
+	flags := flag.NewFlagSet("compass storage migrate", flag.ContinueOnError)
+	to := flags.String("to", storage.BackendSQLite, "backend to migrate to (only sqlite is supported)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *to != storage.BackendSQLite {
+		fmt.Fprintf(os.Stderr, "Error: can only migrate from %s to %s\n", storage.BackendJSON, storage.BackendSQLite)
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	report, err := storage.MigrateJSONToSQLite(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+	fmt.Println("Storage switched to sqlite; the JSON files were left in place.")
+	return 0
+}
+
+// runStorageLayout handles `compass storage layout <layout>`, rewriting the
+// JSON files of the workspace into the requested layout
+func runStorageLayout(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected one layout: %s or %s\n", storage.LayoutSingleFile, storage.LayoutPerEntity)
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	report, err := storage.MigrateLayout(cwd, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+	if report.From == report.To {
+		fmt.Printf("Already using the %s layout.\n", report.To)
+		return 0
+	}
+	fmt.Printf("Switched to the %s layout; restart running compass servers. Backup in %s\n", report.To, report.Backup)
+	return 0
+}
+
+// runStorageCompact handles `compass storage compact`. Opening the JSON
+// backend already replays and compacts the task journals; closing it makes
+// sure nothing was appended in between.
+func runStorageCompact() int {
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	config, err := storage.ReadConfig(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if config.Storage == storage.BackendSQLite {
+		fmt.Println("The sqlite backend has no task journals to compact.")
+		return 0
+	}
+
+	fileStorage, err := storage.NewFileStorage(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := fileStorage.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("Task journals compacted into tasks.json.")
+	return 0
+}
+
+// runMigrateCommand handles `compass migrate [--dry-run]`, upgrading the JSON
+// layout to the current schema version
+func runMigrateCommand(args []string) int {
+	flags := flag.NewFlagSet("compass migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report the migrations and files that would change without writing anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	report, err := storage.MigrateSchema(cwd, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+	switch {
+	case len(report.Steps) == 0:
+		fmt.Printf("Already at schema version %d.\n", report.ToVersion)
+	case *dryRun:
+		fmt.Printf("Dry run: %d files would be rewritten; nothing was changed.\n", len(report.Files))
+	case report.Backup == "":
+		fmt.Printf("Migrated to schema version %d.\n", report.ToVersion)
+	default:
+		fmt.Printf("Migrated to schema version %d; backup in %s\n", report.ToVersion, report.Backup)
+	}
+	return 0
+}
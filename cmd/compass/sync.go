@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/service"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func syncUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  compass sync push [--remote origin] [--ref refs/compass/data] [--json]")
+	fmt.Fprintln(os.Stderr, "  compass sync pull [--remote origin] [--ref refs/compass/data] [--prefer ours|theirs] [--dry-run] [--json]")
+	fmt.Fprintln(os.Stderr, "  compass sync todo-md [--file TODO.md] [--project id] [--prefer file|compass] [--dry-run] [--json]")
+}
+
+// runSyncCommand handles `compass sync <mode> ...`
+func runSyncCommand(args []string) int {
+	if len(args) == 0 {
+		syncUsage()
+		return 2
+	}
+	switch args[0] {
+	case "push", "pull":
+		return runSyncGit(args[0], args[1:])
+	case "todo-md":
+		return runSyncTodoMd(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown sync mode %q\n", args[0])
+		syncUsage()
+		return 2
+	}
+}
+
+// runSyncGit handles `compass sync push` and `compass sync pull`, which
+// share the workspace's data through a git ref. A pull exits with 1 when
+// conflicts stopped it.
+func runSyncGit(mode string, args []string) int {
+	flags := flag.NewFlagSet("compass sync "+mode, flag.ContinueOnError)
+	remote := flags.String("remote", "origin", "git remote to share the data through")
+	ref := flags.String("ref", storage.DefaultSyncRef, "git ref holding the data")
+	prefer := flags.String("prefer", "", "pull only: settle conflicting files in favor of ours or theirs")
+	dryRun := flags.Bool("dry-run", false, "pull only: show what would change without writing")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || (mode == "push" && (*prefer != "" || *dryRun)) {
+		syncUsage()
+		return 2
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	opts := storage.GitSyncOptions{Remote: *remote, Ref: *ref, Prefer: *prefer, DryRun: *dryRun}
+	var report *domain.GitSync
+	if mode == "push" {
+		report, err = storage.PushToGit(cwd, opts)
+	} else {
+		report, err = storage.PullFromGit(cwd, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+	} else {
+		switch {
+		case report.UpToDate && mode == "push":
+			fmt.Printf("%s on %s is up to date.\n", report.Ref, report.Remote)
+		case report.UpToDate:
+			fmt.Printf("Nothing to pull from %s.\n", report.Remote)
+		case mode == "push":
+			fmt.Printf("Pushed %d files to %s on %s (%s).\n", report.Files, report.Ref, report.Remote, shortCommit(report.Commit))
+		default:
+			for _, name := range report.Changed {
+				fmt.Printf("updated  %s\n", name)
+			}
+			for _, name := range report.Deleted {
+				fmt.Printf("deleted  %s\n", name)
+			}
+			for _, conflict := range report.Conflicts {
+				fmt.Printf("conflict %s\n", conflict)
+			}
+			switch {
+			case len(report.Conflicts) > 0 && *prefer == "":
+				fmt.Println("Nothing was written. Edit the conflicting data, or run again with --prefer ours or --prefer theirs.")
+			case report.DryRun:
+				fmt.Printf("Would pull %d changed and %d deleted files from %s.\n", len(report.Changed), len(report.Deleted), report.Remote)
+			default:
+				fmt.Printf("Pulled %d changed and %d deleted files from %s (%s).\n", len(report.Changed), len(report.Deleted), report.Remote, shortCommit(report.Commit))
+				if report.Safety != nil {
+					fmt.Printf("The previous state is in %s.\n", report.Safety.Path)
+				}
+			}
+		}
+	}
+	if len(report.Conflicts) > 0 && *prefer == "" {
+		return 1
+	}
+	return 0
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// runSyncTodoMd handles `compass sync todo-md`. It exits with 1 when
+// conflicts are left for the user to resolve.
+func runSyncTodoMd(args []string) int {
+	flags := flag.NewFlagSet("compass sync todo-md", flag.ContinueOnError)
+	file := flags.String("file", "TODO.md", "checklist file to sync")
+	projectID := flags.String("project", "", "project to sync with (defaults to the current project)")
+	prefer := flags.String("prefer", "", "settle conflicts in favor of file or compass")
+	dryRun := flags.Bool("dry-run", false, "show what would change without writing either side")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		syncUsage()
+		return 2
+	}
+
+	content, err := os.ReadFile(*file)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	store, err := storage.Open(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer closeStore(store)
+
+	if *projectID == "" {
+		current, err := store.GetCurrentProject()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: no current project set; pass --project")
+			return 2
+		}
+		*projectID = current.ID
+	}
+
+	state, err := storage.ReadTodoSyncState(cwd, *file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	result, err := service.NewTodoSyncService(store).Sync(*projectID, string(content), state, service.TodoSyncOptions{Prefer: *prefer, DryRun: *dryRun})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if !*dryRun {
+		if result.Content != string(content) {
+			if err := os.WriteFile(*file, []byte(result.Content), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+		}
+		if err := storage.WriteTodoSyncState(cwd, *file, result.State); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to save sync state: %v\n", err)
+			return 1
+		}
+	}
+
+	report := result.Report
+	if *asJSON {
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+	} else {
+		verb := "Synced"
+		if report.DryRun {
+			verb = "Would sync"
+		}
+		fmt.Printf("%s %s: %d created, %d updated, %d canceled in Compass; %d added, %d rewritten, %d removed in the file.\n",
+			verb, *file, report.Created, report.Updated, report.Canceled, report.Added, report.Rewritten, report.Removed)
+		for _, conflict := range report.Conflicts {
+			detail := ""
+			if len(conflict.Fields) > 0 {
+				detail = " (" + strings.Join(conflict.Fields, ", ") + ")"
+			}
+			fmt.Printf("Conflict: %s [%s]: %s%s\n", conflict.Title, conflict.TaskID, conflict.Reason, detail)
+		}
+		if len(report.Conflicts) > 0 {
+			fmt.Println("Edit either side to match, or run again with --prefer file or --prefer compass.")
+		}
+	}
+	if len(report.Conflicts) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "fmt"
+
+// DefaultAgentName is recorded when no client has identified itself
+const DefaultAgentName = "compass-agent"
+
+// AgentIdentity describes the client that is making changes. Name and Version
+// come from the MCP initialize handshake; Label is an optional per-session
+// name that distinguishes several agents running the same client.
+type AgentIdentity struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	Label   string `json:"label,omitempty"`
+}
+
+// String renders the identity as it is stamped onto entities, e.g.
+// "reviewer (claude-code/1.0.3)"
+func (a AgentIdentity) String() string {
+	client := a.Name
+	if client == "" {
+		client = DefaultAgentName
+	}
+	if a.Version != "" {
+		client = fmt.Sprintf("%s/%s", client, a.Version)
+	}
+	if a.Label != "" {
+		return fmt.Sprintf("%s (%s)", a.Label, client)
+	}
+	return client
+}
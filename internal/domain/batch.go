@@ -0,0 +1,161 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// BatchOp names an operation that can run inside a batch
+type BatchOp string
+
+const (
+	BatchCreateTask     BatchOp = "task.create"
+	BatchUpdateTask     BatchOp = "task.update"
+	BatchLinkTask       BatchOp = "task.link"
+	BatchRecordDecision BatchOp = "decision.record"
+	BatchAddToPlanning  BatchOp = "planning.add_task"
+)
+
+// IsValidBatchOp checks whether op is one of the known batch operations
+func IsValidBatchOp(op BatchOp) bool {
+	switch op {
+	case BatchCreateTask, BatchUpdateTask, BatchLinkTask, BatchRecordDecision, BatchAddToPlanning:
+		return true
+	}
+	return false
+}
+
+// BatchCreates reports whether op creates an entity whose ID later
+// commands can refer to
+func BatchCreates(op BatchOp) bool {
+	return op == BatchCreateTask || op == BatchRecordDecision
+}
+
+// BatchCommand is one step of a batch. Ref names the entity the command
+// creates; a later "$<ref>" in one of the ID parameters of Params is
+// replaced by its ID.
+type BatchCommand struct {
+	Op     BatchOp         `json:"op"`
+	Ref    string          `json:"ref,omitempty"`
+	Params json.RawMessage `json:"params"`
+}
+
+// BatchStep reports what one command of an applied batch did
+type BatchStep struct {
+	Op  BatchOp `json:"op"`
+	Ref string  `json:"ref,omitempty"`
+	ID  string  `json:"id"`
+}
+
+// BatchResult reports an applied batch
+type BatchResult struct {
+	Steps []BatchStep       `json:"steps"`
+	Refs  map[string]string `json:"refs"`
+}
+
+// BatchError reports the command that stopped a batch. A failed batch
+// applies none of its commands.
+type BatchError struct {
+	Index int
+	Op    BatchOp
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch command %d (%s) failed: %v; no changes were applied", e.Index, e.Op, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	batchRefPattern         = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+	batchPlaceholderPattern = regexp.MustCompile(`^\$[A-Za-z][A-Za-z0-9_-]*$`)
+)
+
+// ValidateBatch checks the shape of a batch before anything is applied:
+// every op is known, refs are well formed, unique and only set on commands
+// that create something, and placeholders only name refs of earlier
+// commands
+func ValidateBatch(commands []BatchCommand) error {
+	if len(commands) == 0 {
+		return fmt.Errorf("batch has no commands")
+	}
+	// No IDs exist yet, so refs stand in for themselves
+	defined := map[string]string{}
+	for i, command := range commands {
+		if !IsValidBatchOp(command.Op) {
+			return &BatchError{Index: i, Op: command.Op, Err: fmt.Errorf("unknown operation")}
+		}
+		if _, err := ResolveBatchRefs(command.Params, defined); err != nil {
+			return &BatchError{Index: i, Op: command.Op, Err: err}
+		}
+		if command.Ref == "" {
+			continue
+		}
+		switch {
+		case !BatchCreates(command.Op):
+			return &BatchError{Index: i, Op: command.Op, Err: fmt.Errorf("ref %q is only allowed on commands that create an entity", command.Ref)}
+		case !batchRefPattern.MatchString(command.Ref):
+			return &BatchError{Index: i, Op: command.Op, Err: fmt.Errorf("invalid ref %q", command.Ref)}
+		case defined[command.Ref] != "":
+			return &BatchError{Index: i, Op: command.Op, Err: fmt.Errorf("ref %q is defined twice", command.Ref)}
+		}
+		defined[command.Ref] = command.Ref
+	}
+	return nil
+}
+
+// batchIDParams are the parameters that hold task, decision or session IDs.
+// Only these are resolved, so other text that happens to start with "$"
+// passes through unchanged.
+var batchIDParams = map[string]bool{
+	"id":              true,
+	"parent":          true,
+	"dependsOn":       true,
+	"dependencies":    true,
+	"taskIds":         true,
+	"affectedTaskIds": true,
+}
+
+// ResolveBatchRefs replaces every "$<ref>" in the ID parameters of params,
+// whether a single ID or a list of them, with the ID refs maps it to; a
+// placeholder naming a ref that is not in refs is an error
+func ResolveBatchRefs(params json.RawMessage, refs map[string]string) (json.RawMessage, error) {
+	if len(params) == 0 {
+		return params, nil
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(params, &document); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	resolve := func(value interface{}) (interface{}, error) {
+		id, ok := value.(string)
+		if !ok || !batchPlaceholderPattern.MatchString(id) {
+			return value, nil
+		}
+		resolved, ok := refs[id[1:]]
+		if !ok {
+			return nil, fmt.Errorf("%s does not name an entity created earlier in the batch", id)
+		}
+		return resolved, nil
+	}
+	for key, value := range document {
+		if !batchIDParams[key] {
+			continue
+		}
+		var err error
+		if list, ok := value.([]interface{}); ok {
+			for i := range list {
+				if list[i], err = resolve(list[i]); err != nil {
+					return nil, err
+				}
+			}
+		} else if document[key], err = resolve(value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(document)
+}
@@ -0,0 +1,66 @@
+package domain
+
+import "fmt"
+
+// WIPPolicy controls what happens when a task is moved into a column that
+// has already reached its work-in-progress limit
+type WIPPolicy string
+
+const (
+	WIPPolicyWarn   WIPPolicy = "warn"
+	WIPPolicyReject WIPPolicy = "reject"
+)
+
+// BoardStatuses is the column order used when rendering a project board
+var BoardStatuses = []TaskStatus{
+	StatusPlanned,
+	StatusInProgress,
+	StatusBlocked,
+	StatusOnHold,
+	StatusCompleted,
+	StatusCanceled,
+}
+
+// BoardColumn groups the tasks of a single status together with its limit
+type BoardColumn struct {
+	Status TaskStatus `json:"status"`
+	Count  int        `json:"count"`
+	Limit  int        `json:"limit,omitempty"`
+	Full   bool       `json:"full"`
+	Tasks  []*Task    `json:"tasks"`
+}
+
+// Board is a kanban view of a project's tasks
+type Board struct {
+	ProjectID string         `json:"projectId"`
+	Policy    WIPPolicy      `json:"policy"`
+	Columns   []*BoardColumn `json:"columns"`
+}
+
+// WIPViolation describes a transition into a column that is at capacity
+type WIPViolation struct {
+	TaskID string     `json:"taskId"`
+	Status TaskStatus `json:"status"`
+	Limit  int        `json:"limit"`
+	Count  int        `json:"count"`
+	Policy WIPPolicy  `json:"policy"`
+}
+
+func (v *WIPViolation) Error() string {
+	return fmt.Sprintf("WIP limit reached for %s: %d/%d tasks", v.Status, v.Count, v.Limit)
+}
+
+// IsValidTaskStatus checks whether status is one of the known task statuses
+func IsValidTaskStatus(status TaskStatus) bool {
+	for _, s := range BoardStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidWIPPolicy checks whether policy is one of the known WIP policies
+func IsValidWIPPolicy(policy WIPPolicy) bool {
+	return policy == WIPPolicyWarn || policy == WIPPolicyReject
+}
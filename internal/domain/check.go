@@ -0,0 +1,52 @@
+package domain
+
+// CheckSeverity ranks how much an integrity issue matters
+type CheckSeverity string
+
+const (
+	// SeverityError marks data that is lost, unreadable or inconsistent in
+	// a way Compass cannot serve correctly
+	SeverityError CheckSeverity = "error"
+	// SeverityWarning marks leftovers and stale references that Compass
+	// tolerates but that point at something that no longer exists
+	SeverityWarning CheckSeverity = "warning"
+)
+
+// CheckIssue is one problem found by a storage integrity check
+type CheckIssue struct {
+	Severity CheckSeverity `json:"severity"`
+	// Code identifies the kind of issue, e.g. "dangling-parent"
+	Code    string `json:"code"`
+	Entity  string `json:"entity,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+	// Repairable issues have a fix that cannot lose data
+	Repairable bool `json:"repairable"`
+	Repaired   bool `json:"repaired,omitempty"`
+}
+
+// CheckReport lists what an integrity check found and, when it was asked to
+// repair, what it fixed and where it backed the data up first
+type CheckReport struct {
+	Backend  string        `json:"backend"`
+	Issues   []*CheckIssue `json:"issues"`
+	Repaired int           `json:"repaired"`
+	Backup   string        `json:"backup,omitempty"`
+}
+
+// Count returns the number of issues with the given severity
+func (r *CheckReport) Count(severity CheckSeverity) int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Outstanding returns the number of issues that have not been repaired
+func (r *CheckReport) Outstanding() int {
+	return len(r.Issues) - r.Repaired
+}
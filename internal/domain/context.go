@@ -24,6 +24,8 @@ type SearchResult struct {
 type NextTaskCriteria struct {
 	ProjectID string
 	Exclude   []string
+	// Agent is the identity asking; tasks leased by any other agent are skipped
+	Agent string
 }
 
 type SufficiencyReport struct {
@@ -37,7 +37,12 @@ type PlanningSession struct {
 	Name      string                `json:"name"`
 	Status    PlanningSessionStatus `json:"status"`
 	CreatedAt time.Time             `json:"createdAt"`
-	Tasks     []string              `json:"tasks"`
+	CreatedBy string                `json:"createdBy,omitempty"`
+	// EndedAt is when the session was completed or aborted
+	EndedAt *time.Time `json:"endedAt,omitempty"`
+	// ArchivedAt is set once the session is moved to the archive
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	Tasks      []string   `json:"tasks"`
 }
 
 type Discovery struct {
@@ -48,6 +53,7 @@ type Discovery struct {
 	Impact        Impact          `json:"impact"`
 	AffectedTasks []string        `json:"affectedTasks"`
 	Source        DiscoverySource `json:"source"`
+	RecordedBy    string          `json:"recordedBy,omitempty"`
 }
 
 type Decision struct {
@@ -60,6 +66,7 @@ type Decision struct {
 	Rationale     string    `json:"rationale"`
 	Reversible    bool      `json:"reversible"`
 	AffectedTasks []string  `json:"affectedTasks"`
+	RecordedBy    string    `json:"recordedBy,omitempty"`
 }
 
 func NewPlanningSession(projectID, name string) *PlanningSession {
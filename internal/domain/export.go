@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// ProjectBundleFormat identifies the JSON layout of a ProjectBundle; imports
+// refuse bundles with a different value
+const ProjectBundleFormat = "compass.project/v1"
+
+// ProjectBundle is a self-contained copy of one project that can be imported
+// into another workspace. Entities keep their original IDs; the importer
+// assigns new ones and rewrites every reference between them.
+type ProjectBundle struct {
+	Format           string             `json:"format"`
+	ExportedAt       time.Time          `json:"exportedAt"`
+	Project          *Project           `json:"project"`
+	Tasks            []*Task            `json:"tasks"`
+	Decisions        []*Decision        `json:"decisions"`
+	Discoveries      []*Discovery       `json:"discoveries"`
+	PlanningSessions []*PlanningSession `json:"planningSessions"`
+	// Processes carry only their definitions; runtime state is cleared
+	Processes []*Process `json:"processes"`
+}
+
+// ProjectImport reports what an import created. IDMap maps every ID in the
+// bundle to the ID it was stored under.
+type ProjectImport struct {
+	Project          *Project          `json:"project"`
+	Tasks            int               `json:"tasks"`
+	Decisions        int               `json:"decisions"`
+	Discoveries      int               `json:"discoveries"`
+	PlanningSessions int               `json:"planningSessions"`
+	Processes        int               `json:"processes"`
+	IDMap            map[string]string `json:"idMap"`
+	// Dropped counts references to entities outside the bundle
+	Dropped int `json:"dropped,omitempty"`
+}
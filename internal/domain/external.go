@@ -0,0 +1,38 @@
+package domain
+
+// ExternalRef links a task to the issue it was imported from. Importers
+// match tasks on Source and Key, so importing the same issue again updates
+// the task instead of creating a duplicate.
+type ExternalRef struct {
+	// Source names the tracker, e.g. "github" or "jira"
+	Source string `json:"source"`
+	// Key identifies the issue within the source, e.g. "owner/repo#12" or
+	// "PROJ-7"
+	Key string `json:"key"`
+	URL string `json:"url,omitempty"`
+}
+
+// String returns the reference as "source:key"
+func (r ExternalRef) String() string {
+	return r.Source + ":" + r.Key
+}
+
+// IssueImport reports what importing issues from a tracker did
+type IssueImport struct {
+	Source    string             `json:"source"`
+	ProjectID string             `json:"projectId"`
+	Created   int                `json:"created"`
+	Updated   int                `json:"updated"`
+	Unchanged int                `json:"unchanged"`
+	DryRun    bool               `json:"dryRun,omitempty"`
+	Items     []*IssueImportItem `json:"items"`
+}
+
+// IssueImportItem is the outcome for one issue: "created", "updated" or
+// "unchanged"
+type IssueImportItem struct {
+	Ref    ExternalRef `json:"ref"`
+	TaskID string      `json:"taskId"`
+	Title  string      `json:"title"`
+	Action string      `json:"action"`
+}
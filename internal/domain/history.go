@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// RevisionOp is the kind of change a task revision records
+type RevisionOp string
+
+const (
+	RevisionCreate RevisionOp = "create"
+	RevisionUpdate RevisionOp = "update"
+	RevisionDelete RevisionOp = "delete"
+)
+
+// TaskRevision is one entry in a task's append-only change history. Task
+// holds the full state after the change and is nil for deletions.
+type TaskRevision struct {
+	At        time.Time  `json:"at"`
+	Op        RevisionOp `json:"op"`
+	TaskID    string     `json:"taskId"`
+	ProjectID string     `json:"projectId"`
+	Task      *Task      `json:"task,omitempty"`
+}
+
+// NewTaskRevision snapshots task as it is right now
+func NewTaskRevision(op RevisionOp, task *Task) *TaskRevision {
+	revision := &TaskRevision{
+		At:        time.Now(),
+		Op:        op,
+		TaskID:    task.ID,
+		ProjectID: task.ProjectID,
+	}
+	if op != RevisionDelete {
+		revision.Task = task.Clone()
+	}
+	return revision
+}
+
+// ReplayTaskRevisions reconstructs the state of every task at asOf from its
+// revisions. Tasks deleted on or before asOf are omitted.
+func ReplayTaskRevisions(revisions []*TaskRevision, asOf time.Time) map[string]*Task {
+	ordered := make([]*TaskRevision, len(revisions))
+	copy(ordered, revisions)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].At.Before(ordered[j].At)
+	})
+
+	state := make(map[string]*Task)
+	for _, revision := range ordered {
+		if revision.At.After(asOf) {
+			break
+		}
+		if revision.Op == RevisionDelete || revision.Task == nil {
+			delete(state, revision.TaskID)
+			continue
+		}
+		state[revision.TaskID] = revision.Task
+	}
+	return state
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// TaskLease is a time-limited claim an agent holds on a task. A lease that is
+// not renewed before ExpiresAt lapses automatically and the task becomes
+// claimable by other agents again.
+type TaskLease struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	RenewedAt  time.Time `json:"renewedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// IsActive reports whether the lease is still in force at the given time
+func (l *TaskLease) IsActive(now time.Time) bool {
+	return l != nil && now.Before(l.ExpiresAt)
+}
+
+// ActiveLease returns the task's lease if it has not expired, nil otherwise
+func (t *Task) ActiveLease(now time.Time) *TaskLease {
+	if t.Card.Lease.IsActive(now) {
+		return t.Card.Lease
+	}
+	return nil
+}
+
+// IsLeasedByOther reports whether another agent currently holds the task
+func (t *Task) IsLeasedByOther(agent string, now time.Time) bool {
+	lease := t.ActiveLease(now)
+	return lease != nil && lease.Holder != agent
+}
+
+// LeaseChange sets or, with a nil Lease, clears a task's lease when passed
+// to an update under the "lease" key. The lease is read-only to every other
+// update, and a LeaseChange cannot be decoded from JSON, so only code that
+// manages leases can write one.
+type LeaseChange struct {
+	Lease *TaskLease
+}
+
+// LeaseConflictError is returned when an agent tries to claim, renew or
+// release a task that is leased by someone else
+type LeaseConflictError struct {
+	TaskID    string
+	Holder    string
+	ExpiresAt time.Time
+}
+
+func (e *LeaseConflictError) Error() string {
+	return fmt.Sprintf("task %s is leased by %s until %s", e.TaskID, e.Holder, e.ExpiresAt.Format(time.RFC3339))
+}
@@ -51,8 +51,10 @@ type Process struct {
 	HealthStatus string                `json:"healthStatus,omitempty"`
 	RestartPolicy RestartPolicy        `json:"restartPolicy"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	TaskID      string                 `json:"taskId,omitempty"`
 	CreatedAt   time.Time              `json:"createdAt"`
 	UpdatedAt   time.Time              `json:"updatedAt"`
+	CreatedBy   string                 `json:"createdBy,omitempty"`
 }
 
 // RestartPolicy defines how a process should be restarted
@@ -73,6 +75,7 @@ type ProcessGroup struct {
 	ProcessIDs  []string  `json:"processIds"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
 }
 
 // ProcessLog represents captured output from a process
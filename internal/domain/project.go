@@ -11,8 +11,12 @@ type Project struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Goal        string    `json:"goal"`
+	WIPLimits   map[TaskStatus]int `json:"wipLimits,omitempty"`
+	WIPPolicy   WIPPolicy          `json:"wipPolicy,omitempty"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+	UpdatedBy   string    `json:"updatedBy,omitempty"`
 }
 
 func NewProject(name, description, goal string) *Project {
@@ -27,6 +31,22 @@ func NewProject(name, description, goal string) *Project {
 	}
 }
 
+// WIPLimit returns the work-in-progress limit for a status (0 means unlimited)
+func (p *Project) WIPLimit(status TaskStatus) int {
+	if p.WIPLimits == nil {
+		return 0
+	}
+	return p.WIPLimits[status]
+}
+
+// EffectiveWIPPolicy returns the configured WIP policy, defaulting to warn
+func (p *Project) EffectiveWIPPolicy() WIPPolicy {
+	if p.WIPPolicy == "" {
+		return WIPPolicyWarn
+	}
+	return p.WIPPolicy
+}
+
 type ProjectRepository interface {
 	Create(project *Project) error
 	Get(id string) (*Project, error)
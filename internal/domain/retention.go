@@ -0,0 +1,89 @@
+package domain
+
+import "time"
+
+// Retention defaults, used for every RetentionPolicy field left at zero
+const (
+	DefaultArchiveTasksAfterDays    = 90
+	DefaultArchiveSessionsAfterDays = 30
+	DefaultProcessLogDays           = 7
+	DefaultMaxProcessLogEntries     = 10000
+)
+
+// RetentionPolicy bounds how long finished work stays in the active
+// workspace and how much process output is kept. A zero field takes its
+// default; a negative one turns that rule off.
+type RetentionPolicy struct {
+	// ArchiveTasksAfterDays archives tasks completed or canceled this many
+	// days ago
+	ArchiveTasksAfterDays int `json:"archiveTasksAfterDays,omitempty"`
+	// ArchiveSessionsAfterDays archives planning sessions that were
+	// completed or aborted this many days ago
+	ArchiveSessionsAfterDays int `json:"archiveSessionsAfterDays,omitempty"`
+	// ProcessLogDays deletes process logs older than this many days
+	ProcessLogDays int `json:"processLogDays,omitempty"`
+	// MaxProcessLogEntries keeps at most this many of each process's most
+	// recent logs
+	MaxProcessLogEntries int `json:"maxProcessLogEntries,omitempty"`
+}
+
+// WithDefaults returns the policy with its zero fields set to the defaults
+func (p RetentionPolicy) WithDefaults() RetentionPolicy {
+	if p.ArchiveTasksAfterDays == 0 {
+		p.ArchiveTasksAfterDays = DefaultArchiveTasksAfterDays
+	}
+	if p.ArchiveSessionsAfterDays == 0 {
+		p.ArchiveSessionsAfterDays = DefaultArchiveSessionsAfterDays
+	}
+	if p.ProcessLogDays == 0 {
+		p.ProcessLogDays = DefaultProcessLogDays
+	}
+	if p.MaxProcessLogEntries == 0 {
+		p.MaxProcessLogEntries = DefaultMaxProcessLogEntries
+	}
+	return p
+}
+
+// RetentionCutoff returns the moment days before now, or the zero time when
+// the rule is turned off
+func RetentionCutoff(now time.Time, days int) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+// RetainLogs returns the logs a process keeps under the retention rules, in
+// their original order: those written at or after before, and of those only
+// the newest keep. A zero before or keep turns that rule off.
+func RetainLogs(logs []*ProcessLog, before time.Time, keep int) []*ProcessLog {
+	kept := make([]*ProcessLog, 0, len(logs))
+	for _, log := range logs {
+		if before.IsZero() || !log.Timestamp.Before(before) {
+			kept = append(kept, log)
+		}
+	}
+	if keep > 0 && len(kept) > keep {
+		kept = kept[len(kept)-keep:]
+	}
+	return kept
+}
+
+// GarbageCollection reports what applying a retention policy archived and
+// deleted
+type GarbageCollection struct {
+	Policy RetentionPolicy `json:"policy"`
+	// ArchivedTasks and ArchivedSessions list the IDs moved to the archive
+	ArchivedTasks    []string `json:"archivedTasks,omitempty"`
+	ArchivedSessions []string `json:"archivedSessions,omitempty"`
+	// PrunedLogs counts the process log entries deleted
+	PrunedLogs int `json:"prunedLogs"`
+	// Safety is the snapshot taken before anything was changed
+	Safety *Snapshot `json:"safety,omitempty"`
+	DryRun bool      `json:"dryRun,omitempty"`
+}
+
+// Empty reports whether the collection found nothing to do
+func (gc *GarbageCollection) Empty() bool {
+	return len(gc.ArchivedTasks) == 0 && len(gc.ArchivedSessions) == 0 && gc.PrunedLogs == 0
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretRefPrefix marks an environment value as a reference to a secret in
+// the workspace's encrypted secret store rather than a literal value
+const SecretRefPrefix = "secret://"
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// IsValidSecretName reports whether name can be stored and referenced
+func IsValidSecretName(name string) bool {
+	return len(name) <= 128 && secretNamePattern.MatchString(name)
+}
+
+// ParseSecretRef returns the secret name a secret:// value refers to
+func ParseSecretRef(value string) (string, bool) {
+	if !strings.HasPrefix(value, SecretRefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(value, SecretRefPrefix), true
+}
+
+// SecretRefs returns the distinct secret names referenced by env, sorted
+func SecretRefs(env map[string]string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, value := range env {
+		if name, ok := ParseSecretRef(value); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Redactor replaces resolved secret values with [secret:NAME] so they never
+// reach logs or any other output. A nil Redactor changes nothing.
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// NewRedactor builds a Redactor for values keyed by secret name
+func NewRedactor(values map[string]string) *Redactor {
+	names := make([]string, 0, len(values))
+	for name, value := range values {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	// Longer values first, so a secret that contains another is replaced
+	// as a whole
+	sort.Slice(names, func(i, j int) bool {
+		if len(values[names[i]]) != len(values[names[j]]) {
+			return len(values[names[i]]) > len(values[names[j]])
+		}
+		return names[i] < names[j]
+	})
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, values[name], "[secret:"+name+"]")
+	}
+	return &Redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Redact returns s with every secret value replaced
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// Snapshot describes a compressed archive of a workspace, or of one project
+// in it, that can be restored later. Automatic snapshots are taken before
+// destructive operations and pruned so that only the most recent are kept.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Reason names the operation an automatic snapshot was taken before
+	Reason    string `json:"reason,omitempty"`
+	ProjectID string `json:"projectId,omitempty"`
+	Automatic bool   `json:"automatic"`
+	Backend   string `json:"backend"`
+	Files     int    `json:"files"`
+	Size      int64  `json:"size"`
+}
+
+// SnapshotRestore reports a restore and the safety snapshot taken before it
+type SnapshotRestore struct {
+	Restored *Snapshot `json:"restored"`
+	Safety   *Snapshot `json:"safety"`
+	Files    int       `json:"files"`
+}
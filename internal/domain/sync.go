@@ -0,0 +1,54 @@
+package domain
+
+// TodoSync reports what syncing a TODO.md file with a project did
+type TodoSync struct {
+	ProjectID string `json:"projectId"`
+	// Created counts tasks created from new lines in the file
+	Created int `json:"created"`
+	// Updated counts tasks changed from edits in the file
+	Updated int `json:"updated"`
+	// Canceled counts tasks whose lines were deleted from the file
+	Canceled int `json:"canceled"`
+	// Added counts lines written for tasks the file did not list
+	Added int `json:"added"`
+	// Rewritten counts lines changed from edits in Compass
+	Rewritten int `json:"rewritten"`
+	// Removed counts lines of tasks deleted in Compass
+	Removed   int             `json:"removed"`
+	Conflicts []*SyncConflict `json:"conflicts,omitempty"`
+	DryRun    bool            `json:"dryRun,omitempty"`
+}
+
+// SyncConflict is a task both sides changed since the last sync. Neither
+// side is touched until the conflict is resolved.
+type SyncConflict struct {
+	TaskID string `json:"taskId"`
+	Title  string `json:"title"`
+	// Fields lists the fields both sides changed to different values
+	Fields []string `json:"fields,omitempty"`
+	Reason string   `json:"reason"`
+}
+
+// GitSync reports a push of the workspace's data to a git ref, or a pull
+// merging the ref from a remote into it
+type GitSync struct {
+	Remote string `json:"remote"`
+	Ref    string `json:"ref"`
+	// Commit is the ref's commit afterwards
+	Commit string `json:"commit,omitempty"`
+	// UpToDate is set when there was nothing to push or pull
+	UpToDate bool `json:"upToDate,omitempty"`
+	// Files counts the data files a push recorded
+	Files int `json:"files,omitempty"`
+	// Changed and Deleted list the files a pull wrote or removed, relative
+	// to .compass
+	Changed []string `json:"changed,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+	// Conflicts lists what both sides changed irreconcilably, as
+	// "<file> <json path>"; a pull with conflicts writes nothing unless a
+	// side is preferred
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Safety is the snapshot taken before a pull changed any file
+	Safety *Snapshot `json:"safety,omitempty"`
+	DryRun bool      `json:"dryRun,omitempty"`
+}
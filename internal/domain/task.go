@@ -38,6 +38,9 @@ const (
 type Task struct {
 	ID        string    `json:"id"`
 	ProjectID string    `json:"projectId"`
+	// Version starts at 1 and is bumped by every update; zero marks a task
+	// stored before versioning. Pass it back as ifMatch to detect lost updates.
+	Version   int       `json:"version"`
 	Card      Card      `json:"card"`
 	Context   Context   `json:"context"`
 	Criteria  Criteria  `json:"criteria"`
@@ -58,7 +61,14 @@ type Card struct {
 	CreatedAt   time.Time  `json:"createdAt"`
 	UpdatedAt   time.Time  `json:"updatedAt"`
 	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	CreatedBy   string     `json:"createdBy,omitempty"`
+	UpdatedBy   string     `json:"updatedBy,omitempty"`
 	Verification *CompletionVerification `json:"verification,omitempty"`
+	Lease        *TaskLease              `json:"lease,omitempty"`
+	ExternalRef  *ExternalRef            `json:"externalRef,omitempty"`
+	// ArchivedAt is set once the task is moved to the archive, which keeps
+	// it searchable but out of default listings
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
 }
 
 type Context struct {
@@ -87,6 +97,7 @@ type VerificationEvidence struct {
 	TestResults     string    `json:"testResults,omitempty"`      // Detailed results or output
 	FilesAffected   []string  `json:"filesAffected,omitempty"`    // Files tested/modified
 	RelatedCriteria []int     `json:"relatedCriteria,omitempty"`  // Loose mapping to acceptance criteria indices
+	RecordedBy      string    `json:"recordedBy,omitempty"`       // Agent that produced the evidence
 }
 
 type CompletionVerification struct {
@@ -101,6 +112,7 @@ func NewTask(projectID, title, description string) *Task {
 	return &Task{
 		ID:        uuid.New().String(),
 		ProjectID: projectID,
+		Version:   1,
 		Card: Card{
 			Title:       title,
 			Description: description,
@@ -139,6 +151,15 @@ type TaskFilter struct {
 	DueAfter     *time.Time
 	CreatedAfter *time.Time
 	UpdatedAfter *time.Time
+	// Archived selects whether archived tasks are listed; the zero value
+	// leaves them out
+	Archived ArchiveScope
+	
+	// Ordering and pagination; the zero value lists everything oldest first
+	SortBy   TaskSortField
+	SortDesc bool
+	Limit    int
+	Offset   int
 }
 
 type TaskRepository interface {
@@ -202,6 +223,9 @@ func (t *Task) CompleteWithVerification(evidence []VerificationEvidence, complet
 		if evidence[i].TestedAt.IsZero() {
 			evidence[i].TestedAt = time.Now()
 		}
+		// Evidence is attributed to whoever completes the task, never to
+		// an identity the caller names
+		evidence[i].RecordedBy = completedBy
 	}
 	
 	// Mark task as completed
@@ -209,6 +233,7 @@ func (t *Task) CompleteWithVerification(evidence []VerificationEvidence, complet
 	now := time.Now()
 	t.Card.CompletedAt = &now
 	t.Card.UpdatedAt = now
+	t.Card.UpdatedBy = completedBy
 	
 	// Store verification data
 	t.Card.Verification = &CompletionVerification{
@@ -0,0 +1,341 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaskPatchError reports an update that names an unknown field, targets a
+// read-only field or carries a value of the wrong type
+type TaskPatchError struct {
+	Field  string
+	Reason string
+}
+
+func (e *TaskPatchError) Error() string {
+	return fmt.Sprintf("invalid update for %s: %s", e.Field, e.Reason)
+}
+
+// VersionConflictError reports an update made against a stale copy of a
+// task: the caller's expected version no longer matches the stored one
+type VersionConflictError struct {
+	TaskID   string
+	Expected int
+	Actual   int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("task %s was modified by someone else: expected version %d, current version is %d", e.TaskID, e.Expected, e.Actual)
+}
+
+// taskPatchAliases maps the flat update keys used throughout Compass to their
+// location in the task document
+var taskPatchAliases = map[string]string{
+	"title":            "card",
+	"description":      "card",
+	"status":           "card",
+	"priority":         "card",
+	"parent":           "card",
+	"children":         "card",
+	"labels":           "card",
+	"dueDate":          "card",
+	"estimatedHours":   "card",
+	"actualHours":      "card",
+	"assignedTo":       "card",
+	"updatedAt":        "card",
+	"completedAt":      "card",
+	"updatedBy":        "card",
+	"verification":     "card",
+	"externalRef":      "card",
+	"archivedAt":       "card",
+	"files":            "context",
+	"dependencies":     "context",
+	"assumptions":      "context",
+	"blockers":         "context",
+	"decisions":        "context",
+	"contextualHeader": "context",
+	"lastVerified":     "context",
+	"confidence":       "context",
+	"acceptance":       "criteria",
+	"testScenarios":    "criteria",
+}
+
+// taskReadOnlyFields can never be changed through an update
+var taskReadOnlyFields = map[string]bool{
+	"id":             true,
+	"projectId":      true,
+	"card.createdAt": true,
+	"card.createdBy": true,
+	"card.lease":     true,
+}
+
+// ApplyTaskPatch returns a copy of task with updates applied as an RFC 7396
+// JSON merge patch. Updates may use the task's own shape ("card", "context",
+// "criteria" objects) or the flat shorthand keys such as "title" or "files";
+// both can be mixed. A null value clears a field, arrays replace the existing
+// value, and nested objects are merged. The original task is left untouched.
+//
+// A "version" key makes the update conditional: it fails with a
+// VersionConflictError unless it equals the task's current version. Every
+// successful update increments the version.
+//
+// The lease can only be changed by a LeaseChange under the "lease" key.
+func ApplyTaskPatch(task *Task, updates map[string]interface{}) (*Task, error) {
+	leaseChange, changesLease := updates["lease"].(LeaseChange)
+	if changesLease {
+		rest := make(map[string]interface{}, len(updates))
+		for key, value := range updates {
+			if key != "lease" {
+				rest[key] = value
+			}
+		}
+		updates = rest
+	}
+
+	patch, err := normalizeTaskPatch(updates)
+	if err != nil {
+		return nil, err
+	}
+
+	if expected, ok := patch["version"]; ok {
+		delete(patch, "version")
+		version, ok := expected.(float64)
+		if !ok || version != float64(int(version)) {
+			return nil, &TaskPatchError{Field: "version", Reason: "expected an integer"}
+		}
+		if int(version) != task.Version {
+			return nil, &VersionConflictError{TaskID: task.ID, Expected: int(version), Actual: task.Version}
+		}
+	}
+
+	current, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return nil, err
+	}
+
+	// Echoing a read-only field back unchanged is harmless; changing it is not
+	for _, path := range patchPaths("", patch) {
+		if taskReadOnlyFields[path] && !reflect.DeepEqual(valueAt(patch, path), valueAt(document, path)) {
+			return nil, &TaskPatchError{Field: path, Reason: "field is read-only"}
+		}
+	}
+
+	merged, err := json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	var updated Task
+	if err := decoder.Decode(&updated); err != nil {
+		return nil, patchDecodeError(err)
+	}
+
+	if err := validatePatchedTask(&updated, patch); err != nil {
+		return nil, err
+	}
+
+	if changesLease {
+		updated.Card.Lease = leaseChange.Lease
+	}
+	if !patchSets(patch, "card", "updatedAt") {
+		updated.Card.UpdatedAt = time.Now()
+	}
+	updated.Version = task.Version + 1
+	return &updated, nil
+}
+
+// normalizeTaskPatch converts updates into a merge patch shaped like the
+// task's JSON document, expanding flat shorthand keys
+func normalizeTaskPatch(updates map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(updates)
+	if err != nil {
+		return nil, &TaskPatchError{Field: "updates", Reason: err.Error()}
+	}
+	var flat map[string]interface{}
+	if err := json.Unmarshal(raw, &flat); err != nil {
+		return nil, &TaskPatchError{Field: "updates", Reason: err.Error()}
+	}
+
+	patch := make(map[string]interface{})
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := flat[key]
+		switch key {
+		case "id", "projectId", "version":
+			patch[key] = value
+		case "card", "context", "criteria":
+			section, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, &TaskPatchError{Field: key, Reason: "expected an object"}
+			}
+			target := patchSection(patch, key)
+			for field, fieldValue := range section {
+				target[field] = fieldValue
+			}
+		default:
+			sectionName, ok := taskPatchAliases[key]
+			if !ok {
+				return nil, &TaskPatchError{Field: key, Reason: "unknown field"}
+			}
+			patchSection(patch, sectionName)[key] = value
+		}
+	}
+	return patch, nil
+}
+
+func patchSection(patch map[string]interface{}, name string) map[string]interface{} {
+	section, ok := patch[name].(map[string]interface{})
+	if !ok {
+		section = make(map[string]interface{})
+		patch[name] = section
+	}
+	return section
+}
+
+// mergePatch applies patch to target following RFC 7396
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// PatchedStatus finds a status change in either the flat or the nested form
+// of a task update. The status may be a string, as decoded from JSON, or a
+// TaskStatus set by Go callers.
+func PatchedStatus(updates map[string]interface{}) (TaskStatus, bool) {
+	if status, ok := patchStatus(updates["status"]); ok {
+		return status, true
+	}
+	if card, ok := updates["card"].(map[string]interface{}); ok {
+		return patchStatus(card["status"])
+	}
+	return "", false
+}
+
+func patchStatus(value interface{}) (TaskStatus, bool) {
+	switch status := value.(type) {
+	case string:
+		return TaskStatus(status), true
+	case TaskStatus:
+		return status, true
+	}
+	return "", false
+}
+
+// patchPaths lists the dotted paths of the top two levels a patch touches
+func patchPaths(prefix string, patch map[string]interface{}) []string {
+	var paths []string
+	for key, value := range patch {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		paths = append(paths, path)
+		if nested, ok := value.(map[string]interface{}); ok && prefix == "" {
+			paths = append(paths, patchPaths(path, nested)...)
+		}
+	}
+	return paths
+}
+
+func valueAt(document map[string]interface{}, path string) interface{} {
+	var current interface{} = document
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	return current
+}
+
+func patchSets(patch map[string]interface{}, section, field string) bool {
+	values, ok := patch[section].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = values[field]
+	return ok
+}
+
+func patchDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &TaskPatchError{Field: typeErr.Field, Reason: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	}
+	var timeErr *time.ParseError
+	if errors.As(err, &timeErr) {
+		return &TaskPatchError{Field: "timestamp", Reason: fmt.Sprintf("%q is not an RFC 3339 time", strings.Trim(timeErr.Value, `"`))}
+	}
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &TaskPatchError{Field: field, Reason: "unknown field"}
+	}
+	return &TaskPatchError{Field: "updates", Reason: err.Error()}
+}
+
+// validatePatchedTask checks the enumerated fields the patch changed
+func validatePatchedTask(task *Task, patch map[string]interface{}) error {
+	if patchSets(patch, "card", "title") && strings.TrimSpace(task.Card.Title) == "" {
+		return &TaskPatchError{Field: "card.title", Reason: "title cannot be empty"}
+	}
+	if patchSets(patch, "card", "status") && !IsValidTaskStatus(task.Card.Status) {
+		return &TaskPatchError{Field: "card.status", Reason: fmt.Sprintf("unknown status %q", task.Card.Status)}
+	}
+	if patchSets(patch, "card", "priority") && !IsValidPriority(task.Card.Priority) {
+		return &TaskPatchError{Field: "card.priority", Reason: fmt.Sprintf("unknown priority %q", task.Card.Priority)}
+	}
+	if patchSets(patch, "context", "confidence") && !IsValidConfidence(task.Context.Confidence) {
+		return &TaskPatchError{Field: "context.confidence", Reason: fmt.Sprintf("unknown confidence %q", task.Context.Confidence)}
+	}
+	return nil
+}
+
+// IsValidPriority checks whether priority is one of the known priorities
+func IsValidPriority(priority Priority) bool {
+	switch priority {
+	case PriorityLow, PriorityMedium, PriorityHigh, PriorityCritical:
+		return true
+	}
+	return false
+}
+
+// IsValidConfidence checks whether confidence is one of the known levels
+func IsValidConfidence(confidence Confidence) bool {
+	switch confidence {
+	case ConfidenceLow, ConfidenceMedium, ConfidenceHigh:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaskSortField names the field tasks are ordered by when listing
+type TaskSortField string
+
+const (
+	SortByCreatedAt TaskSortField = "createdAt"
+	SortByUpdatedAt TaskSortField = "updatedAt"
+	SortByDueDate   TaskSortField = "dueDate"
+	SortByPriority  TaskSortField = "priority"
+	SortByTitle     TaskSortField = "title"
+	SortByStatus    TaskSortField = "status"
+)
+
+// IsValidTaskSortField checks whether field is one of the supported sort keys
+func IsValidTaskSortField(field TaskSortField) bool {
+	switch field {
+	case "", SortByCreatedAt, SortByUpdatedAt, SortByDueDate, SortByPriority, SortByTitle, SortByStatus:
+		return true
+	}
+	return false
+}
+
+// ArchiveScope selects archived entities when listing
+type ArchiveScope string
+
+const (
+	// ArchiveExclude lists only entities that are not archived
+	ArchiveExclude ArchiveScope = ""
+	// ArchiveInclude lists archived entities alongside the others
+	ArchiveInclude ArchiveScope = "include"
+	// ArchiveOnly lists nothing but archived entities
+	ArchiveOnly ArchiveScope = "only"
+)
+
+// IsValidArchiveScope checks whether scope is one of the supported values
+func IsValidArchiveScope(scope ArchiveScope) bool {
+	switch scope {
+	case ArchiveExclude, ArchiveInclude, ArchiveOnly:
+		return true
+	}
+	return false
+}
+
+// Includes reports whether an entity that is, or is not, archived is in scope
+func (s ArchiveScope) Includes(archived bool) bool {
+	switch s {
+	case ArchiveInclude:
+		return true
+	case ArchiveOnly:
+		return archived
+	default:
+		return !archived
+	}
+}
+
+var priorityRank = map[Priority]int{
+	PriorityLow:      1,
+	PriorityMedium:   2,
+	PriorityHigh:     3,
+	PriorityCritical: 4,
+}
+
+// Matches reports whether task satisfies every constraint set on the filter.
+// Labels must all be present on the task; time bounds are exclusive.
+func (f TaskFilter) Matches(task *Task) bool {
+	if f.ProjectID != nil && task.ProjectID != *f.ProjectID {
+		return false
+	}
+	if f.Status != nil && task.Card.Status != *f.Status {
+		return false
+	}
+	if f.Priority != nil && task.Card.Priority != *f.Priority {
+		return false
+	}
+	if f.Parent != nil && (task.Card.Parent == nil || *task.Card.Parent != *f.Parent) {
+		return false
+	}
+	if f.AssignedTo != nil && (task.Card.AssignedTo == nil || *task.Card.AssignedTo != *f.AssignedTo) {
+		return false
+	}
+	for _, label := range f.Labels {
+		if !task.HasLabel(label) {
+			return false
+		}
+	}
+	if f.DueBefore != nil && (task.Card.DueDate == nil || !task.Card.DueDate.Before(*f.DueBefore)) {
+		return false
+	}
+	if f.DueAfter != nil && (task.Card.DueDate == nil || !task.Card.DueDate.After(*f.DueAfter)) {
+		return false
+	}
+	if f.CreatedAfter != nil && !task.Card.CreatedAt.After(*f.CreatedAfter) {
+		return false
+	}
+	if f.UpdatedAfter != nil && !task.Card.UpdatedAt.After(*f.UpdatedAfter) {
+		return false
+	}
+	return f.Archived.Includes(task.Card.ArchivedAt != nil)
+}
+
+// ApplyTaskQuery filters, orders and paginates tasks according to filter.
+// Storage backends share it so that every backend lists tasks identically.
+func ApplyTaskQuery(tasks []*Task, filter TaskFilter) []*Task {
+	result := make([]*Task, 0, len(tasks))
+	for _, task := range tasks {
+		if filter.Matches(task) {
+			result = append(result, task)
+		}
+	}
+
+	SortTasks(result, filter.SortBy, filter.SortDesc)
+
+	if filter.Offset > 0 {
+		if filter.Offset >= len(result) {
+			return result[:0]
+		}
+		result = result[filter.Offset:]
+	}
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result
+}
+
+// SortTasks orders tasks by field, falling back to creation time and then ID
+// so that the order is stable across backends. Tasks without a due date sort
+// after those with one.
+func SortTasks(tasks []*Task, field TaskSortField, desc bool) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if cmp := compareTasks(a, b, field); cmp != 0 {
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		if cmp := compareTimes(a.Card.CreatedAt, b.Card.CreatedAt); cmp != 0 {
+			return cmp < 0
+		}
+		return a.ID < b.ID
+	})
+}
+
+func compareTasks(a, b *Task, field TaskSortField) int {
+	switch field {
+	case SortByUpdatedAt:
+		return compareTimes(a.Card.UpdatedAt, b.Card.UpdatedAt)
+	case SortByDueDate:
+		switch {
+		case a.Card.DueDate == nil && b.Card.DueDate == nil:
+			return 0
+		case a.Card.DueDate == nil:
+			return 1
+		case b.Card.DueDate == nil:
+			return -1
+		}
+		return compareTimes(*a.Card.DueDate, *b.Card.DueDate)
+	case SortByPriority:
+		return priorityRank[a.Card.Priority] - priorityRank[b.Card.Priority]
+	case SortByTitle:
+		return strings.Compare(strings.ToLower(a.Card.Title), strings.ToLower(b.Card.Title))
+	case SortByStatus:
+		return strings.Compare(string(a.Card.Status), string(b.Card.Status))
+	default:
+		return compareTimes(a.Card.CreatedAt, b.Card.CreatedAt)
+	}
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// Clone returns a deep copy of the task that shares no slices or pointers
+func (t *Task) Clone() *Task {
+	clone := *t
+
+	clone.Card.Parent = cloneString(t.Card.Parent)
+	clone.Card.Children = cloneStrings(t.Card.Children)
+	clone.Card.Labels = cloneStrings(t.Card.Labels)
+	clone.Card.DueDate = cloneTime(t.Card.DueDate)
+	clone.Card.EstimatedHours = cloneFloat(t.Card.EstimatedHours)
+	clone.Card.ActualHours = cloneFloat(t.Card.ActualHours)
+	clone.Card.AssignedTo = cloneString(t.Card.AssignedTo)
+	clone.Card.CompletedAt = cloneTime(t.Card.CompletedAt)
+	clone.Card.ArchivedAt = cloneTime(t.Card.ArchivedAt)
+	if t.Card.Verification != nil {
+		verification := *t.Card.Verification
+		verification.Evidence = make([]VerificationEvidence, len(t.Card.Verification.Evidence))
+		for i, evidence := range t.Card.Verification.Evidence {
+			evidence.FilesAffected = cloneStrings(evidence.FilesAffected)
+			evidence.RelatedCriteria = append([]int(nil), evidence.RelatedCriteria...)
+			verification.Evidence[i] = evidence
+		}
+		clone.Card.Verification = &verification
+	}
+	if t.Card.Lease != nil {
+		lease := *t.Card.Lease
+		clone.Card.Lease = &lease
+	}
+	if t.Card.ExternalRef != nil {
+		ref := *t.Card.ExternalRef
+		clone.Card.ExternalRef = &ref
+	}
+
+	clone.Context.Files = cloneStrings(t.Context.Files)
+	clone.Context.Dependencies = cloneStrings(t.Context.Dependencies)
+	clone.Context.Assumptions = cloneStrings(t.Context.Assumptions)
+	clone.Context.Blockers = cloneStrings(t.Context.Blockers)
+	clone.Context.Decisions = cloneStrings(t.Context.Decisions)
+
+	clone.Criteria.Acceptance = cloneStrings(t.Criteria.Acceptance)
+	clone.Criteria.Verification = cloneStrings(t.Criteria.Verification)
+	clone.Criteria.TestScenarios = cloneStrings(t.Criteria.TestScenarios)
+
+	return &clone
+}
+
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(values)), values...)
+}
+
+func cloneString(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+func cloneTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+func cloneFloat(value *float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
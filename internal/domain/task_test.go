@@ -2,8 +2,10 @@ package domain
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewTask(t *testing.T) {
@@ -45,4 +47,108 @@ func TestConfidence(t *testing.T) {
 	for _, confidence := range confidences {
 		assert.NotEmpty(t, string(confidence))
 	}
-}
\ No newline at end of file
+}
+
+func TestApplyTaskPatch(t *testing.T) {
+	task := NewTask("test-project-id", "Test Task", "Original description")
+	task.Context.Files = []string{"main.go"}
+	task.Card.Labels = []string{"backend"}
+	due := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	task.Card.DueDate = &due
+
+	updated, err := ApplyTaskPatch(task, map[string]interface{}{
+		"title":    "Renamed Task",
+		"status":   StatusInProgress,
+		"files":    []string{"server.go", "transport.go"},
+		"dueDate":  nil,
+		"context":  map[string]interface{}{"confidence": "high", "blockers": []string{"waiting on review"}},
+		"criteria": map[string]interface{}{"acceptance": []string{"Updates every field"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Renamed Task", updated.Card.Title)
+	assert.Equal(t, "Original description", updated.Card.Description)
+	assert.Equal(t, StatusInProgress, updated.Card.Status)
+	assert.Equal(t, []string{"server.go", "transport.go"}, updated.Context.Files)
+	assert.Nil(t, updated.Card.DueDate)
+	assert.Equal(t, []string{"backend"}, updated.Card.Labels)
+	assert.Equal(t, ConfidenceHigh, updated.Context.Confidence)
+	assert.Equal(t, []string{"waiting on review"}, updated.Context.Blockers)
+	assert.Equal(t, []string{"Updates every field"}, updated.Criteria.Acceptance)
+	assert.True(t, updated.Card.UpdatedAt.After(task.Card.CreatedAt) || updated.Card.UpdatedAt.Equal(task.Card.CreatedAt))
+
+	// The original is untouched
+	assert.Equal(t, "Test Task", task.Card.Title)
+	assert.NotNil(t, task.Card.DueDate)
+}
+
+func TestApplyTaskPatch_Validation(t *testing.T) {
+	task := NewTask("test-project-id", "Test Task", "A test task")
+
+	cases := map[string]map[string]interface{}{
+		"unknown field":        {"colour": "blue"},
+		"unknown nested field": {"card": map[string]interface{}{"colour": "blue"}},
+		"ill-typed field":      {"labels": "not-a-list"},
+		"bad timestamp":        {"dueDate": "next tuesday"},
+		"unknown status":       {"status": "done-ish"},
+		"unknown priority":     {"priority": "urgent"},
+		"read-only field":      {"projectId": "another-project"},
+		"empty title":          {"title": ""},
+		"fractional version":   {"version": 1.5},
+		"lease":                {"lease": map[string]interface{}{"holder": "agent-b"}},
+		"nested lease":         {"card": map[string]interface{}{"lease": map[string]interface{}{"holder": "agent-b"}}},
+	}
+	for name, updates := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ApplyTaskPatch(task, updates)
+			var patchErr *TaskPatchError
+			assert.ErrorAs(t, err, &patchErr)
+		})
+	}
+
+	// Sending a read-only field back unchanged is allowed
+	_, err := ApplyTaskPatch(task, map[string]interface{}{"projectId": task.ProjectID, "title": "Renamed"})
+	assert.NoError(t, err)
+}
+
+func TestApplyTaskPatch_LeaseChange(t *testing.T) {
+	task := NewTask("test-project-id", "Test Task", "A test task")
+	lease := &TaskLease{Holder: "agent-a", ExpiresAt: time.Now().Add(time.Minute)}
+
+	leased, err := ApplyTaskPatch(task, map[string]interface{}{"lease": LeaseChange{Lease: lease}, "version": 1})
+	require.NoError(t, err)
+	require.NotNil(t, leased.Card.Lease)
+	assert.Equal(t, "agent-a", leased.Card.Lease.Holder)
+	assert.Nil(t, task.Card.Lease)
+
+	released, err := ApplyTaskPatch(leased, map[string]interface{}{"lease": LeaseChange{}})
+	require.NoError(t, err)
+	assert.Nil(t, released.Card.Lease)
+}
+
+func TestApplyTaskPatch_Version(t *testing.T) {
+	task := NewTask("test-project-id", "Test Task", "A test task")
+	assert.Equal(t, 1, task.Version)
+
+	updated, err := ApplyTaskPatch(task, map[string]interface{}{"title": "Renamed", "version": 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, 1, task.Version)
+
+	_, err = ApplyTaskPatch(updated, map[string]interface{}{"title": "Stale", "version": 1})
+	var conflictErr *VersionConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, task.ID, conflictErr.TaskID)
+	assert.Equal(t, 1, conflictErr.Expected)
+	assert.Equal(t, 2, conflictErr.Actual)
+}
+
+func TestCompleteWithVerification_AttributesEvidenceToCompleter(t *testing.T) {
+	task := NewTask("test-project-id", "Verified", "")
+	evidence := []VerificationEvidence{{Evidence: "Ran the suite", RecordedBy: "someone-else"}, {Evidence: "Checked by hand"}}
+
+	require.NoError(t, task.CompleteWithVerification(evidence, "agent-a", ""))
+	for _, recorded := range task.Card.Verification.Evidence {
+		assert.Equal(t, "agent-a", recorded.RecordedBy)
+	}
+}
@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// githubIssue is one entry of `gh issue list --json ...`. Parent is not a
+// gh field; it is read when the export was enriched with sub-issue parents.
+type githubIssue struct {
+	Number      int    `json:"number"`
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	State       string `json:"state"`
+	StateReason string `json:"stateReason"`
+	URL         string `json:"url"`
+	Labels      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Assignees []struct {
+		Login string `json:"login"`
+	} `json:"assignees"`
+	Milestone *struct {
+		Title string     `json:"title"`
+		DueOn *time.Time `json:"dueOn"`
+	} `json:"milestone"`
+	Parent *struct {
+		Number int    `json:"number"`
+		URL    string `json:"url"`
+	} `json:"parent"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	ClosedAt  *time.Time `json:"closedAt"`
+}
+
+var githubIssueURL = regexp.MustCompile(`github\.com/([^/]+/[^/]+)/(?:issues|pull)/(\d+)`)
+
+// ParseGitHubIssues reads the JSON array printed by
+//
+//	gh issue list --state all --json number,title,body,state,stateReason,url,labels,assignees,milestone,createdAt,updatedAt,closedAt
+//
+// Issues are keyed "owner/repo#number", with the repository taken from each
+// issue's URL or, failing that, from repo. The milestone's due date becomes
+// the task's due date.
+func ParseGitHubIssues(data []byte, repo string) ([]*Issue, error) {
+	var raw []githubIssue
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid GitHub issues export: %w", err)
+	}
+
+	issues := make([]*Issue, 0, len(raw))
+	for _, gh := range raw {
+		if gh.Number == 0 {
+			return nil, fmt.Errorf("invalid GitHub issues export: issue %q has no number", gh.Title)
+		}
+		issueRepo := repo
+		if match := githubIssueURL.FindStringSubmatch(gh.URL); match != nil {
+			issueRepo = match[1]
+		}
+
+		issue := &Issue{
+			Ref:         domain.ExternalRef{Source: SourceGitHub, Key: githubKey(issueRepo, gh.Number), URL: gh.URL},
+			Title:       gh.Title,
+			Description: gh.Body,
+			Status:      githubStatus(gh.State, gh.StateReason),
+			Labels:      make([]string, 0, len(gh.Labels)),
+			CreatedAt:   gh.CreatedAt,
+			UpdatedAt:   gh.UpdatedAt,
+			ClosedAt:    gh.ClosedAt,
+		}
+		for _, label := range gh.Labels {
+			issue.Labels = append(issue.Labels, label.Name)
+		}
+		issue.Priority = priorityFromLabels(issue.Labels)
+		if len(gh.Assignees) > 0 {
+			issue.Assignee = gh.Assignees[0].Login
+		}
+		if gh.Milestone != nil && gh.Milestone.DueOn != nil {
+			due := *gh.Milestone.DueOn
+			issue.DueDate = &due
+		}
+		if gh.Parent != nil && gh.Parent.Number != 0 {
+			parentRepo := issueRepo
+			if match := githubIssueURL.FindStringSubmatch(gh.Parent.URL); match != nil {
+				parentRepo = match[1]
+			}
+			issue.ParentKey = githubKey(parentRepo, gh.Parent.Number)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func githubKey(repo string, number int) string {
+	return fmt.Sprintf("%s#%d", repo, number)
+}
+
+func githubStatus(state, reason string) domain.TaskStatus {
+	if !strings.EqualFold(state, "closed") {
+		return domain.StatusPlanned
+	}
+	if strings.EqualFold(reason, "not_planned") {
+		return domain.StatusCanceled
+	}
+	return domain.StatusCompleted
+}
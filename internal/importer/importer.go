@@ -0,0 +1,80 @@
+// Package importer reads issues exported from other trackers so they can be
+// stored as Compass tasks. Parsers work on offline export files and never
+// call the trackers' APIs.
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Sources supported by Parse
+const (
+	SourceGitHub = "github"
+	SourceJira   = "jira"
+)
+
+// Issue is a tracker issue converted to Compass terms
+type Issue struct {
+	Ref         domain.ExternalRef
+	Title       string
+	Description string
+	Status      domain.TaskStatus
+	Priority    domain.Priority
+	Labels      []string
+	// Assignee is the first assignee; Compass tasks have only one
+	Assignee string
+	DueDate  *time.Time
+	// ParentKey is the Ref.Key of the parent issue in the same source
+	ParentKey string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ClosedAt  *time.Time
+}
+
+// Options tune how an export file is read
+type Options struct {
+	// Repo ("owner/name") qualifies GitHub issue numbers when the export has
+	// no URLs to take it from
+	Repo string
+}
+
+// Parse reads an export file from the named source
+func Parse(source string, data []byte, opts Options) ([]*Issue, error) {
+	switch source {
+	case SourceGitHub:
+		return ParseGitHubIssues(data, opts.Repo)
+	case SourceJira:
+		return ParseJiraCSV(data)
+	default:
+		return nil, fmt.Errorf("unknown issue source %q (expected %s or %s)", source, SourceGitHub, SourceJira)
+	}
+}
+
+var priorityLabel = regexp.MustCompile(`(?i)^(?:priority\s*[:/-]?\s*)?(critical|urgent|high|medium|normal|low|p[0-3])$`)
+
+// priorityFromLabels reads a priority from labels such as "priority: high"
+// or "P1", defaulting to medium
+func priorityFromLabels(labels []string) domain.Priority {
+	for _, label := range labels {
+		match := priorityLabel.FindStringSubmatch(strings.TrimSpace(label))
+		if match == nil {
+			continue
+		}
+		switch strings.ToLower(match[1]) {
+		case "critical", "urgent", "p0":
+			return domain.PriorityCritical
+		case "high", "p1":
+			return domain.PriorityHigh
+		case "low", "p3":
+			return domain.PriorityLow
+		default:
+			return domain.PriorityMedium
+		}
+	}
+	return domain.PriorityMedium
+}
@@ -0,0 +1,134 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// githubExport is trimmed output of `gh issue list --json ...`, with a
+// sub-issue parent added to #13
+const githubExport = `[
+  {
+    "number": 12,
+    "title": "Split the API package",
+    "body": "Move handlers into their own module.",
+    "state": "OPEN",
+    "stateReason": "",
+    "url": "https://github.com/acme/shop/issues/12",
+    "labels": [{"name": "backend"}, {"name": "priority: high"}],
+    "assignees": [{"login": "octocat"}, {"login": "hubot"}],
+    "milestone": {"title": "v2", "dueOn": "2025-03-01T00:00:00Z"},
+    "createdAt": "2025-01-10T09:00:00Z",
+    "updatedAt": "2025-01-12T09:00:00Z",
+    "closedAt": null
+  },
+  {
+    "number": 13,
+    "title": "Move order handlers",
+    "body": "",
+    "state": "CLOSED",
+    "stateReason": "COMPLETED",
+    "url": "https://github.com/acme/shop/issues/13",
+    "labels": [{"name": "P0"}],
+    "assignees": [],
+    "milestone": null,
+    "parent": {"number": 12, "url": "https://github.com/acme/shop/issues/12"},
+    "createdAt": "2025-01-11T09:00:00Z",
+    "updatedAt": "2025-01-13T09:00:00Z",
+    "closedAt": "2025-01-13T08:00:00Z"
+  },
+  {
+    "number": 14,
+    "title": "Rewrite in another language",
+    "body": "",
+    "state": "CLOSED",
+    "stateReason": "NOT_PLANNED",
+    "url": "https://github.com/acme/shop/issues/14",
+    "labels": [],
+    "assignees": [],
+    "milestone": null,
+    "createdAt": "2025-01-11T09:00:00Z",
+    "updatedAt": "2025-01-13T09:00:00Z",
+    "closedAt": "2025-01-13T09:00:00Z"
+  }
+]
+`
+
+func TestParseGitHubIssues(t *testing.T) {
+	issues, err := Parse(SourceGitHub, []byte(githubExport), Options{})
+	require.NoError(t, err)
+	require.Len(t, issues, 3)
+
+	split := issues[0]
+	assert.Equal(t, domain.ExternalRef{Source: "github", Key: "acme/shop#12", URL: "https://github.com/acme/shop/issues/12"}, split.Ref)
+	assert.Equal(t, domain.StatusPlanned, split.Status)
+	assert.Equal(t, domain.PriorityHigh, split.Priority)
+	assert.Equal(t, []string{"backend", "priority: high"}, split.Labels)
+	assert.Equal(t, "octocat", split.Assignee)
+	require.NotNil(t, split.DueDate)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), split.DueDate.UTC())
+	assert.Empty(t, split.ParentKey)
+
+	move := issues[1]
+	assert.Equal(t, domain.StatusCompleted, move.Status)
+	assert.Equal(t, domain.PriorityCritical, move.Priority)
+	assert.Equal(t, "acme/shop#12", move.ParentKey)
+	require.NotNil(t, move.ClosedAt)
+
+	assert.Equal(t, domain.StatusCanceled, issues[2].Status)
+
+	// Without URLs the repository comes from the options
+	issues, err = ParseGitHubIssues([]byte(`[{"number": 7, "title": "No URL", "state": "OPEN"}]`), "acme/tools")
+	require.NoError(t, err)
+	assert.Equal(t, "acme/tools#7", issues[0].Ref.Key)
+
+	_, err = ParseGitHubIssues([]byte(`{"number": 7}`), "")
+	assert.Error(t, err)
+}
+
+// jiraExport mirrors Jira's "Export CSV (all fields)": repeated Labels
+// columns, locale dates and parents given by numeric issue id
+const jiraExport = `Summary,Issue key,Issue id,Issue Type,Status,Status Category,Priority,Assignee,Created,Updated,Resolved,Due Date,Labels,Labels,Description,Parent
+"Checkout, v2",SHOP-1,10001,Epic,In Progress,In Progress,Highest,Ada Lovelace,10/Jan/25 9:00 AM,12/Jan/25 4:30 PM,,01/Mar/25,checkout,payments,"Rework the checkout flow.
+Multi-line description.",
+Card payments,SHOP-2,10002,Story,QA Review,Done,Low,,11/Jan/25 10:15 AM,13/Jan/25 11:00 AM,13/Jan/25 11:00 AM,,payments,,,10001
+Remove PayPal,SHOP-3,10003,Task,Won't Do,Done,Medium,,11/Jan/25 10:15 AM,13/Jan/25 11:00 AM,,,,,,
+`
+
+func TestParseJiraCSV(t *testing.T) {
+	issues, err := Parse(SourceJira, []byte(jiraExport), Options{})
+	require.NoError(t, err)
+	require.Len(t, issues, 3)
+
+	epic := issues[0]
+	assert.Equal(t, domain.ExternalRef{Source: "jira", Key: "SHOP-1"}, epic.Ref)
+	assert.Equal(t, "Checkout, v2", epic.Title)
+	assert.Equal(t, "Rework the checkout flow.\nMulti-line description.", epic.Description)
+	assert.Equal(t, domain.StatusInProgress, epic.Status)
+	assert.Equal(t, domain.PriorityCritical, epic.Priority)
+	assert.Equal(t, []string{"checkout", "payments"}, epic.Labels)
+	assert.Equal(t, "Ada Lovelace", epic.Assignee)
+	assert.Equal(t, time.Date(2025, 1, 12, 16, 30, 0, 0, time.Local), epic.UpdatedAt)
+	require.NotNil(t, epic.DueDate)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local), *epic.DueDate)
+
+	story := issues[1]
+	assert.Equal(t, domain.StatusCompleted, story.Status, "an unknown status falls back to its category")
+	assert.Equal(t, domain.PriorityLow, story.Priority)
+	assert.Equal(t, "SHOP-1", story.ParentKey)
+	require.NotNil(t, story.ClosedAt)
+
+	assert.Equal(t, domain.StatusCanceled, issues[2].Status)
+
+	_, err = ParseJiraCSV([]byte("Summary,Status\nNo key,Done\n"))
+	assert.Error(t, err)
+	_, err = ParseJiraCSV([]byte("Summary,Issue key,Created\nBad date,X-1,yesterday\n"))
+	assert.Error(t, err)
+	_, err = Parse("trello", nil, Options{})
+	assert.Error(t, err)
+}
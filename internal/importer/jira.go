@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// jiraTimeLayouts covers the date formats Jira uses in CSV exports, which
+// follow the exporting user's locale settings
+var jiraTimeLayouts = []string{
+	"02/Jan/06 3:04 PM",
+	"02/Jan/06 15:04",
+	"02/Jan/06",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC3339,
+	"1/2/2006 15:04",
+	"1/2/2006",
+}
+
+// jiraColumns finds columns by header name. Jira repeats a header, such as
+// "Labels", once per value.
+type jiraColumns map[string][]int
+
+func (c jiraColumns) value(row []string, names ...string) string {
+	for _, name := range names {
+		for _, i := range c[strings.ToLower(name)] {
+			if i < len(row) && strings.TrimSpace(row[i]) != "" {
+				return strings.TrimSpace(row[i])
+			}
+		}
+	}
+	return ""
+}
+
+func (c jiraColumns) values(row []string, name string) []string {
+	values := make([]string, 0)
+	for _, i := range c[strings.ToLower(name)] {
+		if i < len(row) && strings.TrimSpace(row[i]) != "" {
+			values = append(values, strings.TrimSpace(row[i]))
+		}
+	}
+	return values
+}
+
+// ParseJiraCSV reads a Jira "Export CSV (all fields)" file. Issues are keyed
+// by their issue key. The parent comes from "Parent key", or from "Parent"
+// or "Parent id" (which hold the parent's numeric issue id), or from the
+// epic link.
+func ParseJiraCSV(data []byte) ([]*Issue, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Jira CSV export: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("invalid Jira CSV export: no header row")
+	}
+
+	columns := jiraColumns{}
+	for i, name := range rows[0] {
+		key := strings.ToLower(strings.TrimSpace(name))
+		columns[key] = append(columns[key], i)
+	}
+	if columns["issue key"] == nil || columns["summary"] == nil {
+		return nil, fmt.Errorf("invalid Jira CSV export: missing the Issue key or Summary column")
+	}
+
+	issues := make([]*Issue, 0, len(rows)-1)
+	keysByID := map[string]string{}
+	parentIDs := map[*Issue]string{}
+	for line, row := range rows[1:] {
+		key := columns.value(row, "Issue key")
+		if key == "" {
+			return nil, fmt.Errorf("invalid Jira CSV export: row %d has no issue key", line+2)
+		}
+		if id := columns.value(row, "Issue id"); id != "" {
+			keysByID[id] = key
+		}
+
+		issue := &Issue{
+			Ref:         domain.ExternalRef{Source: SourceJira, Key: key},
+			Title:       columns.value(row, "Summary"),
+			Description: columns.value(row, "Description"),
+			Status:      jiraStatus(columns.value(row, "Status"), columns.value(row, "Status Category")),
+			Labels:      columns.values(row, "Labels"),
+			Assignee:    columns.value(row, "Assignee"),
+		}
+		if priority := columns.value(row, "Priority"); priority != "" {
+			issue.Priority = jiraPriority(priority)
+		} else {
+			issue.Priority = priorityFromLabels(issue.Labels)
+		}
+		if issue.CreatedAt, err = parseJiraTime(columns.value(row, "Created")); err != nil {
+			return nil, fmt.Errorf("invalid Jira CSV export: %s created: %w", key, err)
+		}
+		if issue.UpdatedAt, err = parseJiraTime(columns.value(row, "Updated")); err != nil {
+			return nil, fmt.Errorf("invalid Jira CSV export: %s updated: %w", key, err)
+		}
+		if issue.DueDate, err = parseOptionalJiraTime(columns.value(row, "Due Date", "Due date")); err != nil {
+			return nil, fmt.Errorf("invalid Jira CSV export: %s due date: %w", key, err)
+		}
+		if issue.ClosedAt, err = parseOptionalJiraTime(columns.value(row, "Resolved")); err != nil {
+			return nil, fmt.Errorf("invalid Jira CSV export: %s resolved: %w", key, err)
+		}
+
+		issue.ParentKey = columns.value(row, "Parent key", "Custom field (Epic Link)")
+		if issue.ParentKey == "" {
+			if id := columns.value(row, "Parent", "Parent id"); id != "" {
+				parentIDs[issue] = id
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	// Parents may be listed after their children
+	for issue, id := range parentIDs {
+		if key, ok := keysByID[id]; ok {
+			issue.ParentKey = key
+		} else if strings.Contains(id, "-") {
+			issue.ParentKey = id
+		}
+	}
+	return issues, nil
+}
+
+func parseJiraTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range jiraTimeLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+func parseOptionalJiraTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := parseJiraTime(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// jiraStatus maps a workflow status by name, falling back to its category
+// ("To Do", "In Progress", "Done") for statuses it does not know
+func jiraStatus(status, category string) domain.TaskStatus {
+	switch strings.ToLower(status) {
+	case "done", "closed", "resolved", "complete", "completed":
+		return domain.StatusCompleted
+	case "in progress", "in review", "in development", "review", "testing":
+		return domain.StatusInProgress
+	case "blocked", "impeded":
+		return domain.StatusBlocked
+	case "on hold", "waiting", "deferred":
+		return domain.StatusOnHold
+	case "won't do", "wont do", "cancelled", "canceled", "rejected", "declined":
+		return domain.StatusCanceled
+	}
+	if category != "" && !strings.EqualFold(category, status) {
+		return jiraStatus(category, "")
+	}
+	return domain.StatusPlanned
+}
+
+func jiraPriority(priority string) domain.Priority {
+	switch strings.ToLower(priority) {
+	case "highest", "blocker", "critical", "urgent":
+		return domain.PriorityCritical
+	case "high", "major":
+		return domain.PriorityHigh
+	case "low", "lowest", "minor", "trivial":
+		return domain.PriorityLow
+	default:
+		return domain.PriorityMedium
+	}
+}
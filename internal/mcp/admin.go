@@ -0,0 +1,37 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type AdminCheckParams struct {
+	Repair bool `json:"repair,omitempty"`
+}
+
+func (s *MCPServer) handleAdminCheck(params json.RawMessage) (interface{}, error) {
+	var p AdminCheckParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+
+	return s.adminService.Check(p.Repair)
+}
+
+type AdminSnapshotParams struct {
+	ProjectID string `json:"projectId,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+func (s *MCPServer) handleAdminSnapshot(params json.RawMessage) (interface{}, error) {
+	var p AdminSnapshotParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+
+	return s.adminService.Snapshot(p.ProjectID, p.Reason)
+}
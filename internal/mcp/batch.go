@@ -0,0 +1,36 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+type BatchParams struct {
+	ProjectID string                `json:"projectId,omitempty"`
+	Commands  []domain.BatchCommand `json:"commands"`
+}
+
+func (s *MCPServer) handleBatch(params json.RawMessage) (interface{}, error) {
+	var p BatchParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	// Commands that name their own project do not need a current one, so a
+	// missing current project is only an error once a command needs it
+	projectID := p.ProjectID
+	if projectID == "" {
+		if current, err := s.projectService.GetCurrent(); err == nil {
+			projectID = current.ID
+		}
+	}
+
+	result, err := s.batchService.Apply(p.Commands, projectID, s.actor())
+	if err != nil {
+		return nil, err
+	}
+	s.contextRetriever.InvalidateAllTaskCaches()
+	return result, nil
+}
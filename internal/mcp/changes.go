@@ -0,0 +1,47 @@
+package mcp
+
+import (
+	"sort"
+
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// changedResources lists the resources whose content depends on each kind
+// of stored data
+var changedResources = map[storage.ChangeKind][]string{
+	storage.ChangeTasks:     {"compass://todos", "compass://overdue", "compass://blockers"},
+	storage.ChangeProject:   {"compass://projects", "compass://current"},
+	storage.ChangeConfig:    {"compass://current"},
+	storage.ChangeProcesses: {"compass://processes", "compass://processes/running", "compass://processes/failed", "compass://process-groups"},
+}
+
+// ApplyStorageChanges drops cached data made stale by changes written to
+// .compass, by this process or any other, and returns the URIs of the
+// resources whose content may have changed
+func (s *MCPServer) ApplyStorageChanges(changes []storage.Change) []string {
+	affected := map[string]bool{}
+	for _, change := range changes {
+		switch change.Kind {
+		case storage.ChangeAll:
+			s.contextRetriever.InvalidateAllTaskCaches()
+			for _, uris := range changedResources {
+				for _, uri := range uris {
+					affected[uri] = true
+				}
+			}
+			continue
+		case storage.ChangeTasks:
+			s.contextRetriever.InvalidateTaskCache(change.ProjectID)
+		}
+		for _, uri := range changedResources[change.Kind] {
+			affected[uri] = true
+		}
+	}
+
+	uris := make([]string, 0, len(affected))
+	for uri := range affected {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	return uris
+}
@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/importer"
+	"github.com/rcliao/compass/internal/service"
+)
+
+type ProjectExportParams struct {
+	ProjectID string `json:"projectId,omitempty"`
+	Format    string `json:"format,omitempty"`
+}
+
+func (s *MCPServer) handleProjectExport(params json.RawMessage) (interface{}, error) {
+	var p ProjectExportParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+
+	// Use current project if not specified
+	projectID := p.ProjectID
+	if projectID == "" {
+		current, err := s.projectService.GetCurrent()
+		if err != nil {
+			return nil, fmt.Errorf("no current project set and no projectId provided")
+		}
+		projectID = current.ID
+	}
+
+	bundle, err := s.exportService.Export(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Format == "" || p.Format == service.ExportFormatJSON {
+		return bundle, nil
+	}
+
+	// CSV and Markdown are returned as text
+	data, err := s.exportService.Encode(bundle, p.Format)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+type ProjectImportParams struct {
+	Bundle *domain.ProjectBundle `json:"bundle"`
+	Name   string                `json:"name,omitempty"`
+}
+
+func (s *MCPServer) handleProjectImport(params json.RawMessage) (interface{}, error) {
+	var p ProjectImportParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if p.Bundle == nil {
+		return nil, fmt.Errorf("bundle is required")
+	}
+
+	return s.exportService.Import(p.Bundle, p.Name)
+}
+
+type ImportIssuesParams struct {
+	Source    string `json:"source"`
+	Path      string `json:"path,omitempty"`
+	Content   string `json:"content,omitempty"`
+	ProjectID string `json:"projectId,omitempty"`
+	Repo      string `json:"repo,omitempty"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+}
+
+func (s *MCPServer) handleImportIssues(params json.RawMessage) (interface{}, error) {
+	var p ImportIssuesParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	data := []byte(p.Content)
+	switch {
+	case p.Path != "" && p.Content != "":
+		return nil, fmt.Errorf("pass either path or content, not both")
+	case p.Path != "":
+		var err error
+		if data, err = os.ReadFile(p.Path); err != nil {
+			return nil, err
+		}
+	case p.Content == "":
+		return nil, fmt.Errorf("path or content is required")
+	}
+
+	// Use current project if not specified
+	projectID := p.ProjectID
+	if projectID == "" {
+		current, err := s.projectService.GetCurrent()
+		if err != nil {
+			return nil, fmt.Errorf("no current project set and no projectId provided")
+		}
+		projectID = current.ID
+	}
+
+	issues, err := importer.Parse(p.Source, data, importer.Options{Repo: p.Repo})
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.issueImportService.Import(projectID, p.Source, issues, p.DryRun)
+	// A failed import may still have written the issues before the failure
+	s.contextRetriever.InvalidateTaskCache(projectID)
+	return result, err
+}
@@ -172,11 +172,61 @@ func getStatusHeader(status domain.TaskStatus) string {
 		return "✅ Completed"
 	case domain.StatusBlocked:
 		return "🚫 Blocked"
+	case domain.StatusOnHold:
+		return "⏸️ On Hold"
+	case domain.StatusCanceled:
+		return "🗑️ Canceled"
 	default:
 		return string(status)
 	}
 }
 
+// FormatBoardAsMarkdown formats a kanban board with column counts and WIP limits
+func FormatBoardAsMarkdown(board *domain.Board) string {
+	var sb strings.Builder
+	sb.WriteString("# 🗂️ Board\n\n")
+	sb.WriteString(fmt.Sprintf("**WIP Policy:** %s\n\n", board.Policy))
+
+	for _, column := range board.Columns {
+		// Hide empty columns that have no limit configured
+		if column.Count == 0 && column.Limit == 0 {
+			continue
+		}
+
+		header := fmt.Sprintf("## %s (%d", getStatusHeader(column.Status), column.Count)
+		if column.Limit > 0 {
+			header += fmt.Sprintf("/%d", column.Limit)
+		}
+		header += ")"
+		if column.Full {
+			header += " ⚠️ at limit"
+		}
+		sb.WriteString(header + "\n\n")
+
+		for _, task := range column.Tasks {
+			sb.WriteString(formatBoardCard(task))
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimSpace(sb.String())
+}
+
+func formatBoardCard(task *domain.Task) string {
+	id := task.ID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	line := fmt.Sprintf("- **%s** `[%s]`", task.Card.Title, id)
+	if task.Card.Priority != "" {
+		line += fmt.Sprintf(" (%s)", task.Card.Priority)
+	}
+	if task.Card.AssignedTo != nil {
+		line += fmt.Sprintf(" 👤 %s", *task.Card.AssignedTo)
+	}
+	return line + "\n"
+}
+
 // FormatProjectsAsMarkdown formats a list of projects as markdown
 func FormatProjectsAsMarkdown(projects []*domain.Project) string {
 	if len(projects) == 0 {
@@ -275,6 +325,10 @@ func FormatProcessStatusAsMarkdown(process *domain.Process) string {
 	if len(process.Environment) > 0 {
 		sb.WriteString(fmt.Sprintf("\n### Environment Variables\n"))
 		for k, v := range process.Environment {
+			if name, ok := domain.ParseSecretRef(v); ok {
+				sb.WriteString(fmt.Sprintf("- `%s` from secret `%s`\n", k, name))
+				continue
+			}
 			sb.WriteString(fmt.Sprintf("- `%s=%s`\n", k, v))
 		}
 	}
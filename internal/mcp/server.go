@@ -7,6 +7,7 @@ import (
 	"log"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rcliao/compass/internal/domain"
@@ -20,9 +21,24 @@ type MCPServer struct {
 	planningService     *service.PlanningService
 	summaryService      *service.ProjectSummaryService
 	processOrchestrator *service.ProcessOrchestrator
-}
-
-func NewMCPServer(taskService *service.TaskService, projectService *service.ProjectService, contextRetriever *service.ContextRetriever, planningService *service.PlanningService, summaryService *service.ProjectSummaryService, processOrchestrator *service.ProcessOrchestrator) *MCPServer {
+	boardService        *service.BoardService
+	leaseService        *service.LeaseService
+	adminService        *service.AdminService
+	exportService       *service.ExportService
+	issueImportService  *service.IssueImportService
+	batchService        *service.BatchService
+	sessionMu           sync.RWMutex
+	agent               domain.AgentIdentity
+	focusTaskID         string
+}
+
+func NewMCPServer(taskService *service.TaskService, projectService *service.ProjectService, contextRetriever *service.ContextRetriever, planningService *service.PlanningService, summaryService *service.ProjectSummaryService, processOrchestrator *service.ProcessOrchestrator, boardService *service.BoardService, leaseService *service.LeaseService, adminService *service.AdminService, exportService *service.ExportService, issueImportService *service.IssueImportService, batchService *service.BatchService) *MCPServer {
+	// Every task written through the service drops the retriever's cached
+	// copy before the command returns; the watcher only covers writes made
+	// by other processes
+	if taskService != nil && contextRetriever != nil {
+		taskService.OnChange(contextRetriever.InvalidateTaskCache)
+	}
 	return &MCPServer{
 		taskService:         taskService,
 		projectService:      projectService,
@@ -30,6 +46,12 @@ func NewMCPServer(taskService *service.TaskService, projectService *service.Proj
 		planningService:     planningService,
 		summaryService:      summaryService,
 		processOrchestrator: processOrchestrator,
+		boardService:        boardService,
+		leaseService:        leaseService,
+		adminService:        adminService,
+		exportService:       exportService,
+		issueImportService:  issueImportService,
+		batchService:        batchService,
 	}
 }
 
@@ -61,6 +83,28 @@ func (s *MCPServer) HandleCommand(method string, params json.RawMessage) (interf
 		return s.handleProjectCurrent()
 	case "compass.project.set_current":
 		return s.handleProjectSetCurrent(params)
+	case "compass.project.export":
+		return s.handleProjectExport(params)
+	case "compass.project.import":
+		return s.handleProjectImport(params)
+	case "compass.import.issues":
+		return s.handleImportIssues(params)
+	case "compass.batch":
+		return s.handleBatch(params)
+		
+	// Agent commands
+	case "compass.agent.whoami":
+		return s.handleAgentWhoami()
+	case "compass.agent.set_label":
+		return s.handleAgentSetLabel(params)
+		
+	// Focus commands
+	case "compass.focus.set":
+		return s.handleFocusSet(params)
+	case "compass.focus.get":
+		return s.handleFocusGet()
+	case "compass.focus.clear":
+		return s.handleFocusClear()
 		
 	// Task commands
 	case "compass.task.create":
@@ -73,6 +117,12 @@ func (s *MCPServer) HandleCommand(method string, params json.RawMessage) (interf
 		return s.handleTaskGet(params)
 	case "compass.task.delete":
 		return s.handleTaskDelete(params)
+	case "compass.task.claim":
+		return s.handleTaskClaim(params)
+	case "compass.task.heartbeat":
+		return s.handleTaskHeartbeat(params)
+	case "compass.task.release":
+		return s.handleTaskRelease(params)
 		
 	// Context commands
 	case "compass.context.get":
@@ -88,6 +138,12 @@ func (s *MCPServer) HandleCommand(method string, params json.RawMessage) (interf
 	case "compass.blockers":
 		return s.handleGetBlockers(params)
 		
+	// Board commands
+	case "compass.board":
+		return s.handleBoard(params)
+	case "compass.board.limits":
+		return s.handleBoardLimits(params)
+		
 	// Planning commands
 	case "compass.planning.start":
 		return s.handlePlanningStart(params)
@@ -160,6 +216,12 @@ func (s *MCPServer) HandleCommand(method string, params json.RawMessage) (interf
 	case "compass.todo.progress":
 		return s.handleTodoUpdateProgress(params)
 		
+	// Admin commands
+	case "compass.admin.check":
+		return s.handleAdminCheck(params)
+	case "compass.admin.snapshot":
+		return s.handleAdminSnapshot(params)
+		
 	default:
 		return nil, fmt.Errorf("unknown method: %s", method)
 	}
@@ -179,6 +241,8 @@ func (s *MCPServer) handleProjectCreate(params json.RawMessage) (interface{}, er
 	}
 	
 	project := domain.NewProject(p.Name, p.Description, p.Goal)
+	project.CreatedBy = s.actor()
+	project.UpdatedBy = project.CreatedBy
 	if err := s.projectService.Create(project); err != nil {
 		return nil, err
 	}
@@ -252,6 +316,8 @@ func (s *MCPServer) handleTaskCreate(params json.RawMessage) (interface{}, error
 	if len(p.Acceptance) > 0 {
 		task.Criteria.Acceptance = p.Acceptance
 	}
+	task.Card.CreatedBy = s.actor()
+	task.Card.UpdatedBy = task.Card.CreatedBy
 	
 	if err := s.taskService.Create(task); err != nil {
 		return nil, err
@@ -263,6 +329,9 @@ func (s *MCPServer) handleTaskCreate(params json.RawMessage) (interface{}, error
 type UpdateTaskParams struct {
 	ID      string                 `json:"id"`
 	Updates map[string]interface{} `json:"updates"`
+	// IfMatch is the task version the caller last read; the update fails
+	// with a conflict if the task has changed since
+	IfMatch *int `json:"ifMatch,omitempty"`
 }
 
 func (s *MCPServer) handleTaskUpdate(params json.RawMessage) (interface{}, error) {
@@ -271,13 +340,45 @@ func (s *MCPServer) handleTaskUpdate(params json.RawMessage) (interface{}, error
 		return nil, fmt.Errorf("invalid parameters: %w", err)
 	}
 	
-	return s.taskService.Update(p.ID, p.Updates)
+	updates := s.stamp(p.Updates)
+	if p.IfMatch != nil {
+		updates["version"] = *p.IfMatch
+	}
+	
+	// WIP limits are enforced by the task service; under the warn policy the
+	// move goes through and the violation is passed on
+	task, violation, err := s.taskService.UpdateChecked(p.ID, updates)
+	if err != nil {
+		return nil, err
+	}
+	
+	if violation != nil {
+		return map[string]interface{}{
+			"task":    task,
+			"warning": violation.Error(),
+		}, nil
+	}
+	
+	return task, nil
 }
 
 type ListTasksParams struct {
-	ProjectID *string             `json:"projectId,omitempty"`
-	Status    *domain.TaskStatus  `json:"status,omitempty"`
-	Parent    *string             `json:"parent,omitempty"`
+	ProjectID    *string              `json:"projectId,omitempty"`
+	Status       *domain.TaskStatus   `json:"status,omitempty"`
+	Priority     *domain.Priority     `json:"priority,omitempty"`
+	Parent       *string              `json:"parent,omitempty"`
+	Labels       []string             `json:"labels,omitempty"`
+	AssignedTo   *string              `json:"assignedTo,omitempty"`
+	DueBefore    *time.Time           `json:"dueBefore,omitempty"`
+	DueAfter     *time.Time           `json:"dueAfter,omitempty"`
+	CreatedAfter *time.Time           `json:"createdAfter,omitempty"`
+	UpdatedAfter *time.Time           `json:"updatedAfter,omitempty"`
+	SortBy       domain.TaskSortField `json:"sortBy,omitempty"`
+	SortDesc     bool                 `json:"sortDesc,omitempty"`
+	Limit        int                  `json:"limit,omitempty"`
+	Offset       int                  `json:"offset,omitempty"`
+	AsOf         *time.Time           `json:"asOf,omitempty"`
+	Archived     domain.ArchiveScope  `json:"archived,omitempty"`
 }
 
 func (s *MCPServer) handleTaskList(params json.RawMessage) (interface{}, error) {
@@ -289,16 +390,38 @@ func (s *MCPServer) handleTaskList(params json.RawMessage) (interface{}, error)
 	}
 	
 	filter := domain.TaskFilter{
-		ProjectID: p.ProjectID,
-		Status:    p.Status,
-		Parent:    p.Parent,
+		ProjectID:    p.ProjectID,
+		Status:       p.Status,
+		Priority:     p.Priority,
+		Parent:       p.Parent,
+		Labels:       p.Labels,
+		AssignedTo:   p.AssignedTo,
+		DueBefore:    p.DueBefore,
+		DueAfter:     p.DueAfter,
+		CreatedAfter: p.CreatedAfter,
+		UpdatedAfter: p.UpdatedAfter,
+		SortBy:       p.SortBy,
+		SortDesc:     p.SortDesc,
+		Limit:        p.Limit,
+		Offset:       p.Offset,
+		Archived:     p.Archived,
+	}
+	if !domain.IsValidTaskSortField(filter.SortBy) {
+		return nil, fmt.Errorf("invalid sortBy %q", filter.SortBy)
+	}
+	if !domain.IsValidArchiveScope(filter.Archived) {
+		return nil, fmt.Errorf("invalid archived %q: expected include or only", filter.Archived)
+	}
+	
+	if p.AsOf != nil {
+		return s.taskService.ListAsOf(filter, *p.AsOf)
 	}
-	
 	return s.taskService.List(filter)
 }
 
 type GetTaskParams struct {
-	ID string `json:"id"`
+	ID   string     `json:"id"`
+	AsOf *time.Time `json:"asOf,omitempty"`
 }
 
 func (s *MCPServer) handleTaskGet(params json.RawMessage) (interface{}, error) {
@@ -307,6 +430,9 @@ func (s *MCPServer) handleTaskGet(params json.RawMessage) (interface{}, error) {
 		return nil, fmt.Errorf("invalid parameters: %w", err)
 	}
 	
+	if p.AsOf != nil {
+		return s.taskService.GetAsOf(p.ID, *p.AsOf)
+	}
 	return s.taskService.Get(p.ID)
 }
 
@@ -320,6 +446,13 @@ func (s *MCPServer) handleTaskDelete(params json.RawMessage) (interface{}, error
 		return nil, fmt.Errorf("invalid parameters: %w", err)
 	}
 	
+	if _, err := s.taskService.Get(p.ID); err != nil {
+		return nil, err
+	}
+	if _, err := s.adminService.AutoSnapshot("task-delete"); err != nil {
+		return nil, fmt.Errorf("failed to snapshot the workspace before deleting: %w", err)
+	}
+	
 	if err := s.taskService.Delete(p.ID); err != nil {
 		return nil, err
 	}
@@ -327,6 +460,44 @@ func (s *MCPServer) handleTaskDelete(params json.RawMessage) (interface{}, error
 	return map[string]string{"status": "success"}, nil
 }
 
+type ClaimTaskParams struct {
+	ID         string `json:"id"`
+	Agent      string `json:"agent"`
+	TTLSeconds int    `json:"ttlSeconds,omitempty"`
+}
+
+func (s *MCPServer) handleTaskClaim(params json.RawMessage) (interface{}, error) {
+	var p ClaimTaskParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	
+	return s.leaseService.Claim(p.ID, s.leaseHolder(p.Agent), time.Duration(p.TTLSeconds)*time.Second, s.actor())
+}
+
+func (s *MCPServer) handleTaskHeartbeat(params json.RawMessage) (interface{}, error) {
+	var p ClaimTaskParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	
+	return s.leaseService.Heartbeat(p.ID, s.leaseHolder(p.Agent), time.Duration(p.TTLSeconds)*time.Second, s.actor())
+}
+
+type ReleaseTaskParams struct {
+	ID    string `json:"id"`
+	Agent string `json:"agent"`
+}
+
+func (s *MCPServer) handleTaskRelease(params json.RawMessage) (interface{}, error) {
+	var p ReleaseTaskParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	
+	return s.leaseService.Release(p.ID, s.leaseHolder(p.Agent), s.actor())
+}
+
 // Context handlers
 type GetContextParams struct {
 	TaskID string `json:"taskId"`
@@ -383,6 +554,7 @@ func (s *MCPServer) handleContextCheck(params json.RawMessage) (interface{}, err
 type GetNextTaskParams struct {
 	ProjectID string   `json:"projectId,omitempty"`
 	Exclude   []string `json:"exclude,omitempty"`
+	Agent     string   `json:"agent,omitempty"`
 }
 
 func (s *MCPServer) handleGetNextTask(params json.RawMessage) (interface{}, error) {
@@ -406,6 +578,7 @@ func (s *MCPServer) handleGetNextTask(params json.RawMessage) (interface{}, erro
 	criteria := domain.NextTaskCriteria{
 		ProjectID: projectID,
 		Exclude:   p.Exclude,
+		Agent:     s.leaseHolder(p.Agent),
 	}
 	
 	return s.contextRetriever.GetNextTask(criteria)
@@ -443,6 +616,74 @@ func (s *MCPServer) handleGetBlockers(params json.RawMessage) (interface{}, erro
 	return s.taskService.List(filter)
 }
 
+// Board handlers
+type BoardParams struct {
+	ProjectID string `json:"projectId,omitempty"`
+}
+
+func (s *MCPServer) handleBoard(params json.RawMessage) (interface{}, error) {
+	var p BoardParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+	
+	// Use current project if not specified
+	projectID := p.ProjectID
+	if projectID == "" {
+		current, err := s.projectService.GetCurrent()
+		if err != nil {
+			return nil, fmt.Errorf("no current project set and no projectId provided")
+		}
+		projectID = current.ID
+	}
+	
+	board, err := s.boardService.GetBoard(projectID)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Return markdown formatted string
+	return FormatBoardAsMarkdown(board), nil
+}
+
+type BoardLimitsParams struct {
+	ProjectID string                    `json:"projectId,omitempty"`
+	Limits    map[domain.TaskStatus]int `json:"limits,omitempty"`
+	Policy    domain.WIPPolicy          `json:"policy,omitempty"`
+}
+
+func (s *MCPServer) handleBoardLimits(params json.RawMessage) (interface{}, error) {
+	var p BoardLimitsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+	
+	// Use current project if not specified
+	projectID := p.ProjectID
+	if projectID == "" {
+		current, err := s.projectService.GetCurrent()
+		if err != nil {
+			return nil, fmt.Errorf("no current project set and no projectId provided")
+		}
+		projectID = current.ID
+	}
+	
+	project, err := s.boardService.SetLimits(projectID, p.Limits, p.Policy, s.actor())
+	if err != nil {
+		return nil, err
+	}
+	
+	return map[string]interface{}{
+		"projectId": project.ID,
+		"limits":    project.WIPLimits,
+		"policy":    project.EffectiveWIPPolicy(),
+	}, nil
+}
+
 // Planning handlers
 type StartPlanningParams struct {
 	ProjectID string `json:"projectId,omitempty"`
@@ -465,11 +706,12 @@ func (s *MCPServer) handlePlanningStart(params json.RawMessage) (interface{}, er
 		projectID = current.ID
 	}
 	
-	return s.planningService.StartPlanningSession(projectID, p.Name)
+	return s.planningService.StartPlanningSession(projectID, p.Name, s.actor())
 }
 
 type ListPlanningParams struct {
-	ProjectID string `json:"projectId,omitempty"`
+	ProjectID string              `json:"projectId,omitempty"`
+	Archived  domain.ArchiveScope `json:"archived,omitempty"`
 }
 
 func (s *MCPServer) handlePlanningList(params json.RawMessage) (interface{}, error) {
@@ -490,7 +732,11 @@ func (s *MCPServer) handlePlanningList(params json.RawMessage) (interface{}, err
 		projectID = current.ID
 	}
 	
-	return s.planningService.ListPlanningSessions(projectID)
+	if !domain.IsValidArchiveScope(p.Archived) {
+		return nil, fmt.Errorf("invalid archived %q: expected include or only", p.Archived)
+	}
+	
+	return s.planningService.ListPlanningSessions(projectID, p.Archived)
 }
 
 type GetPlanningParams struct {
@@ -556,7 +802,7 @@ func (s *MCPServer) handleDiscoveryAdd(params json.RawMessage) (interface{}, err
 		projectID = current.ID
 	}
 	
-	return s.planningService.RecordDiscovery(projectID, p.Insight, p.Impact, p.Source, p.AffectedTaskIDs)
+	return s.planningService.RecordDiscovery(projectID, p.Insight, p.Impact, p.Source, s.linkToFocus(p.AffectedTaskIDs), s.actor())
 }
 
 type ListDiscoveryParams struct {
@@ -610,7 +856,7 @@ func (s *MCPServer) handleDecisionRecord(params json.RawMessage) (interface{}, e
 		projectID = current.ID
 	}
 	
-	return s.planningService.RecordDecision(projectID, p.Question, p.Choice, p.Rationale, p.Alternatives, p.Reversible, p.AffectedTaskIDs)
+	return s.planningService.RecordDecision(projectID, p.Question, p.Choice, p.Rationale, p.Alternatives, p.Reversible, s.linkToFocus(p.AffectedTaskIDs), s.actor())
 }
 
 type ListDecisionParams struct {
@@ -639,7 +885,8 @@ func (s *MCPServer) handleDecisionList(params json.RawMessage) (interface{}, err
 }
 
 type ProjectSummaryParams struct {
-	ProjectID string `json:"projectId,omitempty"`
+	ProjectID string     `json:"projectId,omitempty"`
+	AsOf      *time.Time `json:"asOf,omitempty"`
 }
 
 func (s *MCPServer) handleProjectSummary(params json.RawMessage) (interface{}, error) {
@@ -660,6 +907,9 @@ func (s *MCPServer) handleProjectSummary(params json.RawMessage) (interface{}, e
 		projectID = current.ID
 	}
 	
+	if p.AsOf != nil {
+		return s.summaryService.GenerateProjectSummaryAsOf(projectID, *p.AsOf)
+	}
 	return s.summaryService.GenerateProjectSummary(projectID)
 }
 
@@ -745,6 +995,8 @@ func (s *MCPServer) handleProcessCreate(params json.RawMessage) (interface{}, er
 		process.Port = p.Port
 	}
 	
+	process.CreatedBy = s.actor()
+	
 	if err := s.processOrchestrator.Create(process); err != nil {
 		return nil, err
 	}
@@ -876,12 +1128,24 @@ type ProcessIDParams struct {
 	ID string `json:"id"`
 }
 
+type StartProcessParams struct {
+	ID     string `json:"id"`
+	TaskID string `json:"taskId,omitempty"`
+}
+
 func (s *MCPServer) handleProcessStart(params json.RawMessage) (interface{}, error) {
-	var p ProcessIDParams
+	var p StartProcessParams
 	if err := json.Unmarshal(params, &p); err != nil {
 		return nil, fmt.Errorf("invalid parameters: %w", err)
 	}
 	
+	// Link the run to the task it serves, falling back to the focus task
+	if taskIDs := s.linkToFocus(nonEmpty(p.TaskID)); len(taskIDs) > 0 {
+		if _, err := s.processOrchestrator.Update(p.ID, map[string]interface{}{"taskId": taskIDs[0]}); err != nil {
+			return nil, err
+		}
+	}
+	
 	if err := s.processOrchestrator.Start(p.ID); err != nil {
 		return nil, err
 	}
@@ -1030,6 +1294,8 @@ func (s *MCPServer) handleProcessGroupCreate(params json.RawMessage) (interface{
 		group.ProcessIDs = p.ProcessIDs
 	}
 	
+	group.CreatedBy = s.actor()
+	
 	if err := s.processOrchestrator.CreateGroup(group); err != nil {
 		return nil, err
 	}
@@ -1249,6 +1515,9 @@ func (s *MCPServer) handleTodoCreate(params json.RawMessage) (interface{}, error
 		todo.Criteria.Verification = p.Criteria.Verification
 	}
 	
+	todo.Card.CreatedBy = s.actor()
+	todo.Card.UpdatedBy = todo.Card.CreatedBy
+	
 	if err := s.taskService.Create(todo); err != nil {
 		return nil, err
 	}
@@ -1300,7 +1569,7 @@ func (s *MCPServer) handleTodoComplete(params json.RawMessage) (interface{}, err
 	}
 	
 	// Complete with verification
-	if err := todo.CompleteWithVerification(evidence, "compass-agent", p.CompletionNotes); err != nil {
+	if err := todo.CompleteWithVerification(evidence, s.actor(), p.CompletionNotes); err != nil {
 		return nil, fmt.Errorf("failed to complete task with verification: %w", err)
 	}
 	
@@ -1312,7 +1581,7 @@ func (s *MCPServer) handleTodoComplete(params json.RawMessage) (interface{}, err
 		"verification": todo.Card.Verification,
 	}
 	
-	return s.taskService.Update(p.ID, updates)
+	return s.taskService.Update(p.ID, s.stamp(updates))
 }
 
 // Helper methods for audit trail capture
@@ -1385,7 +1654,7 @@ func (s *MCPServer) handleTodoReopen(params json.RawMessage) (interface{}, error
 		"updatedAt":   todo.Card.UpdatedAt,
 	}
 	
-	return s.taskService.Update(p.ID, updates)
+	return s.taskService.Update(p.ID, s.stamp(updates))
 }
 
 type ListTodosParams struct {
@@ -1396,7 +1665,13 @@ type ListTodosParams struct {
 	AssignedTo   *string           `json:"assignedTo,omitempty"`
 	DueBefore    *time.Time        `json:"dueBefore,omitempty"`
 	DueAfter     *time.Time        `json:"dueAfter,omitempty"`
+	CreatedAfter *time.Time        `json:"createdAfter,omitempty"`
+	UpdatedAfter *time.Time        `json:"updatedAfter,omitempty"`
+	SortBy       domain.TaskSortField `json:"sortBy,omitempty"`
+	SortDesc     bool              `json:"sortDesc,omitempty"`
 	Limit        int               `json:"limit,omitempty"`
+	Offset       int               `json:"offset,omitempty"`
+	Archived     domain.ArchiveScope `json:"archived,omitempty"`
 }
 
 func (s *MCPServer) handleTodoList(params json.RawMessage) (interface{}, error) {
@@ -1417,13 +1692,26 @@ func (s *MCPServer) handleTodoList(params json.RawMessage) (interface{}, error)
 	}
 	
 	filter := domain.TaskFilter{
-		ProjectID:  projectID,
-		Status:     p.Status,
-		Priority:   p.Priority,
-		Labels:     p.Labels,
-		AssignedTo: p.AssignedTo,
-		DueBefore:  p.DueBefore,
-		DueAfter:   p.DueAfter,
+		ProjectID:    projectID,
+		Status:       p.Status,
+		Priority:     p.Priority,
+		Labels:       p.Labels,
+		AssignedTo:   p.AssignedTo,
+		DueBefore:    p.DueBefore,
+		DueAfter:     p.DueAfter,
+		CreatedAfter: p.CreatedAfter,
+		UpdatedAfter: p.UpdatedAfter,
+		SortBy:       p.SortBy,
+		SortDesc:     p.SortDesc,
+		Limit:        p.Limit,
+		Offset:       p.Offset,
+		Archived:     p.Archived,
+	}
+	if !domain.IsValidTaskSortField(filter.SortBy) {
+		return nil, fmt.Errorf("invalid sortBy %q", filter.SortBy)
+	}
+	if !domain.IsValidArchiveScope(filter.Archived) {
+		return nil, fmt.Errorf("invalid archived %q: expected include or only", filter.Archived)
 	}
 	
 	todos, err := s.taskService.List(filter)
@@ -1431,11 +1719,6 @@ func (s *MCPServer) handleTodoList(params json.RawMessage) (interface{}, error)
 		return nil, err
 	}
 	
-	// Apply limit if specified
-	if p.Limit > 0 && len(todos) > p.Limit {
-		todos = todos[:p.Limit]
-	}
-	
 	// Return markdown formatted string
 	return FormatTodosAsMarkdown(todos), nil
 }
@@ -1493,7 +1776,7 @@ func (s *MCPServer) handleTodoUpdatePriority(params json.RawMessage) (interface{
 		"updatedAt": time.Now(),
 	}
 	
-	return s.taskService.Update(p.ID, updates)
+	return s.taskService.Update(p.ID, s.stamp(updates))
 }
 
 type SetTodoDueParams struct {
@@ -1512,7 +1795,7 @@ func (s *MCPServer) handleTodoSetDue(params json.RawMessage) (interface{}, error
 		"updatedAt": time.Now(),
 	}
 	
-	return s.taskService.Update(p.ID, updates)
+	return s.taskService.Update(p.ID, s.stamp(updates))
 }
 
 type TodoLabelParams struct {
@@ -1538,7 +1821,7 @@ func (s *MCPServer) handleTodoAddLabel(params json.RawMessage) (interface{}, err
 		"updatedAt": todo.Card.UpdatedAt,
 	}
 	
-	return s.taskService.Update(p.ID, updates)
+	return s.taskService.Update(p.ID, s.stamp(updates))
 }
 
 func (s *MCPServer) handleTodoRemoveLabel(params json.RawMessage) (interface{}, error) {
@@ -1559,7 +1842,7 @@ func (s *MCPServer) handleTodoRemoveLabel(params json.RawMessage) (interface{},
 		"updatedAt": todo.Card.UpdatedAt,
 	}
 	
-	return s.taskService.Update(p.ID, updates)
+	return s.taskService.Update(p.ID, s.stamp(updates))
 }
 
 type UpdateTodoProgressParams struct {
@@ -1585,7 +1868,7 @@ func (s *MCPServer) handleTodoUpdateProgress(params json.RawMessage) (interface{
 		"updatedAt":   todo.Card.UpdatedAt,
 	}
 	
-	return s.taskService.Update(p.ID, updates)
+	return s.taskService.Update(p.ID, s.stamp(updates))
 }
 
 // Shutdown gracefully shuts down the MCP server and all managed processes
@@ -2,24 +2,37 @@ package mcp
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/rcliao/compass/internal/domain"
 	"github.com/rcliao/compass/internal/service"
 	"github.com/rcliao/compass/internal/storage"
 )
 
-func TestMCPServer_ProjectCommands(t *testing.T) {
-	// Setup
+func newTestServer() *MCPServer {
 	memStorage := storage.NewMemoryStorage()
 	taskService := service.NewTaskService(memStorage)
 	projectService := service.NewProjectService(memStorage)
 	contextRetriever := service.NewContextRetriever(memStorage, memStorage)
 	planningService := service.NewPlanningService(memStorage, taskService, projectService)
 	summaryService := service.NewProjectSummaryService(taskService, projectService, planningService)
-	server := NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService)
+	boardService := service.NewBoardService(taskService, projectService)
+	leaseService := service.NewLeaseService(taskService)
+	adminService := service.NewAdminService(memStorage, nil)
+	exportService := service.NewExportService(memStorage)
+	issueImportService := service.NewIssueImportService(memStorage)
+	batchService := service.NewBatchService(memStorage)
+	return NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService, nil, boardService, leaseService, adminService, exportService, issueImportService, batchService)
+}
+
+func TestMCPServer_ProjectCommands(t *testing.T) {
+	// Setup
+	server := newTestServer()
 
 	// Test project creation
 	createParams := CreateProjectParams{
@@ -45,13 +58,7 @@ func TestMCPServer_ProjectCommands(t *testing.T) {
 
 func TestMCPServer_TaskCommands(t *testing.T) {
 	// Setup
-	memStorage := storage.NewMemoryStorage()
-	taskService := service.NewTaskService(memStorage)
-	projectService := service.NewProjectService(memStorage)
-	contextRetriever := service.NewContextRetriever(memStorage, memStorage)
-	planningService := service.NewPlanningService(memStorage, taskService, projectService)
-	summaryService := service.NewProjectSummaryService(taskService, projectService, planningService)
-	server := NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService)
+	server := newTestServer()
 
 	// Create a project first
 	createProjectParams := CreateProjectParams{
@@ -105,17 +112,504 @@ func TestMCPServer_TaskCommands(t *testing.T) {
 
 func TestMCPServer_UnknownCommand(t *testing.T) {
 	// Setup
-	memStorage := storage.NewMemoryStorage()
-	taskService := service.NewTaskService(memStorage)
-	projectService := service.NewProjectService(memStorage)
-	contextRetriever := service.NewContextRetriever(memStorage, memStorage)
-	planningService := service.NewPlanningService(memStorage, taskService, projectService)
-	summaryService := service.NewProjectSummaryService(taskService, projectService, planningService)
-	server := NewMCPServer(taskService, projectService, contextRetriever, planningService, summaryService)
+	server := newTestServer()
 
 	// Test unknown command
 	result, err := server.HandleCommand("compass.unknown.command", nil)
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.Contains(t, err.Error(), "unknown method")
-}
\ No newline at end of file
+}
+
+func TestMCPServer_TaskUpdateWIPLimit(t *testing.T) {
+	// Setup
+	server := newTestServer()
+
+	projectResult, err := server.HandleCommand("compass.project.create", json.RawMessage(`{"name":"Board","description":"WIP","goal":"Limit WIP"}`))
+	require.NoError(t, err)
+	project := projectResult.(*domain.Project)
+	require.NoError(t, server.projectService.SetCurrent(project.ID))
+
+	_, err = server.HandleCommand("compass.board.limits", json.RawMessage(`{"limits":{"in-progress":1},"policy":"reject"}`))
+	require.NoError(t, err)
+
+	var ids []string
+	for _, title := range []string{"First", "Second"} {
+		params, _ := json.Marshal(CreateTaskParams{ProjectID: project.ID, Title: title})
+		result, err := server.HandleCommand("compass.task.create", params)
+		require.NoError(t, err)
+		ids = append(ids, result.(*domain.Task).ID)
+	}
+
+	move := func(id string) (interface{}, error) {
+		params, _ := json.Marshal(UpdateTaskParams{ID: id, Updates: map[string]interface{}{"status": "in-progress"}})
+		return server.HandleCommand("compass.task.update", params)
+	}
+
+	_, err = move(ids[0])
+	require.NoError(t, err)
+
+	// Second task would exceed the limit of one in-progress task
+	_, err = move(ids[1])
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "WIP limit reached")
+
+	// Switching to warn lets the move through with a warning
+	_, err = server.HandleCommand("compass.board.limits", json.RawMessage(`{"policy":"warn"}`))
+	require.NoError(t, err)
+
+	result, err := move(ids[1])
+	require.NoError(t, err)
+	response, ok := result.(map[string]interface{})
+	require.True(t, ok)
+	assert.Contains(t, response["warning"], "WIP limit reached")
+
+	board, err := server.HandleCommand("compass.board", nil)
+	require.NoError(t, err)
+	assert.Contains(t, board, "(2/1) ⚠️ at limit")
+}
+
+func TestMCPServer_TaskUpdateIfMatch(t *testing.T) {
+	// Setup
+	server := newTestServer()
+
+	projectResult, err := server.HandleCommand("compass.project.create", json.RawMessage(`{"name":"Versions","description":"ifMatch","goal":"No lost updates"}`))
+	require.NoError(t, err)
+	project := projectResult.(*domain.Project)
+
+	params, _ := json.Marshal(CreateTaskParams{ProjectID: project.ID, Title: "Shared"})
+	result, err := server.HandleCommand("compass.task.create", params)
+	require.NoError(t, err)
+	task := result.(*domain.Task)
+
+	update := func(title string, ifMatch int) (interface{}, error) {
+		params, _ := json.Marshal(UpdateTaskParams{ID: task.ID, Updates: map[string]interface{}{"title": title}, IfMatch: &ifMatch})
+		return server.HandleCommand("compass.task.update", params)
+	}
+
+	result, err = update("First agent", task.Version)
+	require.NoError(t, err)
+	assert.Equal(t, task.Version+1, result.(*domain.Task).Version)
+
+	// The second agent read the same version and loses the race
+	_, err = update("Second agent", task.Version)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	assert.Contains(t, err.Error(), "was modified by someone else")
+}
+
+func TestMCPServer_AgentIdentity(t *testing.T) {
+	// Setup
+	server := newTestServer()
+	server.SetClientInfo("test-client", "1.2.3")
+
+	labelParams, err := json.Marshal(SetAgentLabelParams{Label: "reviewer"})
+	require.NoError(t, err)
+	_, err = server.HandleCommand("compass.agent.set_label", labelParams)
+	require.NoError(t, err)
+
+	projectParams, err := json.Marshal(CreateProjectParams{Name: "Test Project", Description: "A test project", Goal: "Track agents"})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.project.create", projectParams)
+	require.NoError(t, err)
+	project := result.(*domain.Project)
+	assert.Equal(t, "reviewer (test-client/1.2.3)", project.CreatedBy)
+
+	taskParams, err := json.Marshal(CreateTaskParams{ProjectID: project.ID, Title: "Tracked Task", Description: "Who made me?"})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.task.create", taskParams)
+	require.NoError(t, err)
+	task := result.(*domain.Task)
+	assert.Equal(t, "reviewer (test-client/1.2.3)", task.Card.CreatedBy)
+
+	// Updates are attributed to whoever made them
+	server.SetAgentLabel("")
+	updateParams, err := json.Marshal(UpdateTaskParams{ID: task.ID, Updates: map[string]interface{}{"title": "Renamed Task"}})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.task.update", updateParams)
+	require.NoError(t, err)
+	updated := result.(*domain.Task)
+	assert.Equal(t, "test-client/1.2.3", updated.Card.UpdatedBy)
+	assert.Equal(t, "reviewer (test-client/1.2.3)", updated.Card.CreatedBy)
+
+	completeParams, err := json.Marshal(CompleteTodoParams{
+		ID:       task.ID,
+		Evidence: []VerificationEvidenceInput{{Evidence: "Checked the rename end to end"}},
+	})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.todo.complete", completeParams)
+	require.NoError(t, err)
+	completed := result.(*domain.Task)
+	require.NotNil(t, completed.Card.Verification)
+	assert.Equal(t, "test-client/1.2.3", completed.Card.Verification.CompletedBy)
+	assert.Equal(t, "test-client/1.2.3", completed.Card.Verification.Evidence[0].RecordedBy)
+
+	// Leases, planning sessions and board settings are attributed too
+	result, err = server.HandleCommand("compass.task.claim", json.RawMessage(`{"id":"`+task.ID+`"}`))
+	require.NoError(t, err)
+	claimed := result.(*domain.Task)
+	assert.Equal(t, "test-client/1.2.3", claimed.Card.Lease.Holder)
+	assert.Equal(t, "test-client/1.2.3", claimed.Card.UpdatedBy)
+
+	result, err = server.HandleCommand("compass.planning.start", json.RawMessage(`{"projectId":"`+project.ID+`","name":"Sprint"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "test-client/1.2.3", result.(*domain.PlanningSession).CreatedBy)
+
+	_, err = server.HandleCommand("compass.board.limits", json.RawMessage(`{"projectId":"`+project.ID+`","limits":{"in-progress":3}}`))
+	require.NoError(t, err)
+	limited, err := server.projectService.Get(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "test-client/1.2.3", limited.UpdatedBy)
+}
+
+func TestMCPServer_FocusTask(t *testing.T) {
+	// Setup
+	server := newTestServer()
+
+	projectParams, err := json.Marshal(CreateProjectParams{Name: "Test Project", Description: "A test project", Goal: "Stay focused"})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.project.create", projectParams)
+	require.NoError(t, err)
+	project := result.(*domain.Project)
+
+	taskParams, err := json.Marshal(CreateTaskParams{ProjectID: project.ID, Title: "Focus Task", Description: "Current work"})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.task.create", taskParams)
+	require.NoError(t, err)
+	task := result.(*domain.Task)
+
+	focusParams, err := json.Marshal(SetFocusParams{TaskID: task.ID})
+	require.NoError(t, err)
+	_, err = server.HandleCommand("compass.focus.set", focusParams)
+	require.NoError(t, err)
+
+	// Discoveries and decisions without task IDs attach to the focus task
+	discoveryParams, err := json.Marshal(AddDiscoveryParams{ProjectID: project.ID, Insight: "Cache is never invalidated", Impact: domain.ImpactHigh, Source: domain.SourceImplementation})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.discovery.add", discoveryParams)
+	require.NoError(t, err)
+	assert.Equal(t, []string{task.ID}, result.(*domain.Discovery).AffectedTasks)
+
+	decisionParams, err := json.Marshal(RecordDecisionParams{ProjectID: project.ID, Question: "Which cache?", Choice: "LRU", Rationale: "Bounded memory"})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.decision.record", decisionParams)
+	require.NoError(t, err)
+	assert.Equal(t, []string{task.ID}, result.(*domain.Decision).AffectedTasks)
+
+	_, err = server.HandleCommand("compass.focus.clear", nil)
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.focus.get", nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.(map[string]interface{})["focus"])
+
+	result, err = server.HandleCommand("compass.discovery.add", discoveryParams)
+	require.NoError(t, err)
+	assert.Empty(t, result.(*domain.Discovery).AffectedTasks)
+
+	missingParams, err := json.Marshal(SetFocusParams{TaskID: "missing"})
+	require.NoError(t, err)
+	_, err = server.HandleCommand("compass.focus.set", missingParams)
+	assert.Error(t, err)
+}
+
+// unreadableTasks is a store whose task reads fail as if the workspace
+// were locked
+type unreadableTasks struct {
+	storage.Store
+}
+
+func (unreadableTasks) GetTask(id string) (*domain.Task, error) {
+	return nil, errors.New("workspace is locked")
+}
+
+func TestMCPServer_FocusSurvivesReadErrors(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	server := newTestServer()
+	server.taskService = service.NewTaskService(memStorage)
+
+	task := domain.NewTask("project-1", "Focus Task", "")
+	require.NoError(t, memStorage.CreateTask(task))
+	focusParams, err := json.Marshal(SetFocusParams{TaskID: task.ID})
+	require.NoError(t, err)
+	_, err = server.HandleCommand("compass.focus.set", focusParams)
+	require.NoError(t, err)
+
+	// A failed read is reported and the focus is kept
+	server.taskService = service.NewTaskService(unreadableTasks{memStorage})
+	_, err = server.HandleCommand("compass.focus.get", nil)
+	assert.Error(t, err)
+	assert.Equal(t, task.ID, server.FocusTaskID())
+
+	// Only a task that is gone drops the focus
+	server.taskService = service.NewTaskService(memStorage)
+	require.NoError(t, memStorage.DeleteTask(task.ID))
+	result, err := server.HandleCommand("compass.focus.get", nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.(map[string]interface{})["focus"])
+	assert.Empty(t, server.FocusTaskID())
+}
+
+func TestMCPServer_AdminCheck(t *testing.T) {
+	server := newTestServer()
+
+	projectParams, err := json.Marshal(CreateProjectParams{Name: "Checked", Description: "", Goal: ""})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.project.create", projectParams)
+	require.NoError(t, err)
+	project := result.(*domain.Project)
+
+	dependency := "deleted-task"
+	taskParams, err := json.Marshal(CreateTaskParams{ProjectID: project.ID, Title: "Depends on a deleted task", Dependencies: []string{dependency}})
+	require.NoError(t, err)
+	_, err = server.HandleCommand("compass.task.create", taskParams)
+	require.NoError(t, err)
+
+	result, err = server.HandleCommand("compass.admin.check", nil)
+	require.NoError(t, err)
+	report := result.(*domain.CheckReport)
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, "dangling-dependency", report.Issues[0].Code)
+	assert.True(t, report.Issues[0].Repairable)
+
+	result, err = server.HandleCommand("compass.admin.check", json.RawMessage(`{"repair": true}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(*domain.CheckReport).Repaired)
+
+	result, err = server.HandleCommand("compass.admin.check", json.RawMessage(`{}`))
+	require.NoError(t, err)
+	assert.Empty(t, result.(*domain.CheckReport).Issues)
+}
+
+func TestMCPServer_AdminSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+	taskService := service.NewTaskService(fileStorage)
+	projectService := service.NewProjectService(fileStorage)
+	adminService := service.NewAdminService(fileStorage, storage.NewSnapshotter(dir))
+	server := NewMCPServer(taskService, projectService, nil, nil, nil, nil, nil, nil, adminService, nil, nil, nil)
+
+	projectParams, err := json.Marshal(CreateProjectParams{Name: "Snapshotted", Description: "", Goal: ""})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.project.create", projectParams)
+	require.NoError(t, err)
+	project := result.(*domain.Project)
+
+	result, err = server.HandleCommand("compass.admin.snapshot", json.RawMessage(`{"reason": "before bulk update"}`))
+	require.NoError(t, err)
+	snapshot := result.(*domain.Snapshot)
+	assert.False(t, snapshot.Automatic)
+	assert.Equal(t, "before bulk update", snapshot.Reason)
+	assert.FileExists(t, snapshot.Path)
+
+	taskParams, err := json.Marshal(CreateTaskParams{ProjectID: project.ID, Title: "Deleted by mistake"})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.task.create", taskParams)
+	require.NoError(t, err)
+	task := result.(*domain.Task)
+
+	_, err = server.HandleCommand("compass.task.delete", json.RawMessage(`{"id": "missing"}`))
+	assert.Error(t, err)
+	deleteParams, err := json.Marshal(DeleteTaskParams{ID: task.ID})
+	require.NoError(t, err)
+	_, err = server.HandleCommand("compass.task.delete", deleteParams)
+	require.NoError(t, err)
+
+	// Deleting a task snapshots the workspace first; a failed delete does not
+	snapshots, err := storage.ListSnapshots(dir)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.True(t, snapshots[1].Automatic)
+	assert.Equal(t, "task-delete", snapshots[1].Reason)
+
+	_, err = server.HandleCommand("compass.admin.snapshot", json.RawMessage(`{"projectId": "../outside"}`))
+	assert.Error(t, err)
+	_, err = newTestServer().HandleCommand("compass.admin.snapshot", nil)
+	assert.Error(t, err, "memory workspaces have nothing to snapshot")
+}
+
+func TestMCPServer_ProjectExportImport(t *testing.T) {
+	server := newTestServer()
+
+	projectParams, err := json.Marshal(CreateProjectParams{Name: "Exported", Description: "", Goal: ""})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.project.create", projectParams)
+	require.NoError(t, err)
+	project := result.(*domain.Project)
+	taskParams, err := json.Marshal(CreateTaskParams{ProjectID: project.ID, Title: "Travels with the code"})
+	require.NoError(t, err)
+	_, err = server.HandleCommand("compass.task.create", taskParams)
+	require.NoError(t, err)
+
+	_, err = server.HandleCommand("compass.project.export", nil)
+	assert.Error(t, err, "there is no current project")
+
+	exportParams, err := json.Marshal(ProjectExportParams{ProjectID: project.ID, Format: "markdown"})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.project.export", exportParams)
+	require.NoError(t, err)
+	assert.Contains(t, result.(string), "Travels with the code")
+
+	exportParams, err = json.Marshal(ProjectExportParams{ProjectID: project.ID})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.project.export", exportParams)
+	require.NoError(t, err)
+	bundle := result.(*domain.ProjectBundle)
+
+	importParams, err := json.Marshal(ProjectImportParams{Bundle: bundle, Name: "Imported"})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.project.import", importParams)
+	require.NoError(t, err)
+	imported := result.(*domain.ProjectImport)
+	assert.Equal(t, 1, imported.Tasks)
+	assert.Equal(t, "Imported", imported.Project.Name)
+
+	_, err = server.HandleCommand("compass.project.import", json.RawMessage(`{}`))
+	assert.Error(t, err)
+}
+
+func TestMCPServer_ImportIssues(t *testing.T) {
+	server := newTestServer()
+
+	projectParams, err := json.Marshal(CreateProjectParams{Name: "Tracked elsewhere", Description: "", Goal: ""})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.project.create", projectParams)
+	require.NoError(t, err)
+	project := result.(*domain.Project)
+
+	content := `[{"number": 3, "title": "From GitHub", "state": "OPEN", "url": "https://github.com/acme/shop/issues/3", "labels": [{"name": "bug"}]}]`
+	params, err := json.Marshal(ImportIssuesParams{Source: "github", Content: content, ProjectID: project.ID})
+	require.NoError(t, err)
+	result, err = server.HandleCommand("compass.import.issues", params)
+	require.NoError(t, err)
+	imported := result.(*domain.IssueImport)
+	assert.Equal(t, 1, imported.Created)
+
+	result, err = server.HandleCommand("compass.import.issues", params)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.(*domain.IssueImport).Unchanged)
+
+	task, err := server.taskService.Get(imported.Items[0].TaskID)
+	require.NoError(t, err)
+	assert.Equal(t, "acme/shop#3", task.Card.ExternalRef.Key)
+	assert.Equal(t, []string{"bug"}, task.Card.Labels)
+
+	_, err = server.HandleCommand("compass.import.issues", json.RawMessage(`{"source": "github"}`))
+	assert.Error(t, err)
+	_, err = server.HandleCommand("compass.import.issues", json.RawMessage(`{"source": "trello", "content": "[]", "projectId": "`+project.ID+`"}`))
+	assert.Error(t, err)
+}
+
+func TestMCPServer_Batch(t *testing.T) {
+	server := newTestServer()
+
+	projectResult, err := server.HandleCommand("compass.project.create", json.RawMessage(`{"name":"Epic","description":"","goal":"Plan in one call"}`))
+	require.NoError(t, err)
+	project := projectResult.(*domain.Project)
+	require.NoError(t, server.projectService.SetCurrent(project.ID))
+	_, err = server.HandleCommand("compass.board.limits", json.RawMessage(`{"limits":{"in-progress":1},"policy":"reject"}`))
+	require.NoError(t, err)
+
+	// The second move exceeds the WIP limit, so neither task is kept
+	_, err = server.HandleCommand("compass.batch", json.RawMessage(`{"commands": [
+		{"op": "task.create", "ref": "a", "params": {"title": "A", "description": ""}},
+		{"op": "task.create", "ref": "b", "params": {"title": "B", "description": ""}},
+		{"op": "task.update", "params": {"id": "$a", "updates": {"status": "in-progress"}}},
+		{"op": "task.update", "params": {"id": "$b", "updates": {"status": "in-progress"}}}
+	]}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "batch command 3 (task.update) failed")
+	tasks, err := server.taskService.List(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+
+	result, err := server.HandleCommand("compass.batch", json.RawMessage(`{"commands": [
+		{"op": "task.create", "ref": "a", "params": {"title": "A", "description": ""}},
+		{"op": "task.create", "params": {"title": "B", "description": "", "dependencies": ["$a"]}}
+	]}`))
+	require.NoError(t, err)
+	batch := result.(*domain.BatchResult)
+	require.Len(t, batch.Steps, 2)
+	task, err := server.taskService.Get(batch.Steps[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{batch.Refs["a"]}, task.Context.Dependencies)
+}
+
+func TestMCPServer_TaskWritesRefreshCache(t *testing.T) {
+	server := newTestServer()
+	project := domain.NewProject("Cached", "", "")
+	require.NoError(t, server.projectService.Create(project))
+	first := domain.NewTask(project.ID, "First", "")
+	require.NoError(t, server.taskService.Create(first))
+
+	nextParams, err := json.Marshal(GetNextTaskParams{ProjectID: project.ID})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.next", nextParams)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, result.(*domain.Task).ID)
+
+	// The server's own writes are seen by the next query, without a watcher
+	_, err = server.HandleCommand("compass.task.delete", json.RawMessage(`{"id": "`+first.ID+`"}`))
+	require.NoError(t, err)
+	created, err := server.HandleCommand("compass.task.create", json.RawMessage(`{"projectId": "`+project.ID+`", "title": "Second", "description": ""}`))
+	require.NoError(t, err)
+
+	result, err = server.HandleCommand("compass.next", nextParams)
+	require.NoError(t, err)
+	assert.Equal(t, created.(*domain.Task).ID, result.(*domain.Task).ID)
+}
+
+func TestMCPServer_ApplyStorageChanges(t *testing.T) {
+	dir := t.TempDir()
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+	taskService := service.NewTaskService(fileStorage)
+	projectService := service.NewProjectService(fileStorage)
+	contextRetriever := service.NewContextRetriever(fileStorage, fileStorage)
+	server := NewMCPServer(taskService, projectService, contextRetriever, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	project := domain.NewProject("Watched", "", "")
+	require.NoError(t, fileStorage.CreateProject(project))
+	first := domain.NewTask(project.ID, "First", "")
+	require.NoError(t, fileStorage.CreateTask(first))
+	nextParams, err := json.Marshal(GetNextTaskParams{ProjectID: project.ID})
+	require.NoError(t, err)
+	result, err := server.HandleCommand("compass.next", nextParams)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, result.(*domain.Task).ID)
+
+	watcher, err := storage.Watch(dir, 20*time.Millisecond)
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	// Another instance finishes the task the server has cached
+	other, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+	second := domain.NewTask(project.ID, "Second", "")
+	require.NoError(t, other.CreateTask(second))
+	_, err = other.UpdateTask(first.ID, map[string]interface{}{"status": domain.StatusCompleted})
+	require.NoError(t, err)
+	require.NoError(t, other.Close())
+
+	result, err = server.HandleCommand("compass.next", nextParams)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, result.(*domain.Task).ID, "cached until the change is seen")
+
+	var uris []string
+	select {
+	case changes := <-watcher.Changes:
+		assert.Contains(t, changes, storage.Change{Kind: storage.ChangeTasks, ProjectID: project.ID})
+		uris = server.ApplyStorageChanges(changes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+	assert.Contains(t, uris, "compass://todos")
+	assert.NotContains(t, uris, "compass://processes")
+
+	result, err = server.HandleCommand("compass.next", nextParams)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, result.(*domain.Task).ID)
+
+	assert.Len(t, server.ApplyStorageChanges([]storage.Change{{Kind: storage.ChangeAll}}), 9)
+}
@@ -0,0 +1,153 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// SetClientInfo records the client name and version reported during the MCP
+// initialize handshake. Any label chosen for the session is kept.
+func (s *MCPServer) SetClientInfo(name, version string) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	s.agent.Name = name
+	s.agent.Version = version
+}
+
+// SetAgentLabel names this session so agents sharing a client can be told apart
+func (s *MCPServer) SetAgentLabel(label string) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	s.agent.Label = label
+}
+
+// Agent returns the identity of the client driving this session
+func (s *MCPServer) Agent() domain.AgentIdentity {
+	s.sessionMu.RLock()
+	defer s.sessionMu.RUnlock()
+	return s.agent
+}
+
+// actor is the identity string stamped onto entities this session changes
+func (s *MCPServer) actor() string {
+	return s.Agent().String()
+}
+
+// stamp records the acting agent on a partial update
+func (s *MCPServer) stamp(updates map[string]interface{}) map[string]interface{} {
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	updates["updatedBy"] = s.actor()
+	return updates
+}
+
+type SetAgentLabelParams struct {
+	Label string `json:"label"`
+}
+
+func (s *MCPServer) handleAgentSetLabel(params json.RawMessage) (interface{}, error) {
+	var p SetAgentLabelParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	s.SetAgentLabel(p.Label)
+	return s.handleAgentWhoami()
+}
+
+func (s *MCPServer) handleAgentWhoami() (interface{}, error) {
+	agent := s.Agent()
+	return map[string]interface{}{
+		"agent":    agent,
+		"stampsAs": agent.String(),
+	}, nil
+}
+
+// leaseHolder defaults an explicit lease agent to the session identity
+func (s *MCPServer) leaseHolder(agent string) string {
+	if agent != "" {
+		return agent
+	}
+	return s.actor()
+}
+
+// FocusTaskID returns the task this session declared it is working on
+func (s *MCPServer) FocusTaskID() string {
+	s.sessionMu.RLock()
+	defer s.sessionMu.RUnlock()
+	return s.focusTaskID
+}
+
+func (s *MCPServer) setFocusTaskID(taskID string) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	s.focusTaskID = taskID
+}
+
+// linkToFocus falls back to the focus task when no task IDs were given
+func (s *MCPServer) linkToFocus(taskIDs []string) []string {
+	if len(taskIDs) > 0 {
+		return taskIDs
+	}
+	if focus := s.FocusTaskID(); focus != "" {
+		return []string{focus}
+	}
+	return taskIDs
+}
+
+func nonEmpty(id string) []string {
+	if id == "" {
+		return nil
+	}
+	return []string{id}
+}
+
+type SetFocusParams struct {
+	TaskID string `json:"taskId"`
+}
+
+func (s *MCPServer) handleFocusSet(params json.RawMessage) (interface{}, error) {
+	var p SetFocusParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if p.TaskID == "" {
+		return nil, fmt.Errorf("taskId is required")
+	}
+
+	task, err := s.taskService.Get(p.TaskID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setFocusTaskID(task.ID)
+	return task, nil
+}
+
+func (s *MCPServer) handleFocusGet() (interface{}, error) {
+	focus := s.FocusTaskID()
+	if focus == "" {
+		return map[string]interface{}{"focus": nil}, nil
+	}
+
+	task, err := s.taskService.Get(focus)
+	if errors.Is(err, storage.ErrNotFound) {
+		// The task was removed behind our back; drop the stale focus
+		s.setFocusTaskID("")
+		return map[string]interface{}{"focus": nil}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"focus": task}, nil
+}
+
+func (s *MCPServer) handleFocusClear() (interface{}, error) {
+	s.setFocusTaskID("")
+	return map[string]string{"status": "success"}, nil
+}
@@ -62,6 +62,12 @@ type MCPTransport struct {
 	mu           sync.Mutex
 	debugLogs    []string
 	debugLogsMu  sync.Mutex
+
+	// writeMu serializes writes to the client: change notifications are
+	// sent from the storage watcher while requests are being answered
+	writeMu       sync.Mutex
+	subscriptions map[string]bool
+	subMu         sync.Mutex
 }
 
 // NewMCPTransport creates a new MCP transport over stdio
@@ -73,6 +79,7 @@ func NewMCPTransport(server *MCPServer) *MCPTransport {
 		lastActivity: time.Now(),
 		connected:    true,
 		debugLogs:    make([]string, 0, 1000),
+		subscriptions: make(map[string]bool),
 	}
 	return transport
 }
@@ -259,6 +266,11 @@ func (t *MCPTransport) handleInitialize(req JSONRPCRequest) *JSONRPCResponse {
 		}
 	}
 
+	// Remember who is connected so every change can be attributed to them
+	if params.ClientInfo.Name != "" {
+		t.server.SetClientInfo(params.ClientInfo.Name, params.ClientInfo.Version)
+	}
+
 	// Return server capabilities
 	result := map[string]interface{}{
 		"protocolVersion": "2024-11-05",
@@ -267,7 +279,7 @@ func (t *MCPTransport) handleInitialize(req JSONRPCRequest) *JSONRPCResponse {
 				"listChanged": false,
 			},
 			"resources": map[string]interface{}{
-				"subscribe":   false,
+				"subscribe":   true,
 				"listChanged": false,
 			},
 			"prompts": map[string]interface{}{
@@ -343,6 +355,9 @@ func (t *MCPTransport) handleCompassMethod(req JSONRPCRequest) *JSONRPCResponse
 	if req.Method == "resources/read" {
 		return t.handleResourceRead(req)
 	}
+	if req.Method == "resources/subscribe" || req.Method == "resources/unsubscribe" {
+		return t.handleResourceSubscription(req)
+	}
 
 	// Handle prompt requests
 	if req.Method == "prompts/list" {
@@ -411,6 +426,75 @@ func (t *MCPTransport) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"required": []string{"id"},
 			},
 		},
+		{
+			"name":        "compass_project_export",
+			"description": "Export a project with its tasks, decisions, discoveries, planning sessions and process definitions as a JSON bundle, a CSV of tasks or a Markdown report",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"projectId": map[string]interface{}{"type": "string", "description": "Project to export (defaults to the current project)"},
+					"format":    map[string]interface{}{"type": "string", "enum": []string{"json", "csv", "markdown"}, "description": "Output format (default: json)"},
+				},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_project_import",
+			"description": "Import a JSON bundle from compass_project_export as a new project; every entity gets a new ID and references between them are kept",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"bundle": map[string]interface{}{"type": "object", "description": "Bundle produced by compass_project_export with format json"},
+					"name":   map[string]interface{}{"type": "string", "description": "Name for the imported project (defaults to the exported name)"},
+				},
+				"required":             []string{"bundle"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_import_issues",
+			"description": "Import issues from a GitHub issues JSON export (gh issue list --json ...) or a Jira CSV export as tasks; re-importing updates the tasks created before instead of duplicating them",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"source":    map[string]interface{}{"type": "string", "enum": []string{"github", "jira"}, "description": "Tracker the export came from"},
+					"path":      map[string]interface{}{"type": "string", "description": "Path to the export file"},
+					"content":   map[string]interface{}{"type": "string", "description": "Export file contents, instead of path"},
+					"projectId": map[string]interface{}{"type": "string", "description": "Project to import into (defaults to the current project)"},
+					"repo":      map[string]interface{}{"type": "string", "description": "owner/name for GitHub exports without issue URLs"},
+					"dryRun":    map[string]interface{}{"type": "boolean", "description": "Report what would be created or updated without writing"},
+				},
+				"required":             []string{"source"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_batch",
+			"description": "Apply an ordered list of commands all or nothing: the batch runs in one storage transaction, so if one fails none of them take effect. A command with a ref can be referred to by later commands as \"$ref\" in the ID params id, parent, dependsOn, dependencies, taskIds and affectedTaskIds. Ops and their params: task.create {projectId?, title, description, priority?, labels?, parent?, files?, dependencies?, acceptance?}; task.update {id, updates, ifMatch?}; task.link {id, dependsOn}; decision.record {projectId?, question, choice, rationale, alternatives?, reversible, affectedTaskIds?}; planning.add_task {sessionId, taskIds}",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"projectId": map[string]interface{}{"type": "string", "description": "Project for commands that do not name one (defaults to the current project)"},
+					"commands": map[string]interface{}{
+						"type":        "array",
+						"description": "Commands to apply, in order",
+						"minItems":    1,
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"op":     map[string]interface{}{"type": "string", "enum": []string{"task.create", "task.update", "task.link", "decision.record", "planning.add_task"}},
+								"ref":    map[string]interface{}{"type": "string", "description": "Name for the entity this command creates (task.create and decision.record only)"},
+								"params": map[string]interface{}{"type": "object", "description": "Parameters of the operation"},
+							},
+							"required":             []string{"op", "params"},
+							"additionalProperties": false,
+						},
+					},
+				},
+				"required":             []string{"commands"},
+				"additionalProperties": false,
+			},
+		},
 		// Task/TODO commands
 		{
 			"name":        "compass_todo_create",
@@ -483,11 +567,19 @@ func (t *MCPTransport) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"type": "object",
 				"properties": map[string]interface{}{
 					"projectId":  map[string]interface{}{"type": "string", "description": "Filter by project ID"},
-					"status":     map[string]interface{}{"type": "string", "enum": []string{"planned", "in_progress", "completed", "blocked"}, "description": "Filter by status"},
-					"priority":   map[string]interface{}{"type": "string", "enum": []string{"low", "medium", "high"}, "description": "Filter by priority"},
-					"labels":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Filter by labels"},
-					"assignedTo": map[string]interface{}{"type": "string", "description": "Filter by assignee"},
-					"limit":      map[string]interface{}{"type": "integer", "description": "Limit results"},
+					"status":       map[string]interface{}{"type": "string", "enum": []string{"planned", "in-progress", "blocked", "on-hold", "completed", "canceled"}, "description": "Filter by status"},
+					"priority":     map[string]interface{}{"type": "string", "enum": []string{"low", "medium", "high", "critical"}, "description": "Filter by priority"},
+					"labels":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Filter by labels (all must match)"},
+					"assignedTo":   map[string]interface{}{"type": "string", "description": "Filter by assignee"},
+					"dueBefore":    map[string]interface{}{"type": "string", "format": "date-time", "description": "Only items due before this time"},
+					"dueAfter":     map[string]interface{}{"type": "string", "format": "date-time", "description": "Only items due after this time"},
+					"createdAfter": map[string]interface{}{"type": "string", "format": "date-time", "description": "Only items created after this time"},
+					"updatedAfter": map[string]interface{}{"type": "string", "format": "date-time", "description": "Only items updated after this time"},
+					"sortBy":       map[string]interface{}{"type": "string", "enum": []string{"createdAt", "updatedAt", "dueDate", "priority", "title", "status"}, "description": "Sort field (default createdAt)"},
+					"sortDesc":     map[string]interface{}{"type": "boolean", "description": "Sort in descending order"},
+					"limit":        map[string]interface{}{"type": "integer", "description": "Limit results"},
+					"offset":       map[string]interface{}{"type": "integer", "description": "Skip this many results"},
+					"archived":     map[string]interface{}{"type": "string", "enum": []string{"include", "only"}, "description": "List archived items too, or only archived items (default excludes them)"},
 				},
 				"additionalProperties": false,
 			},
@@ -547,6 +639,101 @@ func (t *MCPTransport) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"additionalProperties": false,
 			},
 		},
+		// Agent commands
+		{
+			"name":        "compass_agent_whoami",
+			"description": "Show the agent identity stamped onto changes made in this session",
+			"inputSchema": map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_agent_set_label",
+			"description": "Set a per-session agent label to tell apart agents using the same client",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"label": map[string]interface{}{"type": "string", "description": "Agent label, e.g. reviewer or backend-worker"},
+				},
+				"required":             []string{"label"},
+				"additionalProperties": false,
+			},
+		},
+		// Focus commands
+		{
+			"name":        "compass_focus_set",
+			"description": "Declare the task this session is working on; discoveries, decisions and process starts without task IDs link to it",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"taskId": map[string]interface{}{"type": "string", "description": "Task ID to focus on"},
+				},
+				"required":             []string{"taskId"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_focus_get",
+			"description": "Get the current focus task",
+			"inputSchema": map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_focus_clear",
+			"description": "Clear the current focus task",
+			"inputSchema": map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{},
+				"additionalProperties": false,
+			},
+		},
+		// Lease commands
+		{
+			"name":        "compass_task_claim",
+			"description": "Claim a task for an agent with a time-limited lease so other agents skip it",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":         map[string]interface{}{"type": "string", "description": "Task ID"},
+					"agent":      map[string]interface{}{"type": "string", "description": "Identity of the claiming agent (defaults to this session's identity)"},
+					"ttlSeconds": map[string]interface{}{"type": "integer", "description": "Lease duration in seconds (default 900)"},
+				},
+				"required":             []string{"id"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_task_heartbeat",
+			"description": "Renew a lease the agent already holds",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":         map[string]interface{}{"type": "string", "description": "Task ID"},
+					"agent":      map[string]interface{}{"type": "string", "description": "Identity of the lease holder (defaults to this session's identity)"},
+					"ttlSeconds": map[string]interface{}{"type": "integer", "description": "New lease duration in seconds (default 900)"},
+				},
+				"required":             []string{"id"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_task_release",
+			"description": "Release a task lease so other agents can pick it up",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":    map[string]interface{}{"type": "string", "description": "Task ID"},
+					"agent": map[string]interface{}{"type": "string", "description": "Identity of the lease holder (defaults to this session's identity)"},
+				},
+				"required":             []string{"id"},
+				"additionalProperties": false,
+			},
+		},
 		// Context commands
 		{
 			"name":        "compass_context_search",
@@ -570,6 +757,7 @@ func (t *MCPTransport) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"properties": map[string]interface{}{
 					"projectId": map[string]interface{}{"type": "string", "description": "Project ID (optional if current project is set)"},
 					"exclude":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Task IDs to exclude"},
+					"agent":     map[string]interface{}{"type": "string", "description": "Requesting agent; tasks leased by other agents are skipped"},
 				},
 				"additionalProperties": false,
 			},
@@ -585,6 +773,35 @@ func (t *MCPTransport) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"additionalProperties": false,
 			},
 		},
+		// Board commands
+		{
+			"name":        "compass_board",
+			"description": "Show the project kanban board with tasks grouped by status, column counts and WIP limits",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"projectId": map[string]interface{}{"type": "string", "description": "Project ID (optional if current project is set)"},
+				},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_board_limits",
+			"description": "Configure per-status WIP limits and the enforcement policy for a project",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"projectId": map[string]interface{}{"type": "string", "description": "Project ID (optional if current project is set)"},
+					"limits": map[string]interface{}{
+						"type":                 "object",
+						"description":          "Map of task status to maximum number of tasks (0 removes the limit)",
+						"additionalProperties": map[string]interface{}{"type": "integer", "minimum": 0},
+					},
+					"policy": map[string]interface{}{"type": "string", "enum": []string{"warn", "reject"}, "description": "Whether full columns produce a warning or reject the update"},
+				},
+				"additionalProperties": false,
+			},
+		},
 		// Process commands
 		{
 			"name":        "compass_process_create",
@@ -610,7 +827,8 @@ func (t *MCPTransport) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 			"inputSchema": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"id": map[string]interface{}{"type": "string", "description": "Process ID"},
+					"id":     map[string]interface{}{"type": "string", "description": "Process ID"},
+					"taskId": map[string]interface{}{"type": "string", "description": "Task this run belongs to (defaults to the focus task)"},
 				},
 				"required": []string{"id"},
 			},
@@ -721,6 +939,30 @@ func (t *MCPTransport) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"required": []string{"id"},
 			},
 		},
+		// Admin commands
+		{
+			"name":        "compass_admin_check",
+			"description": "Check the workspace for half-written files, entities outside any project and references to missing tasks; optionally repair the safe issues after a backup",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"repair": map[string]interface{}{"type": "boolean", "description": "Fix the repairable issues after backing up the data"},
+				},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"name":        "compass_admin_snapshot",
+			"description": "Save a compressed snapshot of the workspace, or of one project, to .compass/backups so it can be restored with `compass restore`",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"projectId": map[string]interface{}{"type": "string", "description": "Only snapshot this project"},
+					"reason":    map[string]interface{}{"type": "string", "description": "Why the snapshot is taken, e.g. \"before bulk update\""},
+				},
+				"additionalProperties": false,
+			},
+		},
 	}
 
 	return &JSONRPCResponse{
@@ -787,6 +1029,14 @@ func (t *MCPTransport) handleToolCall(req JSONRPCRequest) *JSONRPCResponse {
 		commandName = "compass.project.current"
 	case "compass_project_set_current":
 		commandName = "compass.project.set_current"
+	case "compass_project_export":
+		commandName = "compass.project.export"
+	case "compass_project_import":
+		commandName = "compass.project.import"
+	case "compass_import_issues":
+		commandName = "compass.import.issues"
+	case "compass_batch":
+		commandName = "compass.batch"
 	case "compass_todo_create":
 		commandName = "compass.todo.create"
 	case "compass_todo_list":
@@ -795,12 +1045,32 @@ func (t *MCPTransport) handleToolCall(req JSONRPCRequest) *JSONRPCResponse {
 		commandName = "compass.todo.complete"
 	case "compass_todo_overdue":
 		commandName = "compass.todo.overdue"
+	case "compass_agent_whoami":
+		commandName = "compass.agent.whoami"
+	case "compass_agent_set_label":
+		commandName = "compass.agent.set_label"
+	case "compass_focus_set":
+		commandName = "compass.focus.set"
+	case "compass_focus_get":
+		commandName = "compass.focus.get"
+	case "compass_focus_clear":
+		commandName = "compass.focus.clear"
+	case "compass_task_claim":
+		commandName = "compass.task.claim"
+	case "compass_task_heartbeat":
+		commandName = "compass.task.heartbeat"
+	case "compass_task_release":
+		commandName = "compass.task.release"
 	case "compass_context_search":
 		commandName = "compass.context.search"
 	case "compass_next":
 		commandName = "compass.next"
 	case "compass_blockers":
 		commandName = "compass.blockers"
+	case "compass_board":
+		commandName = "compass.board"
+	case "compass_board_limits":
+		commandName = "compass.board.limits"
 	// Process commands
 	case "compass_process_create":
 		commandName = "compass.process.create"
@@ -824,6 +1094,11 @@ func (t *MCPTransport) handleToolCall(req JSONRPCRequest) *JSONRPCResponse {
 		commandName = "compass.process.group.start"
 	case "compass_process_group_stop":
 		commandName = "compass.process.group.stop"
+	// Admin commands
+	case "compass_admin_check":
+		commandName = "compass.admin.check"
+	case "compass_admin_snapshot":
+		commandName = "compass.admin.snapshot"
 	default:
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -1105,6 +1380,59 @@ func (t *MCPTransport) handleResourceRead(req JSONRPCRequest) *JSONRPCResponse {
 	}
 }
 
+// handleResourceSubscription handles MCP resources/subscribe and
+// resources/unsubscribe requests
+func (t *MCPTransport) handleResourceSubscription(req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		message := "uri is required"
+		if err != nil {
+			message = err.Error()
+		}
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidParams,
+				Message: "Invalid params",
+				Data:    message,
+			},
+		}
+	}
+
+	t.subMu.Lock()
+	if req.Method == "resources/subscribe" {
+		t.subscriptions[params.URI] = true
+	} else {
+		delete(t.subscriptions, params.URI)
+	}
+	t.subMu.Unlock()
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  map[string]interface{}{},
+	}
+}
+
+// NotifyResourcesUpdated tells the client which of the resources it
+// subscribed to have changed
+func (t *MCPTransport) NotifyResourcesUpdated(uris []string) {
+	for _, uri := range uris {
+		t.subMu.Lock()
+		subscribed := t.subscriptions[uri]
+		t.subMu.Unlock()
+		if !subscribed {
+			continue
+		}
+		if err := t.sendNotification("notifications/resources/updated", map[string]string{"uri": uri}); err != nil {
+			log.Printf("MCP transport: %v", err)
+		}
+	}
+}
+
 // handlePromptsList handles MCP prompts list requests
 func (t *MCPTransport) handlePromptsList(req JSONRPCRequest) *JSONRPCResponse {
 	// Define available Compass prompts
@@ -1220,6 +1548,8 @@ func (t *MCPTransport) sendResponse(response *JSONRPCResponse) error {
 	}
 
 	// Write to stdout with newline
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
 	if _, err := t.writer.Write(append(data, '\n')); err != nil {
 		return fmt.Errorf("failed to write response: %w", err)
 	}
@@ -1253,6 +1583,8 @@ func (t *MCPTransport) sendNotification(method string, params interface{}) error
 	}
 
 	// Write to stdout with newline
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
 	if _, err := t.writer.Write(append(data, '\n')); err != nil {
 		return fmt.Errorf("failed to write notification: %w", err)
 	}
@@ -0,0 +1,249 @@
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Values are decoded into an order-preserving tree so that a merged file
+// keeps the key order compass wrote, and re-encodes byte for byte the way
+// the storage layer does when nothing changed:
+//
+//	*object, []interface{}, string, json.Number, bool, nil
+type object struct {
+	keys   []string
+	fields map[string]interface{}
+}
+
+func newObject() *object {
+	return &object{fields: make(map[string]interface{})}
+}
+
+func (o *object) get(key string) (interface{}, bool) {
+	if o == nil {
+		return nil, false
+	}
+	value, ok := o.fields[key]
+	return value, ok
+}
+
+func (o *object) set(key string, value interface{}) {
+	if _, ok := o.fields[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.fields[key] = value
+}
+
+func parse(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := parseValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+func parseValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := newObject()
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(key.(string), value)
+		}
+		_, err := decoder.Token()
+		return obj, err
+	case json.Delim('['):
+		list := make([]interface{}, 0)
+		for decoder.More() {
+			value, err := parseValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := decoder.Token()
+		return list, err
+	default:
+		return token, nil
+	}
+}
+
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *object:
+		b, ok := b.(*object)
+		if !ok || len(a.fields) != len(b.fields) {
+			return false
+		}
+		for key, value := range a.fields {
+			other, ok := b.fields[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// conflict marks a value both sides changed in ways the rules cannot
+// reconcile. A missing side (deleted, or never added) is recorded as absent.
+type conflict struct {
+	ours, theirs       interface{}
+	hasOurs, hasTheirs bool
+}
+
+// Conflict markers, as git writes them
+const (
+	markerOurs   = "<<<<<<< ours"
+	markerSplit  = "======="
+	markerTheirs = ">>>>>>> theirs"
+)
+
+// encode renders value with two-space indentation and a trailing newline,
+// matching json.MarshalIndent. Conflicts become git-style marker blocks
+// around the members or elements they affect.
+func encode(value interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	if err := encodeValue(&out, value, ""); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func encodeValue(out *bytes.Buffer, value interface{}, indent string) error {
+	switch value := value.(type) {
+	case *object:
+		if len(value.keys) == 0 {
+			out.WriteString("{}")
+			return nil
+		}
+		out.WriteString("{\n")
+		for i, key := range value.keys {
+			last := i == len(value.keys)-1
+			if err := encodeMember(out, key, value.fields[key], indent+"  ", last); err != nil {
+				return err
+			}
+		}
+		out.WriteString(indent + "}")
+		return nil
+	case []interface{}:
+		if len(value) == 0 {
+			out.WriteString("[]")
+			return nil
+		}
+		out.WriteString("[\n")
+		for i, item := range value {
+			last := i == len(value)-1
+			if err := encodeMember(out, "", item, indent+"  ", last); err != nil {
+				return err
+			}
+		}
+		out.WriteString(indent + "]")
+		return nil
+	case *conflict:
+		return fmt.Errorf("conflict outside an object or array")
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		out.Write(data)
+		return nil
+	}
+}
+
+// encodeMember writes one object member (key != "") or array element on
+// its own lines, expanding conflicts into marker blocks
+func encodeMember(out *bytes.Buffer, key string, value interface{}, indent string, last bool) error {
+	c, ok := value.(*conflict)
+	if !ok {
+		return encodeLine(out, key, value, indent, last)
+	}
+
+	out.WriteString(markerOurs + "\n")
+	if c.hasOurs {
+		if err := encodeLine(out, key, c.ours, indent, last); err != nil {
+			return err
+		}
+	}
+	out.WriteString(markerSplit + "\n")
+	if c.hasTheirs {
+		if err := encodeLine(out, key, c.theirs, indent, last); err != nil {
+			return err
+		}
+	}
+	out.WriteString(markerTheirs + "\n")
+	return nil
+}
+
+func encodeLine(out *bytes.Buffer, key string, value interface{}, indent string, last bool) error {
+	out.WriteString(indent)
+	if key != "" {
+		name, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		out.Write(name)
+		out.WriteString(": ")
+	}
+	if err := encodeValue(out, value, indent); err != nil {
+		return err
+	}
+	if !last {
+		out.WriteByte(',')
+	}
+	out.WriteByte('\n')
+	return nil
+}
+
+// whole wraps two complete files in a single conflict block, for files that
+// are not JSON the merge can understand
+func whole(ours, theirs []byte) []byte {
+	var out bytes.Buffer
+	for _, part := range []struct {
+		marker string
+		data   []byte
+	}{{markerOurs, ours}, {markerSplit, theirs}} {
+		out.WriteString(part.marker + "\n")
+		out.Write(part.data)
+		if len(part.data) > 0 && !strings.HasSuffix(string(part.data), "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	out.WriteString(markerTheirs + "\n")
+	return out.Bytes()
+}
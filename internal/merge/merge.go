@@ -0,0 +1,398 @@
+// Package merge reconciles two branches' edits to a .compass data file at
+// the level of individual fields, so compass can act as a git merge driver.
+//
+// Edits made on only one side are always kept. When both sides changed the
+// same value:
+//
+//   - labels, files, dependencies and children are merged as sets
+//   - evidence lists keep every entry from both sides
+//   - lists of entities are merged entity by entity, matched on "id"
+//   - a merged entity's version moves past both sides' versions
+//   - anything else takes the value from the side whose entity was updated
+//     last (updatedAt, card.updatedAt or timestamp)
+//
+// Only values that none of these rules settle are left as conflicts.
+package merge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of a merge
+type Result struct {
+	// Data is the merged file, containing conflict markers if Conflicts is
+	// not empty
+	Data []byte
+	// Conflicts lists the JSON paths (or "/" for the whole file) that both
+	// sides changed irreconcilably
+	Conflicts []string
+}
+
+// Files merges the ancestor, our and their version of the file at path. An
+// empty base means both sides added the file.
+//
+// Task journals are never merged: each one only makes sense replayed over
+// its own side's tasks.json, so the union of two would apply one branch's
+// edits on top of the other's snapshot. Both sides must be compacted into
+// tasks.json first, which then merges field by field.
+func Files(path string, base, ours, theirs []byte) (*Result, error) {
+	if strings.HasSuffix(path, ".journal.jsonl") {
+		return &Result{Data: whole(ours, theirs), Conflicts: []string{"/"}}, nil
+	}
+	if strings.HasSuffix(path, ".jsonl") {
+		return &Result{Data: mergeLines(ours, theirs)}, nil
+	}
+
+	oursValue, oursErr := parse(ours)
+	theirsValue, theirsErr := parse(theirs)
+	if oursErr != nil || theirsErr != nil {
+		return &Result{Data: whole(ours, theirs), Conflicts: []string{"/"}}, nil
+	}
+
+	var baseValue interface{}
+	hasBase := len(bytes.TrimSpace(base)) > 0
+	if hasBase {
+		var err error
+		if baseValue, err = parse(base); err != nil {
+			// Without a usable ancestor every difference is a change on both sides
+			hasBase = false
+		}
+	}
+
+	m := &merger{}
+	merged, _ := m.merge("", "",
+		slot{baseValue, hasBase}, slot{oursValue, true}, slot{theirsValue, true}, noWinner)
+	if _, ok := merged.(*conflict); ok {
+		return &Result{Data: whole(ours, theirs), Conflicts: []string{"/"}}, nil
+	}
+
+	data, err := encode(merged)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Data: data, Conflicts: m.conflicts}, nil
+}
+
+// slot is one side's value for a key, which may be absent
+type slot struct {
+	value   interface{}
+	present bool
+}
+
+func (s slot) same(other slot) bool {
+	return s.present == other.present && (!s.present || equal(s.value, other.value))
+}
+
+type winner int
+
+const (
+	noWinner winner = iota
+	oursWin
+	theirsWin
+)
+
+type merger struct {
+	conflicts []string
+}
+
+var setKeys = map[string]bool{
+	"labels":       true,
+	"files":        true,
+	"dependencies": true,
+	"children":     true,
+}
+
+// merge returns the merged value and whether it is present at all
+func (m *merger) merge(path, key string, base, ours, theirs slot, win winner) (interface{}, bool) {
+	switch {
+	case ours.same(theirs):
+		return ours.value, ours.present
+	case base.same(ours):
+		return theirs.value, theirs.present
+	case base.same(theirs):
+		return ours.value, ours.present
+	}
+
+	if ours.present && theirs.present {
+		if oursObj, ok := ours.value.(*object); ok {
+			if theirsObj, ok := theirs.value.(*object); ok {
+				baseObj, _ := base.value.(*object)
+				_, isEntity := oursObj.get("id")
+				if isEntity {
+					win = latest(oursObj, theirsObj)
+				}
+				merged := m.mergeObject(path, baseObj, oursObj, theirsObj, win)
+				if isEntity {
+					bumpVersion(merged, oursObj, theirsObj)
+				}
+				return merged, true
+			}
+		}
+
+		if merged, ok := mergeNumbers(key, ours.value, theirs.value); ok {
+			return merged, true
+		}
+
+		oursList, oursIsList := ours.value.([]interface{})
+		theirsList, theirsIsList := theirs.value.([]interface{})
+		if oursIsList && theirsIsList {
+			baseList, _ := base.value.([]interface{})
+			switch {
+			case setKeys[key]:
+				return unionList(baseList, oursList, theirsList), true
+			case key == "evidence":
+				return appendList(oursList, theirsList), true
+			case keyedByID(baseList) && keyedByID(oursList) && keyedByID(theirsList):
+				return m.mergeByID(path, baseList, oursList, theirsList), true
+			}
+		}
+	}
+
+	switch win {
+	case oursWin:
+		return ours.value, ours.present
+	case theirsWin:
+		return theirs.value, theirs.present
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	m.conflicts = append(m.conflicts, path)
+	return &conflict{ours: ours.value, theirs: theirs.value, hasOurs: ours.present, hasTheirs: theirs.present}, true
+}
+
+func (m *merger) mergeObject(path string, base, ours, theirs *object, win winner) *object {
+	merged := newObject()
+	keys := append([]string(nil), ours.keys...)
+	for _, key := range theirs.keys {
+		if _, ok := ours.fields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		b, hasBase := base.get(key)
+		o, hasOurs := ours.get(key)
+		t, hasTheirs := theirs.get(key)
+		value, present := m.merge(path+"/"+key, key,
+			slot{b, hasBase}, slot{o, hasOurs}, slot{t, hasTheirs}, win)
+		if present {
+			merged.set(key, value)
+		}
+	}
+	return merged
+}
+
+// mergeByID merges lists of entities one entity at a time, keeping our
+// order and appending entities only they added
+func (m *merger) mergeByID(path string, base, ours, theirs []interface{}) []interface{} {
+	baseByID, oursByID, theirsByID := byID(base), byID(ours), byID(theirs)
+
+	var order []string
+	seen := make(map[string]bool)
+	for _, list := range [][]interface{}{ours, theirs} {
+		for _, item := range list {
+			id := itemID(item)
+			if !seen[id] {
+				seen[id] = true
+				order = append(order, id)
+			}
+		}
+	}
+
+	merged := make([]interface{}, 0, len(order))
+	for _, id := range order {
+		b, hasBase := baseByID[id]
+		o, hasOurs := oursByID[id]
+		t, hasTheirs := theirsByID[id]
+		value, present := m.merge(path+"/"+id, "",
+			slot{b, hasBase}, slot{o, hasOurs}, slot{t, hasTheirs}, noWinner)
+		if present {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// bumpVersion moves a merged entity past both sides' versions when it
+// matches neither, so an ifMatch from either branch is detected as stale
+func bumpVersion(merged, ours, theirs *object) {
+	version, ok := merged.fields["version"].(json.Number)
+	if !ok || equal(merged, ours) || equal(merged, theirs) {
+		return
+	}
+	if n, err := version.Int64(); err == nil {
+		merged.set("version", json.Number(strconv.FormatInt(n+1, 10)))
+	}
+}
+
+// mergeNumbers settles counters that both sides moved by taking the higher
+func mergeNumbers(key string, ours, theirs interface{}) (interface{}, bool) {
+	if key != "version" && key != "schemaVersion" {
+		return nil, false
+	}
+	oursNumber, ok := ours.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	theirsNumber, ok := theirs.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	a, errA := oursNumber.Int64()
+	b, errB := theirsNumber.Int64()
+	if errA != nil || errB != nil {
+		return nil, false
+	}
+
+	if b > a {
+		a = b
+	}
+	return json.Number(strconv.FormatInt(a, 10)), true
+}
+
+// unionList keeps every item either side has, minus the items one side
+// removed from the ancestor
+func unionList(base, ours, theirs []interface{}) []interface{} {
+	removedBy := func(side []interface{}) []interface{} {
+		var removed []interface{}
+		for _, item := range base {
+			if !contains(side, item) {
+				removed = append(removed, item)
+			}
+		}
+		return removed
+	}
+	removedByOurs, removedByTheirs := removedBy(ours), removedBy(theirs)
+
+	merged := make([]interface{}, 0, len(ours)+len(theirs))
+	for _, item := range ours {
+		if !contains(removedByTheirs, item) {
+			merged = append(merged, item)
+		}
+	}
+	for _, item := range theirs {
+		if !contains(merged, item) && !contains(removedByOurs, item) {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// appendList keeps all of our entries and adds the ones only they have.
+// Entries with an "id" are matched on it, others on their contents.
+func appendList(ours, theirs []interface{}) []interface{} {
+	merged := append(make([]interface{}, 0, len(ours)+len(theirs)), ours...)
+	ids := byID(ours)
+	for _, item := range theirs {
+		if id := itemID(item); id != "" {
+			if _, ok := ids[id]; ok {
+				continue
+			}
+		} else if contains(ours, item) {
+			continue
+		}
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+func contains(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func itemID(item interface{}) string {
+	obj, ok := item.(*object)
+	if !ok {
+		return ""
+	}
+	id, _ := obj.fields["id"].(string)
+	return id
+}
+
+// keyedByID reports whether every item is an object with a distinct id
+func keyedByID(list []interface{}) bool {
+	seen := make(map[string]bool, len(list))
+	for _, item := range list {
+		id := itemID(item)
+		if id == "" || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+func byID(list []interface{}) map[string]interface{} {
+	items := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		if id := itemID(item); id != "" {
+			items[id] = item
+		}
+	}
+	return items
+}
+
+// latest picks the side whose entity was updated last
+func latest(ours, theirs *object) winner {
+	oursAt, okOurs := updatedAt(ours)
+	theirsAt, okTheirs := updatedAt(theirs)
+	switch {
+	case !okOurs || !okTheirs || oursAt.Equal(theirsAt):
+		return noWinner
+	case oursAt.After(theirsAt):
+		return oursWin
+	default:
+		return theirsWin
+	}
+}
+
+func updatedAt(entity *object) (time.Time, bool) {
+	candidates := []interface{}{entity.fields["updatedAt"]}
+	if card, ok := entity.fields["card"].(*object); ok {
+		candidates = append(candidates, card.fields["updatedAt"])
+	}
+	candidates = append(candidates, entity.fields["timestamp"])
+
+	for _, candidate := range candidates {
+		if text, ok := candidate.(string); ok {
+			if at, err := time.Parse(time.RFC3339Nano, text); err == nil {
+				return at, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// mergeLines merges append-only JSON Lines files such as task history: our
+// lines first, then the lines only they added. Nothing is ever removed from
+// such files, so the ancestor adds nothing.
+func mergeLines(ours, theirs []byte) []byte {
+	var out bytes.Buffer
+	seen := make(map[string]bool)
+	for _, data := range [][]byte{ours, theirs} {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.TrimSpace(line) == "" || seen[line] {
+				continue
+			}
+			seen[line] = true
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
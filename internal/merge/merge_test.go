@@ -0,0 +1,203 @@
+package merge
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func baseTask() *domain.Task {
+	task := domain.NewTask("p1", "Merge me", "Shared task")
+	task.ID = "t1"
+	task.Card.Labels = []string{"backend"}
+	task.Card.CreatedAt = base
+	task.Card.UpdatedAt = base
+	task.Context.LastVerified = base
+	return task
+}
+
+// edit applies change to a copy of task the way an update would
+func edit(task *domain.Task, at time.Duration, change func(*domain.Task)) *domain.Task {
+	edited := task.Clone()
+	change(edited)
+	edited.Version++
+	edited.Card.UpdatedAt = base.Add(at)
+	return edited
+}
+
+func encodeJSON(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	data, err := json.MarshalIndent(value, "", "  ")
+	require.NoError(t, err)
+	return append(data, '\n')
+}
+
+func decodeTask(t *testing.T, data []byte) *domain.Task {
+	t.Helper()
+	var task domain.Task
+	require.NoError(t, json.Unmarshal(data, &task), string(data))
+	return &task
+}
+
+func TestFiles_UnchangedFileIsByteIdentical(t *testing.T) {
+	data := encodeJSON(t, baseTask())
+
+	result, err := Files("tasks/t1.json", data, data, data)
+	require.NoError(t, err)
+	assert.Empty(t, result.Conflicts)
+	assert.Equal(t, string(data), string(result.Data))
+}
+
+func TestFiles_MergesDifferentFields(t *testing.T) {
+	original := baseTask()
+	ours := edit(original, time.Hour, func(task *domain.Task) { task.Card.Title = "Renamed on main" })
+	theirs := edit(original, 2*time.Hour, func(task *domain.Task) {
+		task.Card.Labels = append(task.Card.Labels, "api")
+		task.Context.Files = append(task.Context.Files, "server.go")
+	})
+
+	result, err := Files("tasks/t1.json", encodeJSON(t, original), encodeJSON(t, ours), encodeJSON(t, theirs))
+	require.NoError(t, err)
+	assert.Empty(t, result.Conflicts)
+
+	merged := decodeTask(t, result.Data)
+	assert.Equal(t, "Renamed on main", merged.Card.Title)
+	assert.Equal(t, []string{"backend", "api"}, merged.Card.Labels)
+	assert.Equal(t, []string{"server.go"}, merged.Context.Files)
+	assert.Equal(t, 3, merged.Version, "both sides moved past version 1")
+	assert.Equal(t, base.Add(2*time.Hour), merged.Card.UpdatedAt)
+}
+
+func TestFiles_LatestUpdateWinsScalars(t *testing.T) {
+	original := baseTask()
+	ours := edit(original, time.Hour, func(task *domain.Task) { task.Card.Status = domain.StatusBlocked })
+	theirs := edit(original, 2*time.Hour, func(task *domain.Task) { task.Card.Status = domain.StatusCompleted })
+
+	result, err := Files("tasks/t1.json", encodeJSON(t, original), encodeJSON(t, ours), encodeJSON(t, theirs))
+	require.NoError(t, err)
+	assert.Empty(t, result.Conflicts)
+	assert.Equal(t, domain.StatusCompleted, decodeTask(t, result.Data).Card.Status)
+}
+
+func TestFiles_SetsUnionAndHonorRemovals(t *testing.T) {
+	original := baseTask()
+	original.Card.Labels = []string{"backend", "stale"}
+	ours := edit(original, time.Hour, func(task *domain.Task) { task.Card.Labels = []string{"backend", "urgent"} })
+	theirs := edit(original, 2*time.Hour, func(task *domain.Task) { task.Card.Labels = []string{"backend", "stale", "api"} })
+
+	result, err := Files("tasks/t1.json", encodeJSON(t, original), encodeJSON(t, ours), encodeJSON(t, theirs))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backend", "urgent", "api"}, decodeTask(t, result.Data).Card.Labels)
+}
+
+func TestFiles_AppendsEvidence(t *testing.T) {
+	original := baseTask()
+	original.Card.Verification = &domain.CompletionVerification{
+		Evidence: []domain.VerificationEvidence{{ID: "e1", Evidence: "unit tests"}},
+	}
+	ours := edit(original, time.Hour, func(task *domain.Task) {
+		task.Card.Verification.Evidence = append(task.Card.Verification.Evidence, domain.VerificationEvidence{ID: "e2", Evidence: "manual check"})
+	})
+	theirs := edit(original, 2*time.Hour, func(task *domain.Task) {
+		task.Card.Verification.Evidence = append(task.Card.Verification.Evidence, domain.VerificationEvidence{ID: "e3", Evidence: "load test"})
+	})
+
+	result, err := Files("tasks/t1.json", encodeJSON(t, original), encodeJSON(t, ours), encodeJSON(t, theirs))
+	require.NoError(t, err)
+	assert.Empty(t, result.Conflicts)
+
+	var ids []string
+	for _, evidence := range decodeTask(t, result.Data).Card.Verification.Evidence {
+		ids = append(ids, evidence.ID)
+	}
+	assert.Equal(t, []string{"e1", "e2", "e3"}, ids)
+}
+
+func TestFiles_ConflictsOnlyOnTheContestedField(t *testing.T) {
+	original := baseTask()
+	ours := edit(original, time.Hour, func(task *domain.Task) { task.Card.Title = "Ours" })
+	theirs := edit(original, time.Hour, func(task *domain.Task) {
+		task.Card.Title = "Theirs"
+		task.Card.Priority = domain.PriorityHigh
+	})
+
+	result, err := Files("tasks/t1.json", encodeJSON(t, original), encodeJSON(t, ours), encodeJSON(t, theirs))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/card/title"}, result.Conflicts)
+
+	text := string(result.Data)
+	assert.Contains(t, text, "<<<<<<< ours\n    \"title\": \"Ours\",\n=======\n    \"title\": \"Theirs\",\n>>>>>>> theirs\n")
+	assert.Contains(t, text, `"priority": "high"`)
+	assert.Equal(t, 1, strings.Count(text, "<<<<<<<"))
+}
+
+func TestFiles_MergesListFilesByID(t *testing.T) {
+	shared := baseTask()
+	ours := edit(shared, time.Hour, func(task *domain.Task) { task.Card.Title = "Edited on main" })
+	added := baseTask()
+	added.ID = "t2"
+	added.Card.Title = "Added on branch"
+
+	list := func(tasks ...*domain.Task) []byte {
+		return encodeJSON(t, map[string]interface{}{"schemaVersion": 2, "items": append([]*domain.Task{}, tasks...)})
+	}
+	result, err := Files("projects/p1/tasks.json", list(shared), list(ours), list(shared, added))
+	require.NoError(t, err)
+	assert.Empty(t, result.Conflicts)
+
+	var merged struct {
+		Items []*domain.Task `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(result.Data, &merged))
+	require.Len(t, merged.Items, 2)
+	assert.Equal(t, "Edited on main", merged.Items[0].Card.Title)
+	assert.Equal(t, "Added on branch", merged.Items[1].Card.Title)
+}
+
+func TestFiles_DeleteAgainstEditConflicts(t *testing.T) {
+	shared := baseTask()
+	theirs := edit(shared, time.Hour, func(task *domain.Task) { task.Card.Title = "Still needed" })
+	list := func(tasks ...*domain.Task) []byte {
+		return encodeJSON(t, map[string]interface{}{"schemaVersion": 2, "items": append([]*domain.Task{}, tasks...)})
+	}
+
+	result, err := Files("projects/p1/tasks.json", list(shared), list(), list(theirs))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/items/t1"}, result.Conflicts)
+	assert.Contains(t, string(result.Data), "<<<<<<< ours\n=======\n")
+}
+
+func TestFiles_UnionsHistoryLines(t *testing.T) {
+	base := []byte("{\"op\":\"create\"}\n")
+	ours := []byte("{\"op\":\"create\"}\n{\"op\":\"update\",\"by\":\"main\"}\n")
+	theirs := []byte("{\"op\":\"create\"}\n{\"op\":\"update\",\"by\":\"branch\"}\n")
+
+	result, err := Files("projects/p1/history/tasks.jsonl", base, ours, theirs)
+	require.NoError(t, err)
+	assert.Empty(t, result.Conflicts)
+	assert.Equal(t, "{\"op\":\"create\"}\n{\"op\":\"update\",\"by\":\"main\"}\n{\"op\":\"update\",\"by\":\"branch\"}\n", string(result.Data))
+}
+
+func TestFiles_RefusesTaskJournals(t *testing.T) {
+	ours := []byte("{\"op\":\"put\",\"id\":\"t1\"}\n")
+	theirs := []byte("{\"op\":\"delete\",\"id\":\"t1\"}\n")
+
+	result, err := Files("projects/p1/tasks.journal.jsonl", nil, ours, theirs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/"}, result.Conflicts)
+}
+
+func TestFiles_UnparseableSideConflictsWholeFile(t *testing.T) {
+	result, err := Files("config.json", []byte(`{}`), []byte(`{"a": 1}`), []byte(`not json`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/"}, result.Conflicts)
+	assert.True(t, strings.HasPrefix(string(result.Data), "<<<<<<< ours\n{\"a\": 1}\n=======\nnot json\n>>>>>>> theirs\n"))
+}
@@ -22,8 +22,9 @@ func NewHybridSearch(storage TaskStorage) *HybridSearch {
 }
 
 func (hs *HybridSearch) Search(query string, opts domain.SearchOptions) ([]*domain.SearchResult, error) {
-	// Get all tasks for the project or all projects
-	filter := domain.TaskFilter{}
+	// Get all tasks for the project or all projects; the archive stays
+	// searchable even though listings leave it out
+	filter := domain.TaskFilter{Archived: domain.ArchiveInclude}
 	if opts.ProjectID != nil {
 		filter.ProjectID = opts.ProjectID
 	}
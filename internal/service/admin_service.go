@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// IntegrityChecker is implemented by storage backends that can verify, and
+// safely repair, their own data
+type IntegrityChecker interface {
+	Check(repair bool) (*domain.CheckReport, error)
+}
+
+// Snapshotter archives the workspace so it can be restored later
+type Snapshotter interface {
+	Snapshot(projectID, reason string) (*domain.Snapshot, error)
+	AutoSnapshot(reason string) (*domain.Snapshot, error)
+}
+
+// AdminService exposes workspace maintenance operations
+type AdminService struct {
+	checker   IntegrityChecker
+	snapshots Snapshotter
+}
+
+// NewAdminService creates the admin service. snapshots may be nil for
+// workspaces without files on disk, which disables snapshots.
+func NewAdminService(checker IntegrityChecker, snapshots Snapshotter) *AdminService {
+	return &AdminService{checker: checker, snapshots: snapshots}
+}
+
+// Check reports integrity issues in the workspace. With repair set, the
+// issues that have a safe fix are repaired after the data is backed up.
+func (as *AdminService) Check(repair bool) (*domain.CheckReport, error) {
+	return as.checker.Check(repair)
+}
+
+// Snapshot archives the workspace, or one project when projectID is set
+func (as *AdminService) Snapshot(projectID, reason string) (*domain.Snapshot, error) {
+	if as.snapshots == nil {
+		return nil, fmt.Errorf("snapshots are not available for this workspace")
+	}
+	return as.snapshots.Snapshot(projectID, reason)
+}
+
+// AutoSnapshot takes an automatic snapshot before a destructive operation.
+// It returns nil without error when snapshots are not available.
+func (as *AdminService) AutoSnapshot(reason string) (*domain.Snapshot, error) {
+	if as == nil || as.snapshots == nil {
+		return nil, nil
+	}
+	return as.snapshots.AutoSnapshot(reason)
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// BatchStorage is the storage BatchService needs: every batch runs in one
+// storage transaction
+type BatchStorage interface {
+	Transaction(fn func(tx storage.Store) error) error
+}
+
+// BatchService applies a list of commands as one unit: either every
+// command takes effect or none does
+type BatchService struct {
+	storage BatchStorage
+}
+
+func NewBatchService(storage BatchStorage) *BatchService {
+	return &BatchService{storage: storage}
+}
+
+type batchCreateTask struct {
+	ProjectID    string          `json:"projectId,omitempty"`
+	Title        string          `json:"title"`
+	Description  string          `json:"description"`
+	Priority     domain.Priority `json:"priority,omitempty"`
+	Labels       []string        `json:"labels,omitempty"`
+	Parent       string          `json:"parent,omitempty"`
+	Files        []string        `json:"files,omitempty"`
+	Dependencies []string        `json:"dependencies,omitempty"`
+	Acceptance   []string        `json:"acceptance,omitempty"`
+}
+
+type batchUpdateTask struct {
+	ID      string                 `json:"id"`
+	Updates map[string]interface{} `json:"updates"`
+	IfMatch *int                   `json:"ifMatch,omitempty"`
+}
+
+type batchLinkTask struct {
+	ID        string   `json:"id"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+type batchRecordDecision struct {
+	ProjectID       string   `json:"projectId,omitempty"`
+	Question        string   `json:"question"`
+	Choice          string   `json:"choice"`
+	Rationale       string   `json:"rationale"`
+	Alternatives    []string `json:"alternatives,omitempty"`
+	Reversible      bool     `json:"reversible"`
+	AffectedTaskIDs []string `json:"affectedTaskIds,omitempty"`
+}
+
+type batchAddToPlanning struct {
+	SessionID string   `json:"sessionId"`
+	TaskIDs   []string `json:"taskIds"`
+}
+
+// batchRun is the state of one Apply call. Its services work on the
+// batch's transaction.
+type batchRun struct {
+	storage   storage.Store
+	tasks     *TaskService
+	planning  *PlanningService
+	projectID string
+	actor     string
+	refs      map[string]string
+}
+
+// Apply runs commands in order inside one storage transaction, so a
+// failing command leaves no trace of the ones before it. projectID is used
+// by commands that do not name a project and may be empty; actor is
+// recorded as the author of every change. The whole batch is checked for
+// unknown operations and dangling references before anything is written.
+func (bs *BatchService) Apply(commands []domain.BatchCommand, projectID, actor string) (*domain.BatchResult, error) {
+	if err := domain.ValidateBatch(commands); err != nil {
+		return nil, err
+	}
+
+	var result *domain.BatchResult
+	err := bs.storage.Transaction(func(tx storage.Store) error {
+		taskService := NewTaskService(tx)
+		projectService := NewProjectService(tx)
+		run := &batchRun{
+			storage:   tx,
+			tasks:     taskService,
+			planning:  NewPlanningService(tx, taskService, projectService),
+			projectID: projectID,
+			actor:     actor,
+			refs:      map[string]string{},
+		}
+		result = &domain.BatchResult{Steps: make([]domain.BatchStep, 0, len(commands)), Refs: run.refs}
+		for i, command := range commands {
+			params, err := domain.ResolveBatchRefs(command.Params, run.refs)
+			var id string
+			if err == nil {
+				id, err = run.apply(command.Op, params)
+			}
+			if err != nil {
+				return &domain.BatchError{Index: i, Op: command.Op, Err: err}
+			}
+			if command.Ref != "" {
+				run.refs[command.Ref] = id
+			}
+			result.Steps = append(result.Steps, domain.BatchStep{Op: command.Op, Ref: command.Ref, ID: id})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (run *batchRun) apply(op domain.BatchOp, params json.RawMessage) (string, error) {
+	switch op {
+	case domain.BatchCreateTask:
+		var p batchCreateTask
+		if err := decodeBatchParams(params, &p); err != nil {
+			return "", err
+		}
+		return run.createTask(p)
+	case domain.BatchUpdateTask:
+		var p batchUpdateTask
+		if err := decodeBatchParams(params, &p); err != nil {
+			return "", err
+		}
+		return p.ID, run.updateTaskParams(p)
+	case domain.BatchLinkTask:
+		var p batchLinkTask
+		if err := decodeBatchParams(params, &p); err != nil {
+			return "", err
+		}
+		return p.ID, run.linkTask(p)
+	case domain.BatchRecordDecision:
+		var p batchRecordDecision
+		if err := decodeBatchParams(params, &p); err != nil {
+			return "", err
+		}
+		return run.recordDecision(p)
+	case domain.BatchAddToPlanning:
+		var p batchAddToPlanning
+		if err := decodeBatchParams(params, &p); err != nil {
+			return "", err
+		}
+		return p.SessionID, run.addToPlanning(p)
+	}
+	return "", fmt.Errorf("unknown operation")
+}
+
+// decodeBatchParams rejects unknown fields, so a misspelled parameter
+// fails the batch instead of being silently dropped
+func decodeBatchParams(params json.RawMessage, target interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("invalid parameters: %w", err)
+	}
+	return nil
+}
+
+func (run *batchRun) project(projectID string) (string, error) {
+	if projectID == "" {
+		projectID = run.projectID
+	}
+	if projectID == "" {
+		return "", fmt.Errorf("no projectId given and no current project set")
+	}
+	if _, err := run.storage.GetProject(projectID); err != nil {
+		return "", err
+	}
+	return projectID, nil
+}
+
+// requireTasks checks that every ID names an existing task
+func (run *batchRun) requireTasks(ids []string) error {
+	for _, id := range ids {
+		if _, err := run.storage.GetTask(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (run *batchRun) createTask(p batchCreateTask) (string, error) {
+	projectID, err := run.project(p.ProjectID)
+	if err != nil {
+		return "", err
+	}
+	if p.Title == "" {
+		return "", fmt.Errorf("title is required")
+	}
+	if p.Priority != "" && !domain.IsValidPriority(p.Priority) {
+		return "", fmt.Errorf("unknown priority %q", p.Priority)
+	}
+	if err := run.requireTasks(p.Dependencies); err != nil {
+		return "", err
+	}
+	var parent *domain.Task
+	if p.Parent != "" {
+		if parent, err = run.storage.GetTask(p.Parent); err != nil {
+			return "", err
+		}
+	}
+
+	task := domain.NewTask(projectID, p.Title, p.Description)
+	if p.Priority != "" {
+		task.Card.Priority = p.Priority
+	}
+	if p.Labels != nil {
+		task.Card.Labels = p.Labels
+	}
+	if p.Files != nil {
+		task.Context.Files = p.Files
+	}
+	if p.Dependencies != nil {
+		task.Context.Dependencies = p.Dependencies
+	}
+	if p.Acceptance != nil {
+		task.Criteria.Acceptance = p.Acceptance
+	}
+	task.Card.CreatedBy = run.actor
+	task.Card.UpdatedBy = run.actor
+	if parent != nil {
+		task.Card.Parent = &parent.ID
+	}
+
+	if err := run.storage.CreateTask(task); err != nil {
+		return "", err
+	}
+
+	if parent != nil {
+		children := append(append([]string{}, parent.Card.Children...), task.ID)
+		if err := run.updateTask(parent.ID, map[string]interface{}{"children": children}); err != nil {
+			return "", err
+		}
+	}
+	return task.ID, nil
+}
+
+// updateTaskParams applies a caller's update
+func (run *batchRun) updateTaskParams(p batchUpdateTask) error {
+	if p.Updates == nil {
+		p.Updates = map[string]interface{}{}
+	}
+	if p.IfMatch != nil {
+		p.Updates["version"] = *p.IfMatch
+	}
+	return run.updateTask(p.ID, p.Updates)
+}
+
+// updateTask applies updates on behalf of the batch's actor. The task
+// service enforces WIP limits the way a single task update does.
+func (run *batchRun) updateTask(id string, updates map[string]interface{}) error {
+	if run.actor != "" {
+		updates["updatedBy"] = run.actor
+	}
+	_, err := run.tasks.Update(id, updates)
+	return err
+}
+
+func (run *batchRun) linkTask(p batchLinkTask) error {
+	task, err := run.storage.GetTask(p.ID)
+	if err != nil {
+		return err
+	}
+	dependencies := append([]string{}, task.Context.Dependencies...)
+	for _, id := range p.DependsOn {
+		if id == task.ID {
+			return fmt.Errorf("task %s cannot depend on itself", id)
+		}
+		if _, err := run.storage.GetTask(id); err != nil {
+			return err
+		}
+		if !containsString(dependencies, id) {
+			dependencies = append(dependencies, id)
+		}
+	}
+	return run.updateTask(task.ID, map[string]interface{}{"dependencies": dependencies})
+}
+
+func (run *batchRun) recordDecision(p batchRecordDecision) (string, error) {
+	projectID, err := run.project(p.ProjectID)
+	if err != nil {
+		return "", err
+	}
+	if p.Question == "" || p.Choice == "" {
+		return "", fmt.Errorf("question and choice are required")
+	}
+	if err := run.requireTasks(p.AffectedTaskIDs); err != nil {
+		return "", err
+	}
+
+	decision, err := run.planning.RecordDecision(projectID, p.Question, p.Choice, p.Rationale, p.Alternatives, p.Reversible, p.AffectedTaskIDs, run.actor)
+	if err != nil {
+		return "", err
+	}
+	return decision.ID, nil
+}
+
+func (run *batchRun) addToPlanning(p batchAddToPlanning) error {
+	session, err := run.storage.GetPlanningSession(p.SessionID)
+	if err != nil {
+		return err
+	}
+	if err := run.requireTasks(p.TaskIDs); err != nil {
+		return err
+	}
+	for _, id := range p.TaskIDs {
+		if containsString(session.Tasks, id) {
+			continue
+		}
+		if err := run.planning.AddTaskToSession(session.ID, id); err != nil {
+			return err
+		}
+		session.Tasks = append(session.Tasks, id)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func batchCommand(t *testing.T, op domain.BatchOp, ref string, params map[string]interface{}) domain.BatchCommand {
+	data, err := json.Marshal(params)
+	require.NoError(t, err)
+	return domain.BatchCommand{Op: op, Ref: ref, Params: data}
+}
+
+func newBatchFixture(t *testing.T) (*BatchService, *storage.MemoryStorage, *domain.Project, *domain.PlanningSession) {
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	projectService := NewProjectService(memStorage)
+	planningService := NewPlanningService(memStorage, taskService, projectService)
+
+	project := domain.NewProject("Batch", "Batch project", "Plan an epic")
+	require.NoError(t, projectService.Create(project))
+	session, err := planningService.StartPlanningSession(project.ID, "Epic planning", "")
+	require.NoError(t, err)
+
+	return NewBatchService(memStorage), memStorage, project, session
+}
+
+func TestBatchService_ApplyResolvesRefs(t *testing.T) {
+	batch, memStorage, project, session := newBatchFixture(t)
+
+	result, err := batch.Apply([]domain.BatchCommand{
+		batchCommand(t, domain.BatchCreateTask, "epic", map[string]interface{}{"title": "Checkout epic", "description": "Ship checkout"}),
+		batchCommand(t, domain.BatchCreateTask, "api", map[string]interface{}{"title": "Checkout API", "description": "Endpoints", "parent": "$epic"}),
+		batchCommand(t, domain.BatchCreateTask, "ui", map[string]interface{}{"title": "Checkout UI", "description": "Pages", "parent": "$epic", "dependencies": []string{"$api"}}),
+		batchCommand(t, domain.BatchLinkTask, "", map[string]interface{}{"id": "$epic", "dependsOn": []string{"$api", "$ui"}}),
+		batchCommand(t, domain.BatchRecordDecision, "rest", map[string]interface{}{"question": "API style?", "choice": "REST", "rationale": "Clients already speak it", "reversible": true, "affectedTaskIds": []string{"$api"}}),
+		batchCommand(t, domain.BatchAddToPlanning, "", map[string]interface{}{"sessionId": session.ID, "taskIds": []string{"$api", "$ui"}}),
+	}, project.ID, "agent-1")
+	require.NoError(t, err)
+	require.Len(t, result.Steps, 6)
+	assert.Equal(t, result.Refs["api"], result.Steps[1].ID)
+	assert.Equal(t, session.ID, result.Steps[5].ID)
+
+	epic, err := memStorage.GetTask(result.Refs["epic"])
+	require.NoError(t, err)
+	assert.Equal(t, []string{result.Refs["api"], result.Refs["ui"]}, epic.Card.Children)
+	assert.Equal(t, []string{result.Refs["api"], result.Refs["ui"]}, epic.Context.Dependencies)
+	assert.Equal(t, "agent-1", epic.Card.UpdatedBy)
+
+	ui, err := memStorage.GetTask(result.Refs["ui"])
+	require.NoError(t, err)
+	require.NotNil(t, ui.Card.Parent)
+	assert.Equal(t, epic.ID, *ui.Card.Parent)
+	assert.Equal(t, []string{result.Refs["api"]}, ui.Context.Dependencies)
+
+	api, err := memStorage.GetTask(result.Refs["api"])
+	require.NoError(t, err)
+	assert.Equal(t, []string{result.Refs["rest"]}, api.Context.Decisions)
+
+	updated, err := memStorage.GetPlanningSession(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{api.ID, ui.ID}, updated.Tasks)
+}
+
+func TestBatchService_ApplyOnlyResolvesIDParams(t *testing.T) {
+	batch, memStorage, project, _ := newBatchFixture(t)
+
+	result, err := batch.Apply([]domain.BatchCommand{
+		batchCommand(t, domain.BatchCreateTask, "env", map[string]interface{}{"title": "$PATH", "description": "Set $HOME", "labels": []string{"$shell"}}),
+		batchCommand(t, domain.BatchCreateTask, "", map[string]interface{}{"title": "Use it", "description": "After env", "dependencies": []string{"$env"}}),
+	}, project.ID, "")
+	require.NoError(t, err)
+
+	env, err := memStorage.GetTask(result.Refs["env"])
+	require.NoError(t, err)
+	assert.Equal(t, "$PATH", env.Card.Title)
+	assert.Equal(t, "Set $HOME", env.Card.Description)
+	assert.Equal(t, []string{"$shell"}, env.Card.Labels)
+
+	dependent, err := memStorage.GetTask(result.Steps[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{env.ID}, dependent.Context.Dependencies)
+}
+
+func TestBatchService_ApplyRollsBackOnFailure(t *testing.T) {
+	batch, memStorage, project, session := newBatchFixture(t)
+
+	existing := domain.NewTask(project.ID, "Existing", "Already planned")
+	require.NoError(t, memStorage.CreateTask(existing))
+	before, err := memStorage.GetTask(existing.ID)
+	require.NoError(t, err)
+
+	_, err = batch.Apply([]domain.BatchCommand{
+		batchCommand(t, domain.BatchCreateTask, "child", map[string]interface{}{"title": "Child", "description": "Under existing", "parent": existing.ID}),
+		batchCommand(t, domain.BatchUpdateTask, "", map[string]interface{}{"id": existing.ID, "updates": map[string]interface{}{"title": "Renamed", "status": "in-progress"}}),
+		batchCommand(t, domain.BatchRecordDecision, "", map[string]interface{}{"question": "Scope?", "choice": "Small", "rationale": "Time", "reversible": true, "affectedTaskIds": []string{existing.ID}}),
+		batchCommand(t, domain.BatchAddToPlanning, "", map[string]interface{}{"sessionId": session.ID, "taskIds": []string{"$child"}}),
+		batchCommand(t, domain.BatchLinkTask, "", map[string]interface{}{"id": "$child", "dependsOn": []string{"missing-task"}}),
+	}, project.ID, "agent-1")
+	require.Error(t, err)
+
+	var batchErr *domain.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 4, batchErr.Index)
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+	assert.Contains(t, err.Error(), "no changes were applied")
+
+	tasks, err := memStorage.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	after := tasks[0]
+	assert.Equal(t, before.Card.Title, after.Card.Title)
+	assert.Equal(t, before.Card.Status, after.Card.Status)
+	assert.Empty(t, after.Card.Children)
+	assert.Empty(t, after.Context.Decisions)
+
+	decisions, err := memStorage.ListDecisions(project.ID)
+	require.NoError(t, err)
+	assert.Empty(t, decisions)
+
+	updated, err := memStorage.GetPlanningSession(session.ID)
+	require.NoError(t, err)
+	assert.Empty(t, updated.Tasks)
+}
+
+func TestBatchService_ApplyValidatesBeforeWriting(t *testing.T) {
+	batch, memStorage, project, _ := newBatchFixture(t)
+
+	_, err := batch.Apply([]domain.BatchCommand{
+		batchCommand(t, domain.BatchCreateTask, "a", map[string]interface{}{"title": "A", "description": "First"}),
+		batchCommand(t, domain.BatchCreateTask, "", map[string]interface{}{"title": "B", "description": "Second", "dependencies": []string{"$later"}}),
+		batchCommand(t, domain.BatchCreateTask, "later", map[string]interface{}{"title": "C", "description": "Third"}),
+	}, project.ID, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "$later")
+
+	tasks, err := memStorage.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// BoardService provides a kanban view of project tasks and enforces the
+// per-status work-in-progress limits configured on each project
+type BoardService struct {
+	taskService    *TaskService
+	projectService *ProjectService
+}
+
+func NewBoardService(taskService *TaskService, projectService *ProjectService) *BoardService {
+	return &BoardService{
+		taskService:    taskService,
+		projectService: projectService,
+	}
+}
+
+// GetBoard groups the project's tasks into status columns with counts and limits
+func (bs *BoardService) GetBoard(projectID string) (*domain.Board, error) {
+	project, err := bs.projectService.Get(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := bs.taskService.List(domain.TaskFilter{ProjectID: &projectID})
+	if err != nil {
+		return nil, err
+	}
+
+	board := &domain.Board{
+		ProjectID: projectID,
+		Policy:    project.EffectiveWIPPolicy(),
+		Columns:   make([]*domain.BoardColumn, 0, len(domain.BoardStatuses)),
+	}
+
+	columns := make(map[domain.TaskStatus]*domain.BoardColumn)
+	for _, status := range domain.BoardStatuses {
+		column := &domain.BoardColumn{
+			Status: status,
+			Limit:  project.WIPLimit(status),
+			Tasks:  make([]*domain.Task, 0),
+		}
+		columns[status] = column
+		board.Columns = append(board.Columns, column)
+	}
+
+	for _, task := range tasks {
+		column, ok := columns[task.Card.Status]
+		if !ok {
+			// Unknown statuses still get a column so no task disappears from the board
+			column = &domain.BoardColumn{Status: task.Card.Status, Tasks: make([]*domain.Task, 0)}
+			columns[task.Card.Status] = column
+			board.Columns = append(board.Columns, column)
+		}
+		column.Tasks = append(column.Tasks, task)
+	}
+
+	for _, column := range board.Columns {
+		column.Count = len(column.Tasks)
+		column.Full = column.Limit > 0 && column.Count >= column.Limit
+	}
+
+	return board, nil
+}
+
+// SetLimits replaces the WIP limits of a project. A zero limit removes the
+// limit for that status; an empty policy keeps the current one. updatedBy
+// is recorded on the project when set.
+func (bs *BoardService) SetLimits(projectID string, limits map[domain.TaskStatus]int, policy domain.WIPPolicy, updatedBy string) (*domain.Project, error) {
+	project, err := bs.projectService.Get(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[domain.TaskStatus]int)
+	for status, limit := range project.WIPLimits {
+		merged[status] = limit
+	}
+	for status, limit := range limits {
+		if !domain.IsValidTaskStatus(status) {
+			return nil, fmt.Errorf("invalid task status: %s", status)
+		}
+		if limit < 0 {
+			return nil, fmt.Errorf("invalid WIP limit for %s: %d", status, limit)
+		}
+		if limit == 0 {
+			delete(merged, status)
+		} else {
+			merged[status] = limit
+		}
+	}
+
+	updates := map[string]interface{}{
+		"wipLimits": merged,
+	}
+	if updatedBy != "" {
+		updates["updatedBy"] = updatedBy
+	}
+	if policy != "" {
+		if !domain.IsValidWIPPolicy(policy) {
+			return nil, fmt.Errorf("invalid WIP policy: %s. Must be one of: warn, reject", policy)
+		}
+		updates["wipPolicy"] = policy
+	}
+
+	return bs.projectService.Update(projectID, updates)
+}
+
+// CheckTransition reports whether moving the task into newStatus would exceed
+// the column's WIP limit. It returns nil when the move is within limits.
+// TaskService.Update enforces the same check on every status change.
+func (bs *BoardService) CheckTransition(taskID string, newStatus domain.TaskStatus) (*domain.WIPViolation, error) {
+	return bs.taskService.CheckTransition(taskID, newStatus)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func TestBoardService_GetBoard(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	projectService := NewProjectService(memStorage)
+	boardService := NewBoardService(taskService, projectService)
+
+	project := domain.NewProject("Test Project", "A test project", "Test board")
+	require.NoError(t, projectService.Create(project))
+
+	planned := domain.NewTask(project.ID, "Planned Task", "Not started")
+	active := domain.NewTask(project.ID, "Active Task", "In flight")
+	active.Card.Status = domain.StatusInProgress
+	require.NoError(t, taskService.Create(planned))
+	require.NoError(t, taskService.Create(active))
+
+	_, err := boardService.SetLimits(project.ID, map[domain.TaskStatus]int{domain.StatusInProgress: 1}, "", "")
+	require.NoError(t, err)
+
+	board, err := boardService.GetBoard(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.WIPPolicyWarn, board.Policy)
+	assert.Len(t, board.Columns, len(domain.BoardStatuses))
+
+	columns := make(map[domain.TaskStatus]*domain.BoardColumn)
+	for _, column := range board.Columns {
+		columns[column.Status] = column
+	}
+	assert.Equal(t, 1, columns[domain.StatusPlanned].Count)
+	assert.False(t, columns[domain.StatusPlanned].Full)
+	assert.Equal(t, 1, columns[domain.StatusInProgress].Count)
+	assert.Equal(t, 1, columns[domain.StatusInProgress].Limit)
+	assert.True(t, columns[domain.StatusInProgress].Full)
+}
+
+func TestBoardService_CheckTransition(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	projectService := NewProjectService(memStorage)
+	boardService := NewBoardService(taskService, projectService)
+
+	project := domain.NewProject("Test Project", "A test project", "Test board")
+	require.NoError(t, projectService.Create(project))
+
+	active := domain.NewTask(project.ID, "Active Task", "In flight")
+	active.Card.Status = domain.StatusInProgress
+	planned := domain.NewTask(project.ID, "Planned Task", "Not started")
+	require.NoError(t, taskService.Create(active))
+	require.NoError(t, taskService.Create(planned))
+
+	// No limits configured
+	violation, err := boardService.CheckTransition(planned.ID, domain.StatusInProgress)
+	require.NoError(t, err)
+	assert.Nil(t, violation)
+
+	_, err = boardService.SetLimits(project.ID, map[domain.TaskStatus]int{domain.StatusInProgress: 1}, domain.WIPPolicyReject, "")
+	require.NoError(t, err)
+
+	violation, err = boardService.CheckTransition(planned.ID, domain.StatusInProgress)
+	require.NoError(t, err)
+	require.NotNil(t, violation)
+	assert.Equal(t, domain.WIPPolicyReject, violation.Policy)
+	assert.Equal(t, 1, violation.Count)
+
+	// A task already in the column does not count against itself
+	violation, err = boardService.CheckTransition(active.ID, domain.StatusInProgress)
+	require.NoError(t, err)
+	assert.Nil(t, violation)
+
+	// Invalid configuration is rejected
+	_, err = boardService.SetLimits(project.ID, map[domain.TaskStatus]int{"doing": 2}, "", "")
+	assert.Error(t, err)
+	_, err = boardService.SetLimits(project.ID, nil, "block", "")
+	assert.Error(t, err)
+}
+
+func TestTaskService_UpdateEnforcesWIPLimit(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	projectService := NewProjectService(memStorage)
+	boardService := NewBoardService(taskService, projectService)
+
+	project := domain.NewProject("Test Project", "A test project", "Test board")
+	require.NoError(t, projectService.Create(project))
+	_, err := boardService.SetLimits(project.ID, map[domain.TaskStatus]int{domain.StatusInProgress: 2}, domain.WIPPolicyReject, "")
+	require.NoError(t, err)
+
+	const workers = 6
+	tasks := make([]*domain.Task, workers)
+	for i := range tasks {
+		tasks[i] = domain.NewTask(project.ID, fmt.Sprintf("Task %d", i), "Waiting")
+		require.NoError(t, taskService.Create(tasks[i]))
+	}
+
+	// Every task races for the two places in the column
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range tasks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = taskService.Update(tasks[i].ID, map[string]interface{}{"status": domain.StatusInProgress})
+		}(i)
+	}
+	wg.Wait()
+
+	moved := 0
+	for _, err := range errs {
+		if err == nil {
+			moved++
+			continue
+		}
+		var violation *domain.WIPViolation
+		assert.ErrorAs(t, err, &violation)
+	}
+	assert.Equal(t, 2, moved)
+
+	// Under the warn policy the move goes through and the violation is reported
+	_, err = boardService.SetLimits(project.ID, nil, domain.WIPPolicyWarn, "")
+	require.NoError(t, err)
+	var waiting *domain.Task
+	for i, err := range errs {
+		if err != nil {
+			waiting = tasks[i]
+			break
+		}
+	}
+	task, violation, err := taskService.UpdateChecked(waiting.ID, map[string]interface{}{"status": domain.StatusInProgress})
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusInProgress, task.Card.Status)
+	require.NotNil(t, violation)
+	assert.Equal(t, 2, violation.Count)
+}
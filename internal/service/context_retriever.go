@@ -89,6 +89,7 @@ func (cr *ContextRetriever) GetTaskContext(taskID string) (*domain.TaskContext,
 			"lastVerified":     task.Context.LastVerified,
 		}
 		cr.taskStorage.UpdateTask(taskID, updates)
+		cr.InvalidateTaskCache(task.ProjectID)
 	}
 	
 	// Get dependencies
@@ -163,6 +164,13 @@ func (cr *ContextRetriever) InvalidateTaskCache(projectID string) {
 	cr.cacheMu.Unlock()
 }
 
+// InvalidateAllTaskCaches drops the cached tasks of every project
+func (cr *ContextRetriever) InvalidateAllTaskCaches() {
+	cr.cacheMu.Lock()
+	cr.taskCache = make(map[string]*TaskCacheEntry)
+	cr.cacheMu.Unlock()
+}
+
 func (cr *ContextRetriever) GetNextTask(criteria domain.NextTaskCriteria) (*domain.Task, error) {
 	// Get all tasks for the project (with caching)
 	tasks, err := cr.getCachedTasks(criteria.ProjectID)
@@ -200,7 +208,21 @@ func (cr *ContextRetriever) GetNextTask(criteria domain.NextTaskCriteria) (*doma
 		return scored[i].Score > scored[j].Score
 	})
 	
-	return scored[0].Task, nil
+	// Leases change far more often than the task cache is refreshed, so check
+	// the live copy of each candidate before handing it out
+	now := time.Now()
+	for _, candidate := range scored {
+		current, err := cr.taskStorage.GetTask(candidate.Task.ID)
+		if err != nil {
+			continue
+		}
+		if current.IsLeasedByOther(criteria.Agent, now) {
+			continue
+		}
+		return current, nil
+	}
+	
+	return nil, fmt.Errorf("no suitable next task found: all candidates are leased by other agents")
 }
 
 func (cr *ContextRetriever) CheckSufficiency(taskID string) (*domain.SufficiencyReport, error) {
@@ -13,4 +13,9 @@ type ProcessStorage interface {
 	GetProcessGroup(groupID string) (*domain.ProcessGroup, error)
 	SaveProcessLogs(logs []*domain.ProcessLog) error
 	GetProcessLogs(processID string, limit int) ([]*domain.ProcessLog, error)
+}
+
+// SecretResolver looks up the value behind a secret:// environment reference
+type SecretResolver interface {
+	Get(name string) (string, error)
 }
\ No newline at end of file
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/importer"
+)
+
+// IssueImportService stores issues read from other trackers as tasks. Each
+// task records the issue it came from in Card.ExternalRef, so importing a
+// newer export of the same tracker updates the tasks instead of duplicating
+// them.
+type IssueImportService struct {
+	storage IssueImportStorage
+}
+
+type IssueImportStorage interface {
+	GetProject(id string) (*domain.Project, error)
+	GetTask(id string) (*domain.Task, error)
+	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
+	CreateTask(task *domain.Task) error
+	UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error)
+}
+
+func NewIssueImportService(storage IssueImportStorage) *IssueImportService {
+	return &IssueImportService{storage: storage}
+}
+
+// Import creates or updates one task per issue in the project. The tracker
+// owns title, description, priority, labels, assignee, due date and parent.
+// It owns the status only once the issue is closed, or when a closed issue
+// is reopened, so work started in Compass on an open issue is not reset.
+// Status changes respect the project's WIP limits.
+// With dryRun set nothing is written.
+func (is *IssueImportService) Import(projectID, source string, issues []*importer.Issue, dryRun bool) (*domain.IssueImport, error) {
+	if _, err := is.storage.GetProject(projectID); err != nil {
+		return nil, err
+	}
+	tasks, err := is.storage.ListTasks(domain.TaskFilter{ProjectID: &projectID, Archived: domain.ArchiveInclude})
+	if err != nil {
+		return nil, err
+	}
+
+	originals := make(map[string]*domain.Task, len(tasks))
+	working := make(map[string]*domain.Task, len(tasks))
+	byRef := make(map[string]*domain.Task)
+	for _, task := range tasks {
+		originals[task.ID] = task
+		working[task.ID] = task.Clone()
+		if task.Card.ExternalRef != nil {
+			byRef[task.Card.ExternalRef.String()] = working[task.ID]
+		}
+	}
+
+	result := &domain.IssueImport{Source: source, ProjectID: projectID, DryRun: dryRun, Items: make([]*domain.IssueImportItem, 0, len(issues))}
+	seen := make(map[string]bool, len(issues))
+	created := make([]*domain.Task, 0)
+	for _, issue := range issues {
+		ref := issue.Ref.String()
+		if seen[ref] {
+			return nil, fmt.Errorf("issue %s appears more than once in the export", ref)
+		}
+		seen[ref] = true
+
+		task, ok := byRef[ref]
+		if !ok {
+			task = domain.NewTask(projectID, issue.Title, issue.Description)
+			if !issue.CreatedAt.IsZero() {
+				task.Card.CreatedAt = issue.CreatedAt
+			}
+			working[task.ID] = task
+			byRef[ref] = task
+			created = append(created, task)
+		}
+		applyIssue(task, issue)
+		result.Items = append(result.Items, &domain.IssueImportItem{Ref: issue.Ref, TaskID: task.ID, Title: issue.Title})
+	}
+
+	for _, issue := range issues {
+		if issue.ParentKey == "" {
+			continue
+		}
+		parent, ok := byRef[domain.ExternalRef{Source: issue.Ref.Source, Key: issue.ParentKey}.String()]
+		if !ok {
+			continue
+		}
+		linkParent(working, byRef[issue.Ref.String()], parent)
+	}
+
+	// Write what changed: new tasks first so parents exist for the updates
+	isNew := make(map[string]bool, len(created))
+	for _, task := range created {
+		isNew[task.ID] = true
+		if !dryRun {
+			if err := is.storage.CreateTask(task); err != nil {
+				return result, fmt.Errorf("failed to create task for %s: %w", task.Card.ExternalRef, err)
+			}
+		}
+	}
+	changed := make(map[string]bool)
+	for _, task := range tasks {
+		patch := importPatch(originals[task.ID], working[task.ID])
+		if len(patch) == 0 {
+			continue
+		}
+		changed[task.ID] = true
+		if dryRun {
+			continue
+		}
+		patch["version"] = task.Version
+		patch["updatedAt"] = time.Now()
+		if _, _, err := updateWithinLimits(is.storage, task.ID, patch); err != nil {
+			return result, fmt.Errorf("failed to update task %s: %w", task.ID, err)
+		}
+	}
+
+	for _, item := range result.Items {
+		switch {
+		case isNew[item.TaskID]:
+			item.Action = "created"
+			result.Created++
+		case changed[item.TaskID]:
+			item.Action = "updated"
+			result.Updated++
+		default:
+			item.Action = "unchanged"
+			result.Unchanged++
+		}
+	}
+	return result, nil
+}
+
+func applyIssue(task *domain.Task, issue *importer.Issue) {
+	ref := issue.Ref
+	task.Card.ExternalRef = &ref
+	task.Card.Title = issue.Title
+	task.Card.Description = issue.Description
+	task.Card.Priority = issue.Priority
+	task.Card.Labels = append(make([]string, 0, len(issue.Labels)), issue.Labels...)
+	task.Card.AssignedTo = nil
+	if issue.Assignee != "" {
+		assignee := issue.Assignee
+		task.Card.AssignedTo = &assignee
+	}
+	task.Card.DueDate = nil
+	if issue.DueDate != nil {
+		due := *issue.DueDate
+		task.Card.DueDate = &due
+	}
+
+	closed := issue.Status == domain.StatusCompleted || issue.Status == domain.StatusCanceled
+	wasClosed := task.Card.Status == domain.StatusCompleted || task.Card.Status == domain.StatusCanceled
+	if closed || wasClosed || task.Card.Status == "" {
+		task.Card.Status = issue.Status
+	}
+	task.Card.CompletedAt = nil
+	if task.Card.Status == domain.StatusCompleted {
+		completedAt := issue.UpdatedAt
+		if issue.ClosedAt != nil {
+			completedAt = *issue.ClosedAt
+		}
+		task.Card.CompletedAt = &completedAt
+	}
+}
+
+// linkParent makes parent the parent of child, removing child from the
+// children of a previous parent
+func linkParent(tasks map[string]*domain.Task, child, parent *domain.Task) {
+	if child.ID == parent.ID {
+		return
+	}
+	if child.Card.Parent != nil && *child.Card.Parent != parent.ID {
+		if previous, ok := tasks[*child.Card.Parent]; ok {
+			previous.Card.Children = removeString(previous.Card.Children, child.ID)
+		}
+	}
+	parentID := parent.ID
+	child.Card.Parent = &parentID
+	for _, id := range parent.Card.Children {
+		if id == child.ID {
+			return
+		}
+	}
+	parent.Card.Children = append(parent.Card.Children, child.ID)
+}
+
+func removeString(values []string, value string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// importPatch lists the fields an import changed, as an update for
+// UpdateTask. Values are compared by their JSON encoding, which is what the
+// storage keeps; empty lists equal missing ones because labels and children
+// are omitted when empty.
+func importPatch(before, after *domain.Task) map[string]interface{} {
+	fields := []struct {
+		key           string
+		before, after interface{}
+	}{
+		{"title", before.Card.Title, after.Card.Title},
+		{"description", before.Card.Description, after.Card.Description},
+		{"status", before.Card.Status, after.Card.Status},
+		{"priority", before.Card.Priority, after.Card.Priority},
+		{"labels", before.Card.Labels, after.Card.Labels},
+		{"assignedTo", before.Card.AssignedTo, after.Card.AssignedTo},
+		{"dueDate", before.Card.DueDate, after.Card.DueDate},
+		{"completedAt", before.Card.CompletedAt, after.Card.CompletedAt},
+		{"parent", before.Card.Parent, after.Card.Parent},
+		{"children", before.Card.Children, after.Card.Children},
+		{"externalRef", before.Card.ExternalRef, after.Card.ExternalRef},
+	}
+
+	patch := make(map[string]interface{})
+	for _, field := range fields {
+		a, _ := json.Marshal(emptyAsNil(field.before))
+		b, _ := json.Marshal(emptyAsNil(field.after))
+		if string(a) != string(b) {
+			patch[field.key] = field.after
+		}
+	}
+	return patch
+}
+
+func emptyAsNil(value interface{}) interface{} {
+	if list, ok := value.([]string); ok && len(list) == 0 {
+		return nil
+	}
+	return value
+}
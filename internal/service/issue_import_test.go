@@ -0,0 +1,103 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/importer"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func githubIssue(number int, key, title string) *importer.Issue {
+	return &importer.Issue{
+		Ref:       domain.ExternalRef{Source: importer.SourceGitHub, Key: key},
+		Title:     title,
+		Status:    domain.StatusPlanned,
+		Priority:  domain.PriorityMedium,
+		Labels:    []string{},
+		CreatedAt: time.Date(2025, 1, number, 9, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2025, 1, number, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestIssueImportService_ReimportIsIdempotent(t *testing.T) {
+	// File storage drops empty lists, which must not count as changes
+	store, err := storage.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+	project := domain.NewProject("Backlog", "", "")
+	require.NoError(t, store.CreateProject(project))
+	importService := NewIssueImportService(store)
+
+	epic := githubIssue(1, "acme/shop#1", "Checkout")
+	epic.Assignee = "octocat"
+	story := githubIssue(2, "acme/shop#2", "Card payments")
+	story.ParentKey = "acme/shop#1"
+	issues := []*importer.Issue{story, epic}
+
+	preview, err := importService.Import(project.ID, importer.SourceGitHub, issues, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, preview.Created)
+	tasks, err := store.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Empty(t, tasks, "a dry run writes nothing")
+
+	result, err := importService.Import(project.ID, importer.SourceGitHub, issues, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Created)
+	storyTask, err := store.GetTask(result.Items[0].TaskID)
+	require.NoError(t, err)
+	epicTask, err := store.GetTask(result.Items[1].TaskID)
+	require.NoError(t, err)
+	assert.Equal(t, "acme/shop#2", storyTask.Card.ExternalRef.Key)
+	assert.Equal(t, epicTask.ID, *storyTask.Card.Parent)
+	assert.Equal(t, []string{storyTask.ID}, epicTask.Card.Children)
+	assert.Equal(t, "octocat", *epicTask.Card.AssignedTo)
+	assert.Equal(t, epic.CreatedAt, epicTask.Card.CreatedAt.UTC())
+
+	// The same export again changes nothing
+	result, err = importService.Import(project.ID, importer.SourceGitHub, issues, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Created)
+	assert.Equal(t, 2, result.Unchanged)
+	unchanged, err := store.GetTask(epicTask.ID)
+	require.NoError(t, err)
+	assert.Equal(t, epicTask.Version, unchanged.Version)
+
+	// Work started in Compass survives a re-import of the open issue, but a
+	// closed issue completes the task
+	_, err = store.UpdateTask(storyTask.ID, map[string]interface{}{"status": domain.StatusInProgress})
+	require.NoError(t, err)
+	epic.Title = "Checkout v2"
+	epic.Assignee = ""
+	result, err = importService.Import(project.ID, importer.SourceGitHub, issues, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, "updated", result.Items[1].Action)
+	got, err := store.GetTask(storyTask.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusInProgress, got.Card.Status)
+	got, err = store.GetTask(epicTask.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Checkout v2", got.Card.Title)
+	assert.Nil(t, got.Card.AssignedTo)
+
+	closedAt := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	story.Status = domain.StatusCompleted
+	story.ClosedAt = &closedAt
+	_, err = importService.Import(project.ID, importer.SourceGitHub, issues, false)
+	require.NoError(t, err)
+	got, err = store.GetTask(storyTask.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusCompleted, got.Card.Status)
+	assert.Equal(t, closedAt, got.Card.CompletedAt.UTC())
+
+	_, err = importService.Import(project.ID, importer.SourceGitHub, []*importer.Issue{epic, epic}, false)
+	assert.Error(t, err)
+	_, err = importService.Import("missing", importer.SourceGitHub, issues, false)
+	assert.Error(t, err)
+}
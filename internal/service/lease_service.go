@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+const (
+	// DefaultLeaseTTL is used when a claim or heartbeat does not ask for a duration
+	DefaultLeaseTTL = 15 * time.Minute
+	// MaxLeaseTTL caps how long a single claim can hold a task without renewal
+	MaxLeaseTTL = 24 * time.Hour
+)
+
+// leaseAttempts bounds how often a lease change is retried when the task
+// changes between reading it and writing the lease
+const leaseAttempts = 5
+
+// LeaseService lets several agents share one task pool by handing out
+// time-limited, renewable leases on individual tasks. Every lease change is
+// a versioned update, so two agents racing for a task, in this process or
+// another, cannot both win.
+type LeaseService struct {
+	taskService *TaskService
+	now         func() time.Time
+}
+
+func NewLeaseService(taskService *TaskService) *LeaseService {
+	return &LeaseService{
+		taskService: taskService,
+		now:         time.Now,
+	}
+}
+
+// Claim leases the task to agent for ttl. Claiming a task the agent already
+// holds renews it; claiming a task held by another agent fails until that
+// lease is released or expires. Like every lease change, it records actor
+// as the task's last editor when set.
+func (ls *LeaseService) Claim(taskID, agent string, ttl time.Duration, actor string) (*domain.Task, error) {
+	if agent == "" {
+		return nil, fmt.Errorf("agent is required to claim a task")
+	}
+	ttl, err := normalizeLeaseTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return ls.changeLease(taskID, actor, func(task *domain.Task, now time.Time) (*domain.TaskLease, bool, error) {
+		current := task.ActiveLease(now)
+		if current != nil && current.Holder != agent {
+			return nil, false, &domain.LeaseConflictError{TaskID: taskID, Holder: current.Holder, ExpiresAt: current.ExpiresAt}
+		}
+
+		lease := &domain.TaskLease{
+			Holder:     agent,
+			AcquiredAt: now,
+			RenewedAt:  now,
+			ExpiresAt:  now.Add(ttl),
+		}
+		if current != nil {
+			lease.AcquiredAt = current.AcquiredAt
+		}
+		return lease, true, nil
+	})
+}
+
+// Heartbeat extends a lease the agent currently holds
+func (ls *LeaseService) Heartbeat(taskID, agent string, ttl time.Duration, actor string) (*domain.Task, error) {
+	ttl, err := normalizeLeaseTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return ls.changeLease(taskID, actor, func(task *domain.Task, now time.Time) (*domain.TaskLease, bool, error) {
+		lease := task.ActiveLease(now)
+		if lease == nil {
+			return nil, false, fmt.Errorf("task %s has no active lease to renew", taskID)
+		}
+		if lease.Holder != agent {
+			return nil, false, &domain.LeaseConflictError{TaskID: taskID, Holder: lease.Holder, ExpiresAt: lease.ExpiresAt}
+		}
+
+		renewed := *lease
+		renewed.RenewedAt = now
+		renewed.ExpiresAt = now.Add(ttl)
+		return &renewed, true, nil
+	})
+}
+
+// Release gives up the agent's lease on a task. Releasing a task with no
+// lease, or whose lease has already expired, succeeds.
+func (ls *LeaseService) Release(taskID, agent, actor string) (*domain.Task, error) {
+	return ls.changeLease(taskID, actor, func(task *domain.Task, now time.Time) (*domain.TaskLease, bool, error) {
+		if lease := task.ActiveLease(now); lease != nil && lease.Holder != agent {
+			return nil, false, &domain.LeaseConflictError{TaskID: taskID, Holder: lease.Holder, ExpiresAt: lease.ExpiresAt}
+		}
+		return nil, task.Card.Lease != nil, nil
+	})
+}
+
+// changeLease reads the task, asks decide for its new lease and writes it
+// only if the task is still at the version decide saw. When another writer
+// got there first the task is read again, so an agent that lost a race for
+// the task gets a LeaseConflictError naming the winner. decide returns
+// false to leave the task unchanged.
+func (ls *LeaseService) changeLease(taskID, actor string, decide func(task *domain.Task, now time.Time) (*domain.TaskLease, bool, error)) (*domain.Task, error) {
+	var err error
+	for attempt := 0; attempt < leaseAttempts; attempt++ {
+		var task *domain.Task
+		task, err = ls.taskService.Get(taskID)
+		if err != nil {
+			return nil, err
+		}
+
+		lease, change, decideErr := decide(task, ls.now())
+		if decideErr != nil {
+			return nil, decideErr
+		}
+		if !change {
+			return task, nil
+		}
+
+		updates := map[string]interface{}{
+			"lease":   domain.LeaseChange{Lease: lease},
+			"version": task.Version,
+		}
+		if actor != "" {
+			updates["updatedBy"] = actor
+		}
+		var updated *domain.Task
+		updated, err = ls.taskService.Update(taskID, updates)
+		var versionErr *domain.VersionConflictError
+		if !errors.As(err, &versionErr) {
+			return updated, err
+		}
+	}
+	return nil, err
+}
+
+func normalizeLeaseTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl == 0 {
+		return DefaultLeaseTTL, nil
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("lease duration must be positive")
+	}
+	if ttl > MaxLeaseTTL {
+		return 0, fmt.Errorf("lease duration %s exceeds maximum of %s", ttl, MaxLeaseTTL)
+	}
+	return ttl, nil
+}
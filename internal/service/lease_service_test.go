@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func TestLeaseService_ClaimHeartbeatRelease(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	leaseService := NewLeaseService(taskService)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	leaseService.now = func() time.Time { return now }
+
+	task := domain.NewTask("project-1", "Shared Task", "Work for one agent")
+	require.NoError(t, taskService.Create(task))
+
+	claimed, err := leaseService.Claim(task.ID, "agent-a", time.Minute, "agent-a")
+	require.NoError(t, err)
+	require.NotNil(t, claimed.Card.Lease)
+	assert.Equal(t, "agent-a", claimed.Card.Lease.Holder)
+	assert.Equal(t, now.Add(time.Minute), claimed.Card.Lease.ExpiresAt)
+	assert.Equal(t, "agent-a", claimed.Card.UpdatedBy)
+
+	// Another agent cannot take or release an active lease
+	_, err = leaseService.Claim(task.ID, "agent-b", time.Minute, "agent-b")
+	var conflict *domain.LeaseConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "agent-a", conflict.Holder)
+	_, err = leaseService.Release(task.ID, "agent-b", "agent-b")
+	assert.ErrorAs(t, err, &conflict)
+
+	// Heartbeats extend the lease but keep the original acquisition time
+	now = now.Add(30 * time.Second)
+	renewed, err := leaseService.Heartbeat(task.ID, "agent-a", time.Minute, "agent-a")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), renewed.Card.Lease.ExpiresAt)
+	assert.Equal(t, now.Add(-30*time.Second), renewed.Card.Lease.AcquiredAt)
+
+	released, err := leaseService.Release(task.ID, "agent-a", "agent-a")
+	require.NoError(t, err)
+	assert.Nil(t, released.Card.Lease)
+
+	_, err = leaseService.Heartbeat(task.ID, "agent-a", time.Minute, "agent-a")
+	assert.Error(t, err)
+}
+
+func TestLeaseService_Expiry(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	leaseService := NewLeaseService(taskService)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	leaseService.now = func() time.Time { return now }
+
+	task := domain.NewTask("project-1", "Shared Task", "Work for one agent")
+	require.NoError(t, taskService.Create(task))
+
+	_, err := leaseService.Claim(task.ID, "agent-a", time.Minute, "agent-a")
+	require.NoError(t, err)
+
+	// Once the lease lapses another agent may claim the task
+	now = now.Add(2 * time.Minute)
+	claimed, err := leaseService.Claim(task.ID, "agent-b", 0, "agent-b")
+	require.NoError(t, err)
+	assert.Equal(t, "agent-b", claimed.Card.Lease.Holder)
+	assert.Equal(t, now.Add(DefaultLeaseTTL), claimed.Card.Lease.ExpiresAt)
+
+	_, err = leaseService.Claim(task.ID, "agent-b", MaxLeaseTTL+time.Minute, "agent-b")
+	assert.Error(t, err)
+}
+
+func TestContextRetriever_GetNextTaskSkipsLeasedTasks(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	leaseService := NewLeaseService(taskService)
+	retriever := NewContextRetriever(memStorage, memStorage)
+
+	project := domain.NewProject("Test Project", "A test project", "Share work")
+	require.NoError(t, memStorage.CreateProject(project))
+
+	urgent := domain.NewTask(project.ID, "Urgent Task", "Scores higher")
+	urgent.Criteria.Acceptance = []string{"Clear definition of done"}
+	other := domain.NewTask(project.ID, "Other Task", "Scores lower")
+	require.NoError(t, taskService.Create(urgent))
+	require.NoError(t, taskService.Create(other))
+
+	_, err := leaseService.Claim(urgent.ID, "agent-a", time.Minute, "agent-a")
+	require.NoError(t, err)
+
+	// The holder still sees its own task, everyone else gets the next one
+	next, err := retriever.GetNextTask(domain.NextTaskCriteria{ProjectID: project.ID, Agent: "agent-a"})
+	require.NoError(t, err)
+	assert.Equal(t, urgent.ID, next.ID)
+
+	next, err = retriever.GetNextTask(domain.NextTaskCriteria{ProjectID: project.ID, Agent: "agent-b"})
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, next.ID)
+}
+
+func TestLeaseService_ConcurrentClaims(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+
+	task := domain.NewTask("project-1", "Contested Task", "Wanted by every agent")
+	require.NoError(t, taskService.Create(task))
+
+	// Separate services share nothing but the storage, like separate servers
+	const agents = 8
+	errs := make([]error, agents)
+	var wg sync.WaitGroup
+	for i := 0; i < agents; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = NewLeaseService(taskService).Claim(task.ID, fmt.Sprintf("agent-%d", i), time.Minute, "")
+		}(i)
+	}
+	wg.Wait()
+
+	winners := 0
+	for _, err := range errs {
+		if err == nil {
+			winners++
+			continue
+		}
+		var conflict *domain.LeaseConflictError
+		assert.ErrorAs(t, err, &conflict)
+	}
+	assert.Equal(t, 1, winners)
+}
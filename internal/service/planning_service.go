@@ -34,7 +34,7 @@ func NewPlanningService(storage PlanningStorage, taskService *TaskService, proje
 	}
 }
 
-func (ps *PlanningService) StartPlanningSession(projectID, name string) (*domain.PlanningSession, error) {
+func (ps *PlanningService) StartPlanningSession(projectID, name, createdBy string) (*domain.PlanningSession, error) {
 	// Verify project exists
 	_, err := ps.projectService.Get(projectID)
 	if err != nil {
@@ -42,6 +42,7 @@ func (ps *PlanningService) StartPlanningSession(projectID, name string) (*domain
 	}
 	
 	session := domain.NewPlanningSession(projectID, name)
+	session.CreatedBy = createdBy
 	err = ps.storage.CreatePlanningSession(session)
 	if err != nil {
 		return nil, err
@@ -54,20 +55,35 @@ func (ps *PlanningService) GetPlanningSession(id string) (*domain.PlanningSessio
 	return ps.storage.GetPlanningSession(id)
 }
 
-func (ps *PlanningService) ListPlanningSessions(projectID string) ([]*domain.PlanningSession, error) {
-	return ps.storage.ListPlanningSessions(projectID)
+// ListPlanningSessions lists a project's sessions; archived sessions are
+// left out unless archived says otherwise
+func (ps *PlanningService) ListPlanningSessions(projectID string, archived domain.ArchiveScope) ([]*domain.PlanningSession, error) {
+	sessions, err := ps.storage.ListPlanningSessions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	
+	result := make([]*domain.PlanningSession, 0, len(sessions))
+	for _, session := range sessions {
+		if archived.Includes(session.ArchivedAt != nil) {
+			result = append(result, session)
+		}
+	}
+	return result, nil
 }
 
 func (ps *PlanningService) CompletePlanningSession(id string) (*domain.PlanningSession, error) {
 	updates := map[string]interface{}{
-		"status": domain.PlanningStatusCompleted,
+		"status":  domain.PlanningStatusCompleted,
+		"endedAt": time.Now(),
 	}
 	return ps.storage.UpdatePlanningSession(id, updates)
 }
 
 func (ps *PlanningService) AbortPlanningSession(id string) (*domain.PlanningSession, error) {
 	updates := map[string]interface{}{
-		"status": domain.PlanningStatusAborted,
+		"status":  domain.PlanningStatusAborted,
+		"endedAt": time.Now(),
 	}
 	return ps.storage.UpdatePlanningSession(id, updates)
 }
@@ -93,9 +109,10 @@ func (ps *PlanningService) AddTaskToSession(sessionID string, taskID string) err
 	return err
 }
 
-func (ps *PlanningService) RecordDiscovery(projectID, insight string, impact domain.Impact, source domain.DiscoverySource, affectedTaskIDs []string) (*domain.Discovery, error) {
+func (ps *PlanningService) RecordDiscovery(projectID, insight string, impact domain.Impact, source domain.DiscoverySource, affectedTaskIDs []string, recordedBy string) (*domain.Discovery, error) {
 	discovery := domain.NewDiscovery(projectID, insight, impact, source)
 	discovery.AffectedTasks = affectedTaskIDs
+	discovery.RecordedBy = recordedBy
 	
 	err := ps.storage.CreateDiscovery(discovery)
 	if err != nil {
@@ -127,9 +144,10 @@ func (ps *PlanningService) RecordDiscovery(projectID, insight string, impact dom
 	return discovery, nil
 }
 
-func (ps *PlanningService) RecordDecision(projectID, question, choice, rationale string, alternatives []string, reversible bool, affectedTaskIDs []string) (*domain.Decision, error) {
+func (ps *PlanningService) RecordDecision(projectID, question, choice, rationale string, alternatives []string, reversible bool, affectedTaskIDs []string, recordedBy string) (*domain.Decision, error) {
 	decision := domain.NewDecision(projectID, question, choice, rationale, alternatives, reversible)
 	decision.AffectedTasks = affectedTaskIDs
+	decision.RecordedBy = recordedBy
 	
 	err := ps.storage.CreateDecision(decision)
 	if err != nil {
@@ -24,12 +24,13 @@ func TestPlanningService_StartPlanningSession(t *testing.T) {
 	require.NoError(t, err)
 	
 	// Start a planning session
-	session, err := planningService.StartPlanningSession(project.ID, "Sprint Planning")
+	session, err := planningService.StartPlanningSession(project.ID, "Sprint Planning", "planner")
 	assert.NoError(t, err)
 	assert.NotNil(t, session)
 	assert.Equal(t, "Sprint Planning", session.Name)
 	assert.Equal(t, project.ID, session.ProjectID)
 	assert.Equal(t, domain.PlanningStatusActive, session.Status)
+	assert.Equal(t, "planner", session.CreatedBy)
 	assert.NotEmpty(t, session.ID)
 }
 
@@ -56,6 +57,7 @@ func TestPlanningService_RecordDiscovery(t *testing.T) {
 		domain.ImpactHigh,
 		domain.SourceResearch,
 		[]string{task.ID},
+		"planner (test-client/1.0)",
 	)
 	
 	assert.NoError(t, err)
@@ -64,6 +66,7 @@ func TestPlanningService_RecordDiscovery(t *testing.T) {
 	assert.Equal(t, domain.ImpactHigh, discovery.Impact)
 	assert.Equal(t, domain.SourceResearch, discovery.Source)
 	assert.Contains(t, discovery.AffectedTasks, task.ID)
+	assert.Equal(t, "planner (test-client/1.0)", discovery.RecordedBy)
 	
 	// Verify discovery is in the list
 	discoveries, err := planningService.ListDiscoveries(project.ID)
@@ -97,6 +100,7 @@ func TestPlanningService_RecordDecision(t *testing.T) {
 		[]string{"MySQL", "SQLite"},
 		true,
 		[]string{task.ID},
+		"planner (test-client/1.0)",
 	)
 	
 	assert.NoError(t, err)
@@ -108,6 +112,7 @@ func TestPlanningService_RecordDecision(t *testing.T) {
 	assert.Contains(t, decision.Alternatives, "SQLite")
 	assert.True(t, decision.Reversible)
 	assert.Contains(t, decision.AffectedTasks, task.ID)
+	assert.Equal(t, "planner (test-client/1.0)", decision.RecordedBy)
 	
 	// Verify decision is in the list
 	decisions, err := planningService.ListDecisions(project.ID)
@@ -129,7 +134,7 @@ func TestPlanningService_GenerateSessionSummary(t *testing.T) {
 	require.NoError(t, err)
 	
 	// Start a planning session
-	session, err := planningService.StartPlanningSession(project.ID, "Sprint Planning")
+	session, err := planningService.StartPlanningSession(project.ID, "Sprint Planning", "")
 	require.NoError(t, err)
 	
 	// Create some tasks
@@ -147,9 +152,9 @@ func TestPlanningService_GenerateSessionSummary(t *testing.T) {
 	require.NoError(t, err)
 	
 	// Record a discovery and decision
-	_, err = planningService.RecordDiscovery(project.ID, "Important insight", domain.ImpactMedium, domain.SourcePlanning, []string{task1.ID})
+	_, err = planningService.RecordDiscovery(project.ID, "Important insight", domain.ImpactMedium, domain.SourcePlanning, []string{task1.ID}, "")
 	require.NoError(t, err)
-	_, err = planningService.RecordDecision(project.ID, "Test question", "Test choice", "Test rationale", []string{"alt1"}, true, []string{task2.ID})
+	_, err = planningService.RecordDecision(project.ID, "Test question", "Test choice", "Test rationale", []string{"alt1"}, true, []string{task2.ID}, "")
 	require.NoError(t, err)
 	
 	// Generate session summary
@@ -54,6 +54,7 @@ type ProcessActor struct {
 	// Immutable data
 	id      string
 	process *domain.Process
+	secrets SecretResolver
 	
 	// Actor state (owned by this goroutine only)
 	cmd         *exec.Cmd
@@ -190,13 +191,11 @@ func (pa *ProcessActor) startProcess() ProcessResponse {
 	pa.cmd = exec.CommandContext(pa.ctx, pa.process.Command, pa.process.Args...)
 	pa.cmd.Dir = pa.process.WorkingDir
 	
-	// Set environment variables
-	if len(pa.process.Environment) > 0 {
-		env := pa.cmd.Environ()
-		for k, v := range pa.process.Environment {
-			env = append(env, fmt.Sprintf("%s=%s", k, v))
-		}
-		pa.cmd.Env = env
+	// Set environment variables. Secret references are resolved here and
+	// only here, into the child's environment, never into pa.process
+	redactor, err := pa.setEnvironment()
+	if err != nil {
+		return ProcessResponse{Success: false, Error: err}
 	}
 	
 	// Force unbuffered output for real-time log capture
@@ -234,8 +233,8 @@ func (pa *ProcessActor) startProcess() ProcessResponse {
 	pa.process.Status = domain.ProcessStatusRunning
 	
 	// Start log capture routines (non-blocking)
-	go pa.captureOutput(stdout, domain.LogTypeStdout)
-	go pa.captureOutput(stderr, domain.LogTypeStderr)
+	go pa.captureOutput(stdout, domain.LogTypeStdout, redactor)
+	go pa.captureOutput(stderr, domain.LogTypeStderr, redactor)
 	
 	// Monitor process completion (non-blocking)
 	go pa.monitorProcess()
@@ -256,6 +255,36 @@ func (pa *ProcessActor) startProcess() ProcessResponse {
 	}
 }
 
+// setEnvironment adds the process's environment to pa.cmd and returns a
+// Redactor for the secret values it resolved
+func (pa *ProcessActor) setEnvironment() (*domain.Redactor, error) {
+	if len(pa.process.Environment) == 0 {
+		return nil, nil
+	}
+
+	secrets := map[string]string{}
+	for _, name := range domain.SecretRefs(pa.process.Environment) {
+		if pa.secrets == nil {
+			return nil, fmt.Errorf("environment references secret %s but no secret store is configured", name)
+		}
+		value, err := pa.secrets.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret: %w", err)
+		}
+		secrets[name] = value
+	}
+
+	env := pa.cmd.Environ()
+	for k, v := range pa.process.Environment {
+		if name, ok := domain.ParseSecretRef(v); ok {
+			v = secrets[name]
+		}
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	pa.cmd.Env = env
+	return domain.NewRedactor(secrets), nil
+}
+
 // stopProcess gracefully stops the process
 func (pa *ProcessActor) stopProcess() ProcessResponse {
 	if !pa.running.Load() {
@@ -371,7 +400,7 @@ func (pa *ProcessActor) getStatus() ProcessResponse {
 }
 
 // captureOutput captures process output and sends to log pipeline
-func (pa *ProcessActor) captureOutput(pipe io.Reader, logType domain.LogType) {
+func (pa *ProcessActor) captureOutput(pipe io.Reader, logType domain.LogType, redactor *domain.Redactor) {
 	defer func() {
 		if r := recover(); r != nil {
 			pa.sendLog(domain.LogTypeSystem, fmt.Sprintf("Panic in output capture (%s): %v", logType, r))
@@ -384,7 +413,7 @@ func (pa *ProcessActor) captureOutput(pipe io.Reader, logType domain.LogType) {
 	for scanner.Scan() {
 		line := scanner.Text()
 		if len(line) > 0 {
-			pa.sendLog(logType, line)
+			pa.sendLog(logType, redactor.Redact(line))
 			lineCount++
 			
 			// Periodic debug info for active processes
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+type mapSecrets map[string]string
+
+func (m mapSecrets) Get(name string) (string, error) {
+	if value, ok := m[name]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("secret not found: %s", name)
+}
+
+func TestProcessActor_ResolvesAndRedactsSecrets(t *testing.T) {
+	process := domain.NewProcess("project", "printer", "sh", []string{"-c", `echo "token=$API_TOKEN mode=$MODE"; sleep 0.5`})
+	process.Environment = map[string]string{"API_TOKEN": "secret://api-token", "MODE": "dev"}
+	logsCh := make(chan LogEntry, 100)
+	actor := NewProcessActor(process, logsCh, make(chan ProcessEvent, 100))
+	defer actor.cancel()
+
+	response := actor.startProcess()
+	require.Error(t, response.Error, "no secret store")
+	actor.secrets = mapSecrets{}
+	response = actor.startProcess()
+	require.ErrorContains(t, response.Error, "api-token")
+
+	actor.secrets = mapSecrets{"api-token": "s3cr3t-value"}
+	response = actor.startProcess()
+	require.NoError(t, response.Error)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case entry := <-logsCh:
+			assert.NotContains(t, entry.Message, "s3cr3t-value")
+			if entry.Type != domain.LogTypeStdout {
+				continue
+			}
+			assert.Equal(t, "token=[secret:api-token] mode=dev", entry.Message)
+			assert.Equal(t, "secret://api-token", process.Environment["API_TOKEN"], "the process keeps the reference")
+			return
+		case <-deadline:
+			t.Fatal("no output captured")
+		}
+	}
+}
@@ -32,6 +32,7 @@ type ProcessOrchestrator struct {
 	
 	// Configuration
 	defaultWorkingDir string
+	secrets           SecretResolver
 	
 	// Control
 	ctx    context.Context
@@ -51,6 +52,9 @@ type ProcessOrchestrator struct {
 type ProcessOrchestratorConfig struct {
 	DefaultWorkingDir string
 	LogPipelineConfig LogPipelineConfig
+	// Secrets resolves secret:// environment values when a process starts;
+	// without it processes that reference secrets fail to start
+	Secrets SecretResolver
 }
 
 // DefaultProcessOrchestratorConfig returns default configuration
@@ -80,6 +84,7 @@ func NewProcessOrchestrator(storage ProcessStorage, config ProcessOrchestratorCo
 		logsCh:            logsCh,
 		eventsCh:          eventsCh,
 		defaultWorkingDir: config.DefaultWorkingDir,
+		secrets:           config.Secrets,
 		ctx:               ctx,
 		cancel:            cancel,
 		done:              make(chan struct{}),
@@ -144,6 +149,7 @@ func (po *ProcessOrchestrator) Create(process *domain.Process) error {
 	
 	// Create actor (but don't start the process yet)
 	actor := NewProcessActor(process, po.logsCh, po.eventsCh)
+	actor.secrets = po.secrets
 	actor.Start()
 	
 	// Register with state manager
@@ -288,6 +294,9 @@ func (po *ProcessOrchestrator) Update(processID string, updates map[string]inter
 	if restart, ok := updates["restartPolicy"].(domain.RestartPolicy); ok {
 		process.RestartPolicy = restart
 	}
+	if taskID, ok := updates["taskId"].(string); ok {
+		process.TaskID = taskID
+	}
 	
 	process.UpdatedAt = time.Now()
 	
@@ -378,10 +387,13 @@ func (po *ProcessOrchestrator) validateProcess(process *domain.Process) error {
 	}
 	
 	// Validate environment variables
-	for key, _ := range process.Environment {
+	for key, value := range process.Environment {
 		if key == "" {
 			return fmt.Errorf("environment variable name cannot be empty")
 		}
+		if name, ok := domain.ParseSecretRef(value); ok && !domain.IsValidSecretName(name) {
+			return fmt.Errorf("environment variable %s references an invalid secret name %q", key, name)
+		}
 	}
 	
 	return nil
@@ -0,0 +1,508 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Export formats supported by ExportService.Encode. Only JSON bundles can be
+// imported again; CSV and Markdown are for people.
+const (
+	ExportFormatJSON     = "json"
+	ExportFormatCSV      = "csv"
+	ExportFormatMarkdown = "markdown"
+)
+
+type ExportService struct {
+	storage ExportStorage
+}
+
+type ExportStorage interface {
+	GetProject(id string) (*domain.Project, error)
+	CreateProject(project *domain.Project) error
+	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
+	CreateTask(task *domain.Task) error
+	ListDecisions(projectID string) ([]*domain.Decision, error)
+	CreateDecision(decision *domain.Decision) error
+	ListDiscoveries(projectID string) ([]*domain.Discovery, error)
+	CreateDiscovery(discovery *domain.Discovery) error
+	ListPlanningSessions(projectID string) ([]*domain.PlanningSession, error)
+	CreatePlanningSession(session *domain.PlanningSession) error
+	ListProcesses(filter domain.ProcessFilter) ([]*domain.Process, error)
+	SaveProcess(projectID string, process *domain.Process) error
+}
+
+func NewExportService(storage ExportStorage) *ExportService {
+	return &ExportService{storage: storage}
+}
+
+// Export collects a project and everything recorded under it into a bundle
+func (es *ExportService) Export(projectID string) (*domain.ProjectBundle, error) {
+	project, err := es.storage.GetProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := es.storage.ListTasks(domain.TaskFilter{ProjectID: &projectID, Archived: domain.ArchiveInclude})
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := es.storage.ListDecisions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	discoveries, err := es.storage.ListDiscoveries(projectID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := es.storage.ListPlanningSessions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	processes, err := es.storage.ListProcesses(domain.ProcessFilter{ProjectID: &projectID})
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := make([]*domain.Process, 0, len(processes))
+	for _, process := range processes {
+		definitions = append(definitions, processDefinition(process))
+	}
+
+	return &domain.ProjectBundle{
+		Format:           domain.ProjectBundleFormat,
+		ExportedAt:       time.Now(),
+		Project:          project,
+		Tasks:            tasks,
+		Decisions:        decisions,
+		Discoveries:      discoveries,
+		PlanningSessions: sessions,
+		Processes:        definitions,
+	}, nil
+}
+
+// Encode renders a bundle in one of the export formats
+func (es *ExportService) Encode(bundle *domain.ProjectBundle, format string) ([]byte, error) {
+	switch format {
+	case "", ExportFormatJSON:
+		return marshalBundle(bundle)
+	case ExportFormatCSV:
+		return encodeTasksCSV(bundle.Tasks)
+	case ExportFormatMarkdown, "md":
+		return []byte(formatBundleMarkdown(bundle)), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q (expected json, csv or markdown)", format)
+	}
+}
+
+// Import stores a copy of the bundle as a new project. Every entity gets a
+// new ID and references between them are rewritten; references to entities
+// outside the bundle are dropped. An empty name keeps the exported one.
+// A bundle that fails to import leaves nothing behind.
+func (es *ExportService) Import(bundle *domain.ProjectBundle, name string) (*domain.ProjectImport, error) {
+	ids, err := newBundleIDs(bundle)
+	if err != nil {
+		return nil, err
+	}
+	result := &domain.ProjectImport{IDMap: ids}
+	remap := func(refs []string) []string {
+		mapped := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			if id, ok := ids[ref]; ok {
+				mapped = append(mapped, id)
+			} else {
+				result.Dropped++
+			}
+		}
+		return mapped
+	}
+
+	project := *bundle.Project
+	project.ID = ids[bundle.Project.ID]
+	if name != "" {
+		project.Name = name
+	}
+	err = withTransaction(es.storage, func(store ExportStorage) error {
+		if err := store.CreateProject(&project); err != nil {
+			return err
+		}
+		result.Project = &project
+
+		for _, original := range bundle.Tasks {
+			task := original.Clone()
+			task.ID = ids[original.ID]
+			task.ProjectID = project.ID
+			task.Version = 1
+			task.Card.Lease = nil
+			if task.Card.Parent != nil {
+				if parent, ok := ids[*task.Card.Parent]; ok {
+					task.Card.Parent = &parent
+				} else {
+					task.Card.Parent = nil
+					result.Dropped++
+				}
+			}
+			task.Card.Children = remap(task.Card.Children)
+			task.Context.Dependencies = remap(task.Context.Dependencies)
+			task.Context.Decisions = remap(task.Context.Decisions)
+			if err := store.CreateTask(task); err != nil {
+				return fmt.Errorf("failed to import task %q: %w", original.Card.Title, err)
+			}
+			result.Tasks++
+		}
+
+		for _, original := range bundle.Decisions {
+			decision := *original
+			decision.ID = ids[original.ID]
+			decision.ProjectID = project.ID
+			decision.AffectedTasks = remap(original.AffectedTasks)
+			if err := store.CreateDecision(&decision); err != nil {
+				return fmt.Errorf("failed to import decision %q: %w", original.Question, err)
+			}
+			result.Decisions++
+		}
+
+		for _, original := range bundle.Discoveries {
+			discovery := *original
+			discovery.ID = ids[original.ID]
+			discovery.ProjectID = project.ID
+			discovery.AffectedTasks = remap(original.AffectedTasks)
+			if err := store.CreateDiscovery(&discovery); err != nil {
+				return fmt.Errorf("failed to import discovery %q: %w", original.Insight, err)
+			}
+			result.Discoveries++
+		}
+
+		for _, original := range bundle.PlanningSessions {
+			session := *original
+			session.ID = ids[original.ID]
+			session.ProjectID = project.ID
+			session.Tasks = remap(original.Tasks)
+			if err := store.CreatePlanningSession(&session); err != nil {
+				return fmt.Errorf("failed to import planning session %q: %w", original.Name, err)
+			}
+			result.PlanningSessions++
+		}
+
+		for _, original := range bundle.Processes {
+			process := processDefinition(original)
+			process.ID = ids[original.ID]
+			process.ProjectID = project.ID
+			if process.TaskID != "" {
+				if taskID, ok := ids[process.TaskID]; ok {
+					process.TaskID = taskID
+				} else {
+					process.TaskID = ""
+					result.Dropped++
+				}
+			}
+			if err := store.SaveProcess(project.ID, process); err != nil {
+				return fmt.Errorf("failed to import process %q: %w", original.Name, err)
+			}
+			result.Processes++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DecodeProjectBundle parses a JSON bundle written by Export
+func DecodeProjectBundle(data []byte) (*domain.ProjectBundle, error) {
+	var bundle domain.ProjectBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid project bundle: %w", err)
+	}
+	return &bundle, nil
+}
+
+func marshalBundle(bundle *domain.ProjectBundle) ([]byte, error) {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// newBundleIDs validates the bundle and assigns a new ID to every entity in
+// it, before anything is written
+func newBundleIDs(bundle *domain.ProjectBundle) (map[string]string, error) {
+	if bundle == nil || bundle.Project == nil {
+		return nil, fmt.Errorf("invalid project bundle: no project")
+	}
+	if bundle.Format != domain.ProjectBundleFormat {
+		return nil, fmt.Errorf("unsupported project bundle format %q (expected %q)", bundle.Format, domain.ProjectBundleFormat)
+	}
+
+	ids := map[string]string{}
+	assign := func(kind, id string) error {
+		if id == "" {
+			return fmt.Errorf("invalid project bundle: %s without an ID", kind)
+		}
+		if _, ok := ids[id]; ok {
+			return fmt.Errorf("invalid project bundle: ID %s is used twice", id)
+		}
+		ids[id] = uuid.New().String()
+		return nil
+	}
+
+	if err := assign("project", bundle.Project.ID); err != nil {
+		return nil, err
+	}
+	for _, task := range bundle.Tasks {
+		if task == nil {
+			return nil, fmt.Errorf("invalid project bundle: empty task entry")
+		}
+		if err := assign("task", task.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, decision := range bundle.Decisions {
+		if decision == nil {
+			return nil, fmt.Errorf("invalid project bundle: empty decision entry")
+		}
+		if err := assign("decision", decision.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, discovery := range bundle.Discoveries {
+		if discovery == nil {
+			return nil, fmt.Errorf("invalid project bundle: empty discovery entry")
+		}
+		if err := assign("discovery", discovery.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, session := range bundle.PlanningSessions {
+		if session == nil {
+			return nil, fmt.Errorf("invalid project bundle: empty planning session entry")
+		}
+		if err := assign("planning session", session.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, process := range bundle.Processes {
+		if process == nil {
+			return nil, fmt.Errorf("invalid project bundle: empty process entry")
+		}
+		if err := assign("process", process.ID); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// processDefinition copies a process without the state of a running instance
+func processDefinition(process *domain.Process) *domain.Process {
+	definition := *process
+	definition.Status = domain.ProcessStatusStopped
+	definition.PID = 0
+	definition.StartedAt = nil
+	definition.StoppedAt = nil
+	definition.LastHealthCheck = nil
+	definition.HealthStatus = ""
+	definition.RestartPolicy.RetryCount = 0
+	definition.RestartPolicy.LastRestart = nil
+	return &definition
+}
+
+var taskCSVHeader = []string{
+	"id", "title", "description", "status", "priority", "parent", "labels", "assignedTo",
+	"dueDate", "estimatedHours", "actualHours", "dependencies", "createdAt", "updatedAt", "completedAt",
+}
+
+// encodeTasksCSV writes one row per task; list columns are joined with ";"
+func encodeTasksCSV(tasks []*domain.Task) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(taskCSVHeader); err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		row := []string{
+			task.ID,
+			task.Card.Title,
+			task.Card.Description,
+			string(task.Card.Status),
+			string(task.Card.Priority),
+			derefString(task.Card.Parent),
+			strings.Join(task.Card.Labels, ";"),
+			derefString(task.Card.AssignedTo),
+			formatCSVTime(task.Card.DueDate),
+			formatCSVHours(task.Card.EstimatedHours),
+			formatCSVHours(task.Card.ActualHours),
+			strings.Join(task.Context.Dependencies, ";"),
+			task.Card.CreatedAt.UTC().Format(time.RFC3339),
+			task.Card.UpdatedAt.UTC().Format(time.RFC3339),
+			formatCSVTime(task.Card.CompletedAt),
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func formatCSVTime(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339)
+}
+
+func formatCSVHours(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+var bundleStatusOrder = []domain.TaskStatus{
+	domain.StatusInProgress, domain.StatusBlocked, domain.StatusPlanned,
+	domain.StatusOnHold, domain.StatusCompleted, domain.StatusCanceled,
+}
+
+// formatBundleMarkdown renders a bundle as a report for reading, not
+// re-importing
+func formatBundleMarkdown(bundle *domain.ProjectBundle) string {
+	var sb strings.Builder
+	project := bundle.Project
+
+	sb.WriteString(fmt.Sprintf("# %s\n\n", project.Name))
+	if project.Description != "" {
+		sb.WriteString(project.Description + "\n\n")
+	}
+	if project.Goal != "" {
+		sb.WriteString(fmt.Sprintf("**Goal:** %s\n\n", project.Goal))
+	}
+	sb.WriteString(fmt.Sprintf("_Exported %s_\n\n", bundle.ExportedAt.Format("2006-01-02 15:04")))
+
+	titles := make(map[string]string, len(bundle.Tasks))
+	byStatus := make(map[domain.TaskStatus][]*domain.Task)
+	for _, task := range bundle.Tasks {
+		titles[task.ID] = task.Card.Title
+		byStatus[task.Card.Status] = append(byStatus[task.Card.Status], task)
+	}
+
+	sb.WriteString(fmt.Sprintf("## Tasks (%d)\n\n", len(bundle.Tasks)))
+	statuses := append([]domain.TaskStatus{}, bundleStatusOrder...)
+	for status := range byStatus {
+		if !containsStatus(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+	for _, status := range statuses {
+		tasks := byStatus[status]
+		if len(tasks) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("### %s (%d)\n\n", status, len(tasks)))
+		for _, task := range tasks {
+			check := " "
+			if task.Card.Status == domain.StatusCompleted {
+				check = "x"
+			}
+			details := []string{string(task.Card.Priority)}
+			if len(task.Card.Labels) > 0 {
+				details = append(details, "labels: "+strings.Join(task.Card.Labels, ", "))
+			}
+			if task.Card.AssignedTo != nil {
+				details = append(details, "assigned to "+*task.Card.AssignedTo)
+			}
+			if task.Card.DueDate != nil {
+				details = append(details, "due "+task.Card.DueDate.Format("2006-01-02"))
+			}
+			if task.Card.Parent != nil {
+				if title, ok := titles[*task.Card.Parent]; ok {
+					details = append(details, "part of "+title)
+				}
+			}
+			sb.WriteString(fmt.Sprintf("- [%s] %s (%s)\n", check, task.Card.Title, strings.Join(details, "; ")))
+			if len(task.Context.Dependencies) > 0 {
+				deps := make([]string, 0, len(task.Context.Dependencies))
+				for _, dep := range task.Context.Dependencies {
+					if title, ok := titles[dep]; ok {
+						deps = append(deps, title)
+					} else {
+						deps = append(deps, dep)
+					}
+				}
+				sb.WriteString(fmt.Sprintf("  - Depends on: %s\n", strings.Join(deps, ", ")))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(bundle.Decisions) > 0 {
+		sb.WriteString(fmt.Sprintf("## Decisions (%d)\n\n", len(bundle.Decisions)))
+		for _, decision := range bundle.Decisions {
+			sb.WriteString(fmt.Sprintf("- **%s** → %s", decision.Question, decision.Choice))
+			if decision.Rationale != "" {
+				sb.WriteString(" — " + decision.Rationale)
+			}
+			sb.WriteString(fmt.Sprintf(" (%s)\n", decision.Timestamp.Format("2006-01-02")))
+			if len(decision.Alternatives) > 0 {
+				sb.WriteString(fmt.Sprintf("  - Alternatives: %s\n", strings.Join(decision.Alternatives, ", ")))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(bundle.Discoveries) > 0 {
+		sb.WriteString(fmt.Sprintf("## Discoveries (%d)\n\n", len(bundle.Discoveries)))
+		for _, discovery := range bundle.Discoveries {
+			sb.WriteString(fmt.Sprintf("- [%s] %s (%s, %s)\n", discovery.Impact, discovery.Insight, discovery.Source, discovery.Timestamp.Format("2006-01-02")))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(bundle.PlanningSessions) > 0 {
+		sb.WriteString(fmt.Sprintf("## Planning Sessions (%d)\n\n", len(bundle.PlanningSessions)))
+		for _, session := range bundle.PlanningSessions {
+			sb.WriteString(fmt.Sprintf("- %s — %s, %d tasks (%s)\n", session.Name, session.Status, len(session.Tasks), session.CreatedAt.Format("2006-01-02")))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(bundle.Processes) > 0 {
+		sb.WriteString(fmt.Sprintf("## Processes (%d)\n\n", len(bundle.Processes)))
+		processes := append([]*domain.Process{}, bundle.Processes...)
+		sort.SliceStable(processes, func(i, j int) bool { return processes[i].Name < processes[j].Name })
+		for _, process := range processes {
+			command := strings.TrimSpace(process.Command + " " + strings.Join(process.Args, " "))
+			sb.WriteString(fmt.Sprintf("- %s: `%s` (%s)\n", process.Name, command, process.Type))
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+func containsStatus(statuses []domain.TaskStatus, status domain.TaskStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func TestExportService_RoundTripRemapsIDs(t *testing.T) {
+	source := storage.NewMemoryStorage()
+	project := domain.NewProject("Monorepo API", "The API half", "Split cleanly")
+	require.NoError(t, source.CreateProject(project))
+
+	parent := domain.NewTask(project.ID, "Extract API", "")
+	child := domain.NewTask(project.ID, "Move handlers", "")
+	child.Card.Parent = &parent.ID
+	child.Card.Labels = []string{"api", "split"}
+	child.Context.Dependencies = []string{parent.ID, "task-in-another-project"}
+	parent.Card.Children = []string{child.ID}
+	require.NoError(t, source.CreateTask(parent))
+	require.NoError(t, source.CreateTask(child))
+
+	decision := domain.NewDecision(project.ID, "Keep history?", "Yes", "Planning context matters", []string{"No"}, false)
+	decision.AffectedTasks = []string{child.ID}
+	require.NoError(t, source.CreateDecision(decision))
+	session := domain.NewPlanningSession(project.ID, "Split plan")
+	session.Tasks = []string{parent.ID, child.ID}
+	require.NoError(t, source.CreatePlanningSession(session))
+	process := domain.NewProcess(project.ID, "api", "go", []string{"run", "./cmd/api"})
+	process.TaskID = child.ID
+	process.Status = domain.ProcessStatusRunning
+	process.PID = 4242
+	require.NoError(t, source.SaveProcess(project.ID, process))
+
+	exporter := NewExportService(source)
+	bundle, err := exporter.Export(project.ID)
+	require.NoError(t, err)
+	assert.Len(t, bundle.Tasks, 2)
+	assert.Equal(t, 0, bundle.Processes[0].PID, "runtime state is not exported")
+
+	data, err := exporter.Encode(bundle, ExportFormatJSON)
+	require.NoError(t, err)
+	decoded, err := DecodeProjectBundle(data)
+	require.NoError(t, err)
+
+	target := storage.NewMemoryStorage()
+	result, err := NewExportService(target).Import(decoded, "API")
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Tasks)
+	assert.Equal(t, 1, result.Decisions)
+	assert.Equal(t, 1, result.PlanningSessions)
+	assert.Equal(t, 1, result.Processes)
+	assert.Equal(t, 1, result.Dropped, "the dependency outside the bundle is dropped")
+	assert.Equal(t, "API", result.Project.Name)
+	assert.NotEqual(t, project.ID, result.Project.ID)
+
+	newParent, err := target.GetTask(result.IDMap[parent.ID])
+	require.NoError(t, err)
+	newChild, err := target.GetTask(result.IDMap[child.ID])
+	require.NoError(t, err)
+	assert.Equal(t, result.Project.ID, newChild.ProjectID)
+	assert.Equal(t, []string{newChild.ID}, newParent.Card.Children)
+	assert.Equal(t, newParent.ID, *newChild.Card.Parent)
+	assert.Equal(t, []string{newParent.ID}, newChild.Context.Dependencies)
+	assert.Equal(t, []string{"api", "split"}, newChild.Card.Labels)
+
+	decisions, err := target.ListDecisions(result.Project.ID)
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, []string{newChild.ID}, decisions[0].AffectedTasks)
+	sessions, err := target.ListPlanningSessions(result.Project.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, []string{newParent.ID, newChild.ID}, sessions[0].Tasks)
+	imported, err := target.GetProcess(result.IDMap[process.ID])
+	require.NoError(t, err)
+	assert.Equal(t, newChild.ID, imported.TaskID)
+	assert.Equal(t, domain.ProcessStatusStopped, imported.Status)
+
+	// Importing the same bundle twice creates a second, independent copy
+	again, err := NewExportService(target).Import(decoded, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, result.Project.ID, again.Project.ID)
+	assert.Equal(t, "Monorepo API", again.Project.Name)
+}
+
+func TestExportService_EncodeFormats(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	project := domain.NewProject("Report", "", "Ship it")
+	require.NoError(t, store.CreateProject(project))
+	done := domain.NewTask(project.ID, "Write, then \"quote\"", "")
+	done.Card.Status = domain.StatusCompleted
+	done.Card.Labels = []string{"docs", "csv"}
+	require.NoError(t, store.CreateTask(done))
+	require.NoError(t, store.CreateDiscovery(domain.NewDiscovery(project.ID, "CSV needs quoting", domain.ImpactLow, domain.SourceTesting)))
+
+	exporter := NewExportService(store)
+	bundle, err := exporter.Export(project.ID)
+	require.NoError(t, err)
+
+	data, err := exporter.Encode(bundle, ExportFormatCSV)
+	require.NoError(t, err)
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, taskCSVHeader, rows[0])
+	assert.Equal(t, "Write, then \"quote\"", rows[1][1])
+	assert.Equal(t, "docs;csv", rows[1][6])
+
+	data, err = exporter.Encode(bundle, ExportFormatMarkdown)
+	require.NoError(t, err)
+	report := string(data)
+	assert.Contains(t, report, "# Report")
+	assert.Contains(t, report, "- [x] Write, then \"quote\"")
+	assert.Contains(t, report, "## Discoveries (1)")
+
+	_, err = exporter.Encode(bundle, "xml")
+	assert.Error(t, err)
+}
+
+func TestExportService_ImportRejectsInvalidBundles(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	exporter := NewExportService(store)
+
+	_, err := exporter.Import(&domain.ProjectBundle{Format: "other", Project: domain.NewProject("X", "", "")}, "")
+	assert.Error(t, err)
+
+	project := domain.NewProject("Duplicated", "", "")
+	task := domain.NewTask(project.ID, "Twice", "")
+	_, err = exporter.Import(&domain.ProjectBundle{Format: domain.ProjectBundleFormat, Project: project, Tasks: []*domain.Task{task, task}}, "")
+	assert.Error(t, err)
+
+	for _, field := range []string{"tasks", "decisions", "discoveries", "planningSessions", "processes"} {
+		data := fmt.Sprintf(`{"format":%q,"project":{"id":"p1","name":"Nulls"},%q:[null]}`, domain.ProjectBundleFormat, field)
+		bundle, err := DecodeProjectBundle([]byte(data))
+		require.NoError(t, err)
+		_, err = exporter.Import(bundle, "")
+		assert.ErrorContains(t, err, "invalid project bundle", field)
+	}
+
+	projects, err := store.ListProjects()
+	require.NoError(t, err)
+	assert.Empty(t, projects, "nothing is written for an invalid bundle")
+}
+
+// failingDiscoveries is a store whose discovery writes fail, inside
+// transactions as well
+type failingDiscoveries struct {
+	storage.Store
+}
+
+func (f failingDiscoveries) CreateDiscovery(discovery *domain.Discovery) error {
+	return errors.New("disk full")
+}
+
+func (f failingDiscoveries) Transaction(fn func(tx storage.Store) error) error {
+	return f.Store.Transaction(func(tx storage.Store) error {
+		return fn(failingDiscoveries{tx})
+	})
+}
+
+func TestExportService_ImportFailureLeavesNoProject(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	project := domain.NewProject("Half", "", "")
+	task := domain.NewTask(project.ID, "Imported before the failure", "")
+	discovery := domain.NewDiscovery(project.ID, "Fails to import", domain.ImpactLow, domain.SourceTesting)
+	bundle := &domain.ProjectBundle{
+		Format:      domain.ProjectBundleFormat,
+		Project:     project,
+		Tasks:       []*domain.Task{task},
+		Discoveries: []*domain.Discovery{discovery},
+	}
+
+	_, err := NewExportService(failingDiscoveries{store}).Import(bundle, "")
+	require.Error(t, err)
+
+	projects, err := store.ListProjects()
+	require.NoError(t, err)
+	assert.Empty(t, projects)
+	tasks, err := store.ListTasks(domain.TaskFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+}
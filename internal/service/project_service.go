@@ -11,6 +11,7 @@ type ProjectService struct {
 type ProjectStorage interface {
 	CreateProject(project *domain.Project) error
 	GetProject(id string) (*domain.Project, error)
+	UpdateProject(id string, updates map[string]interface{}) (*domain.Project, error)
 	ListProjects() ([]*domain.Project, error)
 	SetCurrentProject(id string) error
 	GetCurrentProject() (*domain.Project, error)
@@ -30,6 +31,10 @@ func (s *ProjectService) Get(id string) (*domain.Project, error) {
 	return s.storage.GetProject(id)
 }
 
+func (s *ProjectService) Update(id string, updates map[string]interface{}) (*domain.Project, error) {
+	return s.storage.UpdateProject(id, updates)
+}
+
 func (s *ProjectService) List() ([]*domain.Project, error) {
 	return s.storage.ListProjects()
 }
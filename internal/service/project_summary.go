@@ -30,6 +30,7 @@ type ProjectSummary struct {
 	PlanningSessions []*domain.PlanningSession `json:"planningSessions"`
 	Insights        *ProjectInsights         `json:"insights"`
 	GeneratedAt     time.Time                `json:"generatedAt"`
+	AsOf            *time.Time               `json:"asOf,omitempty"`
 }
 
 type TaskSummary struct {
@@ -51,15 +52,31 @@ type ProjectInsights struct {
 }
 
 func (pss *ProjectSummaryService) GenerateProjectSummary(projectID string) (*ProjectSummary, error) {
-	// Get project
-	project, err := pss.projectService.Get(projectID)
+	// Get all tasks
+	filter := domain.TaskFilter{ProjectID: &projectID}
+	tasks, err := pss.taskService.List(filter)
 	if err != nil {
 		return nil, err
 	}
 	
-	// Get all tasks
+	return pss.generateSummary(projectID, tasks, nil)
+}
+
+// GenerateProjectSummaryAsOf summarizes the project as it stood at asOf,
+// using the task history and ignoring anything recorded later
+func (pss *ProjectSummaryService) GenerateProjectSummaryAsOf(projectID string, asOf time.Time) (*ProjectSummary, error) {
 	filter := domain.TaskFilter{ProjectID: &projectID}
-	tasks, err := pss.taskService.List(filter)
+	tasks, err := pss.taskService.ListAsOf(filter, asOf)
+	if err != nil {
+		return nil, err
+	}
+	
+	return pss.generateSummary(projectID, tasks, &asOf)
+}
+
+func (pss *ProjectSummaryService) generateSummary(projectID string, tasks []*domain.Task, asOf *time.Time) (*ProjectSummary, error) {
+	// Get project
+	project, err := pss.projectService.Get(projectID)
 	if err != nil {
 		return nil, err
 	}
@@ -76,12 +93,21 @@ func (pss *ProjectSummaryService) GenerateProjectSummary(projectID string) (*Pro
 		decisions = []*domain.Decision{} // Continue with empty list
 	}
 	
-	// Get planning sessions
-	sessions, err := pss.planningService.ListPlanningSessions(projectID)
+	// Get planning sessions; a session archived after asOf was still
+	// around then
+	archived := domain.ArchiveExclude
+	if asOf != nil {
+		archived = domain.ArchiveInclude
+	}
+	sessions, err := pss.planningService.ListPlanningSessions(projectID, archived)
 	if err != nil {
 		sessions = []*domain.PlanningSession{} // Continue with empty list
 	}
 	
+	if asOf != nil {
+		discoveries, decisions, sessions = recordedBefore(*asOf, discoveries, decisions, sessions)
+	}
+	
 	// Generate task summary
 	taskSummary := pss.generateTaskSummary(tasks)
 	
@@ -96,9 +122,34 @@ func (pss *ProjectSummaryService) GenerateProjectSummary(projectID string) (*Pro
 		PlanningSessions: sessions,
 		Insights:         insights,
 		GeneratedAt:      time.Now(),
+		AsOf:             asOf,
 	}, nil
 }
 
+// recordedBefore drops planning records created after asOf, and sessions
+// archived by then
+func recordedBefore(asOf time.Time, discoveries []*domain.Discovery, decisions []*domain.Decision, sessions []*domain.PlanningSession) ([]*domain.Discovery, []*domain.Decision, []*domain.PlanningSession) {
+	keptDiscoveries := make([]*domain.Discovery, 0, len(discoveries))
+	for _, d := range discoveries {
+		if !d.Timestamp.After(asOf) {
+			keptDiscoveries = append(keptDiscoveries, d)
+		}
+	}
+	keptDecisions := make([]*domain.Decision, 0, len(decisions))
+	for _, d := range decisions {
+		if !d.Timestamp.After(asOf) {
+			keptDecisions = append(keptDecisions, d)
+		}
+	}
+	keptSessions := make([]*domain.PlanningSession, 0, len(sessions))
+	for _, s := range sessions {
+		if !s.CreatedAt.After(asOf) && (s.ArchivedAt == nil || s.ArchivedAt.After(asOf)) {
+			keptSessions = append(keptSessions, s)
+		}
+	}
+	return keptDiscoveries, keptDecisions, keptSessions
+}
+
 func (pss *ProjectSummaryService) generateTaskSummary(tasks []*domain.Task) *TaskSummary {
 	summary := &TaskSummary{
 		Total:        len(tasks),
@@ -2,6 +2,7 @@ package service
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -53,9 +54,9 @@ func TestProjectSummaryService_GenerateProjectSummary(t *testing.T) {
 	require.NoError(t, err)
 	
 	// Record some discoveries and decisions
-	_, err = planningService.RecordDiscovery(project.ID, "Users prefer dark mode", domain.ImpactHigh, domain.SourceResearch, []string{task1.ID})
+	_, err = planningService.RecordDiscovery(project.ID, "Users prefer dark mode", domain.ImpactHigh, domain.SourceResearch, []string{task1.ID}, "")
 	require.NoError(t, err)
-	_, err = planningService.RecordDecision(project.ID, "Framework choice", "React", "Better ecosystem", []string{"Vue", "Angular"}, true, []string{task2.ID})
+	_, err = planningService.RecordDecision(project.ID, "Framework choice", "React", "Better ecosystem", []string{"Vue", "Angular"}, true, []string{task2.ID}, "")
 	require.NoError(t, err)
 	
 	// Generate project summary
@@ -105,6 +106,31 @@ func TestProjectSummaryService_GenerateProjectSummary(t *testing.T) {
 	assert.False(t, summary.GeneratedAt.IsZero())
 }
 
+func TestProjectSummaryService_AsOfKeepsSessionsArchivedLater(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	projectService := NewProjectService(memStorage)
+	planningService := NewPlanningService(memStorage, taskService, projectService)
+	summaryService := NewProjectSummaryService(taskService, projectService, planningService)
+
+	project := domain.NewProject("Test Project", "A test project", "Build awesome software")
+	require.NoError(t, projectService.Create(project))
+	session, err := planningService.StartPlanningSession(project.ID, "Sprint 1", "")
+	require.NoError(t, err)
+	beforeArchive := time.Now()
+	_, err = memStorage.UpdatePlanningSession(session.ID, map[string]interface{}{"archivedAt": time.Now().Add(time.Millisecond)})
+	require.NoError(t, err)
+
+	summary, err := summaryService.GenerateProjectSummaryAsOf(project.ID, beforeArchive)
+	require.NoError(t, err)
+	require.Len(t, summary.PlanningSessions, 1)
+	assert.Equal(t, session.ID, summary.PlanningSessions[0].ID)
+
+	summary, err = summaryService.GenerateProjectSummaryAsOf(project.ID, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, summary.PlanningSessions)
+}
+
 func TestProjectSummaryService_AnalyzeVelocityTrend(t *testing.T) {
 	summaryService := &ProjectSummaryService{}
 	
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// RetentionStorage is the storage RetentionService needs
+type RetentionStorage interface {
+	ListProjects() ([]*domain.Project, error)
+	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
+	UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error)
+	ListPlanningSessions(projectID string) ([]*domain.PlanningSession, error)
+	UpdatePlanningSession(id string, updates map[string]interface{}) (*domain.PlanningSession, error)
+	ListProcesses(filter domain.ProcessFilter) ([]*domain.Process, error)
+	PruneProcessLogs(processID string, before time.Time, keep int, dryRun bool) (int, error)
+}
+
+// RetentionService applies retention policies: it moves finished tasks and
+// planning sessions to the archive and deletes old process logs
+type RetentionService struct {
+	storage RetentionStorage
+	admin   *AdminService
+}
+
+// NewRetentionService creates the service. admin takes the safety snapshot
+// before a collection changes anything and may be nil.
+func NewRetentionService(storage RetentionStorage, admin *AdminService) *RetentionService {
+	return &RetentionService{storage: storage, admin: admin}
+}
+
+// Collect applies policy as of now. Archived tasks and sessions keep all of
+// their data and can be taken out of the archive again by clearing
+// archivedAt; pruned logs are gone. With dryRun set the report only lists
+// what would change.
+func (rs *RetentionService) Collect(policy domain.RetentionPolicy, now time.Time, dryRun bool) (*domain.GarbageCollection, error) {
+	policy = policy.WithDefaults()
+	report := &domain.GarbageCollection{Policy: policy, DryRun: dryRun}
+
+	projects, err := rs.storage.ListProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	taskCutoff := domain.RetentionCutoff(now, policy.ArchiveTasksAfterDays)
+	sessionCutoff := domain.RetentionCutoff(now, policy.ArchiveSessionsAfterDays)
+	for _, project := range projects {
+		if !taskCutoff.IsZero() {
+			tasks, err := rs.storage.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+			if err != nil {
+				return nil, err
+			}
+			for _, task := range tasks {
+				if closedAt, ok := taskClosedAt(task); ok && closedAt.Before(taskCutoff) {
+					report.ArchivedTasks = append(report.ArchivedTasks, task.ID)
+				}
+			}
+		}
+		if !sessionCutoff.IsZero() {
+			sessions, err := rs.storage.ListPlanningSessions(project.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, session := range sessions {
+				if endedAt, ok := sessionEndedAt(session); ok && session.ArchivedAt == nil && endedAt.Before(sessionCutoff) {
+					report.ArchivedSessions = append(report.ArchivedSessions, session.ID)
+				}
+			}
+		}
+	}
+
+	logCutoff := domain.RetentionCutoff(now, policy.ProcessLogDays)
+	keep := policy.MaxProcessLogEntries
+	if keep < 0 {
+		keep = 0
+	}
+	var pruned []string
+	if !logCutoff.IsZero() || keep > 0 {
+		processes, err := rs.storage.ListProcesses(domain.ProcessFilter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, process := range processes {
+			dropped, err := rs.storage.PruneProcessLogs(process.ID, logCutoff, keep, true)
+			if err != nil {
+				return nil, err
+			}
+			if dropped > 0 {
+				report.PrunedLogs += dropped
+				pruned = append(pruned, process.ID)
+			}
+		}
+	}
+
+	if dryRun || report.Empty() {
+		return report, nil
+	}
+
+	if report.Safety, err = rs.admin.AutoSnapshot("gc"); err != nil {
+		return nil, err
+	}
+
+	for _, id := range report.ArchivedTasks {
+		if _, err := rs.storage.UpdateTask(id, map[string]interface{}{"archivedAt": now}); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range report.ArchivedSessions {
+		if _, err := rs.storage.UpdatePlanningSession(id, map[string]interface{}{"archivedAt": now}); err != nil {
+			return nil, err
+		}
+	}
+	// Processes keep logging while a collection runs, so count what was
+	// actually deleted rather than what was planned
+	report.PrunedLogs = 0
+	for _, id := range pruned {
+		removed, err := rs.storage.PruneProcessLogs(id, logCutoff, keep, false)
+		if err != nil {
+			return nil, err
+		}
+		report.PrunedLogs += removed
+	}
+
+	return report, nil
+}
+
+// taskClosedAt returns when a completed or canceled task was closed
+func taskClosedAt(task *domain.Task) (time.Time, bool) {
+	switch task.Card.Status {
+	case domain.StatusCompleted, domain.StatusCanceled:
+		if task.Card.CompletedAt != nil {
+			return *task.Card.CompletedAt, true
+		}
+		return task.Card.UpdatedAt, true
+	}
+	return time.Time{}, false
+}
+
+// sessionEndedAt returns when a completed or aborted session ended. Sessions
+// recorded before EndedAt existed fall back to when they were started.
+func sessionEndedAt(session *domain.PlanningSession) (time.Time, bool) {
+	if session.Status == domain.PlanningStatusActive {
+		return time.Time{}, false
+	}
+	if session.EndedAt != nil {
+		return *session.EndedAt, true
+	}
+	return session.CreatedAt, true
+}
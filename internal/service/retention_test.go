@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func TestRetentionService_Collect(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	retention := NewRetentionService(store, NewAdminService(store, storage.NewSnapshotter(dir)))
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	project := domain.NewProject("Retention", "", "")
+	require.NoError(t, store.CreateProject(project))
+
+	closedAt := func(days int) *time.Time {
+		at := now.AddDate(0, 0, -days)
+		return &at
+	}
+	oldDone := domain.NewTask(project.ID, "Shipped long ago", "Release notes")
+	oldDone.Card.Status = domain.StatusCompleted
+	oldDone.Card.CompletedAt = closedAt(120)
+	recentDone := domain.NewTask(project.ID, "Shipped last week", "")
+	recentDone.Card.Status = domain.StatusCompleted
+	recentDone.Card.CompletedAt = closedAt(7)
+	oldOpen := domain.NewTask(project.ID, "Still open", "")
+	oldOpen.Card.CreatedAt = now.AddDate(-1, 0, 0)
+	for _, task := range []*domain.Task{oldDone, recentDone, oldOpen} {
+		require.NoError(t, store.CreateTask(task))
+	}
+
+	ended := domain.NewPlanningSession(project.ID, "Q1 planning")
+	ended.Status = domain.PlanningStatusCompleted
+	ended.EndedAt = closedAt(60)
+	active := domain.NewPlanningSession(project.ID, "Ongoing")
+	active.CreatedAt = now.AddDate(-1, 0, 0)
+	require.NoError(t, store.CreatePlanningSession(ended))
+	require.NoError(t, store.CreatePlanningSession(active))
+
+	process := domain.NewProcess(project.ID, "server", "npm", []string{"start"})
+	require.NoError(t, store.SaveProcess(project.ID, process))
+	var logs []*domain.ProcessLog
+	for i := 0; i < 5; i++ {
+		log := domain.NewProcessLog(process.ID, domain.LogTypeStdout, fmt.Sprintf("line %d", i))
+		log.Timestamp = now.AddDate(0, 0, -10+i)
+		logs = append(logs, log)
+	}
+	require.NoError(t, store.SaveProcessLogs(logs))
+
+	policy := domain.RetentionPolicy{MaxProcessLogEntries: 1}
+
+	// A dry run reports without changing anything
+	report, err := retention.Collect(policy, now, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldDone.ID}, report.ArchivedTasks)
+	assert.Equal(t, []string{ended.ID}, report.ArchivedSessions)
+	assert.Equal(t, 4, report.PrunedLogs)
+	assert.Equal(t, domain.DefaultArchiveTasksAfterDays, report.Policy.ArchiveTasksAfterDays)
+	assert.Nil(t, report.Safety)
+	stored, err := store.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	assert.Len(t, stored, 5)
+
+	report, err = retention.Collect(policy, now, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldDone.ID}, report.ArchivedTasks)
+	assert.Equal(t, 4, report.PrunedLogs)
+	require.NotNil(t, report.Safety)
+	assert.Equal(t, "gc", report.Safety.Reason)
+
+	// The archive is left out of listings and next-task context but stays
+	// searchable
+	listed, err := store.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Len(t, listed, 2)
+	archived, err := store.ListTasks(domain.TaskFilter{ProjectID: &project.ID, Archived: domain.ArchiveOnly})
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	assert.True(t, archived[0].Card.ArchivedAt.Equal(now))
+
+	retriever := NewContextRetriever(store, store)
+	cached, err := retriever.getCachedTasks(project.ID)
+	require.NoError(t, err)
+	assert.Len(t, cached, 2)
+	results, err := retriever.Search("release notes", domain.SearchOptions{ProjectID: &project.ID})
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, oldDone.ID, results[0].Task.ID)
+
+	planning := NewPlanningService(store, NewTaskService(store), NewProjectService(store))
+	sessions, err := planning.ListPlanningSessions(project.ID, domain.ArchiveExclude)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, active.ID, sessions[0].ID)
+
+	stored, err = store.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "line 4", stored[0].Message)
+
+	// Nothing is left to collect, so no snapshot is taken
+	report, err = retention.Collect(policy, now, false)
+	require.NoError(t, err)
+	assert.True(t, report.Empty())
+	assert.Nil(t, report.Safety)
+
+	// Negative values turn a rule off
+	again := domain.NewProcessLog(process.ID, domain.LogTypeStderr, "again")
+	again.Timestamp = now
+	require.NoError(t, store.SaveProcessLogs([]*domain.ProcessLog{again}))
+	report, err = retention.Collect(domain.RetentionPolicy{ArchiveTasksAfterDays: -1, MaxProcessLogEntries: -1}, now.AddDate(1, 0, 0), true)
+	require.NoError(t, err)
+	assert.Empty(t, report.ArchivedTasks)
+	assert.Equal(t, 2, report.PrunedLogs, "both logs are older than a week")
+}
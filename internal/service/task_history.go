@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// TaskHistoryStorage is implemented by storage backends that keep an
+// append-only history of task revisions
+type TaskHistoryStorage interface {
+	ListTaskRevisions(projectID string) ([]*domain.TaskRevision, error)
+}
+
+// ListAsOf returns the tasks matching filter as they were at asOf
+func (s *TaskService) ListAsOf(filter domain.TaskFilter, asOf time.Time) ([]*domain.Task, error) {
+	projectID := ""
+	if filter.ProjectID != nil {
+		projectID = *filter.ProjectID
+	}
+
+	state, err := s.stateAsOf(projectID, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*domain.Task, 0, len(state))
+	for _, task := range state {
+		tasks = append(tasks, task)
+	}
+	// Ordered and paginated like a live listing
+	return domain.ApplyTaskQuery(tasks, filter), nil
+}
+
+// GetAsOf returns a task as it was at asOf
+func (s *TaskService) GetAsOf(id string, asOf time.Time) (*domain.Task, error) {
+	state, err := s.stateAsOf("", asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	task, ok := state[id]
+	if !ok {
+		return nil, fmt.Errorf("task with ID %s did not exist at %s", id, asOf.Format(time.RFC3339))
+	}
+	return task, nil
+}
+
+// stateAsOf replays the task history up to asOf. Tasks created before history
+// was recorded have no revisions; they are shown in their current state from
+// the moment they were created.
+func (s *TaskService) stateAsOf(projectID string, asOf time.Time) (map[string]*domain.Task, error) {
+	history, ok := s.storage.(TaskHistoryStorage)
+	if !ok {
+		return nil, fmt.Errorf("storage backend does not keep task history")
+	}
+
+	revisions, err := history.ListTaskRevisions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	state := domain.ReplayTaskRevisions(revisions, asOf)
+
+	tracked := make(map[string]bool, len(revisions))
+	for _, revision := range revisions {
+		tracked[revision.TaskID] = true
+	}
+
+	filter := domain.TaskFilter{Archived: domain.ArchiveInclude}
+	if projectID != "" {
+		filter.ProjectID = &projectID
+	}
+	current, err := s.storage.ListTasks(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range current {
+		if !tracked[task.ID] && !task.Card.CreatedAt.After(asOf) {
+			state[task.ID] = task
+		}
+	}
+
+	return state, nil
+}
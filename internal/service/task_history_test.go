@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+func TestTaskService_AsOf(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	taskService := NewTaskService(memStorage)
+	projectID := "project-1"
+
+	beforeCreate := time.Now()
+	task := domain.NewTask(projectID, "Original Title", "Tracked over time")
+	require.NoError(t, taskService.Create(task))
+	afterCreate := time.Now()
+
+	_, err := taskService.Update(task.ID, map[string]interface{}{"title": "Renamed", "status": domain.StatusInProgress})
+	require.NoError(t, err)
+	afterUpdate := time.Now()
+
+	require.NoError(t, taskService.Delete(task.ID))
+
+	// Before it was created the task did not exist
+	_, err = taskService.GetAsOf(task.ID, beforeCreate)
+	assert.Error(t, err)
+
+	past, err := taskService.GetAsOf(task.ID, afterCreate)
+	require.NoError(t, err)
+	assert.Equal(t, "Original Title", past.Card.Title)
+	assert.Equal(t, domain.StatusPlanned, past.Card.Status)
+
+	past, err = taskService.GetAsOf(task.ID, afterUpdate)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", past.Card.Title)
+
+	inProgress := domain.StatusInProgress
+	tasks, err := taskService.ListAsOf(domain.TaskFilter{ProjectID: &projectID, Status: &inProgress}, afterUpdate)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	tasks, err = taskService.ListAsOf(domain.TaskFilter{ProjectID: &projectID}, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+}
+
+func TestTaskService_ListAsOfOrdersAndPaginates(t *testing.T) {
+	taskService := NewTaskService(storage.NewMemoryStorage())
+	projectID := "project-1"
+	for _, title := range []string{"Bravo", "Alpha", "Charlie"} {
+		require.NoError(t, taskService.Create(domain.NewTask(projectID, title, "")))
+	}
+	asOf := time.Now()
+
+	tasks, err := taskService.ListAsOf(domain.TaskFilter{ProjectID: &projectID, SortBy: domain.SortByTitle, SortDesc: true, Offset: 1, Limit: 1}, asOf)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Bravo", tasks[0].Card.Title)
+}
@@ -1,11 +1,17 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
 )
 
 type TaskService struct {
 	storage TaskStorage
+	// onChange is called with the project of every task written
+	onChange func(projectID string)
 }
 
 type TaskStorage interface {
@@ -14,6 +20,21 @@ type TaskStorage interface {
 	GetTask(id string) (*domain.Task, error)
 	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
 	DeleteTask(id string) error
+	GetProject(id string) (*domain.Project, error)
+}
+
+// wipStorage is what an update that enforces WIP limits needs
+type wipStorage interface {
+	GetProject(id string) (*domain.Project, error)
+	GetTask(id string) (*domain.Task, error)
+	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
+	UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error)
+}
+
+// transactionalStorage is implemented by stores that can run several reads
+// and writes as one unit
+type transactionalStorage interface {
+	Transaction(fn func(tx storage.Store) error) error
 }
 
 func NewTaskService(storage TaskStorage) *TaskService {
@@ -22,12 +43,50 @@ func NewTaskService(storage TaskStorage) *TaskService {
 	}
 }
 
+// OnChange registers fn to be called, before the write returns, with the
+// project of every task created, updated or deleted through the service.
+// Caches of task data use it to stay current with this process's writes.
+func (s *TaskService) OnChange(fn func(projectID string)) {
+	s.onChange = fn
+}
+
+func (s *TaskService) changed(projectID string) {
+	if s.onChange != nil {
+		s.onChange(projectID)
+	}
+}
+
 func (s *TaskService) Create(task *domain.Task) error {
-	return s.storage.CreateTask(task)
+	if err := s.storage.CreateTask(task); err != nil {
+		return err
+	}
+	s.changed(task.ProjectID)
+	return nil
 }
 
+// Update applies updates to the task. An update that moves the task into a
+// column whose WIP limit is reached fails under the reject policy; under the
+// warn policy it goes through, and UpdateChecked reports the violation.
 func (s *TaskService) Update(id string, updates map[string]interface{}) (*domain.Task, error) {
-	return s.storage.UpdateTask(id, updates)
+	task, _, err := s.UpdateChecked(id, updates)
+	return task, err
+}
+
+// UpdateChecked is Update that also returns the WIP limit the update
+// exceeded under the warn policy, or nil
+func (s *TaskService) UpdateChecked(id string, updates map[string]interface{}) (*domain.Task, *domain.WIPViolation, error) {
+	task, violation, err := updateWithinLimits(s.storage, id, updates)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.changed(task.ProjectID)
+	return task, violation, nil
+}
+
+// CheckTransition reports whether moving the task into newStatus would exceed
+// the column's WIP limit. It returns nil when the move is within limits.
+func (s *TaskService) CheckTransition(taskID string, newStatus domain.TaskStatus) (*domain.WIPViolation, error) {
+	return checkTransition(s.storage, taskID, newStatus)
 }
 
 func (s *TaskService) Get(id string) (*domain.Task, error) {
@@ -39,5 +98,136 @@ func (s *TaskService) List(filter domain.TaskFilter) ([]*domain.Task, error) {
 }
 
 func (s *TaskService) Delete(id string) error {
-	return s.storage.DeleteTask(id)
-}
\ No newline at end of file
+	task, err := s.storage.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.DeleteTask(id); err != nil {
+		return err
+	}
+	s.changed(task.ProjectID)
+	return nil
+}
+
+// updateWithinLimits applies updates to the task, enforcing the WIP limit
+// of the column a status change moves it into. When the column has a limit
+// the count and the write run in one storage transaction, so two writers
+// cannot both take its last place.
+func updateWithinLimits(store wipStorage, id string, updates map[string]interface{}) (*domain.Task, *domain.WIPViolation, error) {
+	status, ok := domain.PatchedStatus(updates)
+	if ok {
+		limited, err := hasWIPLimit(store, id, status)
+		if err != nil {
+			return nil, nil, err
+		}
+		ok = limited
+	}
+	if !ok {
+		task, err := store.UpdateTask(id, updates)
+		return task, nil, err
+	}
+
+	var task *domain.Task
+	var violation *domain.WIPViolation
+	apply := func(store wipStorage) error {
+		var err error
+		violation, err = checkTransition(store, id, status)
+		if err != nil {
+			return err
+		}
+		if violation != nil && violation.Policy == domain.WIPPolicyReject {
+			return fmt.Errorf("task update rejected: %w", violation)
+		}
+		task, err = store.UpdateTask(id, updates)
+		return err
+	}
+
+	if err := withTransaction(store, apply); err != nil {
+		return nil, nil, err
+	}
+	return task, violation, nil
+}
+
+// withTransaction runs fn on a transaction of store when store supports
+// them, so fn's writes take effect together or not at all, and on store
+// itself otherwise
+func withTransaction[S any](store S, fn func(store S) error) error {
+	transactional, ok := any(store).(transactionalStorage)
+	if !ok {
+		return fn(store)
+	}
+	return transactional.Transaction(func(tx storage.Store) error {
+		txStore, ok := any(tx).(S)
+		if !ok {
+			return fmt.Errorf("transaction does not provide the storage operations needed")
+		}
+		return fn(txStore)
+	})
+}
+
+// hasWIPLimit reports whether moving the task into status is subject to a
+// WIP limit, so updates that are not skip the transaction
+func hasWIPLimit(store wipStorage, taskID string, status domain.TaskStatus) (bool, error) {
+	task, err := store.GetTask(taskID)
+	if err != nil {
+		return false, err
+	}
+	if task.Card.Status == status {
+		return false, nil
+	}
+	project, err := store.GetProject(task.ProjectID)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Tasks outside any project have no limits to enforce
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return project.WIPLimit(status) > 0, nil
+}
+
+func checkTransition(store wipStorage, taskID string, newStatus domain.TaskStatus) (*domain.WIPViolation, error) {
+	task, err := store.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Staying in the same column never changes its occupancy
+	if task.Card.Status == newStatus {
+		return nil, nil
+	}
+
+	project, err := store.GetProject(task.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := project.WIPLimit(newStatus)
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	tasks, err := store.ListTasks(domain.TaskFilter{ProjectID: &task.ProjectID, Status: &newStatus})
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, t := range tasks {
+		if t.ID != taskID {
+			count++
+		}
+	}
+
+	if count < limit {
+		return nil, nil
+	}
+
+	return &domain.WIPViolation{
+		TaskID: taskID,
+		Status: newStatus,
+		Limit:  limit,
+		Count:  count,
+		Policy: project.EffectiveWIPPolicy(),
+	}, nil
+}
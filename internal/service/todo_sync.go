@@ -0,0 +1,405 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/todomd"
+)
+
+// Conflict resolutions for TodoSyncOptions.Prefer
+const (
+	PreferFile    = "file"
+	PreferCompass = "compass"
+)
+
+// TodoSyncService keeps a TODO.md checklist and a project in step. The
+// caller reads and writes the file and keeps the sync state between runs;
+// the state records what both sides agreed on last time, so each sync can
+// tell an edit in the file from an edit in Compass.
+type TodoSyncService struct {
+	storage TodoSyncStorage
+}
+
+type TodoSyncStorage interface {
+	GetProject(id string) (*domain.Project, error)
+	GetTask(id string) (*domain.Task, error)
+	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
+	CreateTask(task *domain.Task) error
+	UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error)
+}
+
+func NewTodoSyncService(storage TodoSyncStorage) *TodoSyncService {
+	return &TodoSyncService{storage: storage}
+}
+
+type TodoSyncOptions struct {
+	// Prefer settles conflicts in favor of PreferFile or PreferCompass.
+	// When empty, conflicting tasks are reported and left alone.
+	Prefer string
+	DryRun bool
+}
+
+// TodoSyncResult is the report together with the file content and sync
+// state to write back
+type TodoSyncResult struct {
+	Report  *domain.TodoSync
+	Content string
+	State   *todomd.State
+}
+
+// Sync merges the TODO.md content with the project's tasks:
+//
+//   - new lines create tasks, and lines without a task are added for open
+//     tasks the file does not list
+//   - a field changed on one side since the last sync is copied to the other
+//   - a field changed on both sides is a conflict unless opts.Prefer says
+//     which side wins
+//   - deleting a line cancels an open task; deleting a task in Compass
+//     removes its line
+//
+// Nesting is read from the file only: moving a task to another parent in
+// Compass does not move its line. Status changes respect the project's WIP
+// limits. The writes are applied together: if one fails, none are kept.
+// state may be nil for a first sync.
+func (ts *TodoSyncService) Sync(projectID, content string, state *todomd.State, opts TodoSyncOptions) (*TodoSyncResult, error) {
+	switch opts.Prefer {
+	case "", PreferFile, PreferCompass:
+	default:
+		return nil, fmt.Errorf("invalid prefer value %q: must be %s or %s", opts.Prefer, PreferFile, PreferCompass)
+	}
+	if _, err := ts.storage.GetProject(projectID); err != nil {
+		return nil, err
+	}
+	tasks, err := ts.storage.ListTasks(domain.TaskFilter{ProjectID: &projectID, Archived: domain.ArchiveInclude})
+	if err != nil {
+		return nil, err
+	}
+	originals := make(map[string]*domain.Task, len(tasks))
+	working := make(map[string]*domain.Task, len(tasks))
+	for _, task := range tasks {
+		originals[task.ID] = task
+		working[task.ID] = task.Clone()
+	}
+
+	base := map[string]todomd.Fields{}
+	if state != nil && state.ProjectID == projectID && state.Items != nil {
+		base = state.Items
+	}
+	next := make(map[string]todomd.Fields)
+	report := &domain.TodoSync{ProjectID: projectID, DryRun: opts.DryRun}
+	conflict := func(taskID, title, reason string, fields []string) {
+		report.Conflicts = append(report.Conflicts, &domain.SyncConflict{TaskID: taskID, Title: title, Fields: fields, Reason: reason})
+		// Keep the old common ancestor so the conflict shows up again
+		if fields, ok := base[taskID]; ok {
+			next[taskID] = fields
+		}
+	}
+
+	doc := todomd.Parse(content)
+	seen := make(map[string]bool)
+	var fresh, linked, stale []*todomd.Item
+	for _, item := range doc.Items {
+		_, known := working[item.TaskID]
+		_, synced := base[item.TaskID]
+		switch {
+		case item.Title == "":
+			// Nothing to sync, but the task is still listed
+			if known {
+				seen[item.TaskID] = true
+				if fields, ok := base[item.TaskID]; ok {
+					next[item.TaskID] = fields
+				}
+			}
+		case item.TaskID == "" || seen[item.TaskID]:
+			fresh = append(fresh, item)
+		case known:
+			seen[item.TaskID] = true
+			linked = append(linked, item)
+		case synced:
+			stale = append(stale, item)
+		default:
+			fresh = append(fresh, item)
+		}
+	}
+
+	// Lines of tasks deleted in Compass
+	for _, item := range stale {
+		edited := len(withoutParent(item.Fields).Diff(withoutParent(base[item.TaskID]))) > 0
+		switch {
+		case !edited || opts.Prefer == PreferCompass:
+			doc.Remove(item)
+			report.Removed++
+		case opts.Prefer == PreferFile:
+			fresh = append(fresh, item)
+		default:
+			conflict(item.TaskID, item.Title, "deleted in Compass but edited in the file", nil)
+		}
+	}
+
+	// New lines get tasks first, so nesting can refer to them
+	sort.SliceStable(fresh, func(i, j int) bool { return fresh[i].Line < fresh[j].Line })
+	created := make([]*domain.Task, 0, len(fresh))
+	for _, item := range fresh {
+		task := domain.NewTask(projectID, item.Title, "")
+		item.TaskID = task.ID
+		working[task.ID] = task
+		created = append(created, task)
+	}
+	for _, item := range doc.Items {
+		item.Parent = ""
+		if item.Enclosing != nil {
+			if _, ok := working[item.Enclosing.TaskID]; ok {
+				item.Parent = item.Enclosing.TaskID
+			}
+		}
+	}
+	for _, item := range fresh {
+		applyFields(working, working[item.TaskID], item.Fields, true)
+		doc.Set(item, item.Fields)
+		next[item.TaskID] = item.Fields
+		report.Created++
+	}
+
+	for _, item := range linked {
+		task := working[item.TaskID]
+		current := todomd.FieldsOf(task)
+		var ancestor *todomd.Fields
+		if fields, ok := base[item.TaskID]; ok {
+			ancestor = &fields
+		}
+
+		merged, clashes := mergeFields(ancestor, item.Fields, current, opts.Prefer)
+		if len(clashes) > 0 {
+			conflict(task.ID, item.Title, "changed in both the file and Compass", clashes)
+			continue
+		}
+		moved := item.Parent != current.Parent &&
+			((ancestor == nil && item.Parent != "") || (ancestor != nil && item.Parent != ancestor.Parent))
+		applyFields(working, task, merged, moved)
+		if len(importPatch(originals[task.ID], task)) > 0 {
+			report.Updated++
+		}
+		if len(merged.Diff(item.Fields)) > 0 {
+			doc.Set(item, merged)
+			report.Rewritten++
+		}
+		next[task.ID] = merged
+	}
+
+	// Tasks the file does not list
+	var missing []*domain.Task
+	for _, original := range tasks {
+		if seen[original.ID] {
+			continue
+		}
+		task := working[original.ID]
+		fields, synced := base[task.ID]
+		if !synced {
+			if isOpenStatus(task.Card.Status) {
+				missing = append(missing, task)
+			}
+			continue
+		}
+		edited := len(withoutParent(todomd.FieldsOf(task)).Diff(withoutParent(fields))) > 0
+		switch {
+		case !edited || opts.Prefer == PreferFile:
+			// Finished tasks just drop out of the file
+			if isOpenStatus(task.Card.Status) {
+				applyFields(working, task, withStatus(todomd.FieldsOf(task), domain.StatusCanceled), false)
+				report.Canceled++
+			}
+		case opts.Prefer == PreferCompass:
+			missing = append(missing, task)
+		default:
+			conflict(task.ID, task.Card.Title, "deleted from the file but edited in Compass", nil)
+		}
+	}
+	ts.addLines(doc, missing, next)
+	report.Added = len(missing)
+
+	if !opts.DryRun {
+		// The new task IDs only reach TODO.md and the sync state if the
+		// sync succeeds, so a failed sync must not leave the tasks behind
+		err := withTransaction(ts.storage, func(store TodoSyncStorage) error {
+			for _, task := range created {
+				if err := store.CreateTask(task); err != nil {
+					return fmt.Errorf("failed to create task %q: %w", task.Card.Title, err)
+				}
+			}
+			for _, task := range tasks {
+				patch := importPatch(originals[task.ID], working[task.ID])
+				if len(patch) == 0 {
+					continue
+				}
+				patch["version"] = task.Version
+				patch["updatedAt"] = time.Now()
+				if _, _, err := updateWithinLimits(store, task.ID, patch); err != nil {
+					return fmt.Errorf("failed to update task %s: %w", task.ID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &TodoSyncResult{
+		Report:  report,
+		Content: doc.Render(),
+		State:   &todomd.State{ProjectID: projectID, SyncedAt: time.Now(), Items: next},
+	}, nil
+}
+
+// addLines writes lines for tasks, nesting each under its parent's line when
+// the file has one
+func (ts *TodoSyncService) addLines(doc *todomd.Document, tasks []*domain.Task, next map[string]todomd.Fields) {
+	items := make(map[string]*todomd.Item, len(doc.Items))
+	for _, item := range doc.Items {
+		items[item.TaskID] = item
+	}
+	pending := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		pending[task.ID] = true
+	}
+
+	// Parents go in first, unless a cycle holds up every task
+	force := false
+	for len(pending) > 0 {
+		progress := false
+		for _, task := range tasks {
+			if !pending[task.ID] {
+				continue
+			}
+			if !force && task.Card.Parent != nil && pending[*task.Card.Parent] {
+				continue
+			}
+			fields := todomd.FieldsOf(task)
+			parent := items[fields.Parent]
+			if parent == nil {
+				fields.Parent = ""
+			}
+			items[task.ID] = doc.Add(parent, task.ID, fields)
+			next[task.ID] = fields
+			delete(pending, task.ID)
+			progress = true
+		}
+		force = !progress
+	}
+}
+
+// mergeFields does a three-way merge of one task's fields. Without an
+// ancestor every difference is a conflict. The parent always comes from the
+// file.
+func mergeFields(ancestor *todomd.Fields, file, current todomd.Fields, prefer string) (todomd.Fields, []string) {
+	merged := current
+	merged.Parent = file.Parent
+
+	var fileChanged, compassChanged []string
+	if ancestor != nil {
+		fileChanged = file.Diff(*ancestor)
+		compassChanged = current.Diff(*ancestor)
+	}
+	var clashes []string
+	for _, name := range withoutParent(file).Diff(withoutParent(current)) {
+		switch {
+		case ancestor != nil && !containsString(compassChanged, name):
+			copyField(&merged, file, name)
+		case ancestor != nil && !containsString(fileChanged, name):
+			// Only Compass changed it
+		case prefer == PreferFile:
+			copyField(&merged, file, name)
+		case prefer == PreferCompass:
+		default:
+			clashes = append(clashes, name)
+		}
+	}
+	return merged, clashes
+}
+
+func copyField(dst *todomd.Fields, src todomd.Fields, name string) {
+	switch name {
+	case "title":
+		dst.Title = src.Title
+	case "status":
+		dst.Status = src.Status
+	case "priority":
+		dst.Priority = src.Priority
+	case "labels":
+		dst.Labels = src.Labels
+	case "due":
+		dst.Due = src.Due
+	case "assignee":
+		dst.Assignee = src.Assignee
+	}
+}
+
+// applyFields sets a task's fields from a TODO.md line. The parent is only
+// changed when reparent is set.
+func applyFields(tasks map[string]*domain.Task, task *domain.Task, fields todomd.Fields, reparent bool) {
+	task.Card.Title = fields.Title
+	if task.Card.Status != fields.Status {
+		task.Card.Status = fields.Status
+		task.Card.CompletedAt = nil
+		if fields.Status == domain.StatusCompleted {
+			now := time.Now()
+			task.Card.CompletedAt = &now
+		}
+	}
+	task.Card.Priority = fields.Priority
+	task.Card.Labels = append(make([]string, 0, len(fields.Labels)), fields.Labels...)
+
+	task.Card.AssignedTo = nil
+	if fields.Assignee != "" {
+		assignee := fields.Assignee
+		task.Card.AssignedTo = &assignee
+	}
+
+	// Keep the time of day of a due date whose day did not change
+	if task.Card.DueDate == nil || task.Card.DueDate.Format("2006-01-02") != fields.Due {
+		task.Card.DueDate = nil
+		if due, err := time.ParseInLocation("2006-01-02", fields.Due, time.Local); err == nil {
+			task.Card.DueDate = &due
+		}
+	}
+
+	if !reparent {
+		return
+	}
+	if parent, ok := tasks[fields.Parent]; ok {
+		linkParent(tasks, task, parent)
+		return
+	}
+	if task.Card.Parent != nil {
+		if previous, ok := tasks[*task.Card.Parent]; ok {
+			previous.Card.Children = removeString(previous.Card.Children, task.ID)
+		}
+		task.Card.Parent = nil
+	}
+}
+
+func withoutParent(fields todomd.Fields) todomd.Fields {
+	fields.Parent = ""
+	return fields
+}
+
+func withStatus(fields todomd.Fields, status domain.TaskStatus) todomd.Fields {
+	fields.Status = status
+	return fields
+}
+
+func isOpenStatus(status domain.TaskStatus) bool {
+	return status != domain.StatusCompleted && status != domain.StatusCanceled
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
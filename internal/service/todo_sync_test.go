@@ -0,0 +1,169 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+	"github.com/rcliao/compass/internal/todomd"
+)
+
+// todoItem finds the TODO.md line with the given title
+func todoItem(t *testing.T, content, title string) *todomd.Item {
+	t.Helper()
+	for _, item := range todomd.Parse(content).Items {
+		if item.Title == title {
+			return item
+		}
+	}
+	require.Failf(t, "missing TODO.md line", "no line titled %q in:\n%s", title, content)
+	return nil
+}
+
+func TestTodoSyncService_Sync(t *testing.T) {
+	store, err := storage.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+	project := domain.NewProject("Site", "", "")
+	require.NoError(t, store.CreateProject(project))
+	existing := domain.NewTask(project.ID, "Pick a theme", "")
+	require.NoError(t, store.CreateTask(existing))
+	finished := domain.NewTask(project.ID, "Buy the domain", "")
+	finished.Card.Status = domain.StatusCompleted
+	require.NoError(t, store.CreateTask(finished))
+	syncService := NewTodoSyncService(store)
+
+	// First sync: new lines become tasks and open tasks get lines
+	content := "# TODO\n\nPlanning notes.\n\n- [ ] Write docs !high #docs\n  - [ ] Outline due:2025-03-01\n"
+	result, err := syncService.Sync(project.ID, content, nil, TodoSyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Report.Created)
+	assert.Equal(t, 1, result.Report.Added)
+	assert.Empty(t, result.Report.Conflicts)
+	assert.Contains(t, result.Content, "Planning notes.")
+	assert.NotContains(t, result.Content, "Buy the domain")
+
+	docs := todoItem(t, result.Content, "Write docs")
+	outline := todoItem(t, result.Content, "Outline")
+	assert.Equal(t, existing.ID, todoItem(t, result.Content, "Pick a theme").TaskID)
+	docsTask, err := store.GetTask(docs.TaskID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.PriorityHigh, docsTask.Card.Priority)
+	assert.Equal(t, []string{"docs"}, docsTask.Card.Labels)
+	assert.Equal(t, []string{outline.TaskID}, docsTask.Card.Children)
+	outlineTask, err := store.GetTask(outline.TaskID)
+	require.NoError(t, err)
+	assert.Equal(t, docs.TaskID, *outlineTask.Card.Parent)
+	assert.Equal(t, "2025-03-01", outlineTask.Card.DueDate.Format("2006-01-02"))
+
+	// Syncing again changes nothing
+	again, err := syncService.Sync(project.ID, result.Content, result.State, TodoSyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, domain.TodoSync{ProjectID: project.ID}, *again.Report)
+	assert.Equal(t, result.Content, again.Content)
+
+	// Edits on different sides, or different fields, merge
+	content = strings.Replace(result.Content, "- [ ] Outline", "- [x] Outline", 1)
+	_, err = store.UpdateTask(existing.ID, map[string]interface{}{"priority": domain.PriorityLow})
+	require.NoError(t, err)
+	_, err = store.UpdateTask(docs.TaskID, map[string]interface{}{"assignedTo": "alice"})
+	require.NoError(t, err)
+	content = strings.Replace(content, "Write docs !high", "Write the docs !high", 1)
+	result, err = syncService.Sync(project.ID, content, result.State, TodoSyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Report.Updated)
+	assert.Equal(t, 2, result.Report.Rewritten)
+	assert.Contains(t, result.Content, "- [ ] Pick a theme !low <!-- compass:"+existing.ID+" -->")
+	assert.Contains(t, result.Content, "- [ ] Write the docs !high #docs @alice <!-- compass:"+docs.TaskID+" -->")
+	outlineTask, err = store.GetTask(outline.TaskID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusCompleted, outlineTask.Card.Status)
+	assert.NotNil(t, outlineTask.Card.CompletedAt)
+
+	// The same field changed on both sides is a conflict until resolved
+	_, err = store.UpdateTask(existing.ID, map[string]interface{}{"title": "Pick a dark theme"})
+	require.NoError(t, err)
+	conflicted := strings.Replace(result.Content, "Pick a theme", "Pick a light theme", 1)
+	preview, err := syncService.Sync(project.ID, conflicted, result.State, TodoSyncOptions{})
+	require.NoError(t, err)
+	require.Len(t, preview.Report.Conflicts, 1)
+	assert.Equal(t, existing.ID, preview.Report.Conflicts[0].TaskID)
+	assert.Equal(t, []string{"title"}, preview.Report.Conflicts[0].Fields)
+	assert.Equal(t, conflicted, preview.Content)
+	got, err := store.GetTask(existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Pick a dark theme", got.Card.Title)
+
+	result, err = syncService.Sync(project.ID, conflicted, preview.State, TodoSyncOptions{Prefer: PreferFile})
+	require.NoError(t, err)
+	assert.Empty(t, result.Report.Conflicts)
+	got, err = store.GetTask(existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Pick a light theme", got.Card.Title)
+
+	// Deleting a line cancels the task; deleting a task removes its line
+	var kept []string
+	for _, line := range strings.Split(result.Content, "\n") {
+		if !strings.Contains(line, existing.ID) {
+			kept = append(kept, line)
+		}
+	}
+	require.NoError(t, store.DeleteTask(outline.TaskID))
+	state := result.State
+	preview, err = syncService.Sync(project.ID, strings.Join(kept, "\n"), state, TodoSyncOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, preview.Report.Canceled)
+	assert.Equal(t, 1, preview.Report.Removed)
+	assert.NotContains(t, preview.Content, "Outline")
+	got, err = store.GetTask(existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusPlanned, got.Card.Status, "a dry run writes nothing")
+
+	result, err = syncService.Sync(project.ID, strings.Join(kept, "\n"), state, TodoSyncOptions{})
+	require.NoError(t, err)
+	got, err = store.GetTask(existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusCanceled, got.Card.Status)
+	assert.NotContains(t, result.Content, "Pick a light theme", "canceled tasks are not added back")
+
+	_, err = syncService.Sync(project.ID, "", nil, TodoSyncOptions{Prefer: "both"})
+	assert.Error(t, err)
+	_, err = syncService.Sync("missing", "", nil, TodoSyncOptions{})
+	assert.Error(t, err)
+}
+
+func TestTodoSyncService_SyncAppliesAllOrNothing(t *testing.T) {
+	store, err := storage.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+	project := domain.NewProject("Site", "", "")
+	project.WIPLimits = map[domain.TaskStatus]int{domain.StatusInProgress: 1}
+	project.WIPPolicy = domain.WIPPolicyReject
+	require.NoError(t, store.CreateProject(project))
+	active := domain.NewTask(project.ID, "Pick a theme", "")
+	active.Card.Status = domain.StatusInProgress
+	require.NoError(t, store.CreateTask(active))
+	waiting := domain.NewTask(project.ID, "Write docs", "")
+	require.NoError(t, store.CreateTask(waiting))
+	syncService := NewTodoSyncService(store)
+
+	result, err := syncService.Sync(project.ID, "", nil, TodoSyncOptions{})
+	require.NoError(t, err)
+
+	// The new line is created before the start of "Write docs" is rejected
+	content := strings.Replace(result.Content, "- [ ] Write docs", "- [>] Write docs", 1) + "- [ ] Deploy\n"
+	_, err = syncService.Sync(project.ID, content, result.State, TodoSyncOptions{})
+	var violation *domain.WIPViolation
+	require.ErrorAs(t, err, &violation)
+
+	tasks, err := store.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	for _, task := range tasks {
+		assert.NotEqual(t, "Deploy", task.Card.Title)
+	}
+}
@@ -0,0 +1,505 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// checkedWorkspace holds what an integrity check looks at. Entities are
+// grouped by the project that holds them: the project directory in the JSON
+// layout, the project_id column in SQLite. The entities are copies, so fixes
+// are applied to them directly and only reach storage when a backend writes
+// the dirty groups back.
+type checkedWorkspace struct {
+	projects       map[string]bool
+	tasks          map[string][]*domain.Task
+	discoveries    map[string][]*domain.Discovery
+	processes      map[string][]*domain.Process
+	currentProject string
+
+	issues []*domain.CheckIssue
+
+	// What the fixes touched, for the backend to persist
+	changedTasks     map[string]*domain.Task
+	dirtyTasks       map[string]bool
+	dirtyDiscoveries map[string]bool
+	dirtyProcesses   map[string]bool
+	clearCurrent     bool
+}
+
+func newCheckedWorkspace() *checkedWorkspace {
+	return &checkedWorkspace{
+		projects:         make(map[string]bool),
+		tasks:            make(map[string][]*domain.Task),
+		discoveries:      make(map[string][]*domain.Discovery),
+		processes:        make(map[string][]*domain.Process),
+		issues:           make([]*domain.CheckIssue, 0),
+		changedTasks:     make(map[string]*domain.Task),
+		dirtyTasks:       make(map[string]bool),
+		dirtyDiscoveries: make(map[string]bool),
+		dirtyProcesses:   make(map[string]bool),
+	}
+}
+
+// add records an issue. A non-nil fix makes it repairable and is applied to
+// the workspace copies straight away.
+func (w *checkedWorkspace) add(issue *domain.CheckIssue, fix func()) {
+	if fix != nil {
+		issue.Repairable = true
+		fix()
+	}
+	w.issues = append(w.issues, issue)
+}
+
+func (w *checkedWorkspace) repairable() bool {
+	for _, issue := range w.issues {
+		if issue.Repairable {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *checkedWorkspace) changeTask(holder string, task *domain.Task) {
+	w.changedTasks[task.ID] = task
+	w.dirtyTasks[holder] = true
+}
+
+func sortedKeys[T any](groups map[string]T) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// check looks for entities outside any project, duplicate task IDs and
+// references to tasks or projects that do not exist
+func (w *checkedWorkspace) check() {
+	taskHolder := make(map[string]string)
+	byID := make(map[string]*domain.Task)
+
+	for _, holder := range sortedKeys(w.tasks) {
+		for _, task := range w.tasks[holder] {
+			task, holder := task, holder
+			if other, seen := taskHolder[task.ID]; seen {
+				w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "duplicate-task", Entity: "task", ID: task.ID,
+					Message: fmt.Sprintf("task is stored in both project %s and project %s", other, holder)}, nil)
+				continue
+			}
+			taskHolder[task.ID] = holder
+			byID[task.ID] = task
+
+			switch {
+			case !w.projects[holder]:
+				w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "orphan-task", Entity: "task", ID: task.ID,
+					Message: fmt.Sprintf("task belongs to project %s, which does not exist", holder)}, nil)
+			case task.ProjectID != holder:
+				w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "task-project-mismatch", Entity: "task", ID: task.ID,
+					Message: fmt.Sprintf("task is stored in project %s but names project %q", holder, task.ProjectID)},
+					func() {
+						task.ProjectID = holder
+						w.changeTask(holder, task)
+					})
+			}
+		}
+	}
+
+	for _, holder := range sortedKeys(w.tasks) {
+		for _, task := range w.tasks[holder] {
+			if byID[task.ID] != task {
+				continue
+			}
+			w.checkTaskReferences(holder, task, byID, taskHolder)
+		}
+	}
+
+	for _, holder := range sortedKeys(w.discoveries) {
+		for _, discovery := range w.discoveries[holder] {
+			discovery, holder := discovery, holder
+			if !w.projects[holder] {
+				w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "orphan-discovery", Entity: "discovery", ID: discovery.ID,
+					Message: fmt.Sprintf("discovery belongs to project %s, which does not exist", holder)}, nil)
+			}
+			for _, id := range missingTasks(discovery.AffectedTasks, byID) {
+				id := id
+				w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "dangling-discovery-task", Entity: "discovery", ID: discovery.ID,
+					Message: fmt.Sprintf("discovery affects task %s, which does not exist", id)},
+					func() {
+						discovery.AffectedTasks = withoutID(discovery.AffectedTasks, id)
+						w.dirtyDiscoveries[holder] = true
+					})
+			}
+		}
+	}
+
+	for _, holder := range sortedKeys(w.processes) {
+		for _, process := range w.processes[holder] {
+			process, holder := process, holder
+			switch {
+			case !w.projects[holder]:
+				w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "orphan-process", Entity: "process", ID: process.ID,
+					Message: fmt.Sprintf("process %q belongs to project %s, which does not exist", process.Name, holder)}, nil)
+			case process.ProjectID != holder:
+				w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "process-project-mismatch", Entity: "process", ID: process.ID,
+					Message: fmt.Sprintf("process is stored in project %s but names project %q", holder, process.ProjectID)},
+					func() {
+						process.ProjectID = holder
+						w.dirtyProcesses[holder] = true
+					})
+			}
+			if process.TaskID != "" && byID[process.TaskID] == nil {
+				w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "dangling-process-task", Entity: "process", ID: process.ID,
+					Message: fmt.Sprintf("process is linked to task %s, which does not exist", process.TaskID)},
+					func() {
+						process.TaskID = ""
+						w.dirtyProcesses[holder] = true
+					})
+			}
+		}
+	}
+
+	if w.currentProject != "" && !w.projects[w.currentProject] {
+		w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "dangling-current-project", Entity: "project", ID: w.currentProject,
+			Message: "the current project does not exist"},
+			func() { w.clearCurrent = true })
+	}
+}
+
+func (w *checkedWorkspace) checkTaskReferences(holder string, task *domain.Task, byID map[string]*domain.Task, taskHolder map[string]string) {
+	if task.Card.Parent != nil {
+		parentID := *task.Card.Parent
+		parent := byID[parentID]
+		switch {
+		case parent == nil:
+			w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "dangling-parent", Entity: "task", ID: task.ID,
+				Message: fmt.Sprintf("parent task %s does not exist", parentID)},
+				func() {
+					task.Card.Parent = nil
+					w.changeTask(holder, task)
+				})
+		case !containsID(parent.Card.Children, task.ID):
+			w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "missing-child-link", Entity: "task", ID: parentID,
+				Message: fmt.Sprintf("task %s names this task as its parent but is not among its children", task.ID)},
+				func() {
+					parent.Card.Children = append(parent.Card.Children, task.ID)
+					w.changeTask(taskHolder[parentID], parent)
+				})
+		}
+	}
+
+	for _, childID := range task.Card.Children {
+		childID := childID
+		child := byID[childID]
+		switch {
+		case child == nil:
+			w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "dangling-child", Entity: "task", ID: task.ID,
+				Message: fmt.Sprintf("child task %s does not exist", childID)},
+				func() {
+					task.Card.Children = withoutID(task.Card.Children, childID)
+					w.changeTask(holder, task)
+				})
+		case child.Card.Parent == nil || *child.Card.Parent != task.ID:
+			// Either side could be the stale one, so this is left to a person
+			w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "mismatched-child", Entity: "task", ID: task.ID,
+				Message: fmt.Sprintf("child task %s has a different parent", childID)}, nil)
+		}
+	}
+
+	for _, id := range missingTasks(task.Context.Dependencies, byID) {
+		id := id
+		w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "dangling-dependency", Entity: "task", ID: task.ID,
+			Message: fmt.Sprintf("dependency %s does not exist", id)},
+			func() {
+				task.Context.Dependencies = withoutID(task.Context.Dependencies, id)
+				w.changeTask(holder, task)
+			})
+	}
+}
+
+func missingTasks(ids []string, byID map[string]*domain.Task) []string {
+	var missing []string
+	for _, id := range ids {
+		if byID[id] == nil && !containsID(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+func containsID(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutID(ids []string, id string) []string {
+	kept := make([]string, 0, len(ids))
+	for _, candidate := range ids {
+		if candidate != id {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+// repairedTasks bumps the version of every task a fix changed, so clients
+// holding an older copy get a conflict instead of undoing the repair
+func (w *checkedWorkspace) repairedTasks(now time.Time) []*domain.Task {
+	tasks := make([]*domain.Task, 0, len(w.changedTasks))
+	for _, id := range sortedKeys(w.changedTasks) {
+		task := w.changedTasks[id]
+		task.Version++
+		task.Card.UpdatedAt = now
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// report builds the check report, marking the repairable issues as repaired
+// when the fixes were written back
+func (w *checkedWorkspace) report(backend string, repaired bool) *domain.CheckReport {
+	report := &domain.CheckReport{Backend: backend, Issues: w.issues}
+	if repaired {
+		for _, issue := range w.issues {
+			if issue.Repairable {
+				issue.Repaired = true
+				report.Repaired++
+			}
+		}
+	}
+	return report
+}
+
+// Check verifies the JSON workspace: files left half-written by an
+// interrupted save, project directories without a readable project.json,
+// entities stored under the wrong project and references to tasks or
+// projects that no longer exist. With repair set, the repairable issues are
+// fixed after .compass is backed up.
+func (fs *FileStorage) Check(repair bool) (*domain.CheckReport, error) {
+	if fs.tx != nil {
+		return nil, ErrNotTransactional
+	}
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	w := newCheckedWorkspace()
+	compassDir := filepath.Join(fs.basePath, ".compass")
+	rel := func(path string) string {
+		if r, err := filepath.Rel(compassDir, path); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return path
+	}
+
+	temps, err := findTempFiles(compassDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range temps {
+		// The rename that would have replaced the real file never happened,
+		// so the write was never acknowledged and the real file is intact
+		w.add(&domain.CheckIssue{Severity: domain.SeverityWarning, Code: "temp-file", Path: rel(path),
+			Message: "left behind by an interrupted write"}, func() {})
+	}
+
+	config, err := ReadConfig(fs.basePath)
+	if err != nil {
+		return nil, err
+	}
+	if config.CurrentProjectID != nil {
+		w.currentProject = *config.CurrentProjectID
+	}
+
+	entries, err := os.ReadDir(filepath.Join(compassDir, "projects"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	unreadable := func(path string, err error) {
+		w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "unreadable-file", Path: rel(path),
+			Message: err.Error()}, nil)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		id := entry.Name()
+		dir := fs.projectDir(id)
+
+		projectPath := filepath.Join(dir, "project.json")
+		var project domain.Project
+		if err := fs.loadJSON(projectPath, &project); os.IsNotExist(err) {
+			w.add(&domain.CheckIssue{Severity: domain.SeverityError, Code: "missing-project", Entity: "project", ID: id, Path: rel(dir),
+				Message: "project directory has no project.json"}, nil)
+		} else {
+			w.projects[id] = true
+			if err != nil {
+				unreadable(projectPath, err)
+			}
+		}
+
+		if cached, err := fs.cachedTasks(id); err != nil {
+			unreadable(fs.tasksPath(id), err)
+		} else {
+			w.tasks[id] = cloneTasks(cached.list())
+		}
+		if discoveries, err := fs.loadDiscoveries(id); err != nil {
+			path := filepath.Join(dir, "discoveries.json")
+			if fs.perEntity() {
+				path = fs.entityDir(id, discoveriesDir)
+			}
+			unreadable(path, err)
+		} else {
+			w.discoveries[id] = discoveries
+		}
+		if processes, err := fs.loadProcesses(id); err != nil {
+			unreadable(filepath.Join(dir, "processes.json"), err)
+		} else {
+			w.processes[id] = processes
+		}
+	}
+
+	w.check()
+	if !repair || !w.repairable() {
+		return w.report(BackendJSON, false), nil
+	}
+
+	// The snapshot keeps the temp files too, in case one held something
+	snapshot, err := autoSnapshot(fs.basePath, "fsck")
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up before repairing: %w", err)
+	}
+
+	changed := w.repairedTasks(time.Now())
+	for _, id := range sortedKeys(w.dirtyTasks) {
+		if err := fs.saveTasks(id, w.tasks[id]); err != nil {
+			return nil, err
+		}
+	}
+	for _, task := range changed {
+		fs.recordTaskRevision(domain.RevisionUpdate, task)
+	}
+	for _, id := range sortedKeys(w.dirtyDiscoveries) {
+		if err := fs.saveDiscoveries(id, w.discoveries[id]); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range sortedKeys(w.dirtyProcesses) {
+		if err := fs.saveProcesses(id, w.processes[id]); err != nil {
+			return nil, err
+		}
+	}
+	if w.clearCurrent {
+		config.CurrentProjectID = nil
+		if err := WriteConfig(fs.basePath, config); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range temps {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	report := w.report(BackendJSON, true)
+	report.Backup = snapshot.Path
+	return report, nil
+}
+
+// findTempFiles returns the *.tmp files under .compass, outside the backups
+func findTempFiles(compassDir string) ([]string, error) {
+	var temps []string
+	err := filepath.WalkDir(compassDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() && path == filepath.Join(compassDir, "backups") {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tmp") {
+			temps = append(temps, path)
+		}
+		return nil
+	})
+	return temps, err
+}
+
+// Check verifies that every entity belongs to an existing project and only
+// refers to tasks that exist. With repair set, the repairable issues are
+// fixed in place.
+func (ms *MemoryStorage) Check(repair bool) (*domain.CheckReport, error) {
+	if ms.inTx {
+		return nil, ErrNotTransactional
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	w := newCheckedWorkspace()
+	for id := range ms.projects {
+		w.projects[id] = true
+	}
+	for _, task := range ms.tasks.byID {
+		w.tasks[task.ProjectID] = append(w.tasks[task.ProjectID], task.Clone())
+	}
+	for _, discovery := range ms.discoveries {
+		copied := *discovery
+		w.discoveries[discovery.ProjectID] = append(w.discoveries[discovery.ProjectID], &copied)
+	}
+	for _, process := range ms.processes {
+		copied := *process
+		w.processes[process.ProjectID] = append(w.processes[process.ProjectID], &copied)
+	}
+	// Map order is random; report issues in a stable order
+	for _, group := range w.tasks {
+		sort.Slice(group, func(i, j int) bool { return group[i].ID < group[j].ID })
+	}
+	for _, group := range w.discoveries {
+		sortDiscoveries(group)
+	}
+	for _, group := range w.processes {
+		sortProcesses(group)
+	}
+	if ms.currentProject != nil {
+		w.currentProject = *ms.currentProject
+	}
+
+	w.check()
+	if !repair || !w.repairable() {
+		return w.report("memory", false), nil
+	}
+
+	for _, task := range w.repairedTasks(time.Now()) {
+		ms.tasks.add(task)
+		ms.revisions = append(ms.revisions, domain.NewTaskRevision(domain.RevisionUpdate, task))
+	}
+	for _, id := range sortedKeys(w.dirtyDiscoveries) {
+		for _, discovery := range w.discoveries[id] {
+			ms.discoveries[discovery.ID] = discovery
+		}
+	}
+	for _, id := range sortedKeys(w.dirtyProcesses) {
+		for _, process := range w.processes[id] {
+			ms.processes[process.ID] = process
+		}
+	}
+	if w.clearCurrent {
+		ms.currentProject = nil
+	}
+	return w.report("memory", true), nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+func findIssue(report *domain.CheckReport, code string) *domain.CheckIssue {
+	for _, issue := range report.Issues {
+		if issue.Code == code {
+			return issue
+		}
+	}
+	return nil
+}
+
+func TestFileStorage_CheckFindsLayoutProblems(t *testing.T) {
+	fs, project := newJournalFixture(t)
+	other := domain.NewProject("Other", "", "")
+	require.NoError(t, fs.CreateProject(other))
+
+	// A task saved under the wrong project, a save interrupted before its
+	// rename, a directory whose project.json is gone and a corrupt file
+	misplaced := domain.NewTask(other.ID, "Misplaced", "")
+	require.NoError(t, fs.saveTasks(project.ID, []*domain.Task{misplaced}))
+	tempPath := fs.tasksPath(project.ID) + ".tmp"
+	require.NoError(t, os.WriteFile(tempPath, []byte(`{"schemaVersion": 2, "it`), 0644))
+	require.NoError(t, os.MkdirAll(fs.projectDir("ghost"), 0755))
+	require.NoError(t, fs.saveProcesses("ghost", []*domain.Process{domain.NewProcess("ghost", "haunt", "true", nil)}))
+	require.NoError(t, os.WriteFile(filepath.Join(fs.projectDir(other.ID), "discoveries.json"), []byte("{"), 0644))
+	gone := "gone"
+	require.NoError(t, WriteConfig(fs.basePath, &Config{CurrentProjectID: &gone, SchemaVersion: CurrentSchemaVersion}))
+
+	report, err := fs.Check(false)
+	require.NoError(t, err)
+	assert.Equal(t, BackendJSON, report.Backend)
+
+	codes := map[string]domain.CheckSeverity{}
+	for _, issue := range report.Issues {
+		codes[issue.Code] = issue.Severity
+	}
+	assert.Equal(t, map[string]domain.CheckSeverity{
+		"temp-file":                domain.SeverityWarning,
+		"task-project-mismatch":    domain.SeverityError,
+		"missing-project":          domain.SeverityError,
+		"orphan-process":           domain.SeverityError,
+		"unreadable-file":          domain.SeverityError,
+		"dangling-current-project": domain.SeverityWarning,
+	}, codes)
+	assert.Equal(t, "projects/"+project.ID+"/tasks.json.tmp", findIssue(report, "temp-file").Path)
+	assert.False(t, findIssue(report, "orphan-process").Repairable)
+	assert.FileExists(t, tempPath, "a check without repair changes nothing")
+
+	report, err = fs.Check(true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Repaired)
+	assert.Equal(t, 3, report.Outstanding())
+	require.NotEmpty(t, report.Backup)
+	backup := snapshotNames(t, report.Backup)
+	assert.Contains(t, backup, "projects/"+project.ID+"/tasks.json.tmp")
+	assert.Contains(t, backup, "projects/"+project.ID+"/tasks.json")
+
+	assert.NoFileExists(t, tempPath)
+	got, err := fs.GetTask(misplaced.ID)
+	require.NoError(t, err)
+	assert.Equal(t, project.ID, got.ProjectID)
+	config, err := ReadConfig(fs.basePath)
+	require.NoError(t, err)
+	assert.Nil(t, config.CurrentProjectID)
+}
@@ -0,0 +1,47 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/storage"
+	"github.com/rcliao/compass/internal/storage/storagetest"
+)
+
+func TestMemoryStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestFileStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		fileStorage, err := storage.NewFileStorage(t.TempDir())
+		require.NoError(t, err)
+		return fileStorage
+	})
+}
+
+func TestFileStorage_PerEntityConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		dir := t.TempDir()
+		require.NoError(t, storage.WriteConfig(dir, &storage.Config{
+			SchemaVersion: storage.CurrentSchemaVersion,
+			Layout:        storage.LayoutPerEntity,
+		}))
+		fileStorage, err := storage.NewFileStorage(dir)
+		require.NoError(t, err)
+		return fileStorage
+	})
+}
+
+func TestSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		sqliteStorage, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "compass.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { sqliteStorage.Close() })
+		return sqliteStorage
+	})
+}
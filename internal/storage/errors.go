@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+var (
+	// ErrNotFound is returned when the requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when creating an entity whose ID is already taken
+	ErrConflict = errors.New("conflict")
+	// ErrNotTransactional is returned for operations that cannot run inside
+	// a transaction
+	ErrNotTransactional = errors.New("not supported inside a transaction")
+)
+
+// EntityError reports a storage failure for a single entity. It matches
+// ErrNotFound or ErrConflict with errors.Is while keeping the messages
+// callers already show to users.
+type EntityError struct {
+	Entity string
+	ID     string
+	Err    error
+}
+
+func (e *EntityError) Error() string {
+	switch e.Err {
+	case ErrNotFound:
+		return fmt.Sprintf("%s with ID %s not found", e.Entity, e.ID)
+	case ErrConflict:
+		return fmt.Sprintf("%s with ID %s already exists", e.Entity, e.ID)
+	}
+	return fmt.Sprintf("%s with ID %s: %v", e.Entity, e.ID, e.Err)
+}
+
+func (e *EntityError) Unwrap() error {
+	return e.Err
+}
+
+func notFound(entity, id string) error {
+	return &EntityError{Entity: entity, ID: id, Err: ErrNotFound}
+}
+
+func conflict(entity, id string) error {
+	return &EntityError{Entity: entity, ID: id, Err: ErrConflict}
+}
+
+// taskPatchError passes domain.ApplyTaskPatch failures through, marking
+// version conflicts as ErrConflict so callers handle them like any other
+func taskPatchError(err error) error {
+	var versionErr *domain.VersionConflictError
+	if errors.As(err, &versionErr) {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// noCurrentProjectError is returned by GetCurrentProject before a current
+// project has been chosen
+type noCurrentProjectError struct{}
+
+func (noCurrentProjectError) Error() string {
+	return "no current project set"
+}
+
+func (noCurrentProjectError) Unwrap() error {
+	return ErrNotFound
+}
+
+var errNoCurrentProject error = noCurrentProjectError{}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -64,18 +65,44 @@ func (cb *CircuitBreaker) RecordFailure() {
 
 type FileStorage struct {
 	basePath      string
+	layout        string
 	mu            sync.RWMutex
 	circuitBreaker *CircuitBreaker
+	
+	// logRotation decides when process log segments are rotated
+	logRotation LogRotation
+	
+	// Decoded tasks per project, shared by concurrent readers
+	cacheMu   sync.Mutex
+	taskCache map[string]*projectTasks
+	
+	// tx is set on the view a Transaction callback works through
+	tx *fileTx
 }
 
 type Config struct {
 	CurrentProjectID *string `json:"currentProjectId,omitempty"`
+	// Storage selects the backend used for this workspace; empty means json
+	Storage string `json:"storage,omitempty"`
+	// SchemaVersion of the JSON layout; zero means the unversioned v1 layout
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// Layout of the JSON files; empty means single-file
+	Layout string `json:"layout,omitempty"`
+	// SnapshotRetention is how many automatic snapshots to keep; zero means
+	// DefaultSnapshotRetention
+	SnapshotRetention int `json:"snapshotRetention,omitempty"`
+	// Retention is the policy `compass gc` applies; nil means the defaults
+	Retention *domain.RetentionPolicy `json:"retention,omitempty"`
+	// LogRotation decides when process log segments are rotated; nil means
+	// the defaults
+	LogRotation *LogRotation `json:"logRotation,omitempty"`
 }
 
 func NewFileStorage(basePath string) (*FileStorage, error) {
 	fs := &FileStorage{
 		basePath:       basePath,
 		circuitBreaker: NewCircuitBreaker(3, 30*time.Second), // Open circuit after 3 failures for 30 seconds
+		taskCache:      make(map[string]*projectTasks),
 	}
 	
 	err := fs.initialize()
@@ -99,14 +126,50 @@ func (fs *FileStorage) initialize() error {
 		return err
 	}
 	
+	// Another process may be creating or migrating the same workspace
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	
 	// Create config.json if it doesn't exist
 	configPath := filepath.Join(compassDir, "config.json")
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		config := Config{}
-		return fs.saveJSON(configPath, config)
+		config := Config{SchemaVersion: CurrentSchemaVersion}
+		if err := fs.saveJSON(configPath, config); err != nil {
+			return err
+		}
+	} else {
+		// Bring existing data up to the current schema before serving it
+		report, err := MigrateSchema(fs.basePath, false)
+		if err != nil {
+			return err
+		}
+		if len(report.Steps) > 0 {
+			log.Printf("FileStorage: migrated schema v%d -> v%d (%d files rewritten, backup: %s)",
+				report.FromVersion, report.ToVersion, len(report.Files), report.Backup)
+		}
 	}
 	
-	return nil
+	config, err := ReadConfig(fs.basePath)
+	if err != nil {
+		return err
+	}
+	if fs.layout, err = parseLayout(config.Layout); err != nil {
+		return err
+	}
+	if config.LogRotation != nil {
+		fs.logRotation = *config.LogRotation
+	}
+	
+	// Finish a transaction a stopped process left half applied
+	if err := fs.recoverTransaction(); err != nil {
+		return err
+	}
+	
+	// Fold in task journal entries left by processes that stopped or crashed
+	return fs.compactAllTasks()
 }
 
 func (fs *FileStorage) projectDir(projectID string) string {
@@ -114,6 +177,12 @@ func (fs *FileStorage) projectDir(projectID string) string {
 }
 
 func (fs *FileStorage) ensureProjectDir(projectID string) error {
+	if fs.tx != nil {
+		// Created when the transaction commits
+		fs.tx.projects[projectID] = true
+		return nil
+	}
+	
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	
@@ -151,6 +220,15 @@ func (fs *FileStorage) saveJSON(path string, data interface{}) error {
 
 func (fs *FileStorage) saveJSONWithTimeout(path string, data interface{}, timeout time.Duration) error {
 	// Check circuit breaker
+	if fs.tx != nil {
+		data, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		fs.tx.stage(path, append(data, '\n'), false)
+		return nil
+	}
+	
 	if !fs.circuitBreaker.Allow() {
 		return fmt.Errorf("file save circuit breaker open: %s", path)
 	}
@@ -200,6 +278,13 @@ func (fs *FileStorage) loadJSON(path string, target interface{}) error {
 
 func (fs *FileStorage) loadJSONWithTimeout(path string, target interface{}, timeout time.Duration) error {
 	// Check circuit breaker
+	if file, ok := fs.tx.staged(path); ok {
+		if file.removed {
+			return &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		return json.Unmarshal(file.data, target)
+	}
+	
 	if !fs.circuitBreaker.Allow() {
 		return fmt.Errorf("file operation circuit breaker open: %s", path)
 	}
@@ -221,7 +306,8 @@ func (fs *FileStorage) loadJSONWithTimeout(path string, target interface{}, time
 	
 	select {
 	case err := <-done:
-		if err != nil {
+		// A missing file is a normal answer, not a sign the disk is failing
+		if err != nil && !os.IsNotExist(err) {
 			fs.circuitBreaker.RecordFailure()
 		} else {
 			fs.circuitBreaker.RecordSuccess()
@@ -235,202 +321,202 @@ func (fs *FileStorage) loadJSONWithTimeout(path string, target interface{}, time
 
 // Task Repository Implementation
 func (fs *FileStorage) CreateTask(task *domain.Task) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	if err := fs.ensureProjectDir(task.ProjectID); err != nil {
 		return err
 	}
 	
-	tasks, err := fs.loadTasks(task.ProjectID)
-	if err != nil && !os.IsNotExist(err) {
+	cached, err := fs.cachedTasks(task.ProjectID)
+	if err != nil {
 		return err
 	}
 	
 	// Check if task already exists
-	for _, t := range tasks {
-		if t.ID == task.ID {
-			return fmt.Errorf("task with ID %s already exists", task.ID)
-		}
+	if _, ok := cached.index.byID[task.ID]; ok {
+		return conflict("task", task.ID)
 	}
 	
-	tasks = append(tasks, task)
-	return fs.saveTasks(task.ProjectID, tasks)
+	// Keep our own copy so later changes by the caller don't leak into the cache
+	stored := task.Clone()
+	if err := fs.commitTask(task.ProjectID, journalEntry{Op: journalPut, ID: stored.ID, Task: stored}); err != nil {
+		return err
+	}
+	
+	fs.recordTaskRevision(domain.RevisionCreate, task)
+	return nil
 }
 
+// loadTasks returns the project's cached tasks in creation order; callers
+// may reorder or replace entries but must not modify the tasks themselves
 func (fs *FileStorage) loadTasks(projectID string) ([]*domain.Task, error) {
-	tasksPath := filepath.Join(fs.projectDir(projectID), "tasks.json")
-	
-	var tasks []*domain.Task
-	err := fs.loadJSON(tasksPath, &tasks)
-	if os.IsNotExist(err) {
-		return make([]*domain.Task, 0), nil
+	cached, err := fs.cachedTasks(projectID)
+	if err != nil {
+		return nil, err
 	}
 	
-	return tasks, err
+	return cached.list(), nil
 }
 
+// saveTasks replaces all of the project's tasks at once. In the single-file
+// layout it writes a new snapshot and drops the journal, which it already
+// contains.
 func (fs *FileStorage) saveTasks(projectID string, tasks []*domain.Task) error {
-	tasksPath := filepath.Join(fs.projectDir(projectID), "tasks.json")
-	return fs.saveJSON(tasksPath, tasks)
+	defer fs.invalidateTasks(projectID)
+	
+	if fs.perEntity() {
+		dir := fs.entityDir(projectID, tasksDir)
+		for _, task := range tasks {
+			if err := saveEntity(dir, task.ID, task); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
+	if err := fs.saveList(fs.tasksPath(projectID), tasks); err != nil {
+		return err
+	}
+	if err := os.Remove(fs.taskJournalPath(projectID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
-func (fs *FileStorage) UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error) {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-	
-	// Find the task across all projects (unlocked version to avoid deadlock)
+// findTask looks a task up across every project
+func (fs *FileStorage) findTask(id string) (*domain.Task, error) {
 	projects, err := fs.listProjectsUnlocked()
 	if err != nil {
 		return nil, err
 	}
 	
 	for _, project := range projects {
-		tasks, err := fs.loadTasks(project.ID)
+		cached, err := fs.cachedTasks(project.ID)
 		if err != nil {
 			continue
 		}
 		
-		for i, task := range tasks {
-			if task.ID == id {
-				// Create a copy and apply updates
-				updatedTask := *task
-				
-				if title, ok := updates["title"].(string); ok {
-					updatedTask.Card.Title = title
-				}
-				if description, ok := updates["description"].(string); ok {
-					updatedTask.Card.Description = description
-				}
-				if status, ok := updates["status"].(domain.TaskStatus); ok {
-					updatedTask.Card.Status = status
-				}
-				
-				tasks[i] = &updatedTask
-				err = fs.saveTasks(project.ID, tasks)
-				if err != nil {
-					return nil, err
-				}
-				
-				return &updatedTask, nil
-			}
+		if task, ok := cached.index.byID[id]; ok {
+			return task, nil
 		}
 	}
 	
-	return nil, fmt.Errorf("task with ID %s not found", id)
+	return nil, notFound("task", id)
+}
+
+func (fs *FileStorage) UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error) {
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	
+	task, err := fs.taskForUpdate(id)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Apply updates to a copy so a rejected patch changes nothing
+	updatedTask, err := domain.ApplyTaskPatch(task, updates)
+	if err != nil {
+		return nil, taskPatchError(err)
+	}
+	
+	if err := fs.commitTask(task.ProjectID, journalEntry{Op: journalPut, ID: id, Task: updatedTask}); err != nil {
+		return nil, err
+	}
+	
+	fs.recordTaskRevision(domain.RevisionUpdate, updatedTask)
+	return updatedTask.Clone(), nil
 }
 
 func (fs *FileStorage) GetTask(id string) (*domain.Task, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 	
-	projects, err := fs.listProjectsUnlocked()
+	task, err := fs.findTask(id)
 	if err != nil {
 		return nil, err
 	}
 	
-	for _, project := range projects {
-		tasks, err := fs.loadTasks(project.ID)
-		if err != nil {
-			continue
-		}
-		
-		for _, task := range tasks {
-			if task.ID == id {
-				return task, nil
-			}
-		}
-	}
-	
-	return nil, fmt.Errorf("task with ID %s not found", id)
+	return task.Clone(), nil
 }
 
 func (fs *FileStorage) ListTasks(filter domain.TaskFilter) ([]*domain.Task, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 	
-	var result []*domain.Task
-	
 	if filter.ProjectID != nil {
-		tasks, err := fs.loadTasks(*filter.ProjectID)
-		if err != nil && !os.IsNotExist(err) {
-			return nil, err
-		}
-		result = tasks
-	} else {
-		// Load tasks from all projects
-		projects, err := fs.listProjectsUnlocked()
+		cached, err := fs.cachedTasks(*filter.ProjectID)
 		if err != nil {
 			return nil, err
 		}
-		
-		for _, project := range projects {
-			tasks, err := fs.loadTasks(project.ID)
-			if err != nil && !os.IsNotExist(err) {
-				continue
-			}
-			result = append(result, tasks...)
-		}
+		return cloneTasks(cached.index.query(filter)), nil
 	}
 	
-	// Apply filters
-	var filtered []*domain.Task
-	for _, task := range result {
-		if filter.Status != nil && task.Card.Status != *filter.Status {
-			continue
-		}
-		if filter.Parent != nil && task.Card.Parent != filter.Parent {
+	// Query every project, then order and paginate the combined result
+	projects, err := fs.listProjectsUnlocked()
+	if err != nil {
+		return nil, err
+	}
+	
+	unpaged := filter
+	unpaged.Limit, unpaged.Offset = 0, 0
+	
+	var result []*domain.Task
+	for _, project := range projects {
+		cached, err := fs.cachedTasks(project.ID)
+		if err != nil {
 			continue
 		}
-		
-		filtered = append(filtered, task)
+		result = append(result, cached.index.query(unpaged)...)
 	}
 	
-	return filtered, nil
+	return cloneTasks(domain.ApplyTaskQuery(result, filter)), nil
 }
 
 func (fs *FileStorage) DeleteTask(id string) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
-	projects, err := fs.listProjectsUnlocked()
+	task, err := fs.findTask(id)
 	if err != nil {
 		return err
 	}
 	
-	for _, project := range projects {
-		tasks, err := fs.loadTasks(project.ID)
-		if err != nil {
-			continue
-		}
-		
-		for i, task := range tasks {
-			if task.ID == id {
-				// Remove task from slice
-				tasks = append(tasks[:i], tasks[i+1:]...)
-				return fs.saveTasks(project.ID, tasks)
-			}
-		}
+	if err := fs.commitTask(task.ProjectID, journalEntry{Op: journalDelete, ID: id}); err != nil {
+		return err
 	}
 	
-	return fmt.Errorf("task with ID %s not found", id)
+	fs.recordTaskRevision(domain.RevisionDelete, task)
+	return nil
 }
 
 // Project Repository Implementation
 func (fs *FileStorage) CreateProject(project *domain.Project) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	if err := fs.ensureProjectDir(project.ID); err != nil {
 		return err
 	}
 	
 	projectPath := filepath.Join(fs.projectDir(project.ID), "project.json")
-	if _, err := os.Stat(projectPath); err == nil {
-		return fmt.Errorf("project with ID %s already exists", project.ID)
+	if fs.fileExists(projectPath) {
+		return conflict("project", project.ID)
 	}
 	
-	return fs.saveJSON(projectPath, project)
+	return fs.saveProject(projectPath, project)
 }
 
 func (fs *FileStorage) GetProject(id string) (*domain.Project, error) {
@@ -442,12 +528,39 @@ func (fs *FileStorage) GetProject(id string) (*domain.Project, error) {
 	var project domain.Project
 	err := fs.loadJSON(projectPath, &project)
 	if os.IsNotExist(err) {
-		return nil, fmt.Errorf("project with ID %s not found", id)
+		return nil, notFound("project", id)
 	}
 	
 	return &project, err
 }
 
+func (fs *FileStorage) UpdateProject(id string, updates map[string]interface{}) (*domain.Project, error) {
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	
+	projectPath := filepath.Join(fs.projectDir(id), "project.json")
+	
+	var project domain.Project
+	err = fs.loadJSON(projectPath, &project)
+	if os.IsNotExist(err) {
+		return nil, notFound("project", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	applyProjectUpdates(&project, updates)
+	
+	if err := fs.saveProject(projectPath, &project); err != nil {
+		return nil, err
+	}
+	
+	return &project, nil
+}
+
 func (fs *FileStorage) ListProjects() ([]*domain.Project, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
@@ -461,44 +574,60 @@ func (fs *FileStorage) listProjectsUnlocked() ([]*domain.Project, error) {
 	
 	var projects []*domain.Project
 	
-	err := filepath.Walk(projectsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	// Only look one level down: per-entity layouts keep many files below
+	entries, err := os.ReadDir(projectsDir)
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
 		}
-		
-		if info.IsDir() && info.Name() != "projects" {
-			projectPath := filepath.Join(path, "project.json")
-			if _, err := os.Stat(projectPath); err == nil {
-				var project domain.Project
-				if err := fs.loadJSON(projectPath, &project); err == nil {
-					projects = append(projects, &project)
-				}
+	}
+	if fs.tx != nil {
+		for projectID := range fs.tx.projects {
+			if _, statErr := os.Stat(filepath.Join(projectsDir, projectID)); statErr != nil {
+				names = append(names, projectID)
 			}
 		}
-		
-		return nil
-	})
+	}
+	for _, name := range names {
+		projectPath := filepath.Join(projectsDir, name, "project.json")
+		if fs.fileExists(projectPath) {
+			var project domain.Project
+			if err := fs.loadJSON(projectPath, &project); err == nil {
+				projects = append(projects, &project)
+			}
+		}
+	}
+	sortProjects(projects)
 	
 	return projects, err
 }
 
 func (fs *FileStorage) SetCurrentProject(id string) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	// Verify project exists (without additional locking)
 	projectPath := filepath.Join(fs.projectDir(id), "project.json")
 	var project domain.Project
-	err := fs.loadJSON(projectPath, &project)
+	err = fs.loadJSON(projectPath, &project)
 	if os.IsNotExist(err) {
-		return fmt.Errorf("project with ID %s not found", id)
+		return notFound("project", id)
 	}
 	if err != nil {
 		return err
 	}
 	
+	// Keep the other settings in config.json intact
 	configPath := filepath.Join(fs.basePath, ".compass", "config.json")
-	config := Config{CurrentProjectID: &id}
+	var config Config
+	if err := fs.loadJSON(configPath, &config); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	config.CurrentProjectID = &id
 	
 	return fs.saveJSON(configPath, config)
 }
@@ -515,7 +644,7 @@ func (fs *FileStorage) GetCurrentProject() (*domain.Project, error) {
 	}
 	
 	if config.CurrentProjectID == nil {
-		return nil, fmt.Errorf("no current project set")
+		return nil, errNoCurrentProject
 	}
 	
 	// Avoid deadlock by using the unlocked version
@@ -523,7 +652,7 @@ func (fs *FileStorage) GetCurrentProject() (*domain.Project, error) {
 	var project domain.Project
 	err := fs.loadJSON(projectPath, &project)
 	if os.IsNotExist(err) {
-		return nil, fmt.Errorf("project with ID %s not found", *config.CurrentProjectID)
+		return nil, notFound("project", *config.CurrentProjectID)
 	}
 	
 	return &project, err
@@ -531,8 +660,11 @@ func (fs *FileStorage) GetCurrentProject() (*domain.Project, error) {
 
 // Planning Storage Implementation
 func (fs *FileStorage) CreatePlanningSession(session *domain.PlanningSession) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	if err := fs.ensureProjectDir(session.ProjectID); err != nil {
 		return err
@@ -547,7 +679,7 @@ func (fs *FileStorage) CreatePlanningSession(session *domain.PlanningSession) er
 	// Check if session already exists
 	for _, s := range sessions {
 		if s.ID == session.ID {
-			return fmt.Errorf("planning session with ID %s already exists", session.ID)
+			return conflict("planning session", session.ID)
 		}
 	}
 	
@@ -560,7 +692,7 @@ func (fs *FileStorage) loadPlanningSessions(projectID string) ([]*domain.Plannin
 	sessionsPath := filepath.Join(planningDir, "sessions.json")
 	
 	var sessions []*domain.PlanningSession
-	err := fs.loadJSON(sessionsPath, &sessions)
+	err := fs.loadList(sessionsPath, &sessions)
 	if os.IsNotExist(err) {
 		return make([]*domain.PlanningSession, 0), nil
 	}
@@ -570,12 +702,14 @@ func (fs *FileStorage) loadPlanningSessions(projectID string) ([]*domain.Plannin
 
 func (fs *FileStorage) savePlanningSessions(projectID string, sessions []*domain.PlanningSession) error {
 	planningDir := filepath.Join(fs.projectDir(projectID), "planning")
-	if err := os.MkdirAll(planningDir, 0755); err != nil {
-		return err
+	if fs.tx == nil {
+		if err := os.MkdirAll(planningDir, 0755); err != nil {
+			return err
+		}
 	}
 	
 	sessionsPath := filepath.Join(planningDir, "sessions.json")
-	return fs.saveJSON(sessionsPath, sessions)
+	return fs.saveList(sessionsPath, sessions)
 }
 
 func (fs *FileStorage) GetPlanningSession(id string) (*domain.PlanningSession, error) {
@@ -600,19 +734,28 @@ func (fs *FileStorage) GetPlanningSession(id string) (*domain.PlanningSession, e
 		}
 	}
 	
-	return nil, fmt.Errorf("planning session with ID %s not found", id)
+	return nil, notFound("planning session", id)
 }
 
 func (fs *FileStorage) ListPlanningSessions(projectID string) ([]*domain.PlanningSession, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 	
-	return fs.loadPlanningSessions(projectID)
+	sessions, err := fs.loadPlanningSessions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	sortPlanningSessions(sessions)
+	
+	return sessions, nil
 }
 
 func (fs *FileStorage) UpdatePlanningSession(id string, updates map[string]interface{}) (*domain.PlanningSession, error) {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 	
 	projects, err := fs.listProjectsUnlocked()
 	if err != nil {
@@ -630,12 +773,7 @@ func (fs *FileStorage) UpdatePlanningSession(id string, updates map[string]inter
 				// Create a copy and apply updates
 				updatedSession := *session
 				
-				if status, ok := updates["status"].(domain.PlanningSessionStatus); ok {
-					updatedSession.Status = status
-				}
-				if tasks, ok := updates["tasks"].([]string); ok {
-					updatedSession.Tasks = tasks
-				}
+				applyPlanningSessionUpdates(&updatedSession, updates)
 				
 				sessions[i] = &updatedSession
 				err = fs.savePlanningSessions(project.ID, sessions)
@@ -648,13 +786,16 @@ func (fs *FileStorage) UpdatePlanningSession(id string, updates map[string]inter
 		}
 	}
 	
-	return nil, fmt.Errorf("planning session with ID %s not found", id)
+	return nil, notFound("planning session", id)
 }
 
 // Discovery Storage Implementation
 func (fs *FileStorage) CreateDiscovery(discovery *domain.Discovery) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	if err := fs.ensureProjectDir(discovery.ProjectID); err != nil {
 		return err
@@ -665,15 +806,29 @@ func (fs *FileStorage) CreateDiscovery(discovery *domain.Discovery) error {
 		return err
 	}
 	
+	for _, d := range discoveries {
+		if d.ID == discovery.ID {
+			return conflict("discovery", discovery.ID)
+		}
+	}
+	
+	if fs.perEntity() {
+		return fs.writeEntity(fs.entityDir(discovery.ProjectID, discoveriesDir), discovery.ID, discovery)
+	}
+	
 	discoveries = append(discoveries, discovery)
 	return fs.saveDiscoveries(discovery.ProjectID, discoveries)
 }
 
 func (fs *FileStorage) loadDiscoveries(projectID string) ([]*domain.Discovery, error) {
+	if fs.perEntity() {
+		return loadEntities[domain.Discovery](fs.tx, fs.entityDir(projectID, discoveriesDir))
+	}
+	
 	discoveriesPath := filepath.Join(fs.projectDir(projectID), "discoveries.json")
 	
 	var discoveries []*domain.Discovery
-	err := fs.loadJSON(discoveriesPath, &discoveries)
+	err := fs.loadList(discoveriesPath, &discoveries)
 	if os.IsNotExist(err) {
 		return make([]*domain.Discovery, 0), nil
 	}
@@ -682,21 +837,39 @@ func (fs *FileStorage) loadDiscoveries(projectID string) ([]*domain.Discovery, e
 }
 
 func (fs *FileStorage) saveDiscoveries(projectID string, discoveries []*domain.Discovery) error {
+	if fs.perEntity() {
+		for _, discovery := range discoveries {
+			if err := saveEntity(fs.entityDir(projectID, discoveriesDir), discovery.ID, discovery); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
 	discoveriesPath := filepath.Join(fs.projectDir(projectID), "discoveries.json")
-	return fs.saveJSON(discoveriesPath, discoveries)
+	return fs.saveList(discoveriesPath, discoveries)
 }
 
 func (fs *FileStorage) ListDiscoveries(projectID string) ([]*domain.Discovery, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 	
-	return fs.loadDiscoveries(projectID)
+	discoveries, err := fs.loadDiscoveries(projectID)
+	if err != nil {
+		return nil, err
+	}
+	sortDiscoveries(discoveries)
+	
+	return discoveries, nil
 }
 
 // Decision Storage Implementation
 func (fs *FileStorage) CreateDecision(decision *domain.Decision) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	if err := fs.ensureProjectDir(decision.ProjectID); err != nil {
 		return err
@@ -707,15 +880,29 @@ func (fs *FileStorage) CreateDecision(decision *domain.Decision) error {
 		return err
 	}
 	
+	for _, d := range decisions {
+		if d.ID == decision.ID {
+			return conflict("decision", decision.ID)
+		}
+	}
+	
+	if fs.perEntity() {
+		return fs.writeEntity(fs.entityDir(decision.ProjectID, decisionsDir), decision.ID, decision)
+	}
+	
 	decisions = append(decisions, decision)
 	return fs.saveDecisions(decision.ProjectID, decisions)
 }
 
 func (fs *FileStorage) loadDecisions(projectID string) ([]*domain.Decision, error) {
+	if fs.perEntity() {
+		return loadEntities[domain.Decision](fs.tx, fs.entityDir(projectID, decisionsDir))
+	}
+	
 	decisionsPath := filepath.Join(fs.projectDir(projectID), "decisions.json")
 	
 	var decisions []*domain.Decision
-	err := fs.loadJSON(decisionsPath, &decisions)
+	err := fs.loadList(decisionsPath, &decisions)
 	if os.IsNotExist(err) {
 		return make([]*domain.Decision, 0), nil
 	}
@@ -724,21 +911,39 @@ func (fs *FileStorage) loadDecisions(projectID string) ([]*domain.Decision, erro
 }
 
 func (fs *FileStorage) saveDecisions(projectID string, decisions []*domain.Decision) error {
+	if fs.perEntity() {
+		for _, decision := range decisions {
+			if err := saveEntity(fs.entityDir(projectID, decisionsDir), decision.ID, decision); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
 	decisionsPath := filepath.Join(fs.projectDir(projectID), "decisions.json")
-	return fs.saveJSON(decisionsPath, decisions)
+	return fs.saveList(decisionsPath, decisions)
 }
 
 func (fs *FileStorage) ListDecisions(projectID string) ([]*domain.Decision, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 	
-	return fs.loadDecisions(projectID)
+	decisions, err := fs.loadDecisions(projectID)
+	if err != nil {
+		return nil, err
+	}
+	sortDecisions(decisions)
+	
+	return decisions, nil
 }
 
 // Process Storage Implementation
 func (fs *FileStorage) SaveProcess(projectID string, process *domain.Process) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	if err := fs.ensureProjectDir(projectID); err != nil {
 		return err
@@ -788,7 +993,7 @@ func (fs *FileStorage) GetProcess(processID string) (*domain.Process, error) {
 		}
 	}
 	
-	return nil, fmt.Errorf("process with ID %s not found", processID)
+	return nil, notFound("process", processID)
 }
 
 // getProcessUnlocked is an internal version that doesn't acquire locks
@@ -812,7 +1017,7 @@ func (fs *FileStorage) getProcessUnlocked(processID string) (*domain.Process, er
 		}
 	}
 	
-	return nil, fmt.Errorf("process with ID %s not found", processID)
+	return nil, notFound("process", processID)
 }
 
 func (fs *FileStorage) ListProcesses(filter domain.ProcessFilter) ([]*domain.Process, error) {
@@ -854,13 +1059,17 @@ func (fs *FileStorage) ListProcesses(filter domain.ProcessFilter) ([]*domain.Pro
 		}
 		filtered = append(filtered, process)
 	}
+	sortProcesses(filtered)
 	
 	return filtered, nil
 }
 
 func (fs *FileStorage) SaveProcessGroup(projectID string, group *domain.ProcessGroup) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	if err := fs.ensureProjectDir(projectID); err != nil {
 		return err
@@ -910,12 +1119,18 @@ func (fs *FileStorage) GetProcessGroup(groupID string) (*domain.ProcessGroup, er
 		}
 	}
 	
-	return nil, fmt.Errorf("process group with ID %s not found", groupID)
+	return nil, notFound("process group", groupID)
 }
 
 func (fs *FileStorage) SaveProcessLogs(logs []*domain.ProcessLog) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	if fs.tx != nil {
+		return ErrNotTransactional
+	}
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	
 	// Group logs by process ID
 	logsByProcess := make(map[string][]*domain.ProcessLog)
@@ -931,17 +1146,7 @@ func (fs *FileStorage) SaveProcessLogs(logs []*domain.ProcessLog) error {
 			continue
 		}
 		
-		// Load existing logs
-		existingLogs, err := fs.loadProcessLogs(process.ProjectID, processID)
-		if err != nil && !os.IsNotExist(err) {
-			continue
-		}
-		
-		// Append new logs
-		allLogs := append(existingLogs, processLogs...)
-		
-		// Save logs
-		if err := fs.saveProcessLogs(process.ProjectID, processID, allLogs); err != nil {
+		if err := fs.appendProcessLogs(process.ProjectID, processID, processLogs); err != nil {
 			return err
 		}
 	}
@@ -949,32 +1154,38 @@ func (fs *FileStorage) SaveProcessLogs(logs []*domain.ProcessLog) error {
 	return nil
 }
 
-func (fs *FileStorage) GetProcessLogs(processID string, limit int) ([]*domain.ProcessLog, error) {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-	
-	// Find the process to get the project ID
-	process, err := fs.GetProcess(processID)
+func (fs *FileStorage) PruneProcessLogs(processID string, before time.Time, keep int, dryRun bool) (int, error) {
+	if fs.tx != nil {
+		return 0, ErrNotTransactional
+	}
+	unlock, err := fs.lockForWrite()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	defer unlock()
 	
-	logs, err := fs.loadProcessLogs(process.ProjectID, processID)
+	process, err := fs.getProcessUnlocked(processID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	
-	// Return last N logs
-	if limit <= 0 || limit > len(logs) {
-		return logs, nil
-	}
+	return fs.pruneProcessLogs(process.ProjectID, processID, before, keep, dryRun)
+}
+
+func (fs *FileStorage) GetProcessLogs(processID string, limit int) ([]*domain.ProcessLog, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	
-	start := len(logs) - limit
-	if start < 0 {
-		start = 0
+	// Find the process to get the project ID (read lock is already held)
+	process, err := fs.getProcessUnlocked(processID)
+	if err != nil {
+		return nil, err
 	}
 	
-	return logs[start:], nil
+	if limit <= 0 {
+		return fs.loadProcessLogs(process.ProjectID, processID)
+	}
+	return fs.tailProcessLogs(process.ProjectID, processID, limit)
 }
 
 // Helper methods for process storage
@@ -982,7 +1193,7 @@ func (fs *FileStorage) loadProcesses(projectID string) ([]*domain.Process, error
 	processesPath := filepath.Join(fs.projectDir(projectID), "processes.json")
 	
 	var processes []*domain.Process
-	err := fs.loadJSON(processesPath, &processes)
+	err := fs.loadList(processesPath, &processes)
 	if os.IsNotExist(err) {
 		return make([]*domain.Process, 0), nil
 	}
@@ -992,14 +1203,14 @@ func (fs *FileStorage) loadProcesses(projectID string) ([]*domain.Process, error
 
 func (fs *FileStorage) saveProcesses(projectID string, processes []*domain.Process) error {
 	processesPath := filepath.Join(fs.projectDir(projectID), "processes.json")
-	return fs.saveJSON(processesPath, processes)
+	return fs.saveList(processesPath, processes)
 }
 
 func (fs *FileStorage) loadProcessGroups(projectID string) ([]*domain.ProcessGroup, error) {
 	groupsPath := filepath.Join(fs.projectDir(projectID), "process_groups.json")
 	
 	var groups []*domain.ProcessGroup
-	err := fs.loadJSON(groupsPath, &groups)
+	err := fs.loadList(groupsPath, &groups)
 	if os.IsNotExist(err) {
 		return make([]*domain.ProcessGroup, 0), nil
 	}
@@ -1009,28 +1220,5 @@ func (fs *FileStorage) loadProcessGroups(projectID string) ([]*domain.ProcessGro
 
 func (fs *FileStorage) saveProcessGroups(projectID string, groups []*domain.ProcessGroup) error {
 	groupsPath := filepath.Join(fs.projectDir(projectID), "process_groups.json")
-	return fs.saveJSON(groupsPath, groups)
+	return fs.saveList(groupsPath, groups)
 }
-
-func (fs *FileStorage) loadProcessLogs(projectID, processID string) ([]*domain.ProcessLog, error) {
-	logsDir := filepath.Join(fs.projectDir(projectID), "logs")
-	logsPath := filepath.Join(logsDir, fmt.Sprintf("%s.json", processID))
-	
-	var logs []*domain.ProcessLog
-	err := fs.loadJSON(logsPath, &logs)
-	if os.IsNotExist(err) {
-		return make([]*domain.ProcessLog, 0), nil
-	}
-	
-	return logs, err
-}
-
-func (fs *FileStorage) saveProcessLogs(projectID, processID string, logs []*domain.ProcessLog) error {
-	logsDir := filepath.Join(fs.projectDir(projectID), "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		return err
-	}
-	
-	logsPath := filepath.Join(logsDir, fmt.Sprintf("%s.json", processID))
-	return fs.saveJSON(logsPath, logs)
-}
\ No newline at end of file
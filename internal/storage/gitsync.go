@@ -0,0 +1,592 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/merge"
+)
+
+// DefaultSyncRef is the git ref compass sync keeps the workspace's data on.
+// It lives outside refs/heads, so it never shows up as a branch and its
+// commits never touch the working tree.
+const DefaultSyncRef = "refs/compass/data"
+
+// Which side a pull keeps for files both sides changed irreconcilably
+const (
+	PreferOurs   = "ours"
+	PreferTheirs = "theirs"
+)
+
+type GitSyncOptions struct {
+	// Remote is the git remote to push to or pull from; empty means origin
+	Remote string
+	// Ref is the ref holding the data; empty means DefaultSyncRef
+	Ref string
+	// Prefer settles pull conflicts with PreferOurs or PreferTheirs by
+	// keeping that side's version of each conflicting file
+	Prefer string
+	// DryRun reports what a pull would change without writing
+	DryRun bool
+}
+
+func (o GitSyncOptions) withDefaults() GitSyncOptions {
+	if o.Remote == "" {
+		o.Remote = "origin"
+	}
+	if o.Ref == "" {
+		o.Ref = DefaultSyncRef
+	}
+	return o
+}
+
+// trackingRef is where a pull fetches the remote's data ref to, e.g.
+// refs/compass/remotes/origin/data
+func (o GitSyncOptions) trackingRef() string {
+	return "refs/compass/remotes/" + o.Remote + "/" + path.Base(o.Ref)
+}
+
+// PushToGit commits the workspace's data files to the sync ref and pushes
+// the ref to the remote. The commit is built in a private index, so the
+// repository's index, branches and working tree are left alone. The push
+// fails when the remote has data this workspace has not pulled yet.
+func PushToGit(basePath string, opts GitSyncOptions) (*domain.GitSync, error) {
+	opts = opts.withDefaults()
+	if err := checkGitSync(basePath); err != nil {
+		return nil, err
+	}
+	report := &domain.GitSync{Remote: opts.Remote, Ref: opts.Ref}
+
+	parent, err := resolveRef(basePath, opts.Ref)
+	if err != nil {
+		return nil, err
+	}
+	tree, files, err := writeDataTree(basePath)
+	if err != nil {
+		return nil, err
+	}
+	report.Files = files
+
+	report.Commit = parent
+	if parent == "" || treeOf(basePath, parent) != tree {
+		args := []string{"commit-tree", tree, "-m", "Update Compass data"}
+		if parent != "" {
+			args = append(args, "-p", parent)
+		}
+		if report.Commit, err = runGit(basePath, nil, args...); err != nil {
+			return nil, err
+		}
+		if _, err := runGit(basePath, nil, "update-ref", opts.Ref, report.Commit, parent); err != nil {
+			return nil, err
+		}
+	}
+
+	if pushed, _ := resolveRef(basePath, opts.trackingRef()); pushed == report.Commit {
+		report.UpToDate = true
+		return report, nil
+	}
+	if _, err := runGit(basePath, nil, "push", "--quiet", opts.Remote, opts.Ref+":"+opts.Ref); err != nil {
+		if strings.Contains(err.Error(), "rejected") || strings.Contains(err.Error(), "fetch first") {
+			return nil, fmt.Errorf("%s has Compass data that is not here yet; run compass sync pull first: %w", opts.Remote, err)
+		}
+		return nil, err
+	}
+	if _, err := runGit(basePath, nil, "update-ref", opts.trackingRef(), report.Commit); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// PullFromGit fetches the remote's sync ref and merges it into the
+// workspace file by file, with the same field-level rules as the compass
+// merge driver. The common ancestor is the last data both sides shared, so
+// local changes that were never pushed are kept. A snapshot is taken before
+// any file changes. With conflicts and no preferred side nothing is written.
+func PullFromGit(basePath string, opts GitSyncOptions) (*domain.GitSync, error) {
+	opts = opts.withDefaults()
+	switch opts.Prefer {
+	case "", PreferOurs, PreferTheirs:
+	default:
+		return nil, fmt.Errorf("invalid prefer value %q: must be %s or %s", opts.Prefer, PreferOurs, PreferTheirs)
+	}
+	if err := checkGitSync(basePath); err != nil {
+		return nil, err
+	}
+	report := &domain.GitSync{Remote: opts.Remote, Ref: opts.Ref, DryRun: opts.DryRun}
+
+	if _, err := runGit(basePath, nil, "fetch", "--quiet", "--no-tags", opts.Remote, "+"+opts.Ref+":"+opts.trackingRef()); err != nil {
+		if strings.Contains(err.Error(), "couldn't find remote ref") {
+			// Nobody has pushed yet
+			report.UpToDate = true
+			return report, nil
+		}
+		return nil, err
+	}
+	theirs, err := resolveRef(basePath, opts.trackingRef())
+	if err != nil {
+		return nil, err
+	}
+	local, err := resolveRef(basePath, opts.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if local != "" && isAncestor(basePath, theirs, local) {
+		report.UpToDate = true
+		report.Commit = local
+		return report, nil
+	}
+	base := ""
+	if local != "" {
+		base, _ = runGit(basePath, nil, "merge-base", local, theirs)
+	}
+
+	unlock, err := lockForSync(basePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	baseFiles, err := treeFiles(basePath, base)
+	if err != nil {
+		return nil, err
+	}
+	theirFiles, err := treeFiles(basePath, theirs)
+	if err != nil {
+		return nil, err
+	}
+	ourPaths, err := dataFiles(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for _, files := range []map[string]string{baseFiles, theirFiles} {
+		for name := range files {
+			// Data pushed by earlier versions can hold files that are
+			// no longer shared
+			if isSharedFile(name) {
+				paths[name] = true
+			}
+		}
+	}
+	for _, name := range ourPaths {
+		paths[name] = true
+	}
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compassDir := filepath.Join(basePath, ".compass")
+	writes := make(map[string][]byte)
+	var deletes []string
+	for _, name := range names {
+		baseSHA, inBase := baseFiles[name]
+		theirSHA, inTheirs := theirFiles[name]
+		if inBase == inTheirs && baseSHA == theirSHA {
+			// They did not touch it
+			continue
+		}
+
+		ours, err := os.ReadFile(filepath.Join(compassDir, filepath.FromSlash(name)))
+		inOurs := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		baseData, err := readBlob(basePath, baseSHA)
+		if err != nil {
+			return nil, err
+		}
+		theirData, err := readBlob(basePath, theirSHA)
+		if err != nil {
+			return nil, err
+		}
+
+		take := func() {
+			if inTheirs {
+				writes[name] = theirData
+			} else {
+				deletes = append(deletes, name)
+			}
+		}
+		switch {
+		case inOurs == inTheirs && bytes.Equal(ours, theirData):
+		case inOurs == inBase && bytes.Equal(ours, baseData):
+			// Only they changed it
+			take()
+		case !inOurs || !inTheirs:
+			// Deleted on one side, changed on the other
+			report.Conflicts = append(report.Conflicts, name+" /")
+			if opts.Prefer == PreferTheirs {
+				take()
+			}
+		default:
+			result, err := merge.Files(name, baseData, ours, theirData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to merge %s: %w", name, err)
+			}
+			if len(result.Conflicts) == 0 {
+				if !bytes.Equal(result.Data, ours) {
+					writes[name] = result.Data
+				}
+				continue
+			}
+			for _, conflict := range result.Conflicts {
+				report.Conflicts = append(report.Conflicts, name+" "+conflict)
+			}
+			if opts.Prefer == PreferTheirs {
+				take()
+			}
+		}
+	}
+
+	// A project is deleted whole or not at all: keeping one of its files
+	// keeps the rest
+	deleted := make(map[string]bool, len(deletes))
+	for _, name := range deletes {
+		deleted[name] = true
+	}
+	kept := make(map[string]bool)
+	for _, name := range ourPaths {
+		if !deleted[name] {
+			kept[projectOf(name)] = true
+		}
+	}
+	for name := range writes {
+		kept[projectOf(name)] = true
+	}
+	remaining := deletes[:0]
+	for _, name := range deletes {
+		if project := projectOf(name); project == "" || !kept[project] {
+			remaining = append(remaining, name)
+		}
+	}
+	deletes = remaining
+
+	// The current project is a local choice
+	if data, ok := writes["config.json"]; ok {
+		if data, err = keepLocalConfig(basePath, data); err != nil {
+			return nil, err
+		}
+		writes["config.json"] = data
+		if local, err := os.ReadFile(filepath.Join(compassDir, "config.json")); err == nil && bytes.Equal(local, data) {
+			delete(writes, "config.json")
+		}
+	}
+
+	for name := range writes {
+		report.Changed = append(report.Changed, name)
+	}
+	sort.Strings(report.Changed)
+	report.Deleted = deletes
+	if opts.DryRun || (len(report.Conflicts) > 0 && opts.Prefer == "") {
+		return report, nil
+	}
+
+	if len(writes) > 0 || len(deletes) > 0 {
+		if report.Safety, err = autoSnapshot(basePath, "sync-pull"); err != nil {
+			return nil, fmt.Errorf("failed to snapshot before pulling: %w", err)
+		}
+	}
+	for _, name := range report.Changed {
+		target := filepath.Join(compassDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(target, writes[name]); err != nil {
+			return nil, fmt.Errorf("pull stopped halfway, the previous state is in %s: %w", report.Safety.Path, err)
+		}
+	}
+	for _, name := range deletes {
+		target := filepath.Join(compassDir, filepath.FromSlash(name))
+		if project := projectOf(name); project != "" {
+			// Also removes the project's empty directories
+			target = filepath.Join(compassDir, "projects", project)
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return nil, fmt.Errorf("pull stopped halfway, the previous state is in %s: %w", report.Safety.Path, err)
+		}
+	}
+
+	// Record the merge, so the next pull starts from here
+	tree, _, err := writeDataTreeLocked(basePath)
+	if err != nil {
+		return nil, err
+	}
+	fastForward := local == "" || isAncestor(basePath, local, theirs)
+	if fastForward && tree == treeOf(basePath, theirs) {
+		report.Commit = theirs
+	} else {
+		args := []string{"commit-tree", tree, "-m", "Merge Compass data from " + opts.Remote}
+		if !fastForward {
+			args = append(args, "-p", local)
+		}
+		args = append(args, "-p", theirs)
+		if report.Commit, err = runGit(basePath, nil, args...); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := runGit(basePath, nil, "update-ref", opts.Ref, report.Commit, local); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// checkGitSync checks the workspace can be synced
+func checkGitSync(basePath string) error {
+	if _, err := runGit(basePath, nil, "rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("not inside a git repository: %w", err)
+	}
+	config, err := ReadConfig(basePath)
+	if err != nil {
+		return err
+	}
+	if config.Storage == BackendSQLite {
+		return fmt.Errorf("compass sync needs the %s storage backend", BackendJSON)
+	}
+	return nil
+}
+
+// lockForSync takes the workspace's write lock and folds the task journals
+// into tasks.json, so until the returned unlock the files alone hold every
+// write
+func lockForSync(basePath string) (func(), error) {
+	fs, err := NewFileStorage(basePath)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.compactAllTasks(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// dataFiles lists the files a sync shares, relative to .compass: what a
+// snapshot holds, less machine-local state and files being written
+func dataFiles(basePath string) ([]string, error) {
+	compassDir := filepath.Join(basePath, ".compass")
+	files, err := snapshotFiles(compassDir, compassDir)
+	if err != nil {
+		return nil, err
+	}
+	shared := files[:0]
+	for _, name := range files {
+		if isSharedFile(name) {
+			shared = append(shared, name)
+		}
+	}
+	return shared, nil
+}
+
+// isSharedFile reports whether a file under .compass is synced. Process
+// logs, task history and processes.json, which holds the PIDs and status
+// of this machine's processes, stay local, as do files being written.
+func isSharedFile(name string) bool {
+	if strings.HasPrefix(name, "sync/") || strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".journal.jsonl") || name == "transaction.json" {
+		return false
+	}
+	if parts := strings.Split(name, "/"); len(parts) >= 3 && parts[0] == "projects" {
+		switch {
+		case len(parts) == 3 && parts[2] == "processes.json":
+			return false
+		case len(parts) > 3 && (parts[2] == "logs" || parts[2] == "history"):
+			return false
+		}
+	}
+	return true
+}
+
+// writeDataTree stores the data files as a git tree, through a private
+// index, and returns the tree and the number of files in it. The journals
+// are folded in under the same lock, so the tree misses no task write.
+func writeDataTree(basePath string) (string, int, error) {
+	unlock, err := lockForSync(basePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer unlock()
+	return writeDataTreeLocked(basePath)
+}
+
+func writeDataTreeLocked(basePath string) (string, int, error) {
+	files, err := dataFiles(basePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	index, err := os.CreateTemp("", "compass-sync-index-*")
+	if err != nil {
+		return "", 0, err
+	}
+	index.Close()
+	os.Remove(index.Name())
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+
+	var entries bytes.Buffer
+	if len(files) > 0 {
+		var paths bytes.Buffer
+		compassDir := filepath.Join(basePath, ".compass")
+		for _, name := range files {
+			paths.WriteString(filepath.Join(compassDir, filepath.FromSlash(name)) + "\n")
+		}
+		hashes, err := runGitInput(basePath, env, &paths, "hash-object", "-w", "--no-filters", "--stdin-paths")
+		if err != nil {
+			return "", 0, err
+		}
+		shas := strings.Split(hashes, "\n")
+		if len(shas) != len(files) {
+			return "", 0, fmt.Errorf("git hash-object returned %d hashes for %d files", len(shas), len(files))
+		}
+		for i, name := range files {
+			fmt.Fprintf(&entries, "100644 %s\t%s\n", shas[i], name)
+		}
+	}
+	if _, err := runGitInput(basePath, env, &entries, "update-index", "--add", "--index-info"); err != nil {
+		return "", 0, err
+	}
+	tree, err := runGit(basePath, env, "write-tree")
+	return tree, len(files), err
+}
+
+// keepLocalConfig keeps this workspace's current project in a pulled
+// config.json
+func keepLocalConfig(basePath string, pulled []byte) ([]byte, error) {
+	local, err := ReadConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(pulled, &config); err != nil {
+		return nil, fmt.Errorf("invalid config.json on the remote: %w", err)
+	}
+	config.CurrentProjectID = local.CurrentProjectID
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// resolveRef returns the commit a ref points to, or "" when it does not exist
+func resolveRef(basePath, ref string) (string, error) {
+	commit, err := runGit(basePath, nil, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		if _, ok := err.(*gitError); ok {
+			return "", nil
+		}
+		return "", err
+	}
+	return commit, nil
+}
+
+func treeOf(basePath, commit string) string {
+	tree, _ := runGit(basePath, nil, "rev-parse", commit+"^{tree}")
+	return tree
+}
+
+func isAncestor(basePath, ancestor, commit string) bool {
+	_, err := runGit(basePath, nil, "merge-base", "--is-ancestor", ancestor, commit)
+	return err == nil
+}
+
+// treeFiles maps every file in a commit's tree to its blob; an empty commit
+// has no files
+func treeFiles(basePath, commit string) (map[string]string, error) {
+	files := make(map[string]string)
+	if commit == "" {
+		return files, nil
+	}
+	listing, err := runGit(basePath, nil, "ls-tree", "-r", "-z", commit)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range strings.Split(listing, "\x00") {
+		// <mode> SP <type> SP <object> TAB <file>
+		meta, name, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		files[name] = fields[2]
+	}
+	return files, nil
+}
+
+func readBlob(basePath, sha string) ([]byte, error) {
+	if sha == "" {
+		return nil, nil
+	}
+	command := exec.Command("git", "-C", basePath, "cat-file", "blob", sha)
+	data, err := command.Output()
+	if err != nil {
+		return nil, newGitError([]string{"cat-file", "blob", sha}, err)
+	}
+	return data, nil
+}
+
+// gitError is a git command that ran and failed
+type gitError struct {
+	args   []string
+	stderr string
+	err    error
+}
+
+func (e *gitError) Error() string {
+	if e.stderr != "" {
+		return fmt.Sprintf("git %s: %s", e.args[0], e.stderr)
+	}
+	return fmt.Sprintf("git %s: %v", e.args[0], e.err)
+}
+
+func (e *gitError) Unwrap() error {
+	return e.err
+}
+
+func newGitError(args []string, err error) error {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return err
+	}
+	return &gitError{args: args, stderr: strings.TrimSpace(string(exitErr.Stderr)), err: err}
+}
+
+func runGit(basePath string, env []string, args ...string) (string, error) {
+	return runGitInput(basePath, env, nil, args...)
+}
+
+func runGitInput(basePath string, env []string, stdin *bytes.Buffer, args ...string) (string, error) {
+	command := exec.Command("git", append([]string{"-C", basePath}, args...)...)
+	command.Env = append(os.Environ(), env...)
+	if stdin != nil {
+		command.Stdin = stdin
+	}
+	output, err := command.Output()
+	if err != nil {
+		return "", newGitError(args, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// projectOf returns the project a data file belongs to, or ""
+func projectOf(name string) string {
+	parts := strings.SplitN(name, "/", 3)
+	if len(parts) < 3 || parts[0] != "projects" {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// gitWorkspace creates a repository with origin pointing at remote
+func gitWorkspace(t *testing.T, remote string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.name", "Compass Test"},
+		{"config", "user.email", "compass@example.com"},
+		{"remote", "add", "origin", remote},
+	} {
+		_, err := runGit(dir, nil, args...)
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+func updateWorkspaceTask(t *testing.T, dir, id string, updates map[string]interface{}) {
+	t.Helper()
+	store, err := NewFileStorage(dir)
+	require.NoError(t, err)
+	_, err = store.UpdateTask(id, updates)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+}
+
+func workspaceTask(t *testing.T, dir, id string) *domain.Task {
+	t.Helper()
+	store, err := NewFileStorage(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	task, err := store.GetTask(id)
+	require.NoError(t, err)
+	return task
+}
+
+func TestGitSync_PushPullMergesFields(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remote := t.TempDir()
+	_, err := runGit(remote, nil, "init", "--quiet", "--bare")
+	require.NoError(t, err)
+	alice := gitWorkspace(t, remote)
+	bob := gitWorkspace(t, remote)
+
+	// Nothing to pull before the first push
+	report, err := PullFromGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.True(t, report.UpToDate)
+
+	store, err := NewFileStorage(alice)
+	require.NoError(t, err)
+	project := domain.NewProject("Shared", "", "")
+	require.NoError(t, store.CreateProject(project))
+	require.NoError(t, store.SetCurrentProject(project.ID))
+	task := domain.NewTask(project.ID, "Draft the plan", "")
+	require.NoError(t, store.CreateTask(task))
+	require.NoError(t, store.Close())
+
+	report, err = PushToGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, report.Commit)
+	assert.Greater(t, report.Files, 0)
+	pushed, err := resolveRef(remote, DefaultSyncRef)
+	require.NoError(t, err)
+	assert.Equal(t, report.Commit, pushed)
+	tracked, err := runGit(alice, nil, "ls-files")
+	require.NoError(t, err)
+	assert.Empty(t, tracked, "the repository's index is not touched")
+
+	report, err = PushToGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.True(t, report.UpToDate)
+
+	report, err = PullFromGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, report.Changed, "projects/"+project.ID+"/tasks.json")
+	assert.Equal(t, "Draft the plan", workspaceTask(t, bob, task.ID).Card.Title)
+	config, err := ReadConfig(bob)
+	require.NoError(t, err)
+	assert.Nil(t, config.CurrentProjectID, "the current project stays local")
+
+	// Different fields edited on both sides merge
+	updateWorkspaceTask(t, bob, task.ID, map[string]interface{}{"title": "Write the plan"})
+	updateWorkspaceTask(t, alice, task.ID, map[string]interface{}{"priority": domain.PriorityHigh})
+	_, err = PushToGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+	_, err = PushToGit(alice, GitSyncOptions{})
+	assert.ErrorContains(t, err, "run compass sync pull first")
+
+	report, err = PullFromGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Conflicts)
+	require.NotNil(t, report.Safety)
+	merged := workspaceTask(t, alice, task.ID)
+	assert.Equal(t, "Write the plan", merged.Card.Title)
+	assert.Equal(t, domain.PriorityHigh, merged.Card.Priority)
+	config, err = ReadConfig(alice)
+	require.NoError(t, err)
+	assert.Equal(t, project.ID, *config.CurrentProjectID)
+
+	_, err = PushToGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	_, err = PullFromGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, domain.PriorityHigh, workspaceTask(t, bob, task.ID).Card.Priority)
+
+	// The same field edited on both sides keeps the later edit
+	updateWorkspaceTask(t, bob, task.ID, map[string]interface{}{"description": "Bob's notes"})
+	updateWorkspaceTask(t, alice, task.ID, map[string]interface{}{"description": "Alice's notes"})
+	_, err = PushToGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+	report, err = PullFromGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Conflicts)
+	assert.Equal(t, "Alice's notes", workspaceTask(t, alice, task.ID).Card.Description)
+	_, err = PushToGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	_, err = PullFromGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+
+	// A file deleted on one side and changed on the other stops the pull
+	// until a side is preferred
+	require.NoError(t, os.RemoveAll(filepath.Join(bob, ".compass", "projects", project.ID)))
+	_, err = PushToGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+	updateWorkspaceTask(t, alice, task.ID, map[string]interface{}{"status": domain.StatusInProgress})
+	report, err = PullFromGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, report.Conflicts, "projects/"+project.ID+"/tasks.json /")
+	assert.Nil(t, report.Safety, "nothing is written")
+	assert.Equal(t, domain.StatusInProgress, workspaceTask(t, alice, task.ID).Card.Status)
+
+	report, err = PullFromGit(alice, GitSyncOptions{Prefer: PreferOurs})
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusInProgress, workspaceTask(t, alice, task.ID).Card.Status)
+	_, err = PushToGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	report, err = PullFromGit(bob, GitSyncOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Conflicts)
+	assert.Equal(t, domain.StatusInProgress, workspaceTask(t, bob, task.ID).Card.Status)
+
+	_, err = PullFromGit(alice, GitSyncOptions{Prefer: "mine"})
+	assert.Error(t, err)
+}
+
+func TestGitSync_PushKeepsMachineStateLocal(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remote := t.TempDir()
+	_, err := runGit(remote, nil, "init", "--quiet", "--bare")
+	require.NoError(t, err)
+	alice := gitWorkspace(t, remote)
+
+	store, err := NewFileStorage(alice)
+	require.NoError(t, err)
+	project := domain.NewProject("Shared", "", "")
+	require.NoError(t, store.CreateProject(project))
+	task := domain.NewTask(project.ID, "Draft the plan", "")
+	require.NoError(t, store.CreateTask(task))
+	process := domain.NewProcess(project.ID, "api", "go", []string{"run", "."})
+	process.PID = 4242
+	require.NoError(t, store.SaveProcess(project.ID, process))
+	require.NoError(t, store.SaveProcessLogs([]*domain.ProcessLog{{ID: "log-1", ProcessID: process.ID, Type: domain.LogTypeStdout, Message: "listening"}}))
+	// Left in the journal: the store is still open
+	_, err = store.UpdateTask(task.ID, map[string]interface{}{"title": "Write the plan"})
+	require.NoError(t, err)
+
+	report, err := PushToGit(alice, GitSyncOptions{})
+	require.NoError(t, err)
+	files, err := treeFiles(alice, report.Commit)
+	require.NoError(t, err)
+	projectDir := "projects/" + project.ID + "/"
+	assert.Contains(t, files, projectDir+"tasks.json")
+	for name := range files {
+		assert.NotContains(t, name, projectDir+"logs/")
+		assert.NotContains(t, name, projectDir+"history/")
+		assert.NotEqual(t, projectDir+"processes.json", name)
+	}
+
+	pushed, err := readBlob(alice, files[projectDir+"tasks.json"])
+	require.NoError(t, err)
+	assert.Contains(t, string(pushed), "Write the plan", "the journal is folded in before the push")
+}
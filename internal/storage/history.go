@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Task history is an append-only JSON Lines file per project. Each line is a
+// full snapshot of a task after a change, which is what time-travel reads
+// replay to rebuild past state.
+
+func (fs *FileStorage) taskHistoryPath(projectID string) string {
+	return filepath.Join(fs.projectDir(projectID), "history", "tasks.jsonl")
+}
+
+// recordTaskRevision appends a revision to the project's task history. The
+// task change itself has already been saved, so failures are logged rather
+// than returned.
+func (fs *FileStorage) recordTaskRevision(op domain.RevisionOp, task *domain.Task) {
+	if fs.tx != nil {
+		fs.tx.revisions = append(fs.tx.revisions, domain.NewTaskRevision(op, task))
+		return
+	}
+	if err := fs.appendTaskRevision(domain.NewTaskRevision(op, task)); err != nil {
+		log.Printf("FileStorage: failed to record task history for %s: %v", task.ID, err)
+	}
+}
+
+func (fs *FileStorage) appendTaskRevision(revision *domain.TaskRevision) error {
+	path := fs.taskHistoryPath(revision.ProjectID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// ListTaskRevisions returns the recorded task history for a project, or for
+// every project when projectID is empty
+func (fs *FileStorage) ListTaskRevisions(projectID string) ([]*domain.TaskRevision, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	projectIDs := []string{projectID}
+	if projectID == "" {
+		projects, err := fs.listProjectsUnlocked()
+		if err != nil {
+			return nil, err
+		}
+		projectIDs = projectIDs[:0]
+		for _, project := range projects {
+			projectIDs = append(projectIDs, project.ID)
+		}
+	}
+
+	var revisions []*domain.TaskRevision
+	for _, id := range projectIDs {
+		projectRevisions, err := fs.loadTaskRevisions(id)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, projectRevisions...)
+	}
+	return revisions, nil
+}
+
+func (fs *FileStorage) loadTaskRevisions(projectID string) ([]*domain.TaskRevision, error) {
+	file, err := os.Open(fs.taskHistoryPath(projectID))
+	if os.IsNotExist(err) {
+		return fs.withStagedRevisions(projectID, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var revisions []*domain.TaskRevision
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var revision domain.TaskRevision
+		if err := json.Unmarshal(scanner.Bytes(), &revision); err != nil {
+			// A crash can leave a partial last line; skip it rather than
+			// losing the rest of the history
+			log.Printf("FileStorage: skipping unreadable task history line %d for project %s: %v", line, projectID, err)
+			continue
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read task history for project %s: %w", projectID, err)
+	}
+	return fs.withStagedRevisions(projectID, revisions), nil
+}
+
+// ListTaskRevisions returns the recorded task history for a project, or for
+// every project when projectID is empty
+func (ms *MemoryStorage) ListTaskRevisions(projectID string) ([]*domain.TaskRevision, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var revisions []*domain.TaskRevision
+	for _, revision := range ms.revisions {
+		if projectID == "" || revision.ProjectID == projectID {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions, nil
+}
+
+// withStagedRevisions adds the project's revisions staged by a transaction
+func (fs *FileStorage) withStagedRevisions(projectID string, revisions []*domain.TaskRevision) []*domain.TaskRevision {
+	if fs.tx == nil {
+		return revisions
+	}
+	for _, revision := range fs.tx.revisions {
+		if revision.ProjectID == projectID {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions
+}
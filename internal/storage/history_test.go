@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+func TestFileStorage_TaskHistory(t *testing.T) {
+	storage, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+
+	project := domain.NewProject("Test Project", "A test project", "Test goal")
+	require.NoError(t, storage.CreateProject(project))
+
+	task := domain.NewTask(project.ID, "Test Task", "A test task")
+	require.NoError(t, storage.CreateTask(task))
+	_, err = storage.UpdateTask(task.ID, map[string]interface{}{"title": "Renamed Task"})
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteTask(task.ID))
+
+	// A torn final line from a crash must not hide earlier revisions
+	file, err := os.OpenFile(storage.taskHistoryPath(project.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"at":"2024-01-01T00:00:00Z","op":"upd`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	revisions, err := storage.ListTaskRevisions(project.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, domain.RevisionCreate, revisions[0].Op)
+	assert.Equal(t, "Test Task", revisions[0].Task.Card.Title)
+	assert.Equal(t, domain.RevisionUpdate, revisions[1].Op)
+	assert.Equal(t, "Renamed Task", revisions[1].Task.Card.Title)
+	assert.Equal(t, domain.RevisionDelete, revisions[2].Op)
+	assert.Nil(t, revisions[2].Task)
+
+	all, err := storage.ListTaskRevisions("")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// In the single-file layout task writes do not rewrite tasks.json. Each
+// change is appended as one line to the project's task journal and applied
+// to the cached tasks, so a write costs the same however many tasks the
+// project has. tasks.json is a snapshot: the current tasks are the snapshot
+// with the journal replayed on top.
+//
+// Compaction folds the journal into a new snapshot and then removes the
+// journal. It runs once the journal reaches compactionThreshold, when the
+// storage is opened (replaying whatever a crashed process left behind) and
+// when it is closed. Replaying an entry twice gives the same result, so a
+// crash between writing the snapshot and removing the journal loses nothing.
+//
+// Readers load the journal before the snapshot. A concurrent compaction can
+// then only make them replay entries the new snapshot already contains.
+
+// journalCompactEntries is the fewest journal entries that trigger a
+// compaction
+var journalCompactEntries = 512
+
+// compactionThreshold grows with the project so that the cost of rewriting
+// the snapshot, spread over the writes since the last one, stays constant
+func compactionThreshold(tasks int) int {
+	if tasks > journalCompactEntries {
+		return tasks
+	}
+	return journalCompactEntries
+}
+
+const (
+	journalPut    = "put"
+	journalDelete = "delete"
+)
+
+type journalEntry struct {
+	Op   string       `json:"op"`
+	ID   string       `json:"id"`
+	Task *domain.Task `json:"task,omitempty"`
+}
+
+func (fs *FileStorage) taskJournalPath(projectID string) string {
+	return filepath.Join(fs.projectDir(projectID), "tasks.journal.jsonl")
+}
+
+// readJournal returns the complete entries in the journal at path. A final
+// line without a newline is a write still in progress, or one cut short by
+// a crash, and is ignored.
+func readJournal(path string) ([]journalEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if end := bytes.LastIndexByte(data, '\n'); end >= 0 {
+		data = data[:end+1]
+	} else {
+		data = nil
+	}
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || !entry.valid() {
+			log.Printf("FileStorage: skipping unreadable entry on line %d of %s", line, path)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (e journalEntry) valid() bool {
+	switch e.Op {
+	case journalPut:
+		return e.Task != nil && e.Task.ID == e.ID
+	case journalDelete:
+		return e.ID != ""
+	}
+	return false
+}
+
+func (e journalEntry) apply(index *taskIndex) {
+	if e.Op == journalPut {
+		index.add(e.Task)
+	} else {
+		index.remove(e.ID)
+	}
+}
+
+// appendJournal adds entry to the journal at path and returns the journal's
+// new file info. A partial line left by a crashed writer is cut off first so
+// the new entry starts on a line of its own.
+func appendJournal(path string, entry journalEntry) (os.FileInfo, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := trimTornTail(file); err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	return file.Stat()
+}
+
+func trimTornTail(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, info.Size()))
+	if err != nil {
+		return err
+	}
+	return file.Truncate(int64(bytes.LastIndexByte(data, '\n') + 1))
+}
+
+// commitTask makes a task change durable and applies it to the cached
+// tasks. The caller holds the write lock.
+func (fs *FileStorage) commitTask(projectID string, entry journalEntry) error {
+	cached, err := fs.cachedTasks(projectID)
+	if err != nil {
+		return err
+	}
+
+	if fs.tx != nil {
+		entry.apply(cached.index)
+		fs.tx.entries = append(fs.tx.entries, txTaskEntry{ProjectID: projectID, Entry: entry})
+		return nil
+	}
+
+	if fs.perEntity() {
+		dir := fs.entityDir(projectID, tasksDir)
+		if entry.Op == journalPut {
+			err = saveEntity(dir, entry.ID, entry.Task)
+		} else {
+			err = removeEntity(dir, entry.ID)
+		}
+		if err != nil {
+			fs.invalidateTasks(projectID)
+			return err
+		}
+		entry.apply(cached.index)
+		cached.snapshot = stampFile(fs.tasksPath(projectID))
+		return nil
+	}
+
+	info, err := appendJournal(fs.taskJournalPath(projectID), entry)
+	if err != nil {
+		fs.invalidateTasks(projectID)
+		return err
+	}
+	entry.apply(cached.index)
+	cached.journal = newFileStamp(info)
+	cached.journalEntries++
+
+	if cached.journalEntries >= compactionThreshold(len(cached.index.byID)) {
+		// The change itself is already safe in the journal
+		if err := fs.compactTasks(projectID); err != nil {
+			log.Printf("FileStorage: failed to compact task journal for project %s: %v", projectID, err)
+		}
+	}
+	return nil
+}
+
+// compactTasks writes the project's current tasks to a new tasks.json and
+// removes the journal. The caller holds the write lock.
+func (fs *FileStorage) compactTasks(projectID string) error {
+	if fs.perEntity() {
+		return nil
+	}
+	cached, err := fs.cachedTasks(projectID)
+	if err != nil {
+		return err
+	}
+	if cached.journal.info == nil {
+		return nil
+	}
+
+	// The cache already holds exactly what is written, so it stays valid
+	if err := fs.saveList(fs.tasksPath(projectID), cached.list()); err != nil {
+		return err
+	}
+	if err := os.Remove(fs.taskJournalPath(projectID)); err != nil && !os.IsNotExist(err) {
+		fs.invalidateTasks(projectID)
+		return err
+	}
+	cached.snapshot = stampFile(fs.tasksPath(projectID))
+	cached.journal = fileStamp{}
+	cached.journalEntries = 0
+	return nil
+}
+
+// compactAllTasks compacts every project with a journal. The caller holds
+// the write lock.
+func (fs *FileStorage) compactAllTasks() error {
+	projects, err := fs.listProjectsUnlocked()
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		if _, err := os.Stat(fs.taskJournalPath(project.ID)); os.IsNotExist(err) {
+			continue
+		}
+		if err := fs.compactTasks(project.ID); err != nil {
+			return fmt.Errorf("project %s: %w", project.ID, err)
+		}
+	}
+	return nil
+}
+
+// Compact folds every task journal into its tasks.json snapshot, leaving
+// the workspace in a state that is convenient to commit
+func (fs *FileStorage) Compact() error {
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fs.compactAllTasks()
+}
+
+// Close compacts the task journals. The storage remains usable.
+func (fs *FileStorage) Close() error {
+	return fs.Compact()
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+func newJournalFixture(t testing.TB) (*FileStorage, *domain.Project) {
+	fs, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	project := domain.NewProject("Journal", "Append-only writes", "Constant write cost")
+	require.NoError(t, fs.CreateProject(project))
+	return fs, project
+}
+
+func journalLines(t *testing.T, fs *FileStorage, projectID string) int {
+	t.Helper()
+	data, err := os.ReadFile(fs.taskJournalPath(projectID))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestFileStorage_TaskWritesGoToJournal(t *testing.T) {
+	fs, project := newJournalFixture(t)
+
+	task := domain.NewTask(project.ID, "Journaled", "")
+	require.NoError(t, fs.CreateTask(task))
+	_, err := fs.UpdateTask(task.ID, map[string]interface{}{"title": "Journaled twice"})
+	require.NoError(t, err)
+	doomed := domain.NewTask(project.ID, "Deleted", "")
+	require.NoError(t, fs.CreateTask(doomed))
+	require.NoError(t, fs.DeleteTask(doomed.ID))
+
+	assert.Equal(t, 4, journalLines(t, fs, project.ID))
+	assert.NoFileExists(t, fs.tasksPath(project.ID), "writes must not rewrite the snapshot")
+
+	// Another instance sees the journaled state without compacting it away
+	other := &FileStorage{basePath: fs.basePath, layout: fs.layout, circuitBreaker: fs.circuitBreaker, taskCache: make(map[string]*projectTasks)}
+	got, err := other.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Journaled twice", got.Card.Title)
+	_, err = other.GetTask(doomed.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, fs.Close())
+	assert.NoFileExists(t, fs.taskJournalPath(project.ID))
+	var snapshot []*domain.Task
+	require.NoError(t, fs.loadList(fs.tasksPath(project.ID), &snapshot))
+	require.Len(t, snapshot, 1)
+	assert.Equal(t, "Journaled twice", snapshot[0].Card.Title)
+
+	got, err = fs.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Journaled twice", got.Card.Title)
+}
+
+func TestFileStorage_JournalCompactsAtThreshold(t *testing.T) {
+	previous := journalCompactEntries
+	journalCompactEntries = 4
+	t.Cleanup(func() { journalCompactEntries = previous })
+
+	fs, project := newJournalFixture(t)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, fs.CreateTask(domain.NewTask(project.ID, fmt.Sprintf("Task %d", i), "")))
+	}
+
+	assert.Equal(t, 1, journalLines(t, fs, project.ID))
+	var snapshot []*domain.Task
+	require.NoError(t, fs.loadList(fs.tasksPath(project.ID), &snapshot))
+	assert.Len(t, snapshot, 4)
+
+	tasks, err := fs.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 5)
+}
+
+func TestNewFileStorage_ReplaysJournalAfterCrash(t *testing.T) {
+	fs, project := newJournalFixture(t)
+	kept := domain.NewTask(project.ID, "Survives", "")
+	require.NoError(t, fs.CreateTask(kept))
+	require.NoError(t, fs.Compact())
+
+	// A crashed process left entries behind, including one already in the
+	// snapshot and a final write cut off halfway
+	renamed := kept.Clone()
+	renamed.Card.Title = "Renamed before the crash"
+	added := domain.NewTask(project.ID, "Added before the crash", "")
+	for _, entry := range []journalEntry{
+		{Op: journalPut, ID: kept.ID, Task: kept},
+		{Op: journalPut, ID: kept.ID, Task: renamed},
+		{Op: journalPut, ID: added.ID, Task: added},
+	} {
+		_, err := appendJournal(fs.taskJournalPath(project.ID), entry)
+		require.NoError(t, err)
+	}
+	file, err := os.OpenFile(fs.taskJournalPath(project.ID), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"delete","id":"` + kept.ID)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	recovered, err := NewFileStorage(fs.basePath)
+	require.NoError(t, err)
+	assert.NoFileExists(t, recovered.taskJournalPath(project.ID))
+
+	tasks, err := recovered.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Renamed before the crash", "Added before the crash"}, titles(tasks))
+}
+
+func TestAppendJournal_CutsTornTail(t *testing.T) {
+	path := t.TempDir() + "/journal.jsonl"
+	require.NoError(t, os.WriteFile(path, []byte("{\"op\":\"delete\",\"id\":\"a\"}\n{\"op\":\"del"), 0644))
+
+	_, err := appendJournal(path, journalEntry{Op: journalDelete, ID: "b"})
+	require.NoError(t, err)
+
+	entries, err := readJournal(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "a", entries[0].ID)
+	assert.Equal(t, "b", entries[1].ID)
+}
+
+func titles(tasks []*domain.Task) []string {
+	names := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		names = append(names, task.Card.Title)
+	}
+	return names
+}
+
+// BenchmarkFileStorage_UpdateTask shows that the cost of a task update does
+// not grow with the number of tasks in the project
+func BenchmarkFileStorage_UpdateTask(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("tasks=%d", size), func(b *testing.B) {
+			fs, project := newJournalFixture(b)
+			tasks := make([]*domain.Task, size)
+			for i := range tasks {
+				tasks[i] = domain.NewTask(project.ID, fmt.Sprintf("Task %d", i), "")
+			}
+			require.NoError(b, fs.saveTasks(project.ID, tasks))
+			target := tasks[size/2].ID
+			_, err := fs.GetTask(target)
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := fs.UpdateTask(target, map[string]interface{}{"description": fmt.Sprintf("revision %d", i)}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFileStorage_CreateTask measures appending tasks to projects of
+// different sizes. The cache is primed first so only the appends are timed,
+// not decoding the project once.
+func BenchmarkFileStorage_CreateTask(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("tasks=%d", size), func(b *testing.B) {
+			fs, project := newJournalFixture(b)
+			tasks := make([]*domain.Task, size)
+			for i := range tasks {
+				tasks[i] = domain.NewTask(project.ID, fmt.Sprintf("Task %d", i), "")
+			}
+			require.NoError(b, fs.saveTasks(project.ID, tasks))
+			listed, err := fs.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := fs.CreateTask(domain.NewTask(project.ID, "New task", "")); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(listed)), "tasks/project")
+		})
+	}
+}
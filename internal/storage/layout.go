@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File layouts for the JSON backend, selected through the "layout" key of
+// config.json. The single-file layout keeps each project's tasks,
+// discoveries and decisions in one list file apiece; the per-entity layout
+// gives every one of them its own file so that branches touching different
+// entities merge without conflicts.
+const (
+	LayoutSingleFile = "single-file"
+	LayoutPerEntity  = "per-entity"
+)
+
+// Directories holding one file per entity in the per-entity layout
+const (
+	tasksDir       = "tasks"
+	discoveriesDir = "discoveries"
+	decisionsDir   = "decisions"
+)
+
+func parseLayout(layout string) (string, error) {
+	switch layout {
+	case "", LayoutSingleFile:
+		return LayoutSingleFile, nil
+	case LayoutPerEntity:
+		return LayoutPerEntity, nil
+	default:
+		return "", fmt.Errorf("unknown storage layout %q (expected %q or %q)", layout, LayoutSingleFile, LayoutPerEntity)
+	}
+}
+
+func (fs *FileStorage) perEntity() bool {
+	return fs.layout == LayoutPerEntity
+}
+
+func (fs *FileStorage) entityDir(projectID, kind string) string {
+	return filepath.Join(fs.projectDir(projectID), kind)
+}
+
+func entityPath(dir, id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("ID %q cannot be used as a file name", id)
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// encodeEntity renders an entity file. Keys follow the struct field order
+// and the indentation never varies, so unchanged entities always produce
+// byte-identical files and diffs only show the fields that moved.
+func encodeEntity(value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err = stampObject(data, CurrentSchemaVersion)
+	return data, err
+}
+
+func decodeEntity(data []byte, target interface{}) error {
+	var header struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if err := checkSchemaVersion(header.SchemaVersion); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func saveEntity(dir, id string, value interface{}) error {
+	path, err := entityPath(dir, id)
+	if err != nil {
+		return err
+	}
+	data, err := encodeEntity(value)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func removeEntity(dir, id string) error {
+	path, err := entityPath(dir, id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// loadEntities decodes every entity file in dir, in file name order,
+// including the files tx staged. A missing directory holds no entities.
+func loadEntities[T any](tx *fileTx, dir string) ([]*T, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			if _, ok := tx.staged(filepath.Join(dir, entry.Name())); !ok {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	if tx != nil {
+		for path, file := range tx.files {
+			if !file.removed && filepath.Dir(path) == dir && strings.HasSuffix(path, ".json") {
+				names = append(names, filepath.Base(path))
+			}
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]*T, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		var data []byte
+		if file, ok := tx.staged(path); ok {
+			data = file.data
+		} else if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+		var value T
+		if err := decodeEntity(bytes.TrimSpace(data), &value); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		result = append(result, &value)
+	}
+	return result, nil
+}
+
+// LayoutMigration reports what MigrateLayout converted
+type LayoutMigration struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Projects    int    `json:"projects"`
+	Tasks       int    `json:"tasks"`
+	Discoveries int    `json:"discoveries"`
+	Decisions   int    `json:"decisions"`
+	Backup      string `json:"backup,omitempty"`
+}
+
+// MigrateLayout rewrites the JSON workspace under basePath into the given
+// layout and records it in config.json. The files are backed up under
+// .compass/backups first, and the old files are only removed once the new
+// ones and the config are in place. Servers running against the workspace
+// must be restarted to pick up the new layout.
+func MigrateLayout(basePath, layout string) (*LayoutMigration, error) {
+	to, err := parseLayout(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := ReadConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+	if config.Storage == BackendSQLite {
+		return nil, fmt.Errorf("workspace uses the %s backend; layouts only apply to %s", BackendSQLite, BackendJSON)
+	}
+
+	src, err := NewFileStorage(basePath)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := src.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Opening the storage may have created or migrated config.json
+	config, err = ReadConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LayoutMigration{From: src.layout, To: to}
+	if src.layout == to {
+		return report, nil
+	}
+
+	snapshot, err := autoSnapshot(basePath, "layout-"+src.layout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up before changing layout: %w", err)
+	}
+	report.Backup = snapshot.Path
+
+	dst := &FileStorage{
+		basePath:       basePath,
+		layout:         to,
+		circuitBreaker: NewCircuitBreaker(3, 30*time.Second),
+		taskCache:      make(map[string]*projectTasks),
+	}
+
+	projects, err := src.listProjectsUnlocked()
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		tasks, err := src.loadTasks(project.ID)
+		if err != nil {
+			return nil, fmt.Errorf("project %s tasks: %w", project.ID, err)
+		}
+		discoveries, err := src.loadDiscoveries(project.ID)
+		if err != nil {
+			return nil, fmt.Errorf("project %s discoveries: %w", project.ID, err)
+		}
+		decisions, err := src.loadDecisions(project.ID)
+		if err != nil {
+			return nil, fmt.Errorf("project %s decisions: %w", project.ID, err)
+		}
+
+		if err := dst.saveTasks(project.ID, tasks); err != nil {
+			return nil, err
+		}
+		if err := dst.saveDiscoveries(project.ID, discoveries); err != nil {
+			return nil, err
+		}
+		if err := dst.saveDecisions(project.ID, decisions); err != nil {
+			return nil, err
+		}
+
+		report.Projects++
+		report.Tasks += len(tasks)
+		report.Discoveries += len(discoveries)
+		report.Decisions += len(decisions)
+	}
+
+	config.Layout = to
+	if err := WriteConfig(basePath, config); err != nil {
+		return nil, err
+	}
+
+	for _, project := range projects {
+		if err := src.removeLayoutFiles(project.ID); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// removeLayoutFiles deletes the files that hold a project's tasks,
+// discoveries and decisions in this storage's layout
+func (fs *FileStorage) removeLayoutFiles(projectID string) error {
+	if fs.perEntity() {
+		for _, kind := range []string{tasksDir, discoveriesDir, decisionsDir} {
+			if err := os.RemoveAll(fs.entityDir(projectID, kind)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, name := range []string{"tasks.json", "tasks.journal.jsonl", "discoveries.json", "decisions.json"} {
+		if err := os.Remove(filepath.Join(fs.projectDir(projectID), name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+func TestMigrateLayout_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	project := domain.NewProject("Layout", "Split files", "Merge cleanly")
+	require.NoError(t, fs.CreateProject(project))
+	first := domain.NewTask(project.ID, "First", "")
+	second := domain.NewTask(project.ID, "Second", "")
+	require.NoError(t, fs.CreateTask(first))
+	require.NoError(t, fs.CreateTask(second))
+	require.NoError(t, fs.CreateDiscovery(domain.NewDiscovery(project.ID, "Files merge", domain.ImpactHigh, domain.SourceResearch)))
+	require.NoError(t, fs.CreateDecision(domain.NewDecision(project.ID, "Layout?", "per-entity", "Fewer conflicts", nil, true)))
+
+	report, err := MigrateLayout(dir, LayoutPerEntity)
+	require.NoError(t, err)
+	assert.Equal(t, LayoutSingleFile, report.From)
+	assert.Equal(t, 2, report.Tasks)
+	assert.Equal(t, 1, report.Discoveries)
+	assert.Equal(t, 1, report.Decisions)
+	assert.Contains(t, snapshotNames(t, report.Backup), "projects/"+project.ID+"/tasks.json")
+
+	projectDir := filepath.Join(dir, ".compass", "projects", project.ID)
+	assert.NoFileExists(t, filepath.Join(projectDir, "tasks.json"))
+	assert.FileExists(t, filepath.Join(projectDir, "tasks", first.ID+".json"))
+	config, err := ReadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, LayoutPerEntity, config.Layout)
+
+	split, err := NewFileStorage(dir)
+	require.NoError(t, err)
+	tasks, err := split.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	// Updating one task leaves the other task's file untouched
+	secondPath := filepath.Join(projectDir, "tasks", second.ID+".json")
+	before, err := os.ReadFile(secondPath)
+	require.NoError(t, err)
+	_, err = split.UpdateTask(first.ID, map[string]interface{}{"title": "First, renamed"})
+	require.NoError(t, err)
+	after, err := os.ReadFile(secondPath)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	require.NoError(t, split.DeleteTask(second.ID))
+	assert.NoFileExists(t, secondPath)
+
+	report, err = MigrateLayout(dir, LayoutSingleFile)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Tasks)
+	assert.NoDirExists(t, filepath.Join(projectDir, "tasks"))
+
+	single, err := NewFileStorage(dir)
+	require.NoError(t, err)
+	got, err := single.GetTask(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First, renamed", got.Card.Title)
+	discoveries, err := single.ListDiscoveries(project.ID)
+	require.NoError(t, err)
+	assert.Len(t, discoveries, 1)
+}
+
+func TestEncodeEntity_IsStable(t *testing.T) {
+	task := domain.NewTask("p1", "Stable", "Same bytes every time")
+	task.Card.Labels = []string{"b", "a"}
+
+	first, err := encodeEntity(task)
+	require.NoError(t, err)
+	second, err := encodeEntity(task.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Contains(t, string(first), "{\n  \"schemaVersion\": ")
+	assert.Equal(t, byte('\n'), first[len(first)-1])
+}
+
+func TestEntityPath_RejectsUnsafeIDs(t *testing.T) {
+	for _, id := range []string{"", ".", "..", "a/b", `a\b`} {
+		_, err := entityPath("dir", id)
+		assert.Error(t, err, id)
+	}
+}
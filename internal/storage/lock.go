@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LockPath is the advisory lock file every compass process writing the JSON
+// layout under basePath takes before a read-modify-write cycle
+func LockPath(basePath string) string {
+	return filepath.Join(basePath, ".compass", ".lock")
+}
+
+// lockForWrite serializes a write against this process's other goroutines
+// and against other processes sharing the workspace. Reads only take the
+// in-process lock: every file is replaced by an atomic rename, so a reader
+// always sees either the old or the new contents.
+func (fs *FileStorage) lockForWrite() (func(), error) {
+	fs.mu.Lock()
+	if fs.tx != nil {
+		// The transaction already holds the workspace lock
+		return fs.mu.Unlock, nil
+	}
+
+	unlock, err := lockWorkspace(fs.basePath)
+	if err != nil {
+		fs.mu.Unlock()
+		return nil, err
+	}
+
+	// The layout is only known once initialize has read the config, and
+	// initialize recovers on its own
+	if fs.layout != "" {
+		if err := fs.recoverTransaction(); err != nil {
+			unlock()
+			fs.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	return func() {
+		unlock()
+		fs.mu.Unlock()
+	}, nil
+}
+
+// lockWorkspace takes only the cross-process lock, for operations that work
+// on the files directly rather than through a FileStorage. It must not be
+// called while a FileStorage in the same process holds its write lock.
+func lockWorkspace(basePath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(LockPath(basePath)), 0755); err != nil {
+		return nil, fmt.Errorf("failed to open storage lock: %w", err)
+	}
+	file, err := os.OpenFile(LockPath(basePath), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage lock: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to acquire storage lock: %w", err)
+	}
+
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// Advisory locking is only implemented on unix; elsewhere writers are
+// serialized within a process only
+func lockFile(file *os.File) error { return nil }
+
+func unlockFile(file *os.File) error { return nil }
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Two FileStorage instances on one workspace stand in for two compass
+// processes: they share nothing but the files and the advisory lock
+func TestFileStorage_SharedWorkspaceLosesNoWrites(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewFileStorage(dir)
+	require.NoError(t, err)
+	second, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	project := domain.NewProject("Shared", "Two servers", "Lose nothing")
+	require.NoError(t, first.CreateProject(project))
+
+	const perStore = 20
+	var wg sync.WaitGroup
+	for i, store := range []*FileStorage{first, second} {
+		wg.Add(1)
+		go func(i int, store *FileStorage) {
+			defer wg.Done()
+			for n := 0; n < perStore; n++ {
+				task := domain.NewTask(project.ID, fmt.Sprintf("store %d task %d", i, n), "")
+				assert.NoError(t, store.CreateTask(task))
+			}
+		}(i, store)
+	}
+	wg.Wait()
+
+	for _, store := range []*FileStorage{first, second} {
+		tasks, err := store.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+		require.NoError(t, err)
+		assert.Len(t, tasks, 2*perStore)
+	}
+}
+
+func TestFileStorage_StaleVersionFromOtherInstance(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewFileStorage(dir)
+	require.NoError(t, err)
+	second, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	project := domain.NewProject("Shared", "Two servers", "Detect conflicts")
+	require.NoError(t, first.CreateProject(project))
+	task := domain.NewTask(project.ID, "Contested", "")
+	require.NoError(t, first.CreateTask(task))
+
+	// Both read version 1; the second instance writes first
+	_, err = second.GetTask(task.ID)
+	require.NoError(t, err)
+	_, err = second.UpdateTask(task.ID, map[string]interface{}{"title": "Second", "version": 1})
+	require.NoError(t, err)
+
+	_, err = first.UpdateTask(task.ID, map[string]interface{}{"title": "First", "version": 1})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	got, err := first.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Second", got.Card.Title)
+	assert.Equal(t, 2, got.Version)
+}
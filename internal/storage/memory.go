@@ -1,15 +1,15 @@
 package storage
 
 import (
-	"fmt"
 	"sync"
+	"time"
 
 	"github.com/rcliao/compass/internal/domain"
 )
 
 type MemoryStorage struct {
 	mu           sync.RWMutex
-	tasks        map[string]*domain.Task
+	tasks        *taskIndex
 	projects     map[string]*domain.Project
 	discoveries  map[string]*domain.Discovery
 	decisions    map[string]*domain.Decision
@@ -17,12 +17,15 @@ type MemoryStorage struct {
 	processes    map[string]*domain.Process
 	processGroups map[string]*domain.ProcessGroup
 	processLogs  map[string][]*domain.ProcessLog
+	revisions    []*domain.TaskRevision
 	currentProject *string
+	// inTx marks the copy a Transaction callback works on
+	inTx bool
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		tasks:       make(map[string]*domain.Task),
+		tasks:       newTaskIndex(),
 		projects:    make(map[string]*domain.Project),
 		discoveries: make(map[string]*domain.Discovery),
 		decisions:   make(map[string]*domain.Decision),
@@ -38,11 +41,13 @@ func (ms *MemoryStorage) CreateTask(task *domain.Task) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 	
-	if _, exists := ms.tasks[task.ID]; exists {
-		return fmt.Errorf("task with ID %s already exists", task.ID)
+	if _, exists := ms.tasks.byID[task.ID]; exists {
+		return conflict("task", task.ID)
 	}
 	
-	ms.tasks[task.ID] = task
+	// Store a copy so later changes by the caller can't bypass the indexes
+	ms.tasks.add(task.Clone())
+	ms.revisions = append(ms.revisions, domain.NewTaskRevision(domain.RevisionCreate, task))
 	return nil
 }
 
@@ -50,73 +55,52 @@ func (ms *MemoryStorage) UpdateTask(id string, updates map[string]interface{}) (
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 	
-	task, exists := ms.tasks[id]
+	task, exists := ms.tasks.byID[id]
 	if !exists {
-		return nil, fmt.Errorf("task with ID %s not found", id)
+		return nil, notFound("task", id)
 	}
 	
-	// Create a copy to avoid modifying the original
-	updatedTask := *task
-	
-	// Apply updates (simplified for now - in a real implementation, you'd handle all fields)
-	if title, ok := updates["title"].(string); ok {
-		updatedTask.Card.Title = title
-	}
-	if description, ok := updates["description"].(string); ok {
-		updatedTask.Card.Description = description
-	}
-	if status, ok := updates["status"].(domain.TaskStatus); ok {
-		updatedTask.Card.Status = status
+	// Apply updates to a copy so a rejected patch changes nothing
+	updatedTask, err := domain.ApplyTaskPatch(task, updates)
+	if err != nil {
+		return nil, taskPatchError(err)
 	}
 	
-	ms.tasks[id] = &updatedTask
-	return &updatedTask, nil
+	ms.tasks.add(updatedTask)
+	ms.revisions = append(ms.revisions, domain.NewTaskRevision(domain.RevisionUpdate, updatedTask))
+	return updatedTask.Clone(), nil
 }
 
 func (ms *MemoryStorage) GetTask(id string) (*domain.Task, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 	
-	task, exists := ms.tasks[id]
+	task, exists := ms.tasks.byID[id]
 	if !exists {
-		return nil, fmt.Errorf("task with ID %s not found", id)
+		return nil, notFound("task", id)
 	}
 	
-	return task, nil
+	return task.Clone(), nil
 }
 
 func (ms *MemoryStorage) ListTasks(filter domain.TaskFilter) ([]*domain.Task, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 	
-	var result []*domain.Task
-	
-	for _, task := range ms.tasks {
-		if filter.ProjectID != nil && task.ProjectID != *filter.ProjectID {
-			continue
-		}
-		if filter.Status != nil && task.Card.Status != *filter.Status {
-			continue
-		}
-		if filter.Parent != nil && task.Card.Parent != filter.Parent {
-			continue
-		}
-		
-		result = append(result, task)
-	}
-	
-	return result, nil
+	return cloneTasks(ms.tasks.query(filter)), nil
 }
 
 func (ms *MemoryStorage) DeleteTask(id string) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 	
-	if _, exists := ms.tasks[id]; !exists {
-		return fmt.Errorf("task with ID %s not found", id)
+	task, exists := ms.tasks.byID[id]
+	if !exists {
+		return notFound("task", id)
 	}
 	
-	delete(ms.tasks, id)
+	ms.tasks.remove(id)
+	ms.revisions = append(ms.revisions, domain.NewTaskRevision(domain.RevisionDelete, task))
 	return nil
 }
 
@@ -126,7 +110,7 @@ func (ms *MemoryStorage) CreateProject(project *domain.Project) error {
 	defer ms.mu.Unlock()
 	
 	if _, exists := ms.projects[project.ID]; exists {
-		return fmt.Errorf("project with ID %s already exists", project.ID)
+		return conflict("project", project.ID)
 	}
 	
 	ms.projects[project.ID] = project
@@ -139,12 +123,29 @@ func (ms *MemoryStorage) GetProject(id string) (*domain.Project, error) {
 	
 	project, exists := ms.projects[id]
 	if !exists {
-		return nil, fmt.Errorf("project with ID %s not found", id)
+		return nil, notFound("project", id)
 	}
 	
 	return project, nil
 }
 
+func (ms *MemoryStorage) UpdateProject(id string, updates map[string]interface{}) (*domain.Project, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	
+	project, exists := ms.projects[id]
+	if !exists {
+		return nil, notFound("project", id)
+	}
+	
+	// Create a copy and apply updates
+	updatedProject := *project
+	applyProjectUpdates(&updatedProject, updates)
+	
+	ms.projects[id] = &updatedProject
+	return &updatedProject, nil
+}
+
 func (ms *MemoryStorage) ListProjects() ([]*domain.Project, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
@@ -153,6 +154,7 @@ func (ms *MemoryStorage) ListProjects() ([]*domain.Project, error) {
 	for _, project := range ms.projects {
 		result = append(result, project)
 	}
+	sortProjects(result)
 	
 	return result, nil
 }
@@ -162,7 +164,7 @@ func (ms *MemoryStorage) SetCurrentProject(id string) error {
 	defer ms.mu.Unlock()
 	
 	if _, exists := ms.projects[id]; !exists {
-		return fmt.Errorf("project with ID %s not found", id)
+		return notFound("project", id)
 	}
 	
 	ms.currentProject = &id
@@ -174,12 +176,12 @@ func (ms *MemoryStorage) GetCurrentProject() (*domain.Project, error) {
 	defer ms.mu.RUnlock()
 	
 	if ms.currentProject == nil {
-		return nil, fmt.Errorf("no current project set")
+		return nil, errNoCurrentProject
 	}
 	
 	project, exists := ms.projects[*ms.currentProject]
 	if !exists {
-		return nil, fmt.Errorf("current project with ID %s not found", *ms.currentProject)
+		return nil, notFound("project", *ms.currentProject)
 	}
 	
 	return project, nil
@@ -190,6 +192,10 @@ func (ms *MemoryStorage) CreateDiscovery(discovery *domain.Discovery) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 	
+	if _, exists := ms.discoveries[discovery.ID]; exists {
+		return conflict("discovery", discovery.ID)
+	}
+	
 	ms.discoveries[discovery.ID] = discovery
 	return nil
 }
@@ -198,6 +204,10 @@ func (ms *MemoryStorage) CreateDecision(decision *domain.Decision) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 	
+	if _, exists := ms.decisions[decision.ID]; exists {
+		return conflict("decision", decision.ID)
+	}
+	
 	ms.decisions[decision.ID] = decision
 	return nil
 }
@@ -208,7 +218,7 @@ func (ms *MemoryStorage) CreatePlanningSession(session *domain.PlanningSession)
 	defer ms.mu.Unlock()
 	
 	if _, exists := ms.sessions[session.ID]; exists {
-		return fmt.Errorf("planning session with ID %s already exists", session.ID)
+		return conflict("planning session", session.ID)
 	}
 	
 	ms.sessions[session.ID] = session
@@ -221,10 +231,10 @@ func (ms *MemoryStorage) GetPlanningSession(id string) (*domain.PlanningSession,
 	
 	session, exists := ms.sessions[id]
 	if !exists {
-		return nil, fmt.Errorf("planning session with ID %s not found", id)
+		return nil, notFound("planning session", id)
 	}
 	
-	return session, nil
+	return copySession(session), nil
 }
 
 func (ms *MemoryStorage) ListPlanningSessions(projectID string) ([]*domain.PlanningSession, error) {
@@ -234,9 +244,10 @@ func (ms *MemoryStorage) ListPlanningSessions(projectID string) ([]*domain.Plann
 	var result []*domain.PlanningSession
 	for _, session := range ms.sessions {
 		if session.ProjectID == projectID {
-			result = append(result, session)
+			result = append(result, copySession(session))
 		}
 	}
+	sortPlanningSessions(result)
 	
 	return result, nil
 }
@@ -247,18 +258,13 @@ func (ms *MemoryStorage) UpdatePlanningSession(id string, updates map[string]int
 	
 	session, exists := ms.sessions[id]
 	if !exists {
-		return nil, fmt.Errorf("planning session with ID %s not found", id)
+		return nil, notFound("planning session", id)
 	}
 	
 	// Create a copy and apply updates
 	updatedSession := *session
 	
-	if status, ok := updates["status"].(domain.PlanningSessionStatus); ok {
-		updatedSession.Status = status
-	}
-	if tasks, ok := updates["tasks"].([]string); ok {
-		updatedSession.Tasks = tasks
-	}
+	applyPlanningSessionUpdates(&updatedSession, updates)
 	
 	ms.sessions[id] = &updatedSession
 	return &updatedSession, nil
@@ -274,6 +280,7 @@ func (ms *MemoryStorage) ListDiscoveries(projectID string) ([]*domain.Discovery,
 			result = append(result, discovery)
 		}
 	}
+	sortDiscoveries(result)
 	
 	return result, nil
 }
@@ -288,6 +295,7 @@ func (ms *MemoryStorage) ListDecisions(projectID string) ([]*domain.Decision, er
 			result = append(result, decision)
 		}
 	}
+	sortDecisions(result)
 	
 	return result, nil
 }
@@ -307,7 +315,7 @@ func (ms *MemoryStorage) GetProcess(processID string) (*domain.Process, error) {
 	
 	process, exists := ms.processes[processID]
 	if !exists {
-		return nil, fmt.Errorf("process with ID %s not found", processID)
+		return nil, notFound("process", processID)
 	}
 	
 	return process, nil
@@ -330,6 +338,7 @@ func (ms *MemoryStorage) ListProcesses(filter domain.ProcessFilter) ([]*domain.P
 		}
 		result = append(result, process)
 	}
+	sortProcesses(result)
 	
 	return result, nil
 }
@@ -348,13 +357,16 @@ func (ms *MemoryStorage) GetProcessGroup(groupID string) (*domain.ProcessGroup,
 	
 	group, exists := ms.processGroups[groupID]
 	if !exists {
-		return nil, fmt.Errorf("process group with ID %s not found", groupID)
+		return nil, notFound("process group", groupID)
 	}
 	
 	return group, nil
 }
 
 func (ms *MemoryStorage) SaveProcessLogs(logs []*domain.ProcessLog) error {
+	if ms.inTx {
+		return ErrNotTransactional
+	}
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 	
@@ -365,10 +377,34 @@ func (ms *MemoryStorage) SaveProcessLogs(logs []*domain.ProcessLog) error {
 	return nil
 }
 
+func (ms *MemoryStorage) PruneProcessLogs(processID string, before time.Time, keep int, dryRun bool) (int, error) {
+	if ms.inTx {
+		return 0, ErrNotTransactional
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	
+	if _, exists := ms.processes[processID]; !exists {
+		return 0, notFound("process", processID)
+	}
+	
+	logs := ms.processLogs[processID]
+	kept := domain.RetainLogs(logs, before, keep)
+	if dryRun || len(kept) == len(logs) {
+		return len(logs) - len(kept), nil
+	}
+	ms.processLogs[processID] = kept
+	return len(logs) - len(kept), nil
+}
+
 func (ms *MemoryStorage) GetProcessLogs(processID string, limit int) ([]*domain.ProcessLog, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 	
+	if _, exists := ms.processes[processID]; !exists {
+		return nil, notFound("process", processID)
+	}
+	
 	logs, exists := ms.processLogs[processID]
 	if !exists {
 		return []*domain.ProcessLog{}, nil
@@ -385,4 +421,62 @@ func (ms *MemoryStorage) GetProcessLogs(processID string, limit int) ([]*domain.
 	}
 	
 	return logs[start:], nil
-}
\ No newline at end of file
+}
+// Transaction runs fn against a copy of the store while holding the write
+// lock, and adopts the copy only when fn succeeds. Stored entities are never
+// changed in place, so copying the maps and indexes is enough.
+func (ms *MemoryStorage) Transaction(fn func(tx Store) error) error {
+	if ms.inTx {
+		return fn(ms)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	tx := &MemoryStorage{
+		tasks:          newTaskIndex(),
+		projects:       copyMap(ms.projects),
+		discoveries:    copyMap(ms.discoveries),
+		decisions:      copyMap(ms.decisions),
+		sessions:       copyMap(ms.sessions),
+		processes:      copyMap(ms.processes),
+		processGroups:  copyMap(ms.processGroups),
+		processLogs:    ms.processLogs,
+		revisions:      ms.revisions[:len(ms.revisions):len(ms.revisions)],
+		currentProject: ms.currentProject,
+		inTx:           true,
+	}
+	for _, task := range ms.tasks.byID {
+		tx.tasks.add(task)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	ms.tasks = tx.tasks
+	ms.projects = tx.projects
+	ms.discoveries = tx.discoveries
+	ms.decisions = tx.decisions
+	ms.sessions = tx.sessions
+	ms.processes = tx.processes
+	ms.processGroups = tx.processGroups
+	ms.revisions = tx.revisions
+	ms.currentProject = tx.currentProject
+	return nil
+}
+
+// copySession returns a copy of a stored session, so callers that append to
+// its tasks cannot change the stored one, or one a transaction shares
+func copySession(session *domain.PlanningSession) *domain.PlanningSession {
+	copied := *session
+	copied.Tasks = append([]string(nil), session.Tasks...)
+	return &copied
+}
+
+func copyMap[V any](m map[string]V) map[string]V {
+	copied := make(map[string]V, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// SQLiteMigration counts what MigrateJSONToSQLite copied
+type SQLiteMigration struct {
+	Path             string `json:"path"`
+	Projects         int    `json:"projects"`
+	Tasks            int    `json:"tasks"`
+	TaskRevisions    int    `json:"taskRevisions"`
+	PlanningSessions int    `json:"planningSessions"`
+	Discoveries      int    `json:"discoveries"`
+	Decisions        int    `json:"decisions"`
+	Processes        int    `json:"processes"`
+	ProcessGroups    int    `json:"processGroups"`
+	ProcessLogs      int    `json:"processLogs"`
+}
+
+// MigrateJSONToSQLite copies the JSON layout under basePath into a new SQLite
+// database and switches config.json to the sqlite backend. Task history is
+// copied verbatim so point-in-time views keep working. The JSON files are
+// left in place; the database must not exist yet.
+func MigrateJSONToSQLite(basePath string) (*SQLiteMigration, error) {
+	dbPath := SQLitePath(basePath)
+	if _, err := os.Stat(dbPath); err == nil {
+		return nil, fmt.Errorf("sqlite database %s already exists", dbPath)
+	}
+
+	config, err := ReadConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+	if config.Storage == BackendSQLite {
+		return nil, fmt.Errorf("workspace already uses the sqlite backend")
+	}
+
+	src, err := NewFileStorage(basePath)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SQLiteMigration{Path: dbPath}
+	err = dst.withTx(func(tx *sql.Tx) error {
+		return copyJSONLayout(src, tx, config, report)
+	})
+	dst.Close()
+	if err != nil {
+		removeSQLiteFiles(dbPath)
+		return nil, fmt.Errorf("migration failed: %w", err)
+	}
+
+	config.Storage = BackendSQLite
+	if err := WriteConfig(basePath, config); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func copyJSONLayout(src *FileStorage, tx *sql.Tx, config *Config, report *SQLiteMigration) error {
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+
+	projects, err := src.listProjectsUnlocked()
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err := insertProject(tx, project); err != nil {
+			return err
+		}
+		report.Projects++
+
+		tasks, err := src.loadTasks(project.ID)
+		if err != nil {
+			return fmt.Errorf("project %s tasks: %w", project.ID, err)
+		}
+		for _, task := range tasks {
+			if err := insertTask(tx, task); err != nil {
+				return err
+			}
+			report.Tasks++
+		}
+
+		revisions, err := src.loadTaskRevisions(project.ID)
+		if err != nil {
+			return err
+		}
+		for _, revision := range revisions {
+			if err := insertTaskRevision(tx, revision); err != nil {
+				return err
+			}
+			report.TaskRevisions++
+		}
+
+		sessions, err := src.loadPlanningSessions(project.ID)
+		if err != nil {
+			return fmt.Errorf("project %s planning sessions: %w", project.ID, err)
+		}
+		for _, session := range sessions {
+			if err := insertDoc(tx, "planning session", `planning_sessions`, session.ID, project.ID, session); err != nil {
+				return err
+			}
+			report.PlanningSessions++
+		}
+
+		discoveries, err := src.loadDiscoveries(project.ID)
+		if err != nil {
+			return fmt.Errorf("project %s discoveries: %w", project.ID, err)
+		}
+		for _, discovery := range discoveries {
+			if err := insertDoc(tx, "discovery", `discoveries`, discovery.ID, project.ID, discovery); err != nil {
+				return err
+			}
+			report.Discoveries++
+		}
+
+		decisions, err := src.loadDecisions(project.ID)
+		if err != nil {
+			return fmt.Errorf("project %s decisions: %w", project.ID, err)
+		}
+		for _, decision := range decisions {
+			if err := insertDoc(tx, "decision", `decisions`, decision.ID, project.ID, decision); err != nil {
+				return err
+			}
+			report.Decisions++
+		}
+
+		processes, err := src.loadProcesses(project.ID)
+		if err != nil {
+			return fmt.Errorf("project %s processes: %w", project.ID, err)
+		}
+		for _, process := range processes {
+			if err := saveProcess(tx, project.ID, process); err != nil {
+				return err
+			}
+			report.Processes++
+
+			logs, err := src.loadProcessLogs(project.ID, process.ID)
+			if err != nil {
+				return fmt.Errorf("process %s logs: %w", process.ID, err)
+			}
+			for _, log := range logs {
+				if err := insertProcessLog(tx, log); err != nil {
+					return err
+				}
+				report.ProcessLogs++
+			}
+		}
+
+		groups, err := src.loadProcessGroups(project.ID)
+		if err != nil {
+			return fmt.Errorf("project %s process groups: %w", project.ID, err)
+		}
+		for _, group := range groups {
+			if err := saveProcessGroup(tx, project.ID, group); err != nil {
+				return err
+			}
+			report.ProcessGroups++
+		}
+	}
+
+	if config.CurrentProjectID != nil {
+		if err := setMeta(tx, metaCurrentProject, *config.CurrentProjectID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeSQLiteFiles(dbPath string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(dbPath + suffix)
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Storage backends selectable through the "storage" key of config.json
+const (
+	BackendJSON   = "json"
+	BackendSQLite = "sqlite"
+)
+
+func configPath(basePath string) string {
+	return filepath.Join(basePath, ".compass", "config.json")
+}
+
+// ReadConfig loads .compass/config.json, returning an empty config when the
+// workspace has not been initialized yet
+func ReadConfig(basePath string) (*Config, error) {
+	var config Config
+	data, err := os.ReadFile(configPath(basePath))
+	if os.IsNotExist(err) {
+		return &config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", configPath(basePath), err)
+	}
+	return &config, nil
+}
+
+// WriteConfig replaces .compass/config.json atomically
+func WriteConfig(basePath string, config *Config) error {
+	path := configPath(basePath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// Open returns the backend configured for the workspace at basePath
+func Open(basePath string) (Store, error) {
+	config, err := ReadConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Storage {
+	case "", BackendJSON:
+		return NewFileStorage(basePath)
+	case BackendSQLite:
+		return NewSQLiteStorage(SQLitePath(basePath))
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q in config.json (expected %q or %q)", config.Storage, BackendJSON, BackendSQLite)
+	}
+}
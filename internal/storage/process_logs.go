@@ -0,0 +1,552 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Process logs are JSON Lines files under projects/<id>/logs. A batch of
+// logs is appended to the process's active segment, <process>.jsonl, so a
+// write costs the same however much the process has logged before. Once the
+// active segment outgrows the rotation size, or its first log is older than
+// the rotation age, it is renamed to <process>.<rotated at>.jsonl and then
+// compressed to <process>.<rotated at>.jsonl.gz. A crash between the two
+// steps leaves the uncompressed segment, which is read like any other.
+// Pruning removes rotated segments whole and rewrites only the one that
+// straddles the cutoff.
+//
+// Workspaces written before logs were segmented hold a <process>.json array.
+// It is read as the oldest segment and folded into the active segment the
+// next time the process logs.
+
+// Rotation defaults, used when config.json does not set logRotation
+const (
+	DefaultLogSegmentBytes    = 4 << 20
+	DefaultLogSegmentAgeHours = 24
+)
+
+// segmentStampLayout names rotated segments so that they sort by name in
+// the order they were rotated
+const segmentStampLayout = "20060102T150405.000000000Z"
+
+// LogRotation decides when a process's active log segment is rotated
+type LogRotation struct {
+	// MaxBytes rotates the segment once it is this large; zero means
+	// DefaultLogSegmentBytes
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+	// MaxAgeHours rotates the segment once its first log is this old; zero
+	// means DefaultLogSegmentAgeHours
+	MaxAgeHours int `json:"maxAgeHours,omitempty"`
+}
+
+func (r LogRotation) withDefaults() LogRotation {
+	if r.MaxBytes <= 0 {
+		r.MaxBytes = DefaultLogSegmentBytes
+	}
+	if r.MaxAgeHours <= 0 {
+		r.MaxAgeHours = DefaultLogSegmentAgeHours
+	}
+	return r
+}
+
+func (fs *FileStorage) logsDir(projectID string) string {
+	return filepath.Join(fs.projectDir(projectID), "logs")
+}
+
+// logSegments returns the paths of a process's log segments, oldest first.
+// The active segment, when there is one, comes last.
+func (fs *FileStorage) logSegments(projectID, processID string) ([]string, error) {
+	dir := fs.logsDir(projectID)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var legacy, active string
+	rotated := make(map[string]string)
+	prefix := processID + "."
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, prefix)
+		switch {
+		case rest == "json":
+			legacy = filepath.Join(dir, name)
+		case rest == "jsonl":
+			active = filepath.Join(dir, name)
+		case strings.HasSuffix(rest, ".jsonl.gz"):
+			rotated[strings.TrimSuffix(rest, ".jsonl.gz")] = filepath.Join(dir, name)
+		case strings.HasSuffix(rest, ".jsonl"):
+			// Keep the compressed copy when a crash left both
+			stamp := strings.TrimSuffix(rest, ".jsonl")
+			if _, ok := rotated[stamp]; !ok || !strings.HasSuffix(rotated[stamp], ".gz") {
+				rotated[stamp] = filepath.Join(dir, name)
+			}
+		}
+	}
+
+	var segments []string
+	if legacy != "" {
+		segments = append(segments, legacy)
+	}
+	stamps := make([]string, 0, len(rotated))
+	for stamp := range rotated {
+		stamps = append(stamps, stamp)
+	}
+	sort.Strings(stamps)
+	for _, stamp := range stamps {
+		segments = append(segments, rotated[stamp])
+	}
+	if active != "" {
+		segments = append(segments, active)
+	}
+	return segments, nil
+}
+
+// loadProcessLogs returns every log of a process, oldest first
+func (fs *FileStorage) loadProcessLogs(projectID, processID string) ([]*domain.ProcessLog, error) {
+	segments, err := fs.logSegments(projectID, processID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]*domain.ProcessLog, 0)
+	for _, path := range segments {
+		segment, err := fs.readLogSegment(path)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, segment...)
+	}
+	return logs, nil
+}
+
+// tailProcessLogs returns the last limit logs of a process, oldest first.
+// The active segment is read backwards, and older segments are only opened
+// when it holds fewer than limit logs.
+func (fs *FileStorage) tailProcessLogs(projectID, processID string, limit int) ([]*domain.ProcessLog, error) {
+	segments, err := fs.logSegments(projectID, processID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]*domain.ProcessLog, 0, limit)
+	for i := len(segments) - 1; i >= 0 && len(logs) < limit; i-- {
+		var segment []*domain.ProcessLog
+		if strings.HasSuffix(segments[i], ".jsonl") {
+			lines, err := tailLines(segments[i], limit-len(logs))
+			if err != nil {
+				return nil, err
+			}
+			segment = decodeLogLines(segments[i], lines)
+		} else if segment, err = fs.readLogSegment(segments[i]); err != nil {
+			return nil, err
+		}
+
+		if need := limit - len(logs); len(segment) > need {
+			segment = segment[len(segment)-need:]
+		}
+		logs = append(segment, logs...)
+	}
+	return logs, nil
+}
+
+// appendProcessLogs adds logs to the end of a process's active segment,
+// rotating the segment first when it is due
+func (fs *FileStorage) appendProcessLogs(projectID, processID string, logs []*domain.ProcessLog) error {
+	dir := fs.logsDir(projectID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	active := filepath.Join(dir, processID+".jsonl")
+
+	if err := fs.foldLegacyLogs(dir, processID); err != nil {
+		return err
+	}
+	if due, err := fs.rotationDue(active); err != nil {
+		return err
+	} else if due {
+		if err := rotateLogSegment(active, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	data, err := encodeLogLines(logs)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(active, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// A partial line left by a crashed writer is cut off so the batch
+	// starts on a line of its own
+	if err := trimTornTail(file); err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	return err
+}
+
+// pruneProcessLogs deletes the logs domain.RetainLogs drops, segment by
+// segment from the newest. A rotated segment holds nothing newer than the
+// time it was rotated, so one rotated before the cutoff, like one holding
+// only logs past the newest keep, is removed whole without being read.
+// Only a segment straddling the cutoff is rewritten, in its own format, so
+// what remains stays rotated and compressed. A crash part way leaves some
+// logs that should have gone, never loses one that should have stayed.
+// With dryRun set nothing is changed and only the count is returned.
+func (fs *FileStorage) pruneProcessLogs(projectID, processID string, before time.Time, keep int, dryRun bool) (int, error) {
+	segments, err := fs.logSegments(projectID, processID)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned, kept := 0, 0
+	for i := len(segments) - 1; i >= 0; i-- {
+		path := segments[i]
+		stamp, rotated := segmentStamp(path, processID)
+		if (rotated && !before.IsZero() && stamp.Before(before)) || (keep > 0 && kept >= keep) {
+			count, err := fs.countLogLines(path)
+			if err != nil {
+				return pruned, err
+			}
+			if !dryRun {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return pruned, err
+				}
+			}
+			pruned += count
+			continue
+		}
+
+		logs, err := fs.readLogSegment(path)
+		if err != nil {
+			return pruned, err
+		}
+		limit := 0
+		if keep > 0 {
+			limit = keep - kept
+		}
+		retained := domain.RetainLogs(logs, before, limit)
+		kept += len(retained)
+		if dryRun || len(retained) == len(logs) {
+			pruned += len(logs) - len(retained)
+			continue
+		}
+		if err := fs.rewriteLogSegment(path, retained); err != nil {
+			return pruned, err
+		}
+		pruned += len(logs) - len(retained)
+	}
+	return pruned, nil
+}
+
+// segmentStamp returns the time a rotated segment was rotated; false for
+// the active segment and a legacy array
+func segmentStamp(path, processID string) (time.Time, bool) {
+	name := strings.TrimPrefix(filepath.Base(path), processID+".")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".jsonl")
+	stamp, err := time.Parse(segmentStampLayout, name)
+	return stamp, err == nil
+}
+
+// rewriteLogSegment replaces the segment at path with logs, keeping its
+// format, or removes it when no logs are left
+func (fs *FileStorage) rewriteLogSegment(path string, logs []*domain.ProcessLog) error {
+	if len(logs) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if strings.HasSuffix(path, ".json") {
+		return fs.saveList(path, logs)
+	}
+
+	data, err := encodeLogLines(logs)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		if data, err = compressLogs(data); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, data)
+}
+
+// countLogLines counts the log lines of a segment without decoding them
+func (fs *FileStorage) countLogLines(path string) (int, error) {
+	if strings.HasSuffix(path, ".json") {
+		logs, err := fs.readLogSegment(path)
+		return len(logs), err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		reader = gz
+	}
+	count := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return count, nil
+}
+
+// foldLegacyLogs moves the logs of a <process>.json array into the active
+// segment, ahead of anything already there
+func (fs *FileStorage) foldLegacyLogs(dir, processID string) error {
+	legacy := filepath.Join(dir, processID+".json")
+	var logs []*domain.ProcessLog
+	if err := fs.loadList(legacy, &logs); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := encodeLogLines(logs)
+	if err != nil {
+		return err
+	}
+	active := filepath.Join(dir, processID+".jsonl")
+	existing, err := os.ReadFile(active)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if end := bytes.LastIndexByte(existing, '\n'); end >= 0 {
+		data = append(data, existing[:end+1]...)
+	}
+	if err := writeFileAtomic(active, data); err != nil {
+		return err
+	}
+	return os.Remove(legacy)
+}
+
+// rotationDue reports whether the active segment at path has outgrown the
+// rotation size or age
+func (fs *FileStorage) rotationDue(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Size() == 0 {
+		return false, nil
+	}
+
+	rotation := fs.logRotation.withDefaults()
+	if info.Size() >= rotation.MaxBytes {
+		return true, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		// Only a write in progress; nothing to go by yet
+		return false, nil
+	}
+	var first domain.ProcessLog
+	if err := json.Unmarshal(line, &first); err != nil {
+		return false, nil
+	}
+	return time.Since(first.Timestamp) >= time.Duration(rotation.MaxAgeHours)*time.Hour, nil
+}
+
+// rotateLogSegment retires the active segment at path under the time it
+// was rotated and compresses it
+func rotateLogSegment(path string, now time.Time) error {
+	base := strings.TrimSuffix(path, ".jsonl")
+	rotated := fmt.Sprintf("%s.%s.jsonl", base, now.UTC().Format(segmentStampLayout))
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(rotated)
+	if err != nil {
+		return err
+	}
+	compressed, err := compressLogs(data)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(rotated+".gz", compressed); err != nil {
+		return err
+	}
+	return os.Remove(rotated)
+}
+
+func compressLogs(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// readLogSegment decodes a whole segment: a legacy array, a compressed
+// rotated segment or a JSON Lines file
+func (fs *FileStorage) readLogSegment(path string) ([]*domain.ProcessLog, error) {
+	if strings.HasSuffix(path, ".json") {
+		var logs []*domain.ProcessLog
+		if err := fs.loadList(path, &logs); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return logs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// Rotated or rewritten since the segments were listed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = io.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return decodeLogLines(path, splitLines(data)), nil
+}
+
+// tailChunkSize is how much of a log file tailLines reads at a time
+var tailChunkSize = 64 * 1024
+
+// tailLines returns up to n of the last complete lines of the file at path,
+// oldest first, reading backwards so the cost follows n rather than the size
+// of the file. A final line without a newline is a write in progress and is
+// ignored.
+func tailLines(path string, n int) ([][]byte, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	offset := info.Size()
+	for offset > 0 && bytes.Count(data, []byte{'\n'}) <= n {
+		size := int64(tailChunkSize)
+		if size > offset {
+			size = offset
+		}
+		offset -= size
+		chunk := make([]byte, size, int(size)+len(data))
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		data = append(chunk, data...)
+	}
+
+	lines := splitLines(data)
+	if offset > 0 && len(lines) > 0 {
+		// The first line started before what was read
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// splitLines returns the complete lines in data
+func splitLines(data []byte) [][]byte {
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil
+	}
+	return bytes.Split(data[:end], []byte{'\n'})
+}
+
+func decodeLogLines(path string, lines [][]byte) []*domain.ProcessLog {
+	logs := make([]*domain.ProcessLog, 0, len(lines))
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry domain.ProcessLog
+		if err := json.Unmarshal(line, &entry); err != nil {
+			log.Printf("FileStorage: skipping unreadable log line in %s", path)
+			continue
+		}
+		logs = append(logs, &entry)
+	}
+	return logs
+}
+
+func encodeLogLines(logs []*domain.ProcessLog) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range logs {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
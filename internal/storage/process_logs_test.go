@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+func logFiles(t *testing.T, fs *FileStorage, projectID string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(fs.logsDir(projectID))
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func messages(logs []*domain.ProcessLog) []string {
+	result := make([]string, len(logs))
+	for i, log := range logs {
+		result[i] = log.Message
+	}
+	return result
+}
+
+func TestProcessLogs_AppendRotateAndTail(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	defer fs.Close()
+	fs.logRotation = LogRotation{MaxBytes: 400}
+
+	project := domain.NewProject("Logs", "", "")
+	require.NoError(t, fs.CreateProject(project))
+	process := domain.NewProcess(project.ID, "server", "npm", []string{"start"})
+	require.NoError(t, fs.SaveProcess(project.ID, process))
+
+	var want []string
+	for batch := 0; batch < 6; batch++ {
+		var logs []*domain.ProcessLog
+		for i := 0; i < 2; i++ {
+			message := fmt.Sprintf("batch %d line %d", batch, i)
+			logs = append(logs, domain.NewProcessLog(process.ID, domain.LogTypeStdout, message))
+			want = append(want, message)
+		}
+		require.NoError(t, fs.SaveProcessLogs(logs))
+	}
+
+	var rotated int
+	for _, name := range logFiles(t, fs, project.ID) {
+		if strings.HasSuffix(name, ".jsonl.gz") {
+			rotated++
+		}
+	}
+	assert.Greater(t, rotated, 1, "segments past the size limit are compressed")
+	assert.Contains(t, logFiles(t, fs, project.ID), process.ID+".jsonl")
+
+	all, err := fs.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, want, messages(all))
+
+	// The tail crosses into rotated segments only as far as needed, and
+	// reads the active one backwards in chunks shorter than a line
+	defer func(size int) { tailChunkSize = size }(tailChunkSize)
+	tailChunkSize = 16
+	for _, limit := range []int{1, 3, 7, 12, 50} {
+		tail, err := fs.GetProcessLogs(process.ID, limit)
+		require.NoError(t, err)
+		expected := want
+		if limit < len(want) {
+			expected = want[len(want)-limit:]
+		}
+		assert.Equal(t, expected, messages(tail), "limit %d", limit)
+	}
+
+	// A torn final line is ignored and then cut off by the next append
+	active := filepath.Join(fs.logsDir(project.ID), process.ID+".jsonl")
+	file, err := os.OpenFile(active, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"id":"torn","message":"half`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	tail, err := fs.GetProcessLogs(process.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, want[len(want)-1:], messages(tail))
+	require.NoError(t, fs.SaveProcessLogs([]*domain.ProcessLog{domain.NewProcessLog(process.ID, domain.LogTypeStderr, "after")}))
+	tail, err = fs.GetProcessLogs(process.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{want[len(want)-1], "after"}, messages(tail))
+
+	// Pruning drops the older segments whole and leaves the rest rotated
+	// and compressed
+	removed, err := fs.PruneProcessLogs(process.ID, time.Time{}, 3, false)
+	require.NoError(t, err)
+	assert.Equal(t, len(want)-2, removed)
+	files := logFiles(t, fs, project.ID)
+	assert.Contains(t, files, process.ID+".jsonl")
+	for _, name := range files {
+		assert.True(t, name == process.ID+".jsonl" || strings.HasSuffix(name, ".jsonl.gz"), name)
+	}
+	assert.Less(t, len(files)-1, rotated)
+	all, err = fs.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{want[len(want)-2], want[len(want)-1], "after"}, messages(all))
+}
+
+func TestProcessLogs_RotatesByAge(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	defer fs.Close()
+
+	project := domain.NewProject("Logs", "", "")
+	require.NoError(t, fs.CreateProject(project))
+	process := domain.NewProcess(project.ID, "worker", "go", []string{"run", "."})
+	require.NoError(t, fs.SaveProcess(project.ID, process))
+
+	old := domain.NewProcessLog(process.ID, domain.LogTypeStdout, "yesterday")
+	old.Timestamp = time.Now().Add(-25 * time.Hour)
+	require.NoError(t, fs.SaveProcessLogs([]*domain.ProcessLog{old}))
+	require.NoError(t, fs.SaveProcessLogs([]*domain.ProcessLog{domain.NewProcessLog(process.ID, domain.LogTypeStdout, "today")}))
+
+	files := logFiles(t, fs, project.ID)
+	require.Len(t, files, 2)
+	assert.True(t, strings.HasSuffix(files[0], ".jsonl.gz"), files[0])
+	assert.Equal(t, process.ID+".jsonl", files[1])
+
+	all, err := fs.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"yesterday", "today"}, messages(all))
+}
+
+func TestProcessLogs_FoldsLegacyArray(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	defer fs.Close()
+
+	project := domain.NewProject("Logs", "", "")
+	require.NoError(t, fs.CreateProject(project))
+	process := domain.NewProcess(project.ID, "server", "npm", []string{"start"})
+	require.NoError(t, fs.SaveProcess(project.ID, process))
+
+	legacy := []*domain.ProcessLog{
+		domain.NewProcessLog(process.ID, domain.LogTypeStdout, "old 1"),
+		domain.NewProcessLog(process.ID, domain.LogTypeStdout, "old 2"),
+	}
+	require.NoError(t, os.MkdirAll(fs.logsDir(project.ID), 0755))
+	require.NoError(t, fs.saveList(filepath.Join(fs.logsDir(project.ID), process.ID+".json"), legacy))
+
+	tail, err := fs.GetProcessLogs(process.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old 2"}, messages(tail))
+
+	require.NoError(t, fs.SaveProcessLogs([]*domain.ProcessLog{domain.NewProcessLog(process.ID, domain.LogTypeStdout, "new")}))
+	assert.Equal(t, []string{process.ID + ".jsonl"}, logFiles(t, fs, project.ID))
+	all, err := fs.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old 1", "old 2", "new"}, messages(all))
+}
+
+func TestProcessLogs_PruneKeepsSegmentsRotated(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	defer fs.Close()
+
+	project := domain.NewProject("Logs", "", "")
+	require.NoError(t, fs.CreateProject(project))
+	process := domain.NewProcess(project.ID, "server", "npm", []string{"start"})
+	require.NoError(t, fs.SaveProcess(project.ID, process))
+
+	// Three segments rotated an hour apart, the last still active
+	start := time.Now().Add(-4 * time.Hour).UTC()
+	dir := fs.logsDir(project.ID)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	var segments []string
+	for hour := 0; hour < 4; hour++ {
+		var logs []*domain.ProcessLog
+		for minute := 0; minute < 60; minute += 20 {
+			log := domain.NewProcessLog(process.ID, domain.LogTypeStdout, fmt.Sprintf("%d:%02d", hour, minute))
+			log.Timestamp = start.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+			logs = append(logs, log)
+		}
+		data, err := encodeLogLines(logs)
+		require.NoError(t, err)
+		name := process.ID + ".jsonl"
+		if hour < 3 {
+			name = process.ID + "." + start.Add(time.Duration(hour+1)*time.Hour).Format(segmentStampLayout) + ".jsonl.gz"
+			data, err = compressLogs(data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+		segments = append(segments, name)
+	}
+
+	// The cutoff falls inside the second segment: the first goes whole,
+	// the second is rewritten compressed and the rest are left alone
+	removed, err := fs.PruneProcessLogs(process.ID, start.Add(90*time.Minute), 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, 5, removed)
+	assert.Equal(t, segments[1:], logFiles(t, fs, project.ID))
+
+	all, err := fs.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1:40", "2:00", "2:20", "2:40", "3:00", "3:20", "3:40"}, messages(all))
+
+	// Keeping fewer logs than the newer segments hold drops them too
+	removed, err = fs.PruneProcessLogs(process.ID, time.Time{}, 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, 5, removed)
+	assert.Equal(t, segments[3:], logFiles(t, fs, project.ID))
+	all, err = fs.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3:20", "3:40"}, messages(all))
+}
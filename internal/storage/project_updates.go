@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// applyProjectUpdates applies a partial update map to a project. It is shared
+// by every storage backend so that project updates behave identically.
+func applyProjectUpdates(project *domain.Project, updates map[string]interface{}) {
+	if name, ok := updates["name"].(string); ok {
+		project.Name = name
+	}
+	if description, ok := updates["description"].(string); ok {
+		project.Description = description
+	}
+	if goal, ok := updates["goal"].(string); ok {
+		project.Goal = goal
+	}
+	if limits, ok := updates["wipLimits"].(map[domain.TaskStatus]int); ok {
+		project.WIPLimits = limits
+	}
+	if policy, ok := updates["wipPolicy"].(domain.WIPPolicy); ok {
+		project.WIPPolicy = policy
+	}
+	if updatedBy, ok := updates["updatedBy"].(string); ok {
+		project.UpdatedBy = updatedBy
+	}
+	project.UpdatedAt = time.Now()
+}
+
+// applyPlanningSessionUpdates applies a partial update map to a planning
+// session. Like applyProjectUpdates it is shared by every storage backend.
+func applyPlanningSessionUpdates(session *domain.PlanningSession, updates map[string]interface{}) {
+	if status, ok := updates["status"].(domain.PlanningSessionStatus); ok {
+		session.Status = status
+	}
+	if tasks, ok := updates["tasks"].([]string); ok {
+		session.Tasks = tasks
+	}
+	if endedAt, ok := updates["endedAt"].(time.Time); ok {
+		session.EndedAt = &endedAt
+	}
+	// A nil archivedAt takes the session back out of the archive
+	if archivedAt, ok := updates["archivedAt"]; ok {
+		if at, isTime := archivedAt.(time.Time); isTime {
+			session.ArchivedAt = &at
+		} else if archivedAt == nil {
+			session.ArchivedAt = nil
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// CurrentSchemaVersion is the layout this build reads and writes. Version 1
+// is the original unversioned layout of bare JSON arrays; every later
+// version is reached through the migrations in schemaMigrations.
+var CurrentSchemaVersion = len(schemaMigrations) + 1
+
+// ErrSchemaTooNew is returned for data written by a newer compass
+var ErrSchemaTooNew = errors.New("data was written by a newer version of compass")
+
+// listFile is how entity lists (tasks.json, discoveries.json, ...) are
+// stored: the items together with the schema version they were written in
+type listFile struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	Items         interface{} `json:"items"`
+}
+
+// projectFile stamps project.json with the schema version. Readers decode
+// project.json straight into domain.Project and ignore the extra key.
+type projectFile struct {
+	SchemaVersion int `json:"schemaVersion"`
+	*domain.Project
+}
+
+func checkSchemaVersion(version int) error {
+	if version > CurrentSchemaVersion {
+		return fmt.Errorf("%w: schema version %d, this build supports up to %d", ErrSchemaTooNew, version, CurrentSchemaVersion)
+	}
+	return nil
+}
+
+// decodeList decodes an entity list in either the versioned envelope or the
+// original bare-array form into target
+func decodeList(data []byte, target interface{}) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, target)
+	}
+
+	var envelope struct {
+		SchemaVersion int             `json:"schemaVersion"`
+		Items         json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	if err := checkSchemaVersion(envelope.SchemaVersion); err != nil {
+		return err
+	}
+	if len(envelope.Items) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Items, target)
+}
+
+func (fs *FileStorage) loadList(path string, target interface{}) error {
+	var raw json.RawMessage
+	if err := fs.loadJSON(path, &raw); err != nil {
+		return err
+	}
+	return decodeList(raw, target)
+}
+
+func (fs *FileStorage) saveList(path string, items interface{}) error {
+	return fs.saveJSON(path, listFile{SchemaVersion: CurrentSchemaVersion, Items: items})
+}
+
+func (fs *FileStorage) saveProject(path string, project *domain.Project) error {
+	return fs.saveJSON(path, projectFile{SchemaVersion: CurrentSchemaVersion, Project: project})
+}
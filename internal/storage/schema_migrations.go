@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SchemaMigration upgrades the .compass layout from one schema version to
+// the next. Migrations work on raw JSON rather than domain types so that
+// later changes to the domain cannot alter what an old migration does.
+type SchemaMigration struct {
+	From        int
+	Description string
+	// Migrate rewrites one file, identified by its slash-separated path
+	// relative to .compass, and reports whether the contents changed
+	Migrate func(rel string, data []byte) ([]byte, bool, error)
+}
+
+// schemaMigrations is the registry of forward migrations, in order. Entry i
+// upgrades version i+1 to i+2; append new migrations at the end.
+var schemaMigrations = []SchemaMigration{
+	{
+		From:        1,
+		Description: "stamp entity files with schemaVersion and fill task fields that older files left empty",
+		Migrate:     migrateV1Files,
+	},
+}
+
+// SchemaMigrationReport describes a schema migration, planned or applied
+type SchemaMigrationReport struct {
+	FromVersion int      `json:"fromVersion"`
+	ToVersion   int      `json:"toVersion"`
+	DryRun      bool     `json:"dryRun"`
+	Steps       []string `json:"steps"`
+	Files       []string `json:"files"`
+	Backup      string   `json:"backup,omitempty"`
+}
+
+// BackupsDir is where copies of .compass are kept before destructive changes
+func BackupsDir(basePath string) string {
+	return filepath.Join(basePath, ".compass", "backups")
+}
+
+// MigrateSchema brings the JSON layout under basePath up to
+// CurrentSchemaVersion. Unless dryRun is set, every file is backed up under
+// .compass/backups before anything is rewritten.
+func MigrateSchema(basePath string, dryRun bool) (*SchemaMigrationReport, error) {
+	config, err := ReadConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	version := config.SchemaVersion
+	if version == 0 {
+		version = 1
+	}
+	if err := checkSchemaVersion(version); err != nil {
+		return nil, err
+	}
+
+	report := &SchemaMigrationReport{
+		FromVersion: version,
+		ToVersion:   CurrentSchemaVersion,
+		DryRun:      dryRun,
+		Steps:       make([]string, 0),
+		Files:       make([]string, 0),
+	}
+	if version == CurrentSchemaVersion {
+		return report, nil
+	}
+
+	originals, err := readCompassFiles(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(originals))
+	current := make(map[string][]byte, len(originals))
+	for rel, data := range originals {
+		paths = append(paths, rel)
+		current[rel] = data
+	}
+	sort.Strings(paths)
+
+	changed := make(map[string]bool)
+	for _, migration := range schemaMigrations[version-1:] {
+		report.Steps = append(report.Steps, fmt.Sprintf("v%d to v%d: %s", migration.From, migration.From+1, migration.Description))
+		for _, rel := range paths {
+			data, didChange, err := migration.Migrate(rel, current[rel])
+			if err != nil {
+				return nil, fmt.Errorf("migrating %s to v%d: %w", rel, migration.From+1, err)
+			}
+			if didChange {
+				current[rel] = data
+				changed[rel] = true
+			}
+		}
+	}
+	for _, rel := range paths {
+		if changed[rel] {
+			report.Files = append(report.Files, rel)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if len(report.Files) > 0 {
+		snapshot, err := autoSnapshot(basePath, fmt.Sprintf("schema-v%d", version))
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up before migrating: %w", err)
+		}
+		report.Backup = snapshot.Path
+	}
+
+	compassDir := filepath.Join(basePath, ".compass")
+	if err := writeCompassFiles(compassDir, current, report.Files); err != nil {
+		return nil, err
+	}
+
+	config.SchemaVersion = CurrentSchemaVersion
+	if err := WriteConfig(basePath, config); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// readCompassFiles loads every JSON data file under .compass, keyed by its
+// slash-separated relative path. config.json, backups and the SQLite
+// database are not part of the migrated layout.
+func readCompassFiles(basePath string) (map[string][]byte, error) {
+	compassDir := filepath.Join(basePath, ".compass")
+	files := make(map[string][]byte)
+
+	err := filepath.Walk(compassDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(compassDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if rel == "backups" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel == "config.json" || !(strings.HasSuffix(rel, ".json") || strings.HasSuffix(rel, ".jsonl")) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[rel] = data
+		return nil
+	})
+	return files, err
+}
+
+func writeCompassFiles(dir string, files map[string][]byte, paths []string) error {
+	for _, rel := range paths {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, files[rel]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a rename, so readers see
+// either the old or the new contents
+func writeFileAtomic(path string, data []byte) error {
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// v1 -> v2
+
+func migrateV1Files(rel string, data []byte) ([]byte, bool, error) {
+	parts := strings.Split(rel, "/")
+	if len(parts) < 3 || parts[0] != "projects" {
+		return data, false, nil
+	}
+	name := strings.Join(parts[2:], "/")
+
+	switch {
+	case name == "project.json":
+		return stampObject(data, 2)
+	case name == "tasks.json":
+		return wrapList(data, 2, backfillTaskV1)
+	case name == "discoveries.json", name == "decisions.json", name == "planning/sessions.json",
+		name == "processes.json", name == "process_groups.json",
+		strings.HasPrefix(name, "logs/") && strings.HasSuffix(name, ".json"):
+		return wrapList(data, 2, nil)
+	case name == "history/tasks.jsonl":
+		return backfillHistoryV1(data)
+	}
+	return data, false, nil
+}
+
+func indentJSON(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// stampObject adds a leading schemaVersion key to a JSON object, keeping the
+// order of the existing keys
+func stampObject(data []byte, version int) ([]byte, bool, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) < 2 || trimmed[0] != '{' {
+		return nil, false, fmt.Errorf("expected a JSON object")
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return nil, false, err
+	}
+	if _, ok := probe["schemaVersion"]; ok {
+		return data, false, nil
+	}
+
+	stamped := fmt.Sprintf(`{"schemaVersion":%d`, version)
+	if len(probe) > 0 {
+		stamped += ","
+	}
+	out, err := indentJSON(append([]byte(stamped), trimmed[1:]...))
+	return out, err == nil, err
+}
+
+// wrapList turns a bare JSON array into a versioned list file, optionally
+// rewriting each item on the way
+func wrapList(data []byte, version int, rewrite func(map[string]interface{}) bool) ([]byte, bool, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		// Already versioned
+		return data, false, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, false, err
+	}
+	if items == nil {
+		items = make([]json.RawMessage, 0)
+	}
+
+	if rewrite != nil {
+		for i, item := range items {
+			var fields map[string]interface{}
+			if err := json.Unmarshal(item, &fields); err != nil {
+				return nil, false, fmt.Errorf("item %d: %w", i, err)
+			}
+			if !rewrite(fields) {
+				continue
+			}
+			encoded, err := json.Marshal(fields)
+			if err != nil {
+				return nil, false, err
+			}
+			items[i] = encoded
+		}
+	}
+
+	encoded, err := json.Marshal(struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		Items         []json.RawMessage `json:"items"`
+	}{version, items})
+	if err != nil {
+		return nil, false, err
+	}
+	out, err := indentJSON(encoded)
+	return out, err == nil, err
+}
+
+// backfillHistoryV1 applies the task backfill to every snapshot in a task
+// history file. Unreadable lines are kept as they are.
+func backfillHistoryV1(data []byte) ([]byte, bool, error) {
+	var out bytes.Buffer
+	changed := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var revision map[string]interface{}
+		if err := json.Unmarshal(line, &revision); err == nil {
+			if task, ok := revision["task"].(map[string]interface{}); ok && backfillTaskV1(task) {
+				if encoded, err := json.Marshal(revision); err == nil {
+					line = encoded
+					changed = true
+				}
+			}
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, err
+	}
+	if !changed {
+		return data, false, nil
+	}
+	return out.Bytes(), true, nil
+}
+
+// backfillTaskV1 fills the task fields that v1 files could leave empty and
+// that now decode to invalid zero values
+func backfillTaskV1(task map[string]interface{}) bool {
+	changed := false
+	section := func(name string) map[string]interface{} {
+		value, ok := task[name].(map[string]interface{})
+		if !ok {
+			value = make(map[string]interface{})
+			task[name] = value
+			changed = true
+		}
+		return value
+	}
+	setDefault := func(fields map[string]interface{}, key string, value interface{}) {
+		if current, ok := fields[key]; !ok || current == nil || current == "" {
+			fields[key] = value
+			changed = true
+		}
+	}
+	emptyList := func() []interface{} { return make([]interface{}, 0) }
+
+	card := section("card")
+	setDefault(card, "status", "planned")
+	setDefault(card, "priority", "medium")
+
+	context := section("context")
+	for _, key := range []string{"files", "dependencies", "assumptions", "blockers", "decisions"} {
+		setDefault(context, key, emptyList())
+	}
+	setDefault(context, "confidence", "medium")
+	if verified, _ := context["lastVerified"].(string); verified == "" || strings.HasPrefix(verified, "0001-01-01") {
+		if createdAt, ok := card["createdAt"].(string); ok && createdAt != "" {
+			context["lastVerified"] = createdAt
+			changed = true
+		}
+	}
+
+	criteria := section("criteria")
+	setDefault(criteria, "acceptance", emptyList())
+	setDefault(criteria, "verification", emptyList())
+
+	return changed
+}
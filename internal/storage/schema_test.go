@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// writeV1Workspace lays out .compass the way builds before schema versioning
+// did: no version anywhere and tasks missing fields added later
+func writeV1Workspace(t *testing.T, dir string) {
+	t.Helper()
+	projectDir := filepath.Join(dir, ".compass", "projects", "p1")
+	require.NoError(t, os.MkdirAll(filepath.Join(projectDir, "history"), 0755))
+
+	files := map[string]string{
+		".compass/config.json":                     `{"currentProjectId": "p1"}`,
+		".compass/projects/p1/project.json":        `{"id": "p1", "name": "Legacy", "description": "", "goal": "", "createdAt": "2024-01-01T00:00:00Z", "updatedAt": "2024-01-01T00:00:00Z"}`,
+		".compass/projects/p1/tasks.json":          `[{"id": "t1", "projectId": "p1", "card": {"title": "Old task", "createdAt": "2024-01-02T00:00:00Z", "updatedAt": "2024-01-02T00:00:00Z"}, "context": {}, "criteria": {}}]`,
+		".compass/projects/p1/discoveries.json":    `[]`,
+		".compass/projects/p1/history/tasks.jsonl": `{"at": "2024-01-02T00:00:00Z", "op": "create", "taskId": "t1", "projectId": "p1", "task": {"id": "t1", "projectId": "p1", "card": {"title": "Old task", "createdAt": "2024-01-02T00:00:00Z"}}}` + "\n",
+	}
+	for rel, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.FromSlash(rel)), []byte(content), 0644))
+	}
+}
+
+func TestMigrateSchema_DryRunChangesNothing(t *testing.T) {
+	dir := t.TempDir()
+	writeV1Workspace(t, dir)
+	before, err := os.ReadFile(filepath.Join(dir, ".compass", "projects", "p1", "tasks.json"))
+	require.NoError(t, err)
+
+	report, err := MigrateSchema(dir, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.FromVersion)
+	assert.Equal(t, CurrentSchemaVersion, report.ToVersion)
+	assert.Len(t, report.Steps, CurrentSchemaVersion-1)
+	assert.Equal(t, []string{
+		"projects/p1/discoveries.json",
+		"projects/p1/history/tasks.jsonl",
+		"projects/p1/project.json",
+		"projects/p1/tasks.json",
+	}, report.Files)
+	assert.Empty(t, report.Backup)
+
+	after, err := os.ReadFile(filepath.Join(dir, ".compass", "projects", "p1", "tasks.json"))
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	config, err := ReadConfig(dir)
+	require.NoError(t, err)
+	assert.Zero(t, config.SchemaVersion)
+}
+
+func TestNewFileStorage_MigratesV1Workspace(t *testing.T) {
+	dir := t.TempDir()
+	writeV1Workspace(t, dir)
+
+	fs, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	config, err := ReadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, config.SchemaVersion)
+	require.NotNil(t, config.CurrentProjectID)
+	assert.Equal(t, "p1", *config.CurrentProjectID)
+
+	task, err := fs.GetTask("t1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusPlanned, task.Card.Status)
+	assert.Equal(t, domain.PriorityMedium, task.Card.Priority)
+	assert.Equal(t, domain.ConfidenceMedium, task.Context.Confidence)
+	assert.NotNil(t, task.Context.Dependencies)
+	assert.Equal(t, task.Card.CreatedAt, task.Context.LastVerified)
+
+	revisions, err := fs.ListTaskRevisions("p1")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, domain.StatusPlanned, revisions[0].Task.Card.Status)
+
+	var stamped map[string]interface{}
+	data, err := os.ReadFile(filepath.Join(dir, ".compass", "projects", "p1", "project.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &stamped))
+	assert.EqualValues(t, CurrentSchemaVersion, stamped["schemaVersion"])
+	assert.Equal(t, "Legacy", stamped["name"])
+
+	// The untouched v1 files, config included, were backed up first
+	snapshots, err := ListSnapshots(dir)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, "schema-v1", snapshots[0].Reason)
+	original := snapshotEntries(t, snapshots[0].Path)
+	assert.Contains(t, string(original["projects/p1/tasks.json"]), `[{"id": "t1"`)
+	assert.Contains(t, snapshotNames(t, snapshots[0].Path), "config.json")
+
+	// Writes keep the versioned format and a second open is a no-op
+	_, err = fs.UpdateTask("t1", map[string]interface{}{"title": "Renamed"})
+	require.NoError(t, err)
+	report, err := MigrateSchema(dir, false)
+	require.NoError(t, err)
+	assert.Empty(t, report.Steps)
+}
+
+func TestNewFileStorage_RejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, WriteConfig(dir, &Config{SchemaVersion: CurrentSchemaVersion + 1}))
+
+	_, err := NewFileStorage(dir)
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+}
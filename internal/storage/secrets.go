@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// SecretKeyEnv names the environment variable that overrides where the
+// secret key file is kept
+const SecretKeyEnv = "COMPASS_SECRET_KEY_FILE"
+
+// ErrSecretNotFound is returned for a name the store does not hold
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore keeps named values in .compass/secrets.json, each encrypted
+// with AES-256-GCM under a key that lives outside the workspace. The
+// encrypted file can be committed or synced with the rest of .compass; only
+// machines holding the key file can read it.
+type SecretStore struct {
+	basePath string
+	keyPath  string
+	mu       sync.Mutex
+}
+
+type secretsFile struct {
+	// KeyID identifies the key the values were encrypted with, so a
+	// mismatched key file is reported as such rather than as corruption
+	KeyID   string            `json:"keyId"`
+	Secrets map[string]string `json:"secrets"`
+}
+
+// DefaultSecretKeyPath returns the key file used when SecretKeyEnv is not
+// set: secrets.key in the user's compass configuration directory
+func DefaultSecretKeyPath() (string, error) {
+	if path := os.Getenv(SecretKeyEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate the secret key file, set %s: %w", SecretKeyEnv, err)
+	}
+	return filepath.Join(dir, "compass", "secrets.key"), nil
+}
+
+// NewSecretStore opens the secret store of the workspace at basePath with
+// the key file at keyPath, or at DefaultSecretKeyPath when keyPath is empty.
+// Neither file has to exist until a secret is set.
+func NewSecretStore(basePath, keyPath string) *SecretStore {
+	return &SecretStore{basePath: basePath, keyPath: keyPath}
+}
+
+func (s *SecretStore) path() string {
+	return filepath.Join(s.basePath, ".compass", "secrets.json")
+}
+
+// Set encrypts and stores value under name, creating the key file the
+// first time
+func (s *SecretStore) Set(name, value string) error {
+	if !domain.IsValidSecretName(name) {
+		return fmt.Errorf("invalid secret name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockWorkspace(s.basePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	key, err := s.loadKey(true)
+	if err != nil {
+		return err
+	}
+	file, err := s.load()
+	if err != nil {
+		return err
+	}
+	if len(file.Secrets) > 0 && file.KeyID != keyID(key) {
+		return fmt.Errorf("%s was encrypted with a different key than %s", s.path(), s.keyPath)
+	}
+
+	sealed, err := seal(key, name, value)
+	if err != nil {
+		return err
+	}
+	file.KeyID = keyID(key)
+	file.Secrets[name] = sealed
+	return s.save(file)
+}
+
+// Get decrypts the value stored under name
+func (s *SecretStore) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	sealed, ok := file.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	key, err := s.loadKey(false)
+	if err != nil {
+		return "", err
+	}
+	if file.KeyID != keyID(key) {
+		return "", fmt.Errorf("%s was encrypted with a different key than %s", s.path(), s.keyPath)
+	}
+	return unseal(key, name, sealed)
+}
+
+// Delete removes name from the store
+func (s *SecretStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockWorkspace(s.basePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := file.Secrets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	delete(file.Secrets, name)
+	return s.save(file)
+}
+
+// List returns the names of the stored secrets, sorted. It does not need
+// the key.
+func (s *SecretStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(file.Secrets))
+	for name := range file.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *SecretStore) load() (*secretsFile, error) {
+	file := &secretsFile{}
+	data, err := os.ReadFile(s.path())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.path(), err)
+		}
+	}
+	if file.Secrets == nil {
+		file.Secrets = map[string]string{}
+	}
+	return file, nil
+}
+
+func (s *SecretStore) save(file *secretsFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path()), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(), append(data, '\n'))
+}
+
+// loadKey reads the key file, generating it when create is set and it does
+// not exist yet. The key is 32 random bytes, base64 encoded, readable by
+// the owner only.
+func (s *SecretStore) loadKey(create bool) ([]byte, error) {
+	if s.keyPath == "" {
+		path, err := DefaultSecretKeyPath()
+		if err != nil {
+			return nil, err
+		}
+		s.keyPath = path
+	}
+	data, err := os.ReadFile(s.keyPath)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(s.keyPath), 0700); err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+		file, err := os.OpenFile(s.keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.WriteString(encoded); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return key, file.Close()
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("secret key file %s does not exist", s.keyPath)
+		}
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("secret key file %s does not hold a 32-byte base64 key", s.keyPath)
+	}
+	return key, nil
+}
+
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// seal encrypts value with a fresh nonce. The name is authenticated too, so
+// a value cannot be moved to another name without the key.
+func seal(key []byte, name, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func unseal(key []byte, name, sealed string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupt", name)
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s cannot be decrypted: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretStore(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(t.TempDir(), "compass", "secrets.key")
+	secrets := NewSecretStore(dir, keyPath)
+
+	names, err := secrets.List()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	_, err = secrets.Get("API_TOKEN")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	require.NoError(t, secrets.Set("API_TOKEN", "tok-123456"))
+	require.NoError(t, secrets.Set("db.password", "hunter2"))
+	assert.Error(t, secrets.Set("not a name", "x"))
+
+	info, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(filepath.Join(dir, ".compass", "secrets.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "tok-123456")
+	assert.NotContains(t, string(data), "hunter2")
+
+	value, err := secrets.Get("API_TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, "tok-123456", value)
+	names, err = secrets.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"API_TOKEN", "db.password"}, names)
+
+	// A value copied to another name no longer authenticates
+	tampered := strings.Replace(string(data), `"db.password"`, `"OTHER"`, 1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".compass", "secrets.json"), []byte(tampered), 0644))
+	_, err = secrets.Get("OTHER")
+	assert.Error(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".compass", "secrets.json"), data, 0644))
+
+	// Another key cannot read or add to the store; names stay listable
+	other := NewSecretStore(dir, filepath.Join(t.TempDir(), "other.key"))
+	_, err = other.Get("API_TOKEN")
+	assert.ErrorContains(t, err, "does not exist")
+	assert.ErrorContains(t, other.Set("NEW", "value"), "different key")
+	_, err = other.Get("API_TOKEN")
+	assert.ErrorContains(t, err, "different key")
+	names, err = other.List()
+	require.NoError(t, err)
+	assert.Len(t, names, 2)
+
+	require.NoError(t, secrets.Delete("API_TOKEN"))
+	assert.ErrorIs(t, secrets.Delete("API_TOKEN"), ErrSecretNotFound)
+	value, err = secrets.Get("db.password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+}
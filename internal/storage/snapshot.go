@@ -0,0 +1,728 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Snapshots are gzip-compressed tar archives of .compass kept in
+// .compass/backups. The first entry, snapshot.json, describes the archive;
+// the others are workspace files named relative to .compass. The SQLite
+// database is archived through VACUUM INTO, so the copy is consistent even
+// while a server is writing to it.
+
+// DefaultSnapshotRetention is how many automatic snapshots are kept when
+// config.json does not set snapshotRetention
+const DefaultSnapshotRetention = 10
+
+const (
+	snapshotManifestName = "snapshot.json"
+	automaticPrefix      = "auto-"
+	snapshotExt          = ".tar.gz"
+)
+
+// SnapshotOptions selects what CreateSnapshot archives and where
+type SnapshotOptions struct {
+	// ProjectID limits the snapshot to one project (JSON backend only)
+	ProjectID string
+	Reason    string
+	// Automatic snapshots are pruned to the configured retention
+	Automatic bool
+	// Output writes the archive to this path instead of .compass/backups
+	Output string
+}
+
+// snapshotManifest is stored as snapshot.json inside every archive
+type snapshotManifest struct {
+	CreatedAt     time.Time `json:"createdAt"`
+	Reason        string    `json:"reason,omitempty"`
+	ProjectID     string    `json:"projectId,omitempty"`
+	Automatic     bool      `json:"automatic"`
+	Backend       string    `json:"backend"`
+	SchemaVersion int       `json:"schemaVersion"`
+	Files         int       `json:"files"`
+	// WithoutLogs is set when process logs were left out; restoring the
+	// snapshot keeps the workspace's current logs
+	WithoutLogs bool `json:"withoutLogs,omitempty"`
+}
+
+// Snapshotter gives the service layer access to the snapshots of one
+// workspace
+type Snapshotter struct {
+	basePath string
+}
+
+func NewSnapshotter(basePath string) *Snapshotter {
+	return &Snapshotter{basePath: basePath}
+}
+
+// Snapshot archives the workspace, or one project when projectID is set
+func (s *Snapshotter) Snapshot(projectID, reason string) (*domain.Snapshot, error) {
+	return CreateSnapshot(s.basePath, SnapshotOptions{ProjectID: projectID, Reason: reason})
+}
+
+// AutoSnapshot archives the workspace before a destructive operation
+func (s *Snapshotter) AutoSnapshot(reason string) (*domain.Snapshot, error) {
+	return CreateSnapshot(s.basePath, SnapshotOptions{Reason: reason, Automatic: true})
+}
+
+// CreateSnapshot archives the workspace under basePath while holding the
+// workspace lock, so no compass process writes to it halfway through
+func CreateSnapshot(basePath string, opts SnapshotOptions) (*domain.Snapshot, error) {
+	unlock, err := lockWorkspace(basePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	snapshot, err := writeSnapshot(basePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Automatic {
+		pruneSnapshots(basePath)
+	}
+	return snapshot, nil
+}
+
+// autoSnapshot is CreateSnapshot for callers that already hold the lock
+func autoSnapshot(basePath, reason string) (*domain.Snapshot, error) {
+	snapshot, err := writeSnapshot(basePath, SnapshotOptions{Reason: reason, Automatic: true})
+	if err != nil {
+		return nil, err
+	}
+	pruneSnapshots(basePath)
+	return snapshot, nil
+}
+
+func writeSnapshot(basePath string, opts SnapshotOptions) (*domain.Snapshot, error) {
+	config, err := ReadConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := snapshotManifest{
+		CreatedAt:     time.Now().UTC(),
+		Reason:        opts.Reason,
+		ProjectID:     opts.ProjectID,
+		Automatic:     opts.Automatic,
+		Backend:       config.Storage,
+		SchemaVersion: config.SchemaVersion,
+	}
+	if manifest.Backend == "" {
+		manifest.Backend = BackendJSON
+	}
+
+	compassDir := filepath.Join(basePath, ".compass")
+	root := compassDir
+	if opts.ProjectID != "" {
+		if manifest.Backend == BackendSQLite {
+			return nil, fmt.Errorf("project snapshots are only available with the %s backend", BackendJSON)
+		}
+		if _, err := entityPath(compassDir, opts.ProjectID); err != nil {
+			return nil, err
+		}
+		root = filepath.Join(compassDir, "projects", opts.ProjectID)
+		if _, err := os.Stat(filepath.Join(root, "project.json")); os.IsNotExist(err) {
+			return nil, notFound("project", opts.ProjectID)
+		}
+	}
+
+	files, err := snapshotFiles(compassDir, root)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Automatic {
+		// Automatic snapshots are taken before every destructive change,
+		// and the logs, often the bulk of the workspace, are not needed to
+		// undo one
+		files = withoutProcessLogs(files)
+		manifest.WithoutLogs = true
+	}
+
+	name := snapshotName(manifest)
+	target := opts.Output
+	if target == "" {
+		target = filepath.Join(BackupsDir(basePath), name)
+	} else {
+		name = filepath.Base(target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	// The database is copied first so the archive only ever holds a
+	// consistent one
+	var database string
+	if manifest.Backend == BackendSQLite && opts.ProjectID == "" {
+		if _, err := os.Stat(SQLitePath(basePath)); err == nil {
+			database = target + ".db.tmp"
+			defer os.Remove(database)
+			if err := vacuumInto(SQLitePath(basePath), database); err != nil {
+				return nil, fmt.Errorf("failed to copy the sqlite database: %w", err)
+			}
+			files = append(files, "compass.db")
+		}
+	}
+	manifest.Files = len(files)
+
+	tempPath := target + ".tmp"
+	if err := writeSnapshotArchive(tempPath, manifest, compassDir, files, database); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	if err := os.Rename(tempPath, target); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.snapshot(name, target, info.Size()), nil
+}
+
+func (m snapshotManifest) snapshot(name, path string, size int64) *domain.Snapshot {
+	return &domain.Snapshot{
+		Name:      name,
+		Path:      path,
+		CreatedAt: m.CreatedAt,
+		Reason:    m.Reason,
+		ProjectID: m.ProjectID,
+		Automatic: m.Automatic,
+		Backend:   m.Backend,
+		Files:     m.Files,
+		Size:      size,
+	}
+}
+
+// snapshotName sorts automatic snapshots by age, which pruning relies on
+func snapshotName(manifest snapshotManifest) string {
+	kind := "snapshot"
+	if manifest.Automatic {
+		kind = "auto"
+	}
+	parts := []string{kind, manifest.CreatedAt.Format("20060102T150405.000000Z")}
+	if manifest.ProjectID != "" {
+		parts = append(parts, manifest.ProjectID)
+	}
+	if reason := sanitizeName(manifest.Reason); reason != "" {
+		parts = append(parts, reason)
+	}
+	return strings.Join(parts, "-") + snapshotExt
+}
+
+func sanitizeName(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// snapshotFiles lists the files under root, relative to .compass. Backups,
+// the lock file and the live SQLite files are left out.
+func snapshotFiles(compassDir, root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(compassDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if rel == "backups" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel == ".lock" || strings.HasPrefix(rel, "compass.db") || !entry.Type().IsRegular() {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// withoutProcessLogs drops the files under projects/<id>/logs
+func withoutProcessLogs(files []string) []string {
+	kept := files[:0]
+	for _, name := range files {
+		if !isProcessLog(name) {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+func isProcessLog(name string) bool {
+	parts := strings.SplitN(name, "/", 4)
+	return len(parts) == 4 && parts[0] == "projects" && parts[2] == "logs"
+}
+
+func writeSnapshotArchive(target string, manifest snapshotManifest, compassDir string, files []string, database string) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: snapshotManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := archive.Write(data); err != nil {
+		return err
+	}
+
+	for _, rel := range files {
+		source := filepath.Join(compassDir, filepath.FromSlash(rel))
+		if rel == "compass.db" && database != "" {
+			source = database
+		}
+		if err := addSnapshotFile(archive, rel, source); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func addSnapshotFile(archive *tar.Writer, name, source string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, file)
+	return err
+}
+
+func vacuumInto(dbPath, target string) error {
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath, url.Values{"_pragma": {"busy_timeout(5000)"}}))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`VACUUM INTO ?`, target)
+	return err
+}
+
+// pruneSnapshots removes the oldest automatic snapshots beyond the
+// configured retention. Failures only leave extra snapshots behind, so they
+// are logged.
+func pruneSnapshots(basePath string) {
+	keep := DefaultSnapshotRetention
+	if config, err := ReadConfig(basePath); err == nil && config.SnapshotRetention > 0 {
+		keep = config.SnapshotRetention
+	}
+
+	entries, err := os.ReadDir(BackupsDir(basePath))
+	if err != nil {
+		log.Printf("Snapshots: failed to list %s: %v", BackupsDir(basePath), err)
+		return
+	}
+	var automatic []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), automaticPrefix) && strings.HasSuffix(entry.Name(), snapshotExt) {
+			automatic = append(automatic, entry.Name())
+		}
+	}
+	sort.Strings(automatic)
+	for len(automatic) > keep {
+		if err := os.Remove(filepath.Join(BackupsDir(basePath), automatic[0])); err != nil {
+			log.Printf("Snapshots: failed to prune %s: %v", automatic[0], err)
+		}
+		automatic = automatic[1:]
+	}
+}
+
+// ListSnapshots returns the snapshots in .compass/backups, oldest first
+func ListSnapshots(basePath string) ([]*domain.Snapshot, error) {
+	entries, err := os.ReadDir(BackupsDir(basePath))
+	if os.IsNotExist(err) {
+		return make([]*domain.Snapshot, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*domain.Snapshot, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), snapshotExt) {
+			continue
+		}
+		snapshot, err := ReadSnapshot(filepath.Join(BackupsDir(basePath), entry.Name()))
+		if err != nil {
+			log.Printf("Snapshots: skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sortByTime(snapshots,
+		func(s *domain.Snapshot) time.Time { return s.CreatedAt },
+		func(s *domain.Snapshot) string { return s.Name })
+	return snapshots, nil
+}
+
+// ReadSnapshot describes the snapshot archive at path
+func ReadSnapshot(path string) (*domain.Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	archive, err := openSnapshot(file)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := readSnapshotManifest(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return manifest.snapshot(filepath.Base(path), path, info.Size()), nil
+}
+
+func openSnapshot(file io.Reader) (*tar.Reader, error) {
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("not a compass snapshot: %w", err)
+	}
+	return tar.NewReader(gz), nil
+}
+
+func readSnapshotManifest(archive *tar.Reader) (*snapshotManifest, error) {
+	header, err := archive.Next()
+	if err != nil || header.Name != snapshotManifestName {
+		return nil, fmt.Errorf("not a compass snapshot: %s is missing", snapshotManifestName)
+	}
+	var manifest snapshotManifest
+	if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", snapshotManifestName, err)
+	}
+	return &manifest, nil
+}
+
+// ResolveSnapshot finds a snapshot given either its name in .compass/backups
+// or a path to the archive
+func ResolveSnapshot(basePath, ref string) string {
+	if !strings.ContainsAny(ref, `/\`) {
+		candidate := filepath.Join(BackupsDir(basePath), ref)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ref
+}
+
+// RestoreSnapshot replaces the workspace, or the one project a project
+// snapshot holds, with the contents of the snapshot at archivePath. The
+// archive is extracted and checked next to .compass before anything in the
+// workspace changes, and the current workspace is snapshotted so the
+// restore itself can be undone. Servers using the sqlite backend must be
+// restarted afterwards.
+func RestoreSnapshot(basePath, archivePath string) (*domain.SnapshotRestore, error) {
+	restored, err := ReadSnapshot(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if restored.ProjectID != "" {
+		if _, err := entityPath(basePath, restored.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock, err := lockWorkspace(basePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Read the archive before the safety snapshot can prune it
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Staged beside .compass, so moving the files in is a rename
+	staging, err := os.MkdirTemp(basePath, ".compass-restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	files, withoutLogs, err := extractSnapshot(file, staging, restored.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot restore %s: %w", restored.Name, err)
+	}
+	if files != restored.Files {
+		return nil, fmt.Errorf("cannot restore %s: it holds %d of the %d files it lists", restored.Name, files, restored.Files)
+	}
+
+	compassDir := filepath.Join(basePath, ".compass")
+	if withoutLogs {
+		if err := linkProcessLogs(compassDir, staging, restored.ProjectID); err != nil {
+			return nil, fmt.Errorf("failed to keep the process logs: %w", err)
+		}
+	}
+
+	safety, err := writeSnapshot(basePath, SnapshotOptions{Reason: "pre-restore", Automatic: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot the workspace before restoring: %w", err)
+	}
+
+	if err := swapInRestore(basePath, staging, restored.ProjectID); err != nil {
+		return nil, fmt.Errorf("restore failed, the workspace was left as it was (also in %s): %w", safety.Path, err)
+	}
+
+	pruneSnapshots(basePath)
+	return &domain.SnapshotRestore{Restored: restored, Safety: safety, Files: files}, nil
+}
+
+// restoreEntries lists what a restore replaces, relative to .compass: the
+// project directory for a project snapshot, otherwise every entry of
+// .compass or of the snapshot but the backups and the lock
+func restoreEntries(compassDir, staging, projectID string) ([]string, error) {
+	if projectID != "" {
+		return []string{path.Join("projects", projectID)}, nil
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, dir := range []string{compassDir, staging} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if name == "backups" || name == ".lock" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// swapInRestore moves the extracted files in staging into .compass. What
+// they replace is moved aside first and moved back if the swap fails, so a
+// failed restore leaves the workspace as it was.
+func swapInRestore(basePath, staging, projectID string) error {
+	compassDir := filepath.Join(basePath, ".compass")
+	names, err := restoreEntries(compassDir, staging, projectID)
+	if err != nil {
+		return err
+	}
+	aside, err := os.MkdirTemp(basePath, ".compass-replaced-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(aside)
+
+	var moved, placed []string
+	rollback := func() {
+		for _, name := range placed {
+			os.RemoveAll(filepath.Join(compassDir, filepath.FromSlash(name)))
+		}
+		for _, name := range moved {
+			if err := os.Rename(filepath.Join(aside, filepath.FromSlash(name)), filepath.Join(compassDir, filepath.FromSlash(name))); err != nil {
+				log.Printf("Snapshots: failed to move %s back: %v", name, err)
+			}
+		}
+	}
+	move := func(from, to string) error {
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		return os.Rename(from, to)
+	}
+
+	for _, name := range names {
+		current := filepath.Join(compassDir, filepath.FromSlash(name))
+		if _, err := os.Lstat(current); err == nil {
+			if err := move(current, filepath.Join(aside, filepath.FromSlash(name))); err != nil {
+				rollback()
+				return err
+			}
+			moved = append(moved, name)
+		}
+		replacement := filepath.Join(staging, filepath.FromSlash(name))
+		if _, err := os.Lstat(replacement); err == nil {
+			if err := move(replacement, current); err != nil {
+				rollback()
+				return err
+			}
+			placed = append(placed, name)
+		}
+	}
+	return nil
+}
+
+// linkProcessLogs gives the restored projects the workspace's current
+// process logs, for snapshots taken without them. The files are hard
+// linked, or copied where links are not supported, so the workspace's own
+// copies stay in place until the swap.
+func linkProcessLogs(compassDir, staging, projectID string) error {
+	projects, err := os.ReadDir(filepath.Join(staging, "projects"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		if !project.IsDir() || (projectID != "" && project.Name() != projectID) {
+			continue
+		}
+		logs := filepath.Join(compassDir, "projects", project.Name(), "logs")
+		files, err := os.ReadDir(logs)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(staging, "projects", project.Name(), "logs")
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		for _, file := range files {
+			if !file.Type().IsRegular() {
+				continue
+			}
+			source := filepath.Join(logs, file.Name())
+			if err := os.Link(source, filepath.Join(target, file.Name())); err != nil {
+				if err := copyFile(source, filepath.Join(target, file.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// extractSnapshot writes the files of the archive under dir and returns
+// how many there were and whether the snapshot left out process logs
+func extractSnapshot(file io.Reader, dir, projectID string) (int, bool, error) {
+	archive, err := openSnapshot(file)
+	if err != nil {
+		return 0, false, err
+	}
+	manifest, err := readSnapshotManifest(archive)
+	if err != nil {
+		return 0, false, err
+	}
+
+	files := 0
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files, manifest.WithoutLogs, nil
+		}
+		if err != nil {
+			return files, false, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || name == "backups" || strings.HasPrefix(name, "backups/") ||
+			(projectID != "" && !strings.HasPrefix(name, "projects/"+projectID+"/")) {
+			return files, false, fmt.Errorf("snapshot entry %q is outside what the snapshot covers", header.Name)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return files, false, err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return files, false, err
+		}
+		_, err = io.Copy(out, archive)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return files, false, err
+		}
+		files++
+	}
+}
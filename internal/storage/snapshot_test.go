@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// snapshotEntries returns the files in a snapshot archive by name
+func snapshotEntries(t *testing.T, archivePath string) map[string][]byte {
+	t.Helper()
+	file, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	archive, err := openSnapshot(file)
+	require.NoError(t, err)
+	entries := map[string][]byte{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(archive)
+		require.NoError(t, err)
+		entries[header.Name] = data
+	}
+}
+
+// snapshotNames returns the sorted names of the files in a snapshot archive
+func snapshotNames(t *testing.T, archivePath string) []string {
+	t.Helper()
+	names := make([]string, 0)
+	for name := range snapshotEntries(t, archivePath) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSnapshot_CreateAndList(t *testing.T) {
+	fs, project := newJournalFixture(t)
+	require.NoError(t, fs.CreateTask(domain.NewTask(project.ID, "Kept", "")))
+	require.NoError(t, os.WriteFile(filepath.Join(fs.basePath, ".compass", ".lock"), nil, 0644))
+
+	snapshot, err := CreateSnapshot(fs.basePath, SnapshotOptions{Reason: "manual"})
+	require.NoError(t, err)
+	assert.False(t, snapshot.Automatic)
+	assert.Equal(t, BackendJSON, snapshot.Backend)
+	assert.Equal(t, BackupsDir(fs.basePath), filepath.Dir(snapshot.Path))
+
+	entries := snapshotNames(t, snapshot.Path)
+	assert.Contains(t, entries, snapshotManifestName)
+	assert.Contains(t, entries, "config.json")
+	assert.Contains(t, entries, "projects/"+project.ID+"/project.json")
+	assert.NotContains(t, entries, ".lock")
+	assert.Equal(t, len(entries)-1, snapshot.Files)
+
+	projectSnapshot, err := CreateSnapshot(fs.basePath, SnapshotOptions{ProjectID: project.ID})
+	require.NoError(t, err)
+	for _, name := range snapshotNames(t, projectSnapshot.Path) {
+		if name != snapshotManifestName {
+			assert.Contains(t, name, "projects/"+project.ID+"/")
+		}
+	}
+
+	snapshots, err := ListSnapshots(fs.basePath)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, snapshot.Name, snapshots[0].Name)
+	assert.Equal(t, project.ID, snapshots[1].ProjectID)
+
+	_, err = CreateSnapshot(fs.basePath, SnapshotOptions{ProjectID: "../escape"})
+	assert.Error(t, err)
+}
+
+func TestSnapshot_AutomaticRetention(t *testing.T) {
+	fs, _ := newJournalFixture(t)
+	config, err := ReadConfig(fs.basePath)
+	require.NoError(t, err)
+	config.SnapshotRetention = 2
+	require.NoError(t, WriteConfig(fs.basePath, config))
+
+	manual, err := CreateSnapshot(fs.basePath, SnapshotOptions{})
+	require.NoError(t, err)
+	snapshotter := NewSnapshotter(fs.basePath)
+	var latest *domain.Snapshot
+	for i := 0; i < 4; i++ {
+		latest, err = snapshotter.AutoSnapshot("task-delete")
+		require.NoError(t, err)
+	}
+
+	snapshots, err := ListSnapshots(fs.basePath)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 3, "manual snapshots are never pruned")
+	assert.Equal(t, manual.Name, snapshots[0].Name)
+	assert.Equal(t, latest.Name, snapshots[2].Name)
+	assert.True(t, snapshots[1].Automatic)
+	assert.Equal(t, "task-delete", snapshots[1].Reason)
+}
+
+func TestSnapshot_RestoreUndoesChanges(t *testing.T) {
+	fs, project := newJournalFixture(t)
+	task := domain.NewTask(project.ID, "Precious", "")
+	require.NoError(t, fs.CreateTask(task))
+
+	snapshot, err := NewSnapshotter(fs.basePath).AutoSnapshot("task-delete")
+	require.NoError(t, err)
+	require.NoError(t, fs.DeleteTask(task.ID))
+	added := domain.NewProject("Added later", "", "")
+	require.NoError(t, fs.CreateProject(added))
+	require.NoError(t, fs.Close())
+
+	restore, err := RestoreSnapshot(fs.basePath, ResolveSnapshot(fs.basePath, snapshot.Name))
+	require.NoError(t, err)
+	assert.Equal(t, snapshot.Name, restore.Restored.Name)
+	assert.Equal(t, "pre-restore", restore.Safety.Reason)
+	assert.Positive(t, restore.Files)
+
+	reopened, err := NewFileStorage(fs.basePath)
+	require.NoError(t, err)
+	defer reopened.Close()
+	got, err := reopened.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Precious", got.Card.Title)
+	_, err = reopened.GetProject(added.ID)
+	assert.Error(t, err)
+
+	// The safety snapshot still has the state the restore replaced
+	assert.Contains(t, snapshotNames(t, restore.Safety.Path), "projects/"+added.ID+"/project.json")
+}
+
+func TestSnapshot_RestoreProjectLeavesOthersAlone(t *testing.T) {
+	fs, project := newJournalFixture(t)
+	require.NoError(t, fs.CreateTask(domain.NewTask(project.ID, "Before", "")))
+	other := domain.NewProject("Other", "", "")
+	require.NoError(t, fs.CreateProject(other))
+
+	snapshot, err := CreateSnapshot(fs.basePath, SnapshotOptions{ProjectID: project.ID})
+	require.NoError(t, err)
+	after := domain.NewTask(project.ID, "After", "")
+	require.NoError(t, fs.CreateTask(after))
+	otherTask := domain.NewTask(other.ID, "Untouched", "")
+	require.NoError(t, fs.CreateTask(otherTask))
+	require.NoError(t, fs.Close())
+
+	_, err = RestoreSnapshot(fs.basePath, snapshot.Path)
+	require.NoError(t, err)
+
+	reopened, err := NewFileStorage(fs.basePath)
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, err = reopened.GetTask(after.ID)
+	assert.Error(t, err)
+	_, err = reopened.GetTask(otherTask.ID)
+	assert.NoError(t, err)
+}
+
+func TestSnapshot_RejectsForeignArchives(t *testing.T) {
+	fs, _ := newJournalFixture(t)
+	bogus := filepath.Join(t.TempDir(), "bogus.tar.gz")
+	require.NoError(t, os.WriteFile(bogus, []byte("not gzip"), 0644))
+
+	_, err := RestoreSnapshot(fs.basePath, bogus)
+	assert.Error(t, err)
+	_, err = fs.ListProjects()
+	assert.NoError(t, err, "a rejected restore leaves the workspace alone")
+}
+
+func TestSnapshot_RestoreChecksTheArchiveFirst(t *testing.T) {
+	fs, project := newJournalFixture(t)
+	task := domain.NewTask(project.ID, "Still here", "")
+	require.NoError(t, fs.CreateTask(task))
+	require.NoError(t, fs.Close())
+
+	// A valid manifest and first file, then an entry that escapes .compass
+	archivePath := filepath.Join(t.TempDir(), "bad.tar.gz")
+	file, err := os.Create(archivePath)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+	manifest, err := json.Marshal(snapshotManifest{Backend: BackendJSON, Files: 2})
+	require.NoError(t, err)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{snapshotManifestName, manifest},
+		{"config.json", []byte("{}\n")},
+		{"../escape.json", []byte("{}\n")},
+	} {
+		require.NoError(t, archive.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.data))}))
+		_, err = archive.Write(entry.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, file.Close())
+
+	_, err = RestoreSnapshot(fs.basePath, archivePath)
+	assert.ErrorContains(t, err, "outside what the snapshot covers")
+
+	reopened, err := NewFileStorage(fs.basePath)
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, err = reopened.GetTask(task.ID)
+	assert.NoError(t, err, "a rejected archive leaves the workspace alone")
+	leftovers, err := filepath.Glob(filepath.Join(fs.basePath, ".compass-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestSnapshot_AutomaticSnapshotsLeaveOutLogs(t *testing.T) {
+	fs, project := newJournalFixture(t)
+	process := domain.NewProcess(project.ID, "api", "go", nil)
+	require.NoError(t, fs.SaveProcess(project.ID, process))
+	require.NoError(t, fs.SaveProcessLogs([]*domain.ProcessLog{{ID: "log-1", ProcessID: process.ID, Type: domain.LogTypeStdout, Message: "before"}}))
+
+	snapshot, err := NewSnapshotter(fs.basePath).AutoSnapshot("task-delete")
+	require.NoError(t, err)
+	for _, name := range snapshotNames(t, snapshot.Path) {
+		assert.NotContains(t, name, "/logs/")
+	}
+
+	// Restoring it keeps the logs written since
+	require.NoError(t, fs.SaveProcessLogs([]*domain.ProcessLog{{ID: "log-2", ProcessID: process.ID, Type: domain.LogTypeStdout, Message: "after"}}))
+	require.NoError(t, fs.Close())
+	_, err = RestoreSnapshot(fs.basePath, snapshot.Path)
+	require.NoError(t, err)
+
+	reopened, err := NewFileStorage(fs.basePath)
+	require.NoError(t, err)
+	defer reopened.Close()
+	logs, err := reopened.GetProcessLogs(process.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, "after", logs[1].Message)
+}
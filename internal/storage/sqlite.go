@@ -0,0 +1,984 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// SQLiteStorage keeps every entity as a JSON document in an embedded SQLite
+// database. Documents are stored whole so the domain types stay the single
+// source of truth; the extra columns exist only to index lookups.
+type SQLiteStorage struct {
+	db   *sql.DB
+	path string
+	// tx is set on the view a Transaction callback works through
+	tx *sql.Tx
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS projects (
+	id   TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS tasks (
+	id         TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_status ON tasks (project_id, status);
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks (status);
+CREATE TABLE IF NOT EXISTS task_labels (
+	task_id TEXT NOT NULL,
+	label   TEXT NOT NULL,
+	PRIMARY KEY (task_id, label)
+);
+CREATE INDEX IF NOT EXISTS idx_task_labels_label ON task_labels (label);
+CREATE TABLE IF NOT EXISTS task_revisions (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	project_id TEXT NOT NULL,
+	task_id    TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_task_revisions_project ON task_revisions (project_id);
+CREATE TABLE IF NOT EXISTS planning_sessions (
+	id         TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_planning_sessions_project ON planning_sessions (project_id);
+CREATE TABLE IF NOT EXISTS discoveries (
+	id         TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_discoveries_project ON discoveries (project_id);
+CREATE TABLE IF NOT EXISTS decisions (
+	id         TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_decisions_project ON decisions (project_id);
+CREATE TABLE IF NOT EXISTS processes (
+	id         TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	type       TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_processes_project ON processes (project_id);
+CREATE TABLE IF NOT EXISTS process_groups (
+	id         TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS process_logs (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	process_id TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_process_logs_process ON process_logs (process_id);
+`
+
+const metaCurrentProject = "currentProjectId"
+
+// SQLitePath is where the SQLite backend keeps its database for a workspace
+func SQLitePath(basePath string) string {
+	return filepath.Join(basePath, ".compass", "compass.db")
+}
+
+// NewSQLiteStorage opens (creating if needed) the database at path
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to initialize sqlite storage: %w", err)
+	}
+
+	// Write transactions take the lock up front so concurrent writers wait on
+	// busy_timeout instead of failing when a read lock is upgraded
+	dsn := sqliteDSN(path, url.Values{
+		"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)", "synchronous(NORMAL)"},
+		"_txlock": {"immediate"},
+	})
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize sqlite storage: %w", err)
+	}
+	// A single connection serializes access within the process; other
+	// processes are coordinated by SQLite's own locking
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize sqlite storage: %w", err)
+	}
+
+	return &SQLiteStorage{db: db, path: path}, nil
+}
+
+// sqliteDSN builds the file: URI the driver opens path with. Escaping the
+// path keeps a "?", "#" or "%" in it from being read as the start of the
+// parameters or as an escape.
+func sqliteDSN(path string, params url.Values) string {
+	dsn := url.URL{Scheme: "file", OmitHost: true, Path: path, RawQuery: params.Encode()}
+	return dsn.String()
+}
+
+// Close releases the database handle
+func (ss *SQLiteStorage) Close() error {
+	return ss.db.Close()
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// q is where reads go: the enclosing transaction, if any, or the database
+func (ss *SQLiteStorage) q() querier {
+	if ss.tx != nil {
+		return ss.tx
+	}
+	return ss.db
+}
+
+// withTx runs fn in a transaction, committing only if fn succeeds. Inside
+// a Transaction fn joins the enclosing one.
+func (ss *SQLiteStorage) withTx(fn func(tx *sql.Tx) error) error {
+	if ss.tx != nil {
+		return fn(ss.tx)
+	}
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Transaction runs fn in one database transaction. Write transactions take
+// the database lock when they begin, so other writers wait for this one.
+func (ss *SQLiteStorage) Transaction(fn func(tx Store) error) error {
+	if ss.tx != nil {
+		return fn(ss)
+	}
+	return ss.withTx(func(tx *sql.Tx) error {
+		return fn(&SQLiteStorage{db: ss.db, path: ss.path, tx: tx})
+	})
+}
+
+func encodeDoc(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// getDoc decodes the single document selected by query into target. It
+// returns sql.ErrNoRows when nothing matches.
+func getDoc(q querier, target interface{}, query string, args ...interface{}) error {
+	var data string
+	if err := q.QueryRow(query, args...).Scan(&data); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), target)
+}
+
+// listDocs decodes every document selected by query
+func listDocs[T any](q querier, query string, args ...interface{}) ([]*T, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*T
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var value T
+		if err := json.Unmarshal([]byte(data), &value); err != nil {
+			return nil, err
+		}
+		result = append(result, &value)
+	}
+	return result, rows.Err()
+}
+
+func exists(q querier, query string, args ...interface{}) (bool, error) {
+	var one int
+	err := q.QueryRow(query, args...).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Task Repository Implementation
+func (ss *SQLiteStorage) CreateTask(task *domain.Task) error {
+	return ss.withTx(func(tx *sql.Tx) error {
+		found, err := exists(tx, `SELECT 1 FROM tasks WHERE id = ?`, task.ID)
+		if err != nil {
+			return err
+		}
+		if found {
+			return conflict("task", task.ID)
+		}
+		if err := insertTask(tx, task); err != nil {
+			return err
+		}
+		return insertTaskRevision(tx, domain.NewTaskRevision(domain.RevisionCreate, task))
+	})
+}
+
+func insertTask(q querier, task *domain.Task) error {
+	data, err := encodeDoc(task)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(`INSERT INTO tasks (id, project_id, status, data) VALUES (?, ?, ?, ?)`,
+		task.ID, task.ProjectID, string(task.Card.Status), data); err != nil {
+		return err
+	}
+	return insertTaskLabels(q, task)
+}
+
+func insertTaskLabels(q querier, task *domain.Task) error {
+	for _, label := range task.Card.Labels {
+		if _, err := q.Exec(`INSERT OR IGNORE INTO task_labels (task_id, label) VALUES (?, ?)`, task.ID, label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertTaskRevision(q querier, revision *domain.TaskRevision) error {
+	data, err := encodeDoc(revision)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO task_revisions (project_id, task_id, data) VALUES (?, ?, ?)`,
+		revision.ProjectID, revision.TaskID, data)
+	return err
+}
+
+func getTask(q querier, id string) (*domain.Task, error) {
+	var task domain.Task
+	err := getDoc(q, &task, `SELECT data FROM tasks WHERE id = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("task", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (ss *SQLiteStorage) UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error) {
+	var updated *domain.Task
+	err := ss.withTx(func(tx *sql.Tx) error {
+		task, err := getTask(tx, id)
+		if err != nil {
+			return err
+		}
+
+		updated, err = domain.ApplyTaskPatch(task, updates)
+		if err != nil {
+			return taskPatchError(err)
+		}
+
+		data, err := encodeDoc(updated)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE tasks SET project_id = ?, status = ?, data = ? WHERE id = ?`,
+			updated.ProjectID, string(updated.Card.Status), data, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM task_labels WHERE task_id = ?`, id); err != nil {
+			return err
+		}
+		if err := insertTaskLabels(tx, updated); err != nil {
+			return err
+		}
+		return insertTaskRevision(tx, domain.NewTaskRevision(domain.RevisionUpdate, updated))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (ss *SQLiteStorage) GetTask(id string) (*domain.Task, error) {
+	return getTask(ss.q(), id)
+}
+
+// ListTasks narrows the candidates with the project, status and label
+// indexes, then applies the full filter so results match every other backend
+func (ss *SQLiteStorage) ListTasks(filter domain.TaskFilter) ([]*domain.Task, error) {
+	var where []string
+	var args []interface{}
+
+	if filter.ProjectID != nil {
+		where = append(where, "project_id = ?")
+		args = append(args, *filter.ProjectID)
+	}
+	if filter.Status != nil {
+		where = append(where, "status = ?")
+		args = append(args, string(*filter.Status))
+	}
+	if len(filter.Labels) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Labels)), ", ")
+		where = append(where, "id IN (SELECT task_id FROM task_labels WHERE label IN ("+placeholders+") GROUP BY task_id HAVING COUNT(*) = ?)")
+		labels := make(map[string]bool)
+		for _, label := range filter.Labels {
+			args = append(args, label)
+			labels[label] = true
+		}
+		args = append(args, len(labels))
+	}
+
+	query := `SELECT data FROM tasks`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	tasks, err := listDocs[domain.Task](ss.q(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return domain.ApplyTaskQuery(tasks, filter), nil
+}
+
+func (ss *SQLiteStorage) DeleteTask(id string) error {
+	return ss.withTx(func(tx *sql.Tx) error {
+		task, err := getTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM task_labels WHERE task_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM tasks WHERE id = ?`, id); err != nil {
+			return err
+		}
+		return insertTaskRevision(tx, domain.NewTaskRevision(domain.RevisionDelete, task))
+	})
+}
+
+// ListTaskRevisions returns the recorded task history for a project, or for
+// every project when projectID is empty
+func (ss *SQLiteStorage) ListTaskRevisions(projectID string) ([]*domain.TaskRevision, error) {
+	if projectID == "" {
+		return listDocs[domain.TaskRevision](ss.q(), `SELECT data FROM task_revisions ORDER BY seq`)
+	}
+	return listDocs[domain.TaskRevision](ss.q(), `SELECT data FROM task_revisions WHERE project_id = ? ORDER BY seq`, projectID)
+}
+
+// Project Repository Implementation
+func (ss *SQLiteStorage) CreateProject(project *domain.Project) error {
+	return ss.withTx(func(tx *sql.Tx) error {
+		found, err := exists(tx, `SELECT 1 FROM projects WHERE id = ?`, project.ID)
+		if err != nil {
+			return err
+		}
+		if found {
+			return conflict("project", project.ID)
+		}
+		return insertProject(tx, project)
+	})
+}
+
+func insertProject(q querier, project *domain.Project) error {
+	data, err := encodeDoc(project)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO projects (id, data) VALUES (?, ?)`, project.ID, data)
+	return err
+}
+
+func getProject(q querier, id string) (*domain.Project, error) {
+	var project domain.Project
+	err := getDoc(q, &project, `SELECT data FROM projects WHERE id = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("project", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (ss *SQLiteStorage) GetProject(id string) (*domain.Project, error) {
+	return getProject(ss.q(), id)
+}
+
+func (ss *SQLiteStorage) UpdateProject(id string, updates map[string]interface{}) (*domain.Project, error) {
+	var project *domain.Project
+	err := ss.withTx(func(tx *sql.Tx) error {
+		var err error
+		project, err = getProject(tx, id)
+		if err != nil {
+			return err
+		}
+
+		applyProjectUpdates(project, updates)
+
+		data, err := encodeDoc(project)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE projects SET data = ? WHERE id = ?`, data, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func (ss *SQLiteStorage) ListProjects() ([]*domain.Project, error) {
+	projects, err := listDocs[domain.Project](ss.q(), `SELECT data FROM projects`)
+	if err != nil {
+		return nil, err
+	}
+	sortProjects(projects)
+	return projects, nil
+}
+
+func (ss *SQLiteStorage) SetCurrentProject(id string) error {
+	return ss.withTx(func(tx *sql.Tx) error {
+		if _, err := getProject(tx, id); err != nil {
+			return err
+		}
+		return setMeta(tx, metaCurrentProject, id)
+	})
+}
+
+func setMeta(q querier, key, value string) error {
+	_, err := q.Exec(`INSERT INTO meta (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+func (ss *SQLiteStorage) GetCurrentProject() (*domain.Project, error) {
+	var id string
+	err := ss.q().QueryRow(`SELECT value FROM meta WHERE key = ?`, metaCurrentProject).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNoCurrentProject
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getProject(ss.q(), id)
+}
+
+// Planning Storage Implementation
+func (ss *SQLiteStorage) CreatePlanningSession(session *domain.PlanningSession) error {
+	return ss.createDoc("planning session", `planning_sessions`, session.ID, session.ProjectID, session)
+}
+
+// createDoc inserts a document keyed by ID and project, rejecting duplicates
+func (ss *SQLiteStorage) createDoc(entity, table, id, projectID string, value interface{}) error {
+	return ss.withTx(func(tx *sql.Tx) error {
+		return insertDoc(tx, entity, table, id, projectID, value)
+	})
+}
+
+func insertDoc(q querier, entity, table, id, projectID string, value interface{}) error {
+	found, err := exists(q, `SELECT 1 FROM `+table+` WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if found {
+		return conflict(entity, id)
+	}
+	data, err := encodeDoc(value)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO `+table+` (id, project_id, data) VALUES (?, ?, ?)`, id, projectID, data)
+	return err
+}
+
+func getPlanningSession(q querier, id string) (*domain.PlanningSession, error) {
+	var session domain.PlanningSession
+	err := getDoc(q, &session, `SELECT data FROM planning_sessions WHERE id = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("planning session", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (ss *SQLiteStorage) GetPlanningSession(id string) (*domain.PlanningSession, error) {
+	return getPlanningSession(ss.q(), id)
+}
+
+func (ss *SQLiteStorage) ListPlanningSessions(projectID string) ([]*domain.PlanningSession, error) {
+	sessions, err := listDocs[domain.PlanningSession](ss.q(), `SELECT data FROM planning_sessions WHERE project_id = ?`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	sortPlanningSessions(sessions)
+	return sessions, nil
+}
+
+func (ss *SQLiteStorage) UpdatePlanningSession(id string, updates map[string]interface{}) (*domain.PlanningSession, error) {
+	var session *domain.PlanningSession
+	err := ss.withTx(func(tx *sql.Tx) error {
+		var err error
+		session, err = getPlanningSession(tx, id)
+		if err != nil {
+			return err
+		}
+
+		applyPlanningSessionUpdates(session, updates)
+
+		data, err := encodeDoc(session)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE planning_sessions SET data = ? WHERE id = ?`, data, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Discovery Storage Implementation
+func (ss *SQLiteStorage) CreateDiscovery(discovery *domain.Discovery) error {
+	return ss.createDoc("discovery", `discoveries`, discovery.ID, discovery.ProjectID, discovery)
+}
+
+func (ss *SQLiteStorage) ListDiscoveries(projectID string) ([]*domain.Discovery, error) {
+	discoveries, err := listDocs[domain.Discovery](ss.q(), `SELECT data FROM discoveries WHERE project_id = ?`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	sortDiscoveries(discoveries)
+	return discoveries, nil
+}
+
+// Decision Storage Implementation
+func (ss *SQLiteStorage) CreateDecision(decision *domain.Decision) error {
+	return ss.createDoc("decision", `decisions`, decision.ID, decision.ProjectID, decision)
+}
+
+func (ss *SQLiteStorage) ListDecisions(projectID string) ([]*domain.Decision, error) {
+	decisions, err := listDocs[domain.Decision](ss.q(), `SELECT data FROM decisions WHERE project_id = ?`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	sortDecisions(decisions)
+	return decisions, nil
+}
+
+// Process Storage Implementation
+func (ss *SQLiteStorage) SaveProcess(projectID string, process *domain.Process) error {
+	return saveProcess(ss.q(), projectID, process)
+}
+
+func saveProcess(q querier, projectID string, process *domain.Process) error {
+	data, err := encodeDoc(process)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO processes (id, project_id, status, type, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET project_id = excluded.project_id, status = excluded.status, type = excluded.type, data = excluded.data`,
+		process.ID, projectID, string(process.Status), string(process.Type), data)
+	return err
+}
+
+func (ss *SQLiteStorage) GetProcess(processID string) (*domain.Process, error) {
+	var process domain.Process
+	err := getDoc(ss.q(), &process, `SELECT data FROM processes WHERE id = ?`, processID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("process", processID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &process, nil
+}
+
+func (ss *SQLiteStorage) ListProcesses(filter domain.ProcessFilter) ([]*domain.Process, error) {
+	var where []string
+	var args []interface{}
+
+	if filter.ProjectID != nil {
+		where = append(where, "project_id = ?")
+		args = append(args, *filter.ProjectID)
+	}
+	if filter.Status != nil {
+		where = append(where, "status = ?")
+		args = append(args, string(*filter.Status))
+	}
+	if filter.Type != nil {
+		where = append(where, "type = ?")
+		args = append(args, string(*filter.Type))
+	}
+
+	query := `SELECT data FROM processes`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	processes, err := listDocs[domain.Process](ss.q(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	sortProcesses(processes)
+	return processes, nil
+}
+
+func (ss *SQLiteStorage) SaveProcessGroup(projectID string, group *domain.ProcessGroup) error {
+	return saveProcessGroup(ss.q(), projectID, group)
+}
+
+func saveProcessGroup(q querier, projectID string, group *domain.ProcessGroup) error {
+	data, err := encodeDoc(group)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO process_groups (id, project_id, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET project_id = excluded.project_id, data = excluded.data`,
+		group.ID, projectID, data)
+	return err
+}
+
+func (ss *SQLiteStorage) GetProcessGroup(groupID string) (*domain.ProcessGroup, error) {
+	var group domain.ProcessGroup
+	err := getDoc(ss.q(), &group, `SELECT data FROM process_groups WHERE id = ?`, groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("process group", groupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// SaveProcessLogs appends logs to their processes. Like FileStorage, logs for
+// processes that were never saved are dropped.
+func (ss *SQLiteStorage) SaveProcessLogs(logs []*domain.ProcessLog) error {
+	if ss.tx != nil {
+		return ErrNotTransactional
+	}
+	return ss.withTx(func(tx *sql.Tx) error {
+		known := make(map[string]bool)
+		for _, log := range logs {
+			ok, seen := known[log.ProcessID]
+			if !seen {
+				var err error
+				ok, err = exists(tx, `SELECT 1 FROM processes WHERE id = ?`, log.ProcessID)
+				if err != nil {
+					return err
+				}
+				known[log.ProcessID] = ok
+			}
+			if !ok {
+				continue
+			}
+			if err := insertProcessLog(tx, log); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertProcessLog(q querier, log *domain.ProcessLog) error {
+	data, err := encodeDoc(log)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO process_logs (process_id, data) VALUES (?, ?)`, log.ProcessID, data)
+	return err
+}
+
+func (ss *SQLiteStorage) GetProcessLogs(processID string, limit int) ([]*domain.ProcessLog, error) {
+	found, err := exists(ss.q(), `SELECT 1 FROM processes WHERE id = ?`, processID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, notFound("process", processID)
+	}
+
+	if limit <= 0 {
+		logs, err := listDocs[domain.ProcessLog](ss.q(), `SELECT data FROM process_logs WHERE process_id = ? ORDER BY seq`, processID)
+		if err != nil {
+			return nil, err
+		}
+		if logs == nil {
+			logs = make([]*domain.ProcessLog, 0)
+		}
+		return logs, nil
+	}
+
+	// Return last N logs, oldest first
+	logs, err := listDocs[domain.ProcessLog](ss.q(), `SELECT data FROM process_logs WHERE process_id = ? ORDER BY seq DESC LIMIT ?`, processID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+	if logs == nil {
+		logs = make([]*domain.ProcessLog, 0)
+	}
+	return logs, nil
+}
+
+// prunedLogsWhere matches the logs domain.RetainLogs drops for process ?1,
+// cutoff ?2 (empty for none) and keep ?3 (-1 for no limit): those logged
+// before the cutoff, and those older than the newest keep of the rest.
+// SQLite compares the timestamps to the millisecond.
+const prunedLogsWhere = `process_id = ?1 AND (
+	(?2 != '' AND unixepoch(json_extract(data, '$.timestamp'), 'subsec') < unixepoch(?2, 'subsec'))
+	OR seq < (SELECT MIN(seq) FROM (
+		SELECT seq FROM process_logs
+		WHERE process_id = ?1 AND NOT (?2 != '' AND unixepoch(json_extract(data, '$.timestamp'), 'subsec') < unixepoch(?2, 'subsec'))
+		ORDER BY seq DESC LIMIT ?3)))`
+
+// PruneProcessLogs deletes the logs domain.RetainLogs drops with a single
+// statement, or with dryRun set only counts them
+func (ss *SQLiteStorage) PruneProcessLogs(processID string, before time.Time, keep int, dryRun bool) (int, error) {
+	if ss.tx != nil {
+		return 0, ErrNotTransactional
+	}
+	cutoff := ""
+	if !before.IsZero() {
+		cutoff = before.UTC().Format(time.RFC3339Nano)
+	}
+	if keep <= 0 {
+		keep = -1
+	}
+
+	removed := 0
+	err := ss.withTx(func(tx *sql.Tx) error {
+		found, err := exists(tx, `SELECT 1 FROM processes WHERE id = ?`, processID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return notFound("process", processID)
+		}
+
+		if dryRun {
+			return tx.QueryRow(`SELECT COUNT(*) FROM process_logs WHERE `+prunedLogsWhere, processID, cutoff, keep).Scan(&removed)
+		}
+		result, err := tx.Exec(`DELETE FROM process_logs WHERE `+prunedLogsWhere, processID, cutoff, keep)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		removed = int(affected)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// Check runs SQLite's own integrity check and then verifies that every
+// entity belongs to an existing project and only refers to tasks that
+// exist. With repair set, the repairable issues are fixed in one
+// transaction after the database is copied under .compass/backups.
+func (ss *SQLiteStorage) Check(repair bool) (*domain.CheckReport, error) {
+	if ss.tx != nil {
+		return nil, ErrNotTransactional
+	}
+	var problems []string
+	rows, err := ss.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	w, err := loadCheckedWorkspace(ss.q())
+	if err != nil {
+		return nil, err
+	}
+	if repair && w.repairable() {
+		backup := filepath.Join(filepath.Dir(ss.path), "backups", "fsck-"+time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.MkdirAll(backup, 0755); err != nil {
+			return nil, err
+		}
+		if _, err := ss.db.Exec(`VACUUM INTO ?`, filepath.Join(backup, filepath.Base(ss.path))); err != nil {
+			return nil, fmt.Errorf("failed to back up before repairing: %w", err)
+		}
+
+		// Check again inside the transaction so the fixes apply to what is
+		// actually stored
+		err := ss.withTx(func(tx *sql.Tx) error {
+			w, err = loadCheckedWorkspace(tx)
+			if err != nil {
+				return err
+			}
+			return w.repairSQLite(tx)
+		})
+		if err != nil {
+			return nil, err
+		}
+		report := w.report(BackendSQLite, true)
+		report.Backup = backup
+		report.Issues = append(integrityIssues(problems), report.Issues...)
+		return report, nil
+	}
+
+	report := w.report(BackendSQLite, false)
+	report.Issues = append(integrityIssues(problems), report.Issues...)
+	return report, nil
+}
+
+func integrityIssues(problems []string) []*domain.CheckIssue {
+	issues := make([]*domain.CheckIssue, 0, len(problems))
+	for _, problem := range problems {
+		issues = append(issues, &domain.CheckIssue{Severity: domain.SeverityError, Code: "database-corrupt", Message: problem})
+	}
+	return issues
+}
+
+func loadCheckedWorkspace(q querier) (*checkedWorkspace, error) {
+	w := newCheckedWorkspace()
+
+	rows, err := q.Query(`SELECT id FROM projects`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		w.projects[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if w.tasks, err = listHeldDocs[domain.Task](q, `SELECT project_id, data FROM tasks ORDER BY id`); err != nil {
+		return nil, err
+	}
+	if w.discoveries, err = listHeldDocs[domain.Discovery](q, `SELECT project_id, data FROM discoveries ORDER BY id`); err != nil {
+		return nil, err
+	}
+	if w.processes, err = listHeldDocs[domain.Process](q, `SELECT project_id, data FROM processes ORDER BY id`); err != nil {
+		return nil, err
+	}
+
+	err = q.QueryRow(`SELECT value FROM meta WHERE key = ?`, metaCurrentProject).Scan(&w.currentProject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	w.check()
+	return w, nil
+}
+
+// listHeldDocs decodes the (project_id, data) rows selected by query,
+// grouped by project
+func listHeldDocs[T any](q querier, query string) (map[string][]*T, error) {
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[string][]*T)
+	for rows.Next() {
+		var projectID, data string
+		if err := rows.Scan(&projectID, &data); err != nil {
+			return nil, err
+		}
+		var value T
+		if err := json.Unmarshal([]byte(data), &value); err != nil {
+			return nil, err
+		}
+		groups[projectID] = append(groups[projectID], &value)
+	}
+	return groups, rows.Err()
+}
+
+func (w *checkedWorkspace) repairSQLite(tx *sql.Tx) error {
+	for _, task := range w.repairedTasks(time.Now()) {
+		data, err := encodeDoc(task)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE tasks SET project_id = ?, data = ? WHERE id = ?`, task.ProjectID, data, task.ID); err != nil {
+			return err
+		}
+		if err := insertTaskRevision(tx, domain.NewTaskRevision(domain.RevisionUpdate, task)); err != nil {
+			return err
+		}
+	}
+	for _, id := range sortedKeys(w.dirtyDiscoveries) {
+		for _, discovery := range w.discoveries[id] {
+			data, err := encodeDoc(discovery)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`UPDATE discoveries SET data = ? WHERE id = ?`, data, discovery.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range sortedKeys(w.dirtyProcesses) {
+		for _, process := range w.processes[id] {
+			if err := saveProcess(tx, id, process); err != nil {
+				return err
+			}
+		}
+	}
+	if w.clearCurrent {
+		if _, err := tx.Exec(`DELETE FROM meta WHERE key = ?`, metaCurrentProject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+func TestMigrateJSONToSQLite(t *testing.T) {
+	dir := t.TempDir()
+	fileStorage, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	project := domain.NewProject("Migrated", "JSON layout", "Move to sqlite")
+	require.NoError(t, fileStorage.CreateProject(project))
+	require.NoError(t, fileStorage.SetCurrentProject(project.ID))
+
+	task := domain.NewTask(project.ID, "Keep history", "Revisions survive the move")
+	task.Card.Labels = []string{"storage"}
+	require.NoError(t, fileStorage.CreateTask(task))
+	beforeUpdate := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	_, err = fileStorage.UpdateTask(task.ID, map[string]interface{}{"status": "in-progress"})
+	require.NoError(t, err)
+
+	require.NoError(t, fileStorage.CreateDiscovery(domain.NewDiscovery(project.ID, "SQLite is faster", domain.ImpactHigh, domain.SourceTesting)))
+	process := domain.NewProcess(project.ID, "server", "go", []string{"run", "."})
+	require.NoError(t, fileStorage.SaveProcess(project.ID, process))
+	require.NoError(t, fileStorage.SaveProcessLogs([]*domain.ProcessLog{domain.NewProcessLog(process.ID, domain.LogTypeStdout, "listening")}))
+
+	report, err := MigrateJSONToSQLite(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Projects)
+	assert.Equal(t, 1, report.Tasks)
+	assert.Equal(t, 2, report.TaskRevisions)
+	assert.Equal(t, 1, report.Discoveries)
+	assert.Equal(t, 1, report.Processes)
+	assert.Equal(t, 1, report.ProcessLogs)
+
+	config, err := ReadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, BackendSQLite, config.Storage)
+	require.NotNil(t, config.CurrentProjectID)
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+	sqliteStorage, ok := store.(*SQLiteStorage)
+	require.True(t, ok, "config should select the sqlite backend")
+	defer sqliteStorage.Close()
+
+	current, err := store.GetCurrentProject()
+	require.NoError(t, err)
+	assert.Equal(t, project.ID, current.ID)
+
+	got, err := store.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusInProgress, got.Card.Status)
+
+	tasks, err := store.ListTasks(domain.TaskFilter{Labels: []string{"storage"}})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	revisions, err := store.ListTaskRevisions(project.ID)
+	require.NoError(t, err)
+	state := domain.ReplayTaskRevisions(revisions, beforeUpdate)
+	require.Contains(t, state, task.ID)
+	assert.Equal(t, domain.StatusPlanned, state[task.ID].Card.Status)
+
+	logs, err := store.GetProcessLogs(process.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "listening", logs[0].Message)
+
+	// The JSON layout is left untouched and a second run is refused
+	_, err = os.Stat(fileStorage.tasksPath(project.ID))
+	assert.NoError(t, err)
+	_, err = MigrateJSONToSQLite(dir)
+	assert.Error(t, err)
+}
+
+func TestOpen_SelectsBackendFromConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+	_, ok := store.(*FileStorage)
+	assert.True(t, ok, "json is the default backend")
+
+	project := domain.NewProject("Config", "Keeps settings", "Preserve storage key")
+	require.NoError(t, store.CreateProject(project))
+	require.NoError(t, WriteConfig(dir, &Config{Storage: BackendJSON}))
+	require.NoError(t, store.SetCurrentProject(project.ID))
+
+	config, err := ReadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, BackendJSON, config.Storage, "setting the current project must keep the backend choice")
+
+	require.NoError(t, WriteConfig(dir, &Config{Storage: "postgres"}))
+	_, err = Open(dir)
+	assert.Error(t, err)
+}
+
+func TestNewSQLiteStorage_PathWithURIMetacharacters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "odd?name#100%", "compass.db")
+	store, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = os.Stat(path)
+	require.NoError(t, err, "the database is created at the path as given")
+
+	var mode string
+	require.NoError(t, store.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode))
+	assert.Equal(t, "wal", mode, "the parameters still apply")
+
+	require.NoError(t, vacuumInto(path, filepath.Join(filepath.Dir(path), "copy.db")))
+}
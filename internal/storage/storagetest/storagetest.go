@@ -0,0 +1,690 @@
+// Package storagetest is a conformance suite for storage.Store backends.
+// A backend passes the suite by calling Run from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Store {
+//			return NewMyStorage(t.TempDir())
+//		})
+//	}
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+	"github.com/rcliao/compass/internal/storage"
+)
+
+// Factory returns an empty store. It is called once per subtest.
+type Factory func(t *testing.T) storage.Store
+
+// Run exercises every part of the storage.Store contract against the
+// backend returned by newStore
+func Run(t *testing.T, newStore Factory) {
+	t.Run("Tasks", func(t *testing.T) { testTasks(t, newStore(t)) })
+	t.Run("TaskPatch", func(t *testing.T) { testTaskPatch(t, newStore(t)) })
+	t.Run("TaskVersion", func(t *testing.T) { testTaskVersion(t, newStore(t)) })
+	t.Run("TaskFilter", func(t *testing.T) { testTaskFilter(t, newStore(t)) })
+	t.Run("TaskRevisions", func(t *testing.T) { testTaskRevisions(t, newStore(t)) })
+	t.Run("Projects", func(t *testing.T) { testProjects(t, newStore(t)) })
+	t.Run("Planning", func(t *testing.T) { testPlanning(t, newStore(t)) })
+	t.Run("Processes", func(t *testing.T) { testProcesses(t, newStore(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, newStore(t)) })
+	t.Run("Check", func(t *testing.T) { testCheck(t, newStore(t)) })
+	t.Run("Transaction", func(t *testing.T) { testTransaction(t, newStore(t)) })
+}
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func createProject(t *testing.T, store storage.Store, name string, offset time.Duration) *domain.Project {
+	t.Helper()
+	project := domain.NewProject(name, "Conformance fixture", "Pass the suite")
+	project.CreatedAt = base.Add(offset)
+	project.UpdatedAt = project.CreatedAt
+	require.NoError(t, store.CreateProject(project))
+	return project
+}
+
+func createTask(t *testing.T, store storage.Store, projectID, title string, offset time.Duration) *domain.Task {
+	t.Helper()
+	task := domain.NewTask(projectID, title, "Conformance fixture")
+	task.Card.CreatedAt = base.Add(offset)
+	task.Card.UpdatedAt = task.Card.CreatedAt
+	require.NoError(t, store.CreateTask(task))
+	return task
+}
+
+func titles(tasks []*domain.Task) []string {
+	names := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		names = append(names, task.Card.Title)
+	}
+	return names
+}
+
+func testTasks(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Tasks", 0)
+	task := createTask(t, store, project.ID, "Write suite", 0)
+
+	err := store.CreateTask(task)
+	assert.True(t, errors.Is(err, storage.ErrConflict), "duplicate create: %v", err)
+
+	got, err := store.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, task.Card.Title, got.Card.Title)
+	assert.Equal(t, project.ID, got.ProjectID)
+
+	// Returned tasks are copies
+	got.Card.Title = "Mutated by caller"
+	got.Card.Labels = append(got.Card.Labels, "leaked")
+	again, err := store.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Write suite", again.Card.Title)
+	assert.NotContains(t, again.Card.Labels, "leaked")
+
+	updated, err := store.UpdateTask(task.ID, map[string]interface{}{
+		"title":  "Write conformance suite",
+		"status": string(domain.StatusInProgress),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Write conformance suite", updated.Card.Title)
+	assert.Equal(t, domain.StatusInProgress, updated.Card.Status)
+
+	got, err = store.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Write conformance suite", got.Card.Title)
+
+	require.NoError(t, store.DeleteTask(task.ID))
+
+	_, err = store.GetTask(task.ID)
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "get deleted: %v", err)
+	assert.EqualError(t, err, fmt.Sprintf("task with ID %s not found", task.ID))
+
+	_, err = store.UpdateTask(task.ID, map[string]interface{}{"title": "Gone"})
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "update deleted: %v", err)
+
+	err = store.DeleteTask(task.ID)
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "delete deleted: %v", err)
+}
+
+func testTaskPatch(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Patch", 0)
+	task := createTask(t, store, project.ID, "Patch me", 0)
+
+	_, err := store.UpdateTask(task.ID, map[string]interface{}{"status": "not-a-status"})
+	var patchErr *domain.TaskPatchError
+	assert.True(t, errors.As(err, &patchErr), "invalid status: %v", err)
+
+	_, err = store.UpdateTask(task.ID, map[string]interface{}{"title": "Renamed", "bogus": true})
+	assert.Error(t, err)
+
+	got, err := store.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Patch me", got.Card.Title, "rejected patches must not be applied")
+	assert.Equal(t, domain.StatusPlanned, got.Card.Status)
+
+	updated, err := store.UpdateTask(task.ID, map[string]interface{}{
+		"card": map[string]interface{}{"labels": []string{"api"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api"}, updated.Card.Labels)
+	assert.Equal(t, "Patch me", updated.Card.Title)
+}
+
+func testTaskVersion(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Version", 0)
+	task := createTask(t, store, project.ID, "Versioned", 0)
+
+	got, err := store.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Version)
+
+	updated, err := store.UpdateTask(task.ID, map[string]interface{}{"title": "First writer", "version": 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	// A second writer still holding version 1 must not overwrite the first
+	_, err = store.UpdateTask(task.ID, map[string]interface{}{"title": "Second writer", "version": 1})
+	assert.True(t, errors.Is(err, storage.ErrConflict), "stale version: %v", err)
+	var versionErr *domain.VersionConflictError
+	require.True(t, errors.As(err, &versionErr), "stale version: %v", err)
+	assert.Equal(t, 1, versionErr.Expected)
+	assert.Equal(t, 2, versionErr.Actual)
+
+	got, err = store.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First writer", got.Card.Title)
+	assert.Equal(t, 2, got.Version)
+
+	// Updates without a version are unconditional but still bump it
+	updated, err = store.UpdateTask(task.ID, map[string]interface{}{"title": "Blind write"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.Version)
+}
+
+func testTaskFilter(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Filter", 0)
+	other := createProject(t, store, "Other", time.Hour)
+	createTask(t, store, other.ID, "Elsewhere", 0)
+
+	for i, title := range []string{"Alpha", "Bravo", "Charlie", "Delta"} {
+		task := domain.NewTask(project.ID, title, "Filter fixture")
+		task.Card.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		task.Card.UpdatedAt = task.Card.CreatedAt
+		if i%2 == 0 {
+			task.Card.Labels = []string{"backend"}
+			task.Card.Status = domain.StatusInProgress
+		}
+		require.NoError(t, store.CreateTask(task))
+	}
+
+	list := func(filter domain.TaskFilter) []string {
+		filter.ProjectID = &project.ID
+		tasks, err := store.ListTasks(filter)
+		require.NoError(t, err)
+		return titles(tasks)
+	}
+
+	inProgress := domain.StatusInProgress
+	assert.Equal(t, []string{"Alpha", "Bravo", "Charlie", "Delta"}, list(domain.TaskFilter{}))
+	assert.Equal(t, []string{"Alpha", "Charlie"}, list(domain.TaskFilter{Status: &inProgress}))
+	assert.Equal(t, []string{"Alpha", "Charlie"}, list(domain.TaskFilter{Labels: []string{"backend"}}))
+	assert.Equal(t, []string{"Delta", "Charlie"}, list(domain.TaskFilter{SortBy: domain.SortByTitle, SortDesc: true, Limit: 2}))
+	assert.Equal(t, []string{"Bravo", "Charlie"}, list(domain.TaskFilter{Offset: 1, Limit: 2}))
+	assert.Empty(t, list(domain.TaskFilter{Offset: 10}))
+
+	all, err := store.ListTasks(domain.TaskFilter{})
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	// Archived tasks are only listed on request
+	titled := domain.TaskFilter{ProjectID: &project.ID, SortBy: domain.SortByTitle, Offset: 1, Limit: 1}
+	found, err := store.ListTasks(titled)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bravo"}, titles(found))
+	bravo := found[0]
+	_, err = store.UpdateTask(bravo.ID, map[string]interface{}{"archivedAt": base})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alpha", "Charlie", "Delta"}, list(domain.TaskFilter{}))
+	assert.Equal(t, []string{"Alpha", "Bravo", "Charlie", "Delta"}, list(domain.TaskFilter{Archived: domain.ArchiveInclude}))
+	assert.Equal(t, []string{"Bravo"}, list(domain.TaskFilter{Archived: domain.ArchiveOnly}))
+	got, err := store.GetTask(bravo.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Card.ArchivedAt)
+
+	_, err = store.UpdateTask(bravo.ID, map[string]interface{}{"archivedAt": nil})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alpha", "Bravo", "Charlie", "Delta"}, list(domain.TaskFilter{}))
+}
+
+func testTaskRevisions(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "History", 0)
+	task := createTask(t, store, project.ID, "Tracked", 0)
+
+	_, err := store.UpdateTask(task.ID, map[string]interface{}{"title": "Tracked again"})
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteTask(task.ID))
+
+	revisions, err := store.ListTaskRevisions(project.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, domain.RevisionCreate, revisions[0].Op)
+	assert.Equal(t, domain.RevisionUpdate, revisions[1].Op)
+	assert.Equal(t, "Tracked again", revisions[1].Task.Card.Title)
+	assert.Equal(t, domain.RevisionDelete, revisions[2].Op)
+
+	all, err := store.ListTaskRevisions("")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
+
+func testProjects(t *testing.T, store storage.Store) {
+	_, err := store.GetCurrentProject()
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "no current project: %v", err)
+
+	second := createProject(t, store, "Second", time.Hour)
+	first := createProject(t, store, "First", 0)
+
+	err = store.CreateProject(first)
+	assert.True(t, errors.Is(err, storage.ErrConflict), "duplicate create: %v", err)
+
+	_, err = store.GetProject("missing")
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "get missing: %v", err)
+	assert.EqualError(t, err, "project with ID missing not found")
+
+	_, err = store.UpdateProject("missing", map[string]interface{}{"name": "Nope"})
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "update missing: %v", err)
+
+	updated, err := store.UpdateProject(first.ID, map[string]interface{}{"name": "First renamed"})
+	require.NoError(t, err)
+	assert.Equal(t, "First renamed", updated.Name)
+
+	got, err := store.GetProject(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First renamed", got.Name)
+
+	projects, err := store.ListProjects()
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+	assert.Equal(t, first.ID, projects[0].ID)
+	assert.Equal(t, second.ID, projects[1].ID)
+
+	err = store.SetCurrentProject("missing")
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "set missing current: %v", err)
+
+	require.NoError(t, store.SetCurrentProject(second.ID))
+	current, err := store.GetCurrentProject()
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, current.ID)
+}
+
+func testPlanning(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Planning", 0)
+
+	later := domain.NewPlanningSession(project.ID, "Later")
+	later.CreatedAt = base.Add(time.Hour)
+	earlier := domain.NewPlanningSession(project.ID, "Earlier")
+	earlier.CreatedAt = base
+	require.NoError(t, store.CreatePlanningSession(later))
+	require.NoError(t, store.CreatePlanningSession(earlier))
+
+	err := store.CreatePlanningSession(earlier)
+	assert.True(t, errors.Is(err, storage.ErrConflict), "duplicate session: %v", err)
+
+	_, err = store.GetPlanningSession("missing")
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "get missing session: %v", err)
+
+	_, err = store.UpdatePlanningSession("missing", map[string]interface{}{})
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "update missing session: %v", err)
+
+	updated, err := store.UpdatePlanningSession(earlier.ID, map[string]interface{}{
+		"status": domain.PlanningStatusCompleted,
+		"tasks":  []string{"task-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, domain.PlanningStatusCompleted, updated.Status)
+
+	got, err := store.GetPlanningSession(earlier.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-1"}, got.Tasks)
+
+	_, err = store.UpdatePlanningSession(earlier.ID, map[string]interface{}{"endedAt": base, "archivedAt": base.Add(time.Hour)})
+	require.NoError(t, err)
+	got, err = store.GetPlanningSession(earlier.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.EndedAt)
+	require.NotNil(t, got.ArchivedAt)
+	assert.True(t, got.ArchivedAt.Equal(base.Add(time.Hour)))
+	_, err = store.UpdatePlanningSession(earlier.ID, map[string]interface{}{"archivedAt": nil})
+	require.NoError(t, err)
+	got, err = store.GetPlanningSession(earlier.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.ArchivedAt)
+
+	sessions, err := store.ListPlanningSessions(project.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "Earlier", sessions[0].Name)
+	assert.Equal(t, "Later", sessions[1].Name)
+
+	newer := domain.NewDiscovery(project.ID, "Newer insight", domain.ImpactLow, domain.SourceTesting)
+	newer.Timestamp = base.Add(time.Hour)
+	older := domain.NewDiscovery(project.ID, "Older insight", domain.ImpactHigh, domain.SourceResearch)
+	older.Timestamp = base
+	require.NoError(t, store.CreateDiscovery(newer))
+	require.NoError(t, store.CreateDiscovery(older))
+
+	err = store.CreateDiscovery(older)
+	assert.True(t, errors.Is(err, storage.ErrConflict), "duplicate discovery: %v", err)
+
+	discoveries, err := store.ListDiscoveries(project.ID)
+	require.NoError(t, err)
+	require.Len(t, discoveries, 2)
+	assert.Equal(t, "Older insight", discoveries[0].Insight)
+	assert.Equal(t, "Newer insight", discoveries[1].Insight)
+
+	decision := domain.NewDecision(project.ID, "Which store?", "Both", "Conformance", []string{"One"}, true)
+	require.NoError(t, store.CreateDecision(decision))
+
+	err = store.CreateDecision(decision)
+	assert.True(t, errors.Is(err, storage.ErrConflict), "duplicate decision: %v", err)
+
+	decisions, err := store.ListDecisions(project.ID)
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, "Both", decisions[0].Choice)
+
+	empty, err := store.ListDiscoveries("missing")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func testProcesses(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Processes", 0)
+
+	server := domain.NewProcess(project.ID, "server", "go", []string{"run", "."})
+	server.CreatedAt = base.Add(time.Hour)
+	server.Type = domain.ProcessTypeWebServer
+	tests := domain.NewProcess(project.ID, "tests", "go", []string{"test", "./..."})
+	tests.CreatedAt = base
+	tests.Type = domain.ProcessTypeTest
+	require.NoError(t, store.SaveProcess(project.ID, server))
+	require.NoError(t, store.SaveProcess(project.ID, tests))
+
+	// SaveProcess upserts
+	server.Status = domain.ProcessStatusRunning
+	require.NoError(t, store.SaveProcess(project.ID, server))
+
+	got, err := store.GetProcess(server.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ProcessStatusRunning, got.Status)
+
+	_, err = store.GetProcess("missing")
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "get missing process: %v", err)
+
+	all, err := store.ListProcesses(domain.ProcessFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "tests", all[0].Name)
+	assert.Equal(t, "server", all[1].Name)
+
+	running := domain.ProcessStatusRunning
+	filtered, err := store.ListProcesses(domain.ProcessFilter{Status: &running})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, server.ID, filtered[0].ID)
+
+	testType := domain.ProcessTypeTest
+	filtered, err = store.ListProcesses(domain.ProcessFilter{Type: &testType})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, tests.ID, filtered[0].ID)
+
+	group := domain.NewProcessGroup(project.ID, "dev", "Development stack")
+	require.NoError(t, store.SaveProcessGroup(project.ID, group))
+	gotGroup, err := store.GetProcessGroup(group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "dev", gotGroup.Name)
+
+	_, err = store.GetProcessGroup("missing")
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "get missing group: %v", err)
+
+	var logs []*domain.ProcessLog
+	for i := 0; i < 5; i++ {
+		log := domain.NewProcessLog(server.ID, domain.LogTypeStdout, fmt.Sprintf("line %d", i))
+		log.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		logs = append(logs, log)
+	}
+	require.NoError(t, store.SaveProcessLogs(logs[:3]))
+	require.NoError(t, store.SaveProcessLogs(logs[3:]))
+
+	tail, err := store.GetProcessLogs(server.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, tail, 2)
+	assert.Equal(t, "line 3", tail[0].Message)
+	assert.Equal(t, "line 4", tail[1].Message)
+
+	everything, err := store.GetProcessLogs(server.ID, 0)
+	require.NoError(t, err)
+	assert.Len(t, everything, 5)
+
+	none, err := store.GetProcessLogs(tests.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	_, err = store.GetProcessLogs("missing", 10)
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "logs for missing process: %v", err)
+
+	// A dry run counts what pruning would drop without dropping it
+	removed, err := store.PruneProcessLogs(server.ID, base.Add(time.Minute), 2, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	everything, err = store.GetProcessLogs(server.ID, 0)
+	require.NoError(t, err)
+	assert.Len(t, everything, 5)
+
+	// Pruning drops logs older than the cutoff, then the oldest beyond keep
+	removed, err = store.PruneProcessLogs(server.ID, base.Add(time.Minute), 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	removed, err = store.PruneProcessLogs(server.ID, time.Time{}, 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	everything, err = store.GetProcessLogs(server.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, everything, 2)
+	assert.Equal(t, "line 3", everything[0].Message)
+	removed, err = store.PruneProcessLogs(server.ID, time.Time{}, 2, false)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	_, err = store.PruneProcessLogs("missing", time.Time{}, 1, false)
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "prune logs for missing process: %v", err)
+}
+
+func testConcurrency(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Concurrency", 0)
+	shared := createTask(t, store, project.ID, "Shared", 0)
+
+	const workers = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*3)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			task := domain.NewTask(project.ID, fmt.Sprintf("Worker %02d", i), "Concurrent create")
+			if err := store.CreateTask(task); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := store.UpdateTask(shared.ID, map[string]interface{}{
+				"labels": []string{fmt.Sprintf("worker-%02d", i)},
+			}); err != nil {
+				errs <- err
+			}
+			if _, err := store.ListTasks(domain.TaskFilter{ProjectID: &project.ID}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	tasks, err := store.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Len(t, tasks, workers+1, "concurrent creates must not be lost")
+
+	got, err := store.GetTask(shared.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Card.Labels, 1, "concurrent updates must apply whole patches")
+
+	// Concurrent creates of the same ID: exactly one wins
+	contested := domain.NewTask(project.ID, "Contested", "Only one create succeeds")
+	var created, conflicts int
+	var mu sync.Mutex
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task := *contested
+			err := store.CreateTask(&task)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, storage.ErrConflict):
+				conflicts++
+			default:
+				t.Errorf("unexpected create error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, created)
+	assert.Equal(t, workers-1, conflicts)
+}
+
+func issueCodes(report *domain.CheckReport) []string {
+	codes := make([]string, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+func testCheck(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Check", 0)
+	require.NoError(t, store.SetCurrentProject(project.ID))
+
+	report, err := store.Check(false)
+	require.NoError(t, err)
+	assert.Empty(t, report.Issues, "a fresh store is consistent")
+
+	parent := createTask(t, store, project.ID, "Parent", time.Hour)
+	deleted := createTask(t, store, project.ID, "Deleted", 2*time.Hour)
+	child := domain.NewTask(project.ID, "Child", "Conformance fixture")
+	child.Card.Parent = &parent.ID
+	child.Context.Dependencies = []string{deleted.ID}
+	require.NoError(t, store.CreateTask(child))
+	_, err = store.UpdateTask(parent.ID, map[string]interface{}{"children": []string{deleted.ID}})
+	require.NoError(t, err)
+
+	discovery := domain.NewDiscovery(project.ID, "Touches a deleted task", domain.ImpactLow, domain.SourceTesting)
+	discovery.AffectedTasks = []string{deleted.ID}
+	require.NoError(t, store.CreateDiscovery(discovery))
+	process := domain.NewProcess(project.ID, "worker", "true", nil)
+	process.TaskID = deleted.ID
+	require.NoError(t, store.SaveProcess(project.ID, process))
+	require.NoError(t, store.DeleteTask(deleted.ID))
+
+	report, err = store.Check(false)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"missing-child-link", "dangling-child", "dangling-dependency", "dangling-discovery-task", "dangling-process-task"}, issueCodes(report))
+	assert.Zero(t, report.Repaired)
+	got, err := store.GetTask(child.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{deleted.ID}, got.Context.Dependencies, "a check without repair changes nothing")
+
+	report, err = store.Check(true)
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.Repaired)
+	assert.Zero(t, report.Outstanding())
+
+	got, err = store.GetTask(parent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{child.ID}, got.Card.Children)
+	assert.Equal(t, 3, got.Version, "repairs bump the version")
+	got, err = store.GetTask(child.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Context.Dependencies)
+	discoveries, err := store.ListDiscoveries(project.ID)
+	require.NoError(t, err)
+	require.Len(t, discoveries, 1)
+	assert.Empty(t, discoveries[0].AffectedTasks)
+	gotProcess, err := store.GetProcess(process.ID)
+	require.NoError(t, err)
+	assert.Empty(t, gotProcess.TaskID)
+
+	report, err = store.Check(false)
+	require.NoError(t, err)
+	assert.Empty(t, report.Issues)
+}
+
+func testTransaction(t *testing.T, store storage.Store) {
+	project := createProject(t, store, "Transactions", 0)
+	existing := createTask(t, store, project.ID, "Existing", 0)
+
+	var created *domain.Task
+	var added *domain.Project
+	err := store.Transaction(func(tx storage.Store) error {
+		added = createProject(t, tx, "Added", time.Hour)
+		created = createTask(t, tx, added.ID, "Created", time.Hour)
+		if _, err := tx.UpdateTask(existing.ID, map[string]interface{}{"title": "Renamed", "version": existing.Version}); err != nil {
+			return err
+		}
+		if err := tx.CreateDecision(domain.NewDecision(project.ID, "Scope?", "Small", "Time", nil, true)); err != nil {
+			return err
+		}
+
+		// The transaction reads its own writes
+		got, err := tx.GetTask(created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Created", got.Card.Title)
+		projects, err := tx.ListProjects()
+		require.NoError(t, err)
+		assert.Len(t, projects, 2)
+
+		// A nested transaction is part of this one
+		return tx.Transaction(func(inner storage.Store) error {
+			return inner.CreateDiscovery(domain.NewDiscovery(project.ID, "Found inside a nested transaction", domain.ImpactLow, domain.SourceTesting))
+		})
+	})
+	require.NoError(t, err)
+
+	got, err := store.GetTask(existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", got.Card.Title)
+	_, err = store.GetTask(created.ID)
+	require.NoError(t, err)
+	_, err = store.GetProject(added.ID)
+	require.NoError(t, err)
+	decisions, err := store.ListDecisions(project.ID)
+	require.NoError(t, err)
+	assert.Len(t, decisions, 1)
+	discoveries, err := store.ListDiscoveries(project.ID)
+	require.NoError(t, err)
+	assert.Len(t, discoveries, 1)
+	revisions, err := store.ListTaskRevisions("")
+	require.NoError(t, err)
+	assert.Len(t, revisions, 3)
+
+	// A failed transaction leaves nothing behind
+	failure := errors.New("give up")
+	err = store.Transaction(func(tx storage.Store) error {
+		createProject(t, tx, "Discarded", 2*time.Hour)
+		createTask(t, tx, project.ID, "Discarded", 2*time.Hour)
+		_, err := tx.UpdateTask(existing.ID, map[string]interface{}{"title": "Discarded"})
+		require.NoError(t, err)
+		require.NoError(t, tx.DeleteTask(created.ID))
+		require.NoError(t, tx.CreateDecision(domain.NewDecision(project.ID, "Again?", "No", "Discarded", nil, true)))
+
+		require.NoError(t, tx.SetCurrentProject(project.ID))
+		return failure
+	})
+	assert.True(t, errors.Is(err, failure), "failed transaction: %v", err)
+
+	tasks, err := store.ListTasks(domain.TaskFilter{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Renamed", "Created"}, titles(tasks))
+	projects, err := store.ListProjects()
+	require.NoError(t, err)
+	assert.Len(t, projects, 2)
+	decisions, err = store.ListDecisions(project.ID)
+	require.NoError(t, err)
+	assert.Len(t, decisions, 1)
+	_, err = store.GetCurrentProject()
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "current project after rollback: %v", err)
+	revisions, err = store.ListTaskRevisions("")
+	require.NoError(t, err)
+	assert.Len(t, revisions, 3)
+
+	// Process logs are written outside transactions
+	err = store.Transaction(func(tx storage.Store) error {
+		return tx.SaveProcessLogs([]*domain.ProcessLog{{ProcessID: "p"}})
+	})
+	assert.True(t, errors.Is(err, storage.ErrNotTransactional), "process logs: %v", err)
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Store is the contract every storage backend implements. The service layer
+// still depends on its own narrow interfaces; Store exists so a backend can
+// be checked against all of them at once and run through storagetest.
+//
+// Backends must behave identically for:
+//   - errors: missing entities match ErrNotFound and duplicate creates match
+//     ErrConflict under errors.Is, with "<entity> with ID <id> not found" and
+//     "<entity> with ID <id> already exists" messages
+//   - tasks: UpdateTask applies a merge patch via domain.ApplyTaskPatch and
+//     leaves the stored task untouched when the patch is rejected; every
+//     update bumps Task.Version and a "version" key in the patch that does
+//     not match fails with ErrConflict; tasks returned by any method are
+//     copies the caller may modify
+//   - filtering: ListTasks honors every domain.TaskFilter field, including
+//     sorting and pagination
+//   - ordering: projects, planning sessions and processes are listed by
+//     creation time, discoveries and decisions by timestamp, ties broken by ID
+//   - checks: Check reports entities outside any project and references to
+//     missing tasks or projects; with repair set it drops the dangling
+//     references, bumping the version of every task it changes
+//   - concurrency: all methods are safe to call from multiple goroutines
+//   - transactions: Transaction runs fn against tx, a Store whose writes
+//     other callers only see, all at once, after fn returns nil, and never
+//     see when it returns an error; other writers wait until it ends.
+//     Process logs and Check are outside transactions and fail with
+//     ErrNotTransactional on tx, and calling Transaction on tx runs fn as
+//     part of the enclosing transaction.
+type Store interface {
+	// Tasks
+	CreateTask(task *domain.Task) error
+	GetTask(id string) (*domain.Task, error)
+	UpdateTask(id string, updates map[string]interface{}) (*domain.Task, error)
+	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
+	DeleteTask(id string) error
+	ListTaskRevisions(projectID string) ([]*domain.TaskRevision, error)
+
+	// Projects
+	CreateProject(project *domain.Project) error
+	GetProject(id string) (*domain.Project, error)
+	UpdateProject(id string, updates map[string]interface{}) (*domain.Project, error)
+	ListProjects() ([]*domain.Project, error)
+	SetCurrentProject(id string) error
+	GetCurrentProject() (*domain.Project, error)
+
+	// Planning
+	CreatePlanningSession(session *domain.PlanningSession) error
+	GetPlanningSession(id string) (*domain.PlanningSession, error)
+	ListPlanningSessions(projectID string) ([]*domain.PlanningSession, error)
+	UpdatePlanningSession(id string, updates map[string]interface{}) (*domain.PlanningSession, error)
+	CreateDiscovery(discovery *domain.Discovery) error
+	ListDiscoveries(projectID string) ([]*domain.Discovery, error)
+	CreateDecision(decision *domain.Decision) error
+	ListDecisions(projectID string) ([]*domain.Decision, error)
+
+	// Processes
+	SaveProcess(projectID string, process *domain.Process) error
+	GetProcess(processID string) (*domain.Process, error)
+	ListProcesses(filter domain.ProcessFilter) ([]*domain.Process, error)
+	SaveProcessGroup(projectID string, group *domain.ProcessGroup) error
+	GetProcessGroup(groupID string) (*domain.ProcessGroup, error)
+	SaveProcessLogs(logs []*domain.ProcessLog) error
+	GetProcessLogs(processID string, limit int) ([]*domain.ProcessLog, error)
+	// PruneProcessLogs deletes the logs domain.RetainLogs drops and
+	// returns how many it deleted; with dryRun set it only counts them
+	PruneProcessLogs(processID string, before time.Time, keep int, dryRun bool) (int, error)
+
+	// Maintenance
+	Check(repair bool) (*domain.CheckReport, error)
+
+	// Transaction applies the writes fn makes through tx atomically
+	Transaction(fn func(tx Store) error) error
+}
+
+var (
+	_ Store = (*FileStorage)(nil)
+	_ Store = (*MemoryStorage)(nil)
+	_ Store = (*SQLiteStorage)(nil)
+)
+
+// sortByTime orders items by the time returned by at, breaking ties by ID so
+// every backend lists entities in the same order
+func sortByTime[T any](items []T, at func(T) time.Time, id func(T) string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		ti, tj := at(items[i]), at(items[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return id(items[i]) < id(items[j])
+	})
+}
+
+func sortProjects(projects []*domain.Project) {
+	sortByTime(projects,
+		func(p *domain.Project) time.Time { return p.CreatedAt },
+		func(p *domain.Project) string { return p.ID })
+}
+
+func sortPlanningSessions(sessions []*domain.PlanningSession) {
+	sortByTime(sessions,
+		func(s *domain.PlanningSession) time.Time { return s.CreatedAt },
+		func(s *domain.PlanningSession) string { return s.ID })
+}
+
+func sortDiscoveries(discoveries []*domain.Discovery) {
+	sortByTime(discoveries,
+		func(d *domain.Discovery) time.Time { return d.Timestamp },
+		func(d *domain.Discovery) string { return d.ID })
+}
+
+func sortDecisions(decisions []*domain.Decision) {
+	sortByTime(decisions,
+		func(d *domain.Decision) time.Time { return d.Timestamp },
+		func(d *domain.Decision) string { return d.ID })
+}
+
+func sortProcesses(processes []*domain.Process) {
+	sortByTime(processes,
+		func(p *domain.Process) time.Time { return p.CreatedAt },
+		func(p *domain.Process) string { return p.ID })
+}
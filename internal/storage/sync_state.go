@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rcliao/compass/internal/todomd"
+)
+
+// todoSyncStatePath is where the state of syncing file is kept: one JSON
+// document per synced file under .compass/sync/todo-md, named after the
+// file's path relative to the workspace
+func todoSyncStatePath(basePath, file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	name := abs
+	if rel, err := filepath.Rel(basePath, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		name = rel
+	}
+	return filepath.Join(basePath, ".compass", "sync", "todo-md", url.PathEscape(filepath.ToSlash(name))+".json"), nil
+}
+
+// ReadTodoSyncState loads the state the last sync of file left, or nil when
+// the file was never synced
+func ReadTodoSyncState(basePath, file string) (*todomd.State, error) {
+	path, err := todoSyncStatePath(basePath, file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state todomd.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// WriteTodoSyncState replaces the sync state of file atomically
+func WriteTodoSyncState(basePath, file string, state *todomd.State) error {
+	path, err := todoSyncStatePath(basePath, file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// taskIndex keeps tasks addressable by ID and by the fields listings most
+// often filter on, so a query only has to look at a small candidate set
+type taskIndex struct {
+	byID      map[string]*domain.Task
+	byProject map[string]map[string]*domain.Task
+	byStatus  map[domain.TaskStatus]map[string]*domain.Task
+	byLabel   map[string]map[string]*domain.Task
+}
+
+func newTaskIndex(tasks ...*domain.Task) *taskIndex {
+	index := &taskIndex{
+		byID:      make(map[string]*domain.Task),
+		byProject: make(map[string]map[string]*domain.Task),
+		byStatus:  make(map[domain.TaskStatus]map[string]*domain.Task),
+		byLabel:   make(map[string]map[string]*domain.Task),
+	}
+	for _, task := range tasks {
+		index.add(task)
+	}
+	return index
+}
+
+func (ix *taskIndex) add(task *domain.Task) {
+	ix.remove(task.ID)
+	ix.byID[task.ID] = task
+	addToSet(ix.byProject, task.ProjectID, task)
+	addToSet(ix.byStatus, task.Card.Status, task)
+	for _, label := range task.Card.Labels {
+		addToSet(ix.byLabel, label, task)
+	}
+}
+
+func (ix *taskIndex) remove(id string) {
+	task, ok := ix.byID[id]
+	if !ok {
+		return
+	}
+	delete(ix.byID, id)
+	removeFromSet(ix.byProject, task.ProjectID, id)
+	removeFromSet(ix.byStatus, task.Card.Status, id)
+	for _, label := range task.Card.Labels {
+		removeFromSet(ix.byLabel, label, id)
+	}
+}
+
+// query answers filter from the narrowest index that applies
+func (ix *taskIndex) query(filter domain.TaskFilter) []*domain.Task {
+	candidates := ix.byID
+	narrow := func(set map[string]*domain.Task) {
+		if len(set) < len(candidates) {
+			candidates = set
+		}
+	}
+	if filter.ProjectID != nil {
+		narrow(ix.byProject[*filter.ProjectID])
+	}
+	if filter.Status != nil {
+		narrow(ix.byStatus[*filter.Status])
+	}
+	for _, label := range filter.Labels {
+		narrow(ix.byLabel[label])
+	}
+
+	tasks := make([]*domain.Task, 0, len(candidates))
+	for _, task := range candidates {
+		tasks = append(tasks, task)
+	}
+	return domain.ApplyTaskQuery(tasks, filter)
+}
+
+func addToSet[K comparable](sets map[K]map[string]*domain.Task, key K, task *domain.Task) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[string]*domain.Task)
+		sets[key] = set
+	}
+	set[task.ID] = task
+}
+
+func removeFromSet[K comparable](sets map[K]map[string]*domain.Task, key K, id string) {
+	if set, ok := sets[key]; ok {
+		delete(set, id)
+		if len(set) == 0 {
+			delete(sets, key)
+		}
+	}
+}
+
+func cloneTasks(tasks []*domain.Task) []*domain.Task {
+	clones := make([]*domain.Task, len(tasks))
+	for i, task := range tasks {
+		clones[i] = task.Clone()
+	}
+	return clones
+}
+
+// projectTasks is FileStorage's cached copy of one project's tasks. It is
+// valid for as long as the snapshot (tasks.json, or the tasks directory in
+// the per-entity layout) and the task journal are unchanged on disk. Files
+// are replaced by rename, so a write by another process always changes the
+// file identity, size or modification time. A directory's modification time
+// moves whenever a file in it is replaced, added or removed.
+//
+// Writers update the cache in place while holding the write lock; readers
+// only use it under the read lock and hand out clones.
+type projectTasks struct {
+	snapshot       fileStamp
+	journal        fileStamp
+	journalEntries int
+	index          *taskIndex
+}
+
+// fileStamp identifies one version of a file; the zero value stands for a
+// file that does not exist
+type fileStamp struct {
+	info    os.FileInfo
+	modTime time.Time
+	size    int64
+}
+
+func newFileStamp(info os.FileInfo) fileStamp {
+	if info == nil {
+		return fileStamp{}
+	}
+	return fileStamp{info: info, modTime: info.ModTime(), size: info.Size()}
+}
+
+// stampFile stamps the file at path as it is now
+func stampFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return newFileStamp(info)
+}
+
+func (s fileStamp) matches(other fileStamp) bool {
+	if s.info == nil || other.info == nil {
+		return s.info == nil && other.info == nil
+	}
+	return os.SameFile(s.info, other.info) && s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+// list returns the tasks ordered by creation time, then ID
+func (p *projectTasks) list() []*domain.Task {
+	tasks := make([]*domain.Task, 0, len(p.index.byID))
+	for _, task := range p.index.byID {
+		tasks = append(tasks, task)
+	}
+	sortByTime(tasks,
+		func(t *domain.Task) time.Time { return t.Card.CreatedAt },
+		func(t *domain.Task) string { return t.ID })
+	return tasks
+}
+
+// tasksPath is tasks.json, or the tasks directory in the per-entity layout
+func (fs *FileStorage) tasksPath(projectID string) string {
+	if fs.perEntity() {
+		return fs.entityDir(projectID, tasksDir)
+	}
+	return filepath.Join(fs.projectDir(projectID), "tasks.json")
+}
+
+// cachedTasks returns the project's tasks, decoding them only when they
+// changed since they were last read or written by this process
+func (fs *FileStorage) cachedTasks(projectID string) (*projectTasks, error) {
+	if fs.tx != nil {
+		return fs.tx.cachedTasks(projectID)
+	}
+
+	var journal fileStamp
+	if !fs.perEntity() {
+		journal = stampFile(fs.taskJournalPath(projectID))
+	}
+	snapshot := stampFile(fs.tasksPath(projectID))
+
+	fs.cacheMu.Lock()
+	cached, ok := fs.taskCache[projectID]
+	fs.cacheMu.Unlock()
+	if ok && cached.snapshot.matches(snapshot) && cached.journal.matches(journal) {
+		return cached, nil
+	}
+
+	// The journal is read first; see journal.go
+	var entries []journalEntry
+	if journal.info != nil {
+		var err error
+		if entries, err = readJournal(fs.taskJournalPath(projectID)); err != nil {
+			return nil, err
+		}
+	}
+
+	tasks := make([]*domain.Task, 0)
+	if snapshot.info != nil {
+		var err error
+		if fs.perEntity() {
+			tasks, err = loadEntities[domain.Task](nil, fs.tasksPath(projectID))
+		} else {
+			err = fs.loadList(fs.tasksPath(projectID), &tasks)
+		}
+		if os.IsNotExist(err) {
+			// Replaced by a compaction since it was stamped; stamp and try again
+			return fs.cachedTasks(projectID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cached = &projectTasks{
+		snapshot:       snapshot,
+		journal:        journal,
+		journalEntries: len(entries),
+		index:          newTaskIndex(tasks...),
+	}
+	for _, entry := range entries {
+		entry.apply(cached.index)
+	}
+
+	fs.cacheMu.Lock()
+	fs.taskCache[projectID] = cached
+	fs.cacheMu.Unlock()
+	return cached, nil
+}
+
+// taskForUpdate finds the task an update applies to. The caller holds the
+// write lock. In the per-entity layout the cache is stamped by the tasks/
+// directory, whose mtime and size can stay the same when another process
+// renames a new version of an entity into it within one clock tick, so the
+// task's own file is read again: a versioned update is then checked
+// against, and a patch applied to, what is on disk.
+func (fs *FileStorage) taskForUpdate(id string) (*domain.Task, error) {
+	task, err := fs.findTask(id)
+	if err != nil || !fs.perEntity() {
+		return task, err
+	}
+	if fs.tx != nil {
+		for _, staged := range fs.tx.entries {
+			if staged.Entry.ID == id {
+				return task, nil
+			}
+		}
+	}
+
+	path, err := entityPath(fs.entityDir(task.ProjectID, tasksDir), id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	cached, cacheErr := fs.cachedTasks(task.ProjectID)
+	if cacheErr != nil {
+		return nil, cacheErr
+	}
+	if os.IsNotExist(err) {
+		cached.index.remove(id)
+		return nil, notFound("task", id)
+	}
+
+	var current domain.Task
+	if err := decodeEntity(data, &current); err != nil {
+		return nil, err
+	}
+	cached.index.add(&current)
+	return &current, nil
+}
+
+func (fs *FileStorage) invalidateTasks(projectID string) {
+	fs.cacheMu.Lock()
+	delete(fs.taskCache, projectID)
+	fs.cacheMu.Unlock()
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+type taskLister interface {
+	CreateProject(project *domain.Project) error
+	CreateTask(task *domain.Task) error
+	ListTasks(filter domain.TaskFilter) ([]*domain.Task, error)
+}
+
+func TestListTasks_FiltersMatchAcrossBackends(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+
+	backends := map[string]taskLister{
+		"memory": NewMemoryStorage(),
+		"file":   fileStorage,
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			project := domain.NewProject("Test Project", "A test project", "Test goal")
+			require.NoError(t, backend.CreateProject(project))
+
+			base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			parentID := "parent-task"
+			alice := "alice"
+
+			titles := []string{"Alpha", "Bravo", "Charlie", "Delta"}
+			for i, title := range titles {
+				task := domain.NewTask(project.ID, title, "Filter fixture")
+				task.Card.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+				task.Card.UpdatedAt = task.Card.CreatedAt
+				due := base.Add(time.Duration(10-i) * 24 * time.Hour)
+				task.Card.DueDate = &due
+				if i%2 == 0 {
+					task.Card.Labels = []string{"backend", "api"}
+					task.Card.Priority = domain.PriorityHigh
+					// A distinct pointer with the same value must still match
+					parent := parentID
+					task.Card.Parent = &parent
+				} else {
+					task.Card.Labels = []string{"frontend"}
+					task.Card.AssignedTo = &alice
+				}
+				require.NoError(t, backend.CreateTask(task))
+			}
+
+			list := func(filter domain.TaskFilter) []string {
+				filter.ProjectID = &project.ID
+				tasks, err := backend.ListTasks(filter)
+				require.NoError(t, err)
+				names := make([]string, 0, len(tasks))
+				for _, task := range tasks {
+					names = append(names, task.Card.Title)
+				}
+				return names
+			}
+
+			high := domain.PriorityHigh
+			dueBefore := base.Add(9 * 24 * time.Hour)
+			createdAfter := base.Add(90 * time.Minute)
+
+			assert.Equal(t, []string{"Alpha", "Bravo", "Charlie", "Delta"}, list(domain.TaskFilter{}))
+			assert.Equal(t, []string{"Alpha", "Charlie"}, list(domain.TaskFilter{Priority: &high}))
+			assert.Equal(t, []string{"Alpha", "Charlie"}, list(domain.TaskFilter{Labels: []string{"backend", "api"}}))
+			assert.Empty(t, list(domain.TaskFilter{Labels: []string{"backend", "frontend"}}))
+			assert.Equal(t, []string{"Bravo", "Delta"}, list(domain.TaskFilter{AssignedTo: &alice}))
+			assert.Equal(t, []string{"Alpha", "Charlie"}, list(domain.TaskFilter{Parent: &parentID}))
+			assert.Equal(t, []string{"Charlie", "Delta"}, list(domain.TaskFilter{DueBefore: &dueBefore}))
+			assert.Equal(t, []string{"Charlie", "Delta"}, list(domain.TaskFilter{CreatedAfter: &createdAfter}))
+			assert.Equal(t, []string{"Delta", "Charlie", "Bravo", "Alpha"}, list(domain.TaskFilter{SortBy: domain.SortByDueDate}))
+			assert.Equal(t, []string{"Charlie", "Bravo"}, list(domain.TaskFilter{SortBy: domain.SortByTitle, SortDesc: true, Offset: 1, Limit: 2}))
+		})
+	}
+}
+
+func TestFileStorage_TaskCacheSeesExternalWrites(t *testing.T) {
+	storage, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+
+	project := domain.NewProject("Test Project", "A test project", "Test goal")
+	require.NoError(t, storage.CreateProject(project))
+	task := domain.NewTask(project.ID, "Cached Task", "Loaded once")
+	require.NoError(t, storage.CreateTask(task))
+
+	tasks, err := storage.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+
+	// Mutating a returned task must not leak into the cache
+	tasks[0].Card.Title = "Mutated"
+	cached, err := storage.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Cached Task", cached.Card.Title)
+
+	// Another process writing to the task journal invalidates the cache
+	other, err := NewFileStorage(storage.basePath)
+	require.NoError(t, err)
+	_, err = other.UpdateTask(task.ID, map[string]interface{}{"title": "Changed Elsewhere"})
+	require.NoError(t, err)
+
+	reloaded, err := storage.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Changed Elsewhere", reloaded.Card.Title)
+}
+
+func TestFileStorage_VersionedUpdateRereadsEntityFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, WriteConfig(dir, &Config{SchemaVersion: CurrentSchemaVersion, Layout: LayoutPerEntity}))
+	storage, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	project := domain.NewProject("Test Project", "A test project", "Test goal")
+	require.NoError(t, storage.CreateProject(project))
+	task := domain.NewTask(project.ID, "Cached Task", "Loaded once")
+	require.NoError(t, storage.CreateTask(task))
+	cached, err := storage.GetTask(task.ID)
+	require.NoError(t, err)
+
+	// Another process replaces the task's file within the same tick, so
+	// the tasks/ directory looks unchanged
+	tasksDir := storage.entityDir(project.ID, tasksDir)
+	info, err := os.Stat(tasksDir)
+	require.NoError(t, err)
+	other, err := NewFileStorage(dir)
+	require.NoError(t, err)
+	_, err = other.UpdateTask(task.ID, map[string]interface{}{"title": "Changed Elsewhere"})
+	require.NoError(t, err)
+	require.NoError(t, os.Chtimes(tasksDir, info.ModTime(), info.ModTime()))
+	if after, err := os.Stat(tasksDir); err == nil && after.Size() != info.Size() {
+		t.Skip("the file system changes the directory size on rename")
+	}
+
+	_, err = storage.UpdateTask(task.ID, map[string]interface{}{"title": "Stale", "version": cached.Version})
+	var conflict *domain.VersionConflictError
+	require.True(t, errors.As(err, &conflict), "update against a replaced version: %v", err)
+
+	updated, err := storage.UpdateTask(task.ID, map[string]interface{}{"priority": "high"})
+	require.NoError(t, err)
+	assert.Equal(t, "Changed Elsewhere", updated.Card.Title, "patches apply to the version on disk")
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// A JSON transaction runs against a view of the storage that holds its
+// writes in memory. Reads through the view see the staged files on top of
+// the ones on disk. When the callback succeeds, everything it staged is
+// written to .compass/transaction.json in one atomic rename and only then
+// applied to the data files. A process that stops halfway through applying
+// leaves the record behind, and the next write (or the next open) replays
+// it; replaying writes the same files and task entries again, so it is safe
+// however much was applied before.
+
+// fileTx holds what a transaction staged
+type fileTx struct {
+	base *FileStorage
+	// files maps the absolute path of every staged file to its contents;
+	// order lists the paths in the order they were first staged
+	files map[string]*stagedFile
+	order []string
+	// projects whose directories the transaction needs
+	projects map[string]bool
+	// tasks holds the transaction's copy of each project's tasks, and
+	// entries the task changes to commit, in order
+	tasks     map[string]*projectTasks
+	entries   []txTaskEntry
+	revisions []*domain.TaskRevision
+}
+
+type stagedFile struct {
+	data    []byte
+	removed bool
+}
+
+// txRecord is the committed transaction as written to transaction.json.
+// File paths are relative to .compass, with forward slashes.
+type txRecord struct {
+	Projects []string      `json:"projects,omitempty"`
+	Files    []txFile      `json:"files,omitempty"`
+	Tasks    []txTaskEntry `json:"tasks,omitempty"`
+}
+
+type txFile struct {
+	Path    string `json:"path"`
+	Data    []byte `json:"data,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+type txTaskEntry struct {
+	ProjectID string       `json:"projectId"`
+	Entry     journalEntry `json:"entry"`
+}
+
+func transactionPath(basePath string) string {
+	return filepath.Join(basePath, ".compass", "transaction.json")
+}
+
+// Transaction runs fn against a view that stages its writes and commits
+// them once fn returns nil. The write lock is held throughout, so other
+// writers, in this process or another, wait for the transaction to end.
+func (fs *FileStorage) Transaction(fn func(tx Store) error) error {
+	if fs.tx != nil {
+		return fn(fs)
+	}
+
+	unlock, err := fs.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	view := &FileStorage{
+		basePath:       fs.basePath,
+		layout:         fs.layout,
+		circuitBreaker: fs.circuitBreaker,
+		logRotation:    fs.logRotation,
+		taskCache:      make(map[string]*projectTasks),
+		tx: &fileTx{
+			base:     fs,
+			files:    make(map[string]*stagedFile),
+			projects: make(map[string]bool),
+			tasks:    make(map[string]*projectTasks),
+		},
+	}
+	if err := fn(view); err != nil {
+		return err
+	}
+	return fs.commitTransaction(view.tx)
+}
+
+func (tx *fileTx) stage(path string, data []byte, removed bool) {
+	if _, ok := tx.files[path]; !ok {
+		tx.order = append(tx.order, path)
+	}
+	tx.files[path] = &stagedFile{data: data, removed: removed}
+}
+
+// staged returns the staged version of the file at path, if there is one
+func (tx *fileTx) staged(path string) (*stagedFile, bool) {
+	if tx == nil {
+		return nil, false
+	}
+	file, ok := tx.files[path]
+	return file, ok
+}
+
+// cachedTasks returns the transaction's copy of the project's tasks. Cached
+// tasks are never modified in place, so the copy shares them with the base.
+func (tx *fileTx) cachedTasks(projectID string) (*projectTasks, error) {
+	if cached, ok := tx.tasks[projectID]; ok {
+		return cached, nil
+	}
+	base, err := tx.base.cachedTasks(projectID)
+	if err != nil {
+		return nil, err
+	}
+	cached := &projectTasks{index: newTaskIndex()}
+	for _, task := range base.index.byID {
+		cached.index.add(task)
+	}
+	tx.tasks[projectID] = cached
+	return cached, nil
+}
+
+// record converts what the transaction staged into the record to commit
+func (tx *fileTx) record(compassDir string) (*txRecord, error) {
+	record := &txRecord{Tasks: tx.entries}
+	for projectID := range tx.projects {
+		record.Projects = append(record.Projects, projectID)
+	}
+	sort.Strings(record.Projects)
+	for _, path := range tx.order {
+		rel, err := filepath.Rel(compassDir, path)
+		if err != nil {
+			return nil, err
+		}
+		file := tx.files[path]
+		record.Files = append(record.Files, txFile{Path: filepath.ToSlash(rel), Data: file.data, Removed: file.removed})
+	}
+	return record, nil
+}
+
+// commitTransaction records the staged writes and applies them. The caller
+// holds the write lock.
+func (fs *FileStorage) commitTransaction(tx *fileTx) error {
+	compassDir := filepath.Join(fs.basePath, ".compass")
+	record, err := tx.record(compassDir)
+	if err != nil {
+		return err
+	}
+	if len(record.Files) > 0 || len(record.Tasks) > 0 {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(transactionPath(fs.basePath), data); err != nil {
+			return fmt.Errorf("failed to record transaction: %w", err)
+		}
+		if err := fs.applyTransaction(record); err != nil {
+			return fmt.Errorf("transaction was recorded but not fully applied; the next write finishes it: %w", err)
+		}
+		if err := os.Remove(transactionPath(fs.basePath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Like any other task history, the revisions are best effort
+	for _, revision := range tx.revisions {
+		if err := fs.appendTaskRevision(revision); err != nil {
+			log.Printf("FileStorage: failed to record task history for %s: %v", revision.TaskID, err)
+		}
+	}
+	return nil
+}
+
+func (fs *FileStorage) applyTransaction(record *txRecord) error {
+	compassDir := filepath.Join(fs.basePath, ".compass")
+	for _, projectID := range record.Projects {
+		if err := fs.ensureProjectDir(projectID); err != nil {
+			return err
+		}
+	}
+	for _, file := range record.Files {
+		path := filepath.Join(compassDir, filepath.FromSlash(file.Path))
+		if file.Removed {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, file.Data); err != nil {
+			return err
+		}
+	}
+	for _, task := range record.Tasks {
+		if err := fs.commitTask(task.ProjectID, task.Entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverTransaction applies a transaction a stopped process committed but
+// did not finish applying. The caller holds the write lock.
+func (fs *FileStorage) recoverTransaction() error {
+	data, err := os.ReadFile(transactionPath(fs.basePath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var record txRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return fmt.Errorf("unreadable transaction record %s: %w", transactionPath(fs.basePath), err)
+	}
+	if err := fs.applyTransaction(&record); err != nil {
+		return fmt.Errorf("failed to finish interrupted transaction: %w", err)
+	}
+	log.Printf("FileStorage: finished applying an interrupted transaction")
+	return os.Remove(transactionPath(fs.basePath))
+}
+
+// fileExists reports whether the file at path exists, counting the files
+// staged by a transaction
+func (fs *FileStorage) fileExists(path string) bool {
+	if file, ok := fs.tx.staged(path); ok {
+		return !file.removed
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// writeEntity saves one entity file of the per-entity layout, or stages it
+// in a transaction
+func (fs *FileStorage) writeEntity(dir, id string, value interface{}) error {
+	if fs.tx == nil {
+		return saveEntity(dir, id, value)
+	}
+	path, err := entityPath(dir, id)
+	if err != nil {
+		return err
+	}
+	data, err := encodeEntity(value)
+	if err != nil {
+		return err
+	}
+	fs.tx.stage(path, data, false)
+	return nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// writeTxRecord leaves a committed but unapplied transaction behind, as a
+// process stopped right after recording it would
+func writeTxRecord(t *testing.T, fs *FileStorage, record *txRecord) {
+	t.Helper()
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, writeFileAtomic(transactionPath(fs.basePath), data))
+}
+
+func TestFileStorage_RecoversInterruptedTransaction(t *testing.T) {
+	fs, project := newJournalFixture(t)
+
+	task := domain.NewTask(project.ID, "Recovered", "Committed before the crash")
+	renamed := *project
+	renamed.Name = "Renamed in the transaction"
+	projectData, err := json.MarshalIndent(projectFile{SchemaVersion: CurrentSchemaVersion, Project: &renamed}, "", "  ")
+	require.NoError(t, err)
+
+	writeTxRecord(t, fs, &txRecord{
+		Files: []txFile{{Path: "projects/" + project.ID + "/project.json", Data: append(projectData, '\n')}},
+		Tasks: []txTaskEntry{{ProjectID: project.ID, Entry: journalEntry{Op: journalPut, ID: task.ID, Task: task}}},
+	})
+
+	reopened, err := NewFileStorage(fs.basePath)
+	require.NoError(t, err)
+
+	got, err := reopened.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Recovered", got.Card.Title)
+	gotProject, err := reopened.GetProject(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed in the transaction", gotProject.Name)
+
+	_, err = os.Stat(transactionPath(fs.basePath))
+	assert.True(t, os.IsNotExist(err), "record removed: %v", err)
+}
+
+func TestFileStorage_NextWriteFinishesTransaction(t *testing.T) {
+	fs, project := newJournalFixture(t)
+
+	// Another process committed a transaction and stopped before applying it
+	task := domain.NewTask(project.ID, "Committed", "Recorded by another process")
+	writeTxRecord(t, fs, &txRecord{
+		Tasks: []txTaskEntry{{ProjectID: project.ID, Entry: journalEntry{Op: journalPut, ID: task.ID, Task: task}}},
+	})
+
+	require.NoError(t, fs.CreateTask(domain.NewTask(project.ID, "Later", "Written afterwards")))
+
+	tasks, err := fs.ListTasks(domain.TaskFilter{ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Committed", "Later"}, []string{tasks[0].Card.Title, tasks[1].Card.Title})
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often the polling watcher rescans .compass
+const DefaultWatchInterval = 2 * time.Second
+
+// watchSettle is how long a burst of writes has to stay quiet before the
+// watcher reports it, so a rename or a journal flush is reported once
+var watchSettle = 100 * time.Millisecond
+
+// ChangeKind names the kind of data a changed file holds
+type ChangeKind string
+
+const (
+	ChangeTasks     ChangeKind = "tasks"
+	ChangeProject   ChangeKind = "project"
+	ChangePlanning  ChangeKind = "planning"
+	ChangeKnowledge ChangeKind = "knowledge"
+	ChangeProcesses ChangeKind = "processes"
+	ChangeConfig    ChangeKind = "config"
+	// ChangeAll means anything may have changed: the SQLite database was
+	// written or the watcher lost track of events
+	ChangeAll ChangeKind = "all"
+)
+
+// Change is one kind of data that changed on disk. ProjectID is empty for
+// workspace-wide changes.
+type Change struct {
+	Kind      ChangeKind `json:"kind"`
+	ProjectID string     `json:"projectId,omitempty"`
+}
+
+// classifyChange maps a path relative to .compass to the data it holds.
+// Backups, locks, temporary files, process logs and task history are not
+// reported: they either mirror a file that is reported or are not read back
+// by anything that caches.
+func classifyChange(rel string) (Change, bool) {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	name := parts[len(parts)-1]
+	if name == ".lock" || strings.HasSuffix(name, ".tmp") {
+		return Change{}, false
+	}
+
+	switch {
+	case rel == "config.json":
+		return Change{Kind: ChangeConfig}, true
+	case strings.HasPrefix(name, "compass.db") && len(parts) == 1:
+		return Change{Kind: ChangeAll}, true
+	case parts[0] != "projects" || len(parts) < 3:
+		return Change{}, false
+	}
+
+	projectID := parts[1]
+	switch parts[2] {
+	case "project.json":
+		return Change{Kind: ChangeProject, ProjectID: projectID}, true
+	case "tasks.json", "tasks.journal.jsonl", tasksDir:
+		return Change{Kind: ChangeTasks, ProjectID: projectID}, true
+	case "planning":
+		return Change{Kind: ChangePlanning, ProjectID: projectID}, true
+	case "discoveries.json", "decisions.json", discoveriesDir, decisionsDir:
+		return Change{Kind: ChangeKnowledge, ProjectID: projectID}, true
+	case "processes.json", "process_groups.json":
+		return Change{Kind: ChangeProcesses, ProjectID: projectID}, true
+	}
+	return Change{}, false
+}
+
+// skipWatchDir reports directories under .compass whose contents are never
+// reported, so they are not watched or scanned at all
+func skipWatchDir(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if rel == "backups" || rel == "sync" {
+		return true
+	}
+	parts := strings.Split(rel, "/")
+	return len(parts) == 3 && parts[0] == "projects" && (parts[2] == "logs" || parts[2] == "history")
+}
+
+// Watcher reports changes to the files under .compass, whichever process
+// made them. Changes delivers one batch per burst of writes.
+type Watcher struct {
+	Changes <-chan []Change
+
+	// Polling is set when the watcher rescans the tree instead of
+	// receiving events from the operating system
+	Polling bool
+
+	paths chan string
+	stop  chan struct{}
+	done  sync.WaitGroup
+	close func() error
+}
+
+// Watch starts watching the .compass directory under basePath. It uses
+// inotify where available and otherwise rescans the tree every interval.
+func Watch(basePath string, interval time.Duration) (*Watcher, error) {
+	compassDir := filepath.Join(basePath, ".compass")
+	if _, err := os.Stat(compassDir); err != nil {
+		return nil, err
+	}
+
+	w := newWatcher()
+	if closer, err := startNotify(compassDir, w.paths, w.stop); err == nil {
+		w.close = closer
+	} else {
+		w.Polling = true
+		w.close = startPolling(compassDir, interval, w.paths, w.stop)
+	}
+	return w, nil
+}
+
+// watchPolling is Watch without inotify
+func watchPolling(basePath string, interval time.Duration) *Watcher {
+	w := newWatcher()
+	w.Polling = true
+	w.close = startPolling(filepath.Join(basePath, ".compass"), interval, w.paths, w.stop)
+	return w
+}
+
+func newWatcher() *Watcher {
+	changes := make(chan []Change, 16)
+	w := &Watcher{
+		Changes: changes,
+		paths:   make(chan string, 256),
+		stop:    make(chan struct{}),
+	}
+	w.done.Add(1)
+	go w.coalesce(changes)
+	return w
+}
+
+// Close stops the watcher and closes Changes
+func (w *Watcher) Close() error {
+	close(w.stop)
+	err := w.close()
+	w.done.Wait()
+	return err
+}
+
+// coalesce collects the relative paths reported by the backend until they
+// settle and sends the distinct changes they amount to. An empty path means
+// the backend lost track of what changed.
+func (w *Watcher) coalesce(out chan<- []Change) {
+	defer w.done.Done()
+	defer close(out)
+
+	pending := map[Change]bool{}
+	timer := time.NewTimer(watchSettle)
+	timer.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case rel := <-w.paths:
+			change, ok := Change{Kind: ChangeAll}, rel == ""
+			if !ok {
+				change, ok = classifyChange(rel)
+			}
+			if ok {
+				pending[change] = true
+				timer.Reset(watchSettle)
+			}
+		case <-timer.C:
+			batch := make([]Change, 0, len(pending))
+			for change := range pending {
+				batch = append(batch, change)
+			}
+			pending = map[Change]bool{}
+			sort.Slice(batch, func(i, j int) bool {
+				if batch[i].Kind != batch[j].Kind {
+					return batch[i].Kind < batch[j].Kind
+				}
+				return batch[i].ProjectID < batch[j].ProjectID
+			})
+			select {
+			case out <- batch:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// startPolling rescans compassDir every interval and reports files that
+// appeared, disappeared or changed size or modification time
+func startPolling(compassDir string, interval time.Duration, paths chan<- string, stop <-chan struct{}) func() error {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		previous := scanWatchTree(compassDir)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			current := scanWatchTree(compassDir)
+			for rel, file := range current {
+				if old, ok := previous[rel]; !ok || old != file {
+					if !sendPath(paths, rel, stop) {
+						return
+					}
+				}
+			}
+			for rel := range previous {
+				if _, ok := current[rel]; !ok {
+					if !sendPath(paths, rel, stop) {
+						return
+					}
+				}
+			}
+			previous = current
+		}
+	}()
+	return func() error {
+		<-done
+		return nil
+	}
+}
+
+func scanWatchTree(compassDir string) map[string]watchedFile {
+	files := map[string]watchedFile{}
+	filepath.WalkDir(compassDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(compassDir, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if entry.IsDir() {
+			if skipWatchDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			files[filepath.ToSlash(rel)] = watchedFile{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return files
+}
+
+func sendPath(paths chan<- string, rel string, stop <-chan struct{}) bool {
+	select {
+	case paths <- rel:
+		return true
+	case <-stop:
+		return false
+	}
+}
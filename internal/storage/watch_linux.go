@@ -0,0 +1,137 @@
+//go:build linux
+
+package storage
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotifyWatch follows every directory under .compass that can hold
+// reported files. inotify is not recursive, so directories created later
+// are added as their creation is seen.
+type inotifyWatch struct {
+	fd         int
+	file       *os.File
+	compassDir string
+	dirs       map[int32]string
+}
+
+// startNotify reports changes under compassDir from inotify events. The
+// descriptor is non-blocking so that closing the file wakes the reader.
+func startNotify(compassDir string, paths chan<- string, stop <-chan struct{}) (func() error, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	iw := &inotifyWatch{
+		fd:         fd,
+		file:       os.NewFile(uintptr(fd), "inotify"),
+		compassDir: compassDir,
+		dirs:       map[int32]string{},
+	}
+	if _, err := iw.addTree(""); err != nil {
+		iw.file.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		iw.run(paths, stop)
+	}()
+	return func() error {
+		err := iw.file.Close()
+		<-done
+		return err
+	}, nil
+}
+
+// addTree watches rel and the directories below it and returns the files
+// already in them, which were written before the watch existed
+func (iw *inotifyWatch) addTree(rel string) ([]string, error) {
+	var files []string
+	root := filepath.Join(iw.compassDir, filepath.FromSlash(rel))
+	err := filepath.WalkDir(root, func(current string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if current == root {
+				return err
+			}
+			return nil
+		}
+		sub, err := filepath.Rel(iw.compassDir, current)
+		if err != nil {
+			return err
+		}
+		sub = filepath.ToSlash(sub)
+		if !entry.IsDir() {
+			files = append(files, sub)
+			return nil
+		}
+		if sub == "." {
+			sub = ""
+		} else if skipWatchDir(sub) {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(iw.fd, current, inotifyMask)
+		if err != nil {
+			if current == root {
+				return err
+			}
+			return nil
+		}
+		iw.dirs[int32(wd)] = sub
+		return nil
+	})
+	return files, err
+}
+
+func (iw *inotifyWatch) run(paths chan<- string, stop <-chan struct{}) {
+	buffer := make([]byte, 64*1024)
+	for {
+		n, err := iw.file.Read(buffer)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+			name := strings.TrimRight(string(buffer[start:offset]), "\x00")
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				if !sendPath(paths, "", stop) {
+					return
+				}
+				continue
+			}
+			dir, ok := iw.dirs[event.Wd]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(iw.dirs, event.Wd)
+				continue
+			}
+			if !ok || name == "" {
+				continue
+			}
+
+			rel := path.Join(dir, name)
+			reported := []string{rel}
+			if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && !skipWatchDir(rel) {
+				files, _ := iw.addTree(rel)
+				reported = append(reported, files...)
+			}
+			for _, rel := range reported {
+				if !sendPath(paths, rel, stop) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package storage
+
+import "errors"
+
+// Change notifications are only implemented with inotify; elsewhere Watch
+// falls back to polling
+func startNotify(compassDir string, paths chan<- string, stop <-chan struct{}) (func() error, error) {
+	return nil, errors.New("file change notifications are not supported on this platform")
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+func TestClassifyChange(t *testing.T) {
+	cases := map[string]*Change{
+		"config.json":                          {Kind: ChangeConfig},
+		"compass.db-wal":                       {Kind: ChangeAll},
+		"projects/p1/project.json":             {Kind: ChangeProject, ProjectID: "p1"},
+		"projects/p1/tasks.json":               {Kind: ChangeTasks, ProjectID: "p1"},
+		"projects/p1/tasks.journal.jsonl":      {Kind: ChangeTasks, ProjectID: "p1"},
+		"projects/p1/tasks/t1.json":            {Kind: ChangeTasks, ProjectID: "p1"},
+		"projects/p1/planning/sessions.json":   {Kind: ChangePlanning, ProjectID: "p1"},
+		"projects/p1/decisions/d1.json":        {Kind: ChangeKnowledge, ProjectID: "p1"},
+		"projects/p1/process_groups.json":      {Kind: ChangeProcesses, ProjectID: "p1"},
+		"projects/p1/tasks.json.tmp":           nil,
+		"projects/p1/logs/proc.jsonl":          nil,
+		"projects/p1/history/tasks.jsonl":      nil,
+		"backups/20240101T000000Z/config.json": nil,
+		".lock":                                nil,
+		"projects/p1":                          nil,
+	}
+	for rel, want := range cases {
+		change, ok := classifyChange(rel)
+		if want == nil {
+			assert.False(t, ok, rel)
+			continue
+		}
+		assert.True(t, ok, rel)
+		assert.Equal(t, *want, change, rel)
+	}
+}
+
+func nextChanges(t *testing.T, w *Watcher) []Change {
+	t.Helper()
+	select {
+	case changes := <-w.Changes:
+		return changes
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+		return nil
+	}
+}
+
+func TestWatch(t *testing.T) {
+	backends := map[string]func(dir string) (*Watcher, error){
+		"default": func(dir string) (*Watcher, error) { return Watch(dir, 20*time.Millisecond) },
+		"polling": func(dir string) (*Watcher, error) { return watchPolling(dir, 20*time.Millisecond), nil },
+	}
+	for name, start := range backends {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			fs, err := NewFileStorage(dir)
+			require.NoError(t, err)
+			defer fs.Close()
+			project := domain.NewProject("Watched", "", "")
+			require.NoError(t, fs.CreateProject(project))
+
+			w, err := start(dir)
+			require.NoError(t, err)
+			assert.Equal(t, name == "polling" || runtime.GOOS != "linux", w.Polling)
+			// Let the poller take its first scan before anything changes
+			time.Sleep(50 * time.Millisecond)
+
+			require.NoError(t, fs.CreateTask(domain.NewTask(project.ID, "Seen", "")))
+			require.NoError(t, fs.Close())
+			assert.Equal(t, []Change{{Kind: ChangeTasks, ProjectID: project.ID}}, nextChanges(t, w))
+
+			// Projects created after the watch started are followed too
+			other := domain.NewProject("Later", "", "")
+			require.NoError(t, fs.CreateProject(other))
+			assert.Contains(t, nextChanges(t, w), Change{Kind: ChangeProject, ProjectID: other.ID})
+			require.NoError(t, fs.CreateTask(domain.NewTask(other.ID, "Also seen", "")))
+			require.NoError(t, fs.Close())
+			assert.Contains(t, nextChanges(t, w), Change{Kind: ChangeTasks, ProjectID: other.ID})
+
+			// Files nothing caches are not reported
+			require.NoError(t, os.WriteFile(filepath.Join(dir, ".compass", "scratch.tmp"), []byte("x"), 0644))
+			select {
+			case changes := <-w.Changes:
+				t.Fatalf("unexpected changes %v", changes)
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			require.NoError(t, w.Close())
+			_, open := <-w.Changes
+			assert.False(t, open)
+		})
+	}
+}
@@ -0,0 +1,317 @@
+// Package todomd reads and writes the checklist format Compass syncs with a
+// TODO.md file:
+//
+//	## Next
+//	- [ ] Write the docs !high #docs @alice due:2025-03-01 <!-- compass:<task-id> -->
+//	  - [x] Outline <!-- compass:<task-id> -->
+//
+// The box holds the status: " " planned, "x" completed, ">" in progress,
+// "!" blocked, "~" on hold and "-" canceled. Priority, labels, assignee and
+// due date are inline markers; an item indented under another is its child.
+// Lines that are not checklist items are kept as they are.
+package todomd
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+// Fields are the parts of a task a TODO.md line carries
+type Fields struct {
+	Title    string            `json:"title"`
+	Status   domain.TaskStatus `json:"status"`
+	Priority domain.Priority   `json:"priority"`
+	Labels   []string          `json:"labels,omitempty"`
+	// Due is a date in YYYY-MM-DD form
+	Due      string `json:"due,omitempty"`
+	Assignee string `json:"assignee,omitempty"`
+	// Parent is the task ID of the enclosing item
+	Parent string `json:"parent,omitempty"`
+}
+
+// FieldsOf returns the fields of a task as a TODO.md line shows them
+func FieldsOf(task *domain.Task) Fields {
+	fields := Fields{
+		Title:    task.Card.Title,
+		Status:   task.Card.Status,
+		Priority: task.Card.Priority,
+		Labels:   append([]string(nil), task.Card.Labels...),
+	}
+	if fields.Priority == "" {
+		fields.Priority = domain.PriorityMedium
+	}
+	if task.Card.DueDate != nil {
+		fields.Due = task.Card.DueDate.Format("2006-01-02")
+	}
+	if task.Card.AssignedTo != nil {
+		fields.Assignee = *task.Card.AssignedTo
+	}
+	if task.Card.Parent != nil {
+		fields.Parent = *task.Card.Parent
+	}
+	return fields
+}
+
+// Diff returns the names of the fields that differ, comparing labels as sets
+func (f Fields) Diff(other Fields) []string {
+	var diff []string
+	if f.Title != other.Title {
+		diff = append(diff, "title")
+	}
+	if f.Status != other.Status {
+		diff = append(diff, "status")
+	}
+	if f.Priority != other.Priority {
+		diff = append(diff, "priority")
+	}
+	if !sameSet(f.Labels, other.Labels) {
+		diff = append(diff, "labels")
+	}
+	if f.Due != other.Due {
+		diff = append(diff, "due")
+	}
+	if f.Assignee != other.Assignee {
+		diff = append(diff, "assignee")
+	}
+	if f.Parent != other.Parent {
+		diff = append(diff, "parent")
+	}
+	return diff
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// State is what the last sync left on both sides: the fields of every
+// synced task, keyed by task ID. A sync compares the file and Compass
+// against it to tell which side changed.
+type State struct {
+	ProjectID string            `json:"projectId"`
+	SyncedAt  time.Time         `json:"syncedAt"`
+	Items     map[string]Fields `json:"items"`
+}
+
+// Item is one checklist line
+type Item struct {
+	Fields
+	TaskID string
+	// Line is the item's index in Document.Lines
+	Line   int
+	Indent int
+	// Enclosing is the item this one is nested under, if any
+	Enclosing *Item
+}
+
+// Document is a parsed TODO.md file
+type Document struct {
+	Lines []string
+	Items []*Item
+}
+
+var (
+	itemPattern     = regexp.MustCompile(`^(\s*)[-*+] \[([ xX>!~-])\] ?(.*)$`)
+	idPattern       = regexp.MustCompile(`\s*<!--\s*compass:([A-Za-z0-9-]+)\s*-->\s*$`)
+	labelPattern    = regexp.MustCompile(`^#([A-Za-z][\w./:-]*)$`)
+	priorityPattern = regexp.MustCompile(`^!(critical|high|medium|low)$`)
+	duePattern      = regexp.MustCompile(`^due:(\d{4}-\d{2}-\d{2})$`)
+	assigneePattern = regexp.MustCompile(`^@([\w.-]+)$`)
+)
+
+var statusMarks = map[string]domain.TaskStatus{
+	" ": domain.StatusPlanned,
+	"x": domain.StatusCompleted,
+	"X": domain.StatusCompleted,
+	">": domain.StatusInProgress,
+	"!": domain.StatusBlocked,
+	"~": domain.StatusOnHold,
+	"-": domain.StatusCanceled,
+}
+
+var markOfStatus = map[domain.TaskStatus]string{
+	domain.StatusPlanned:    " ",
+	domain.StatusCompleted:  "x",
+	domain.StatusInProgress: ">",
+	domain.StatusBlocked:    "!",
+	domain.StatusOnHold:     "~",
+	domain.StatusCanceled:   "-",
+}
+
+// Parse reads a TODO.md file. It never fails: lines it does not understand
+// are kept as text.
+func Parse(data string) *Document {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	doc := &Document{}
+	if data != "" {
+		doc.Lines = strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	}
+
+	var open []*Item
+	for i, line := range doc.Lines {
+		match := itemPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		item := &Item{Line: i, Indent: len(strings.ReplaceAll(match[1], "\t", "    "))}
+		text := match[3]
+		if id := idPattern.FindStringSubmatch(text); id != nil {
+			item.TaskID = id[1]
+			text = text[:len(text)-len(id[0])]
+		}
+		item.Fields = parseText(text)
+		item.Status = statusMarks[match[2]]
+
+		for len(open) > 0 && open[len(open)-1].Indent >= item.Indent {
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 {
+			item.Enclosing = open[len(open)-1]
+			item.Parent = item.Enclosing.TaskID
+		}
+		open = append(open, item)
+		doc.Items = append(doc.Items, item)
+	}
+	return doc
+}
+
+func parseText(text string) Fields {
+	fields := Fields{Priority: domain.PriorityMedium}
+	words := make([]string, 0)
+	for _, word := range strings.Fields(text) {
+		switch {
+		case labelPattern.MatchString(word):
+			fields.Labels = append(fields.Labels, labelPattern.FindStringSubmatch(word)[1])
+		case priorityPattern.MatchString(word):
+			fields.Priority = domain.Priority(priorityPattern.FindStringSubmatch(word)[1])
+		case duePattern.MatchString(word) && validDate(duePattern.FindStringSubmatch(word)[1]):
+			fields.Due = duePattern.FindStringSubmatch(word)[1]
+		case assigneePattern.MatchString(word):
+			fields.Assignee = assigneePattern.FindStringSubmatch(word)[1]
+		default:
+			words = append(words, word)
+		}
+	}
+	fields.Title = strings.Join(words, " ")
+	return fields
+}
+
+func validDate(value string) bool {
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
+// FormatLine renders one checklist line
+func FormatLine(indent int, taskID string, fields Fields) string {
+	mark, ok := markOfStatus[fields.Status]
+	if !ok {
+		mark = " "
+	}
+
+	parts := []string{strings.Repeat(" ", indent) + "- [" + mark + "]", fields.Title}
+	if fields.Priority != "" && fields.Priority != domain.PriorityMedium {
+		parts = append(parts, "!"+string(fields.Priority))
+	}
+	for _, label := range fields.Labels {
+		parts = append(parts, "#"+label)
+	}
+	if fields.Assignee != "" {
+		parts = append(parts, "@"+fields.Assignee)
+	}
+	if fields.Due != "" {
+		parts = append(parts, "due:"+fields.Due)
+	}
+	if taskID != "" {
+		parts = append(parts, "<!-- compass:"+taskID+" -->")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Set rewrites an item's line with new fields
+func (d *Document) Set(item *Item, fields Fields) {
+	item.Fields = fields
+	d.Lines[item.Line] = FormatLine(item.Indent, item.TaskID, fields)
+}
+
+// Remove deletes an item's line. Items nested under it stay where they are.
+func (d *Document) Remove(item *Item) {
+	d.Lines = append(d.Lines[:item.Line], d.Lines[item.Line+1:]...)
+	items := d.Items[:0]
+	for _, other := range d.Items {
+		if other == item {
+			continue
+		}
+		if other.Enclosing == item {
+			other.Enclosing = item.Enclosing
+		}
+		if other.Line > item.Line {
+			other.Line--
+		}
+		items = append(items, other)
+	}
+	d.Items = items
+}
+
+// Add inserts a line for a task: after the last item nested under parent,
+// or after the last item of the file when parent is nil
+func (d *Document) Add(parent *Item, taskID string, fields Fields) *Item {
+	item := &Item{Fields: fields, TaskID: taskID, Enclosing: parent}
+	if len(d.Lines) == 0 {
+		d.Lines = []string{"# TODO", ""}
+	}
+	item.Line = len(d.Lines)
+	if parent != nil {
+		item.Indent = parent.Indent + 2
+		item.Line = parent.Line + 1
+	} else if len(d.Items) > 0 {
+		item.Line = 0
+	}
+	for _, other := range d.Items {
+		if other.Line >= item.Line && (parent == nil || other.within(parent)) {
+			item.Line = other.Line + 1
+		}
+	}
+
+	d.Lines = append(d.Lines, "")
+	copy(d.Lines[item.Line+1:], d.Lines[item.Line:])
+	d.Lines[item.Line] = FormatLine(item.Indent, taskID, fields)
+	for _, other := range d.Items {
+		if other.Line >= item.Line {
+			other.Line++
+		}
+	}
+	d.Items = append(d.Items, item)
+	return item
+}
+
+func (i *Item) within(parent *Item) bool {
+	for up := i.Enclosing; up != nil; up = up.Enclosing {
+		if up == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// Render writes the document back, ending with a newline
+func (d *Document) Render() string {
+	if len(d.Lines) == 0 {
+		return ""
+	}
+	return strings.Join(d.Lines, "\n") + "\n"
+}
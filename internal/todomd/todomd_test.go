@@ -0,0 +1,115 @@
+package todomd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcliao/compass/internal/domain"
+)
+
+const sample = `# TODO
+
+Notes stay as they are.
+
+- [ ] Write the docs !high #docs #api @alice due:2025-03-01 <!-- compass:task-1 -->
+  - [x] Outline <!-- compass:task-2 -->
+  - [>] Examples for #42 due:2025-02-30
+- [!] Fix login !critical
+* [~] Later
+- [-] Dropped <!-- compass:task-3 -->
+- [ ]
+`
+
+func TestParse(t *testing.T) {
+	doc := Parse(sample)
+	require.Len(t, doc.Items, 7)
+
+	docs := doc.Items[0]
+	assert.Equal(t, "task-1", docs.TaskID)
+	assert.Equal(t, Fields{
+		Title:    "Write the docs",
+		Status:   domain.StatusPlanned,
+		Priority: domain.PriorityHigh,
+		Labels:   []string{"docs", "api"},
+		Due:      "2025-03-01",
+		Assignee: "alice",
+	}, docs.Fields)
+	assert.Equal(t, 4, docs.Line)
+
+	outline := doc.Items[1]
+	assert.Equal(t, domain.StatusCompleted, outline.Status)
+	assert.Equal(t, docs, outline.Enclosing)
+	assert.Equal(t, "task-1", outline.Parent)
+
+	// "#42" is not a label and an impossible date is not a due date
+	examples := doc.Items[2]
+	assert.Equal(t, "Examples for #42 due:2025-02-30", examples.Title)
+	assert.Equal(t, domain.StatusInProgress, examples.Status)
+	assert.Empty(t, examples.TaskID)
+	assert.Equal(t, docs, examples.Enclosing)
+
+	assert.Equal(t, domain.StatusBlocked, doc.Items[3].Status)
+	assert.Equal(t, domain.PriorityCritical, doc.Items[3].Priority)
+	assert.Nil(t, doc.Items[3].Enclosing)
+	assert.Equal(t, domain.StatusOnHold, doc.Items[4].Status)
+	assert.Equal(t, domain.StatusCanceled, doc.Items[5].Status)
+	assert.Empty(t, doc.Items[6].Title)
+
+	assert.Equal(t, sample, doc.Render(), "parsing alone changes nothing")
+}
+
+func TestFormatLineRoundTrips(t *testing.T) {
+	fields := Fields{
+		Title:    "Ship it",
+		Status:   domain.StatusBlocked,
+		Priority: domain.PriorityLow,
+		Labels:   []string{"release"},
+		Due:      "2025-04-01",
+		Assignee: "bob",
+	}
+	line := FormatLine(2, "task-9", fields)
+	assert.Equal(t, "  - [!] Ship it !low #release @bob due:2025-04-01 <!-- compass:task-9 -->", line)
+
+	doc := Parse(line)
+	require.Len(t, doc.Items, 1)
+	assert.Equal(t, "task-9", doc.Items[0].TaskID)
+	assert.Equal(t, fields, doc.Items[0].Fields)
+	assert.Empty(t, fields.Diff(doc.Items[0].Fields))
+}
+
+func TestDocumentEdits(t *testing.T) {
+	doc := Parse(sample)
+	docs, outline, fix := doc.Items[0], doc.Items[1], doc.Items[3]
+
+	child := doc.Add(docs, "task-4", Fields{Title: "Review", Status: domain.StatusPlanned, Priority: domain.PriorityMedium})
+	assert.Equal(t, 7, child.Line, "after the last nested item")
+	assert.Equal(t, 2, child.Indent)
+	assert.Equal(t, 8, fix.Line)
+
+	top := doc.Add(nil, "task-5", Fields{Title: "Release", Status: domain.StatusPlanned, Priority: domain.PriorityMedium})
+	assert.Equal(t, 12, top.Line, "after the last item")
+
+	doc.Remove(outline)
+	assert.Equal(t, 6, child.Line)
+	doc.Set(fix, Fields{Title: "Fix login", Status: domain.StatusCompleted, Priority: domain.PriorityCritical})
+
+	assert.Equal(t, `# TODO
+
+Notes stay as they are.
+
+- [ ] Write the docs !high #docs #api @alice due:2025-03-01 <!-- compass:task-1 -->
+  - [>] Examples for #42 due:2025-02-30
+  - [ ] Review <!-- compass:task-4 -->
+- [x] Fix login !critical
+* [~] Later
+- [-] Dropped <!-- compass:task-3 -->
+- [ ]
+- [ ] Release <!-- compass:task-5 -->
+`, doc.Render())
+
+	empty := Parse("")
+	empty.Add(nil, "task-6", Fields{Title: "First", Status: domain.StatusPlanned, Priority: domain.PriorityMedium})
+	assert.Equal(t, "# TODO\n\n- [ ] First <!-- compass:task-6 -->\n", empty.Render())
+}